@@ -1,37 +1,53 @@
 package adguardapi
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
+	"time"
 
+	"github.com/welasco/adguardfilter/common/config"
+	"github.com/welasco/adguardfilter/common/events"
 	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/tracing"
 	"github.com/welasco/adguardfilter/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // GetBlockedServices retrieves the blocked services configuration from the API
-func GetBlockedServices() (model.ServiceConfig, error) {
+func (c *Client) GetBlockedServices() (model.ServiceConfig, error) {
+	return c.GetBlockedServicesContext(context.Background())
+}
+
+// GetBlockedServicesContext retrieves the blocked services configuration, tracing the call as part of ctx
+func (c *Client) GetBlockedServicesContext(ctx context.Context) (model.ServiceConfig, error) {
+	ctx, span := tracing.Start(ctx, "adguardapi.GetBlockedServices", attribute.String("adguardfilter.operation", "get"))
+	defer span.End()
+
+	// Older AdGuard versions only list the IDs, without a schedule
+	legacy := c.APIVersion() == APIVersionLegacy
+	endpoint := "blocked_services/get"
+	if legacy {
+		endpoint = "blocked_services/list"
+	}
+
 	// Create the GET request
-	apiURL := authBaseURL + "/control/blocked_services/get"
-	req, err := http.NewRequest("GET", apiURL, nil)
+	req, err := c.newAdGuardRequest("GET", endpoint, nil)
 	if err != nil {
 		logger.Error("[adguardapi][GetBlockedServices] Failed to create GET request")
 		logger.Error(err)
 		return model.ServiceConfig{}, err
 	}
 
-	// Set required headers
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
 	// Perform the authenticated request (will auto re-authenticate if needed)
-	resp, err := DoAuthenticatedRequest(req)
+	resp, err := c.DoAuthenticatedRequestContext(ctx, req)
 	if err != nil {
-		logger.Error("[adguardapi][GetBlockedServices] Failed to get blocked services from: " + apiURL)
+		logger.Error("[adguardapi][GetBlockedServices] Failed to get blocked services from: " + req.URL.String())
 		logger.Error(err)
 		return model.ServiceConfig{}, err
 	}
@@ -55,13 +71,18 @@ func GetBlockedServices() (model.ServiceConfig, error) {
 
 	// Unmarshal JSON into ServiceConfig model
 	var serviceConfig model.ServiceConfig
-	err = json.Unmarshal(body, &serviceConfig)
+	if legacy {
+		err = json.Unmarshal(body, &serviceConfig.IDs)
+	} else {
+		err = json.Unmarshal(body, &serviceConfig)
+	}
 	if err != nil {
 		logger.Error("[adguardapi][GetBlockedServices] Failed to unmarshal JSON response")
 		logger.Error(err)
 		return model.ServiceConfig{}, err
 	}
 
+	span.SetAttributes(attribute.Int("adguardfilter.service_count", len(serviceConfig.IDs)))
 	logger.Info("[adguardapi][GetBlockedServices] Successfully retrieved blocked services configuration")
 	logger.Debug("[adguardapi][GetBlockedServices] Number of blocked service IDs: ", len(serviceConfig.IDs))
 	logger.Debug("[adguardapi][GetBlockedServices] Timezone: " + serviceConfig.Schedule.TimeZone)
@@ -69,179 +90,412 @@ func GetBlockedServices() (model.ServiceConfig, error) {
 	return serviceConfig, nil
 }
 
-// GetAllBlockedServices retrieves all available blocked services from the API
-func GetAllBlockedServices() ([]model.BlockedService, error) {
-	apiURL := authBaseURL + "/control/blocked_services/all"
-	req, err := http.NewRequest("GET", apiURL, nil)
+// fetchAllBlockedServices retrieves all available blocked services from the API, bypassing the catalog cache
+func (c *Client) fetchAllBlockedServices() ([]model.BlockedService, error) {
+	req, err := c.newAdGuardRequest("GET", "blocked_services/all", nil)
 	if err != nil {
-		logger.Error("[adguardapi][GetAllBlockedServices] Failed to create GET request")
+		logger.Error("[adguardapi][fetchAllBlockedServices] Failed to create GET request")
 		logger.Error(err)
 		return nil, err
 	}
 
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
-	resp, err := DoAuthenticatedRequest(req)
+	resp, err := c.DoAuthenticatedRequest(req)
 	if err != nil {
-		logger.Error("[adguardapi][GetAllBlockedServices] Failed to get all blocked services from: " + apiURL)
+		logger.Error("[adguardapi][fetchAllBlockedServices] Failed to get all blocked services from: " + req.URL.String())
 		logger.Error(err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		logger.Error("[adguardapi][GetAllBlockedServices] Request failed with status: " + resp.Status)
+		logger.Error("[adguardapi][fetchAllBlockedServices] Request failed with status: " + resp.Status)
 		return nil, errors.New("request failed with status: " + resp.Status)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("[adguardapi][GetAllBlockedServices] Failed to read response body")
+		logger.Error("[adguardapi][fetchAllBlockedServices] Failed to read response body")
 		logger.Error(err)
 		return nil, err
 	}
 
-	logger.Debug("[adguardapi][GetAllBlockedServices] Response body: " + string(body))
+	logger.Debug("[adguardapi][fetchAllBlockedServices] Response body: " + string(body))
 
 	var allServicesResp model.AllBlockedServicesResponse
 	err = json.Unmarshal(body, &allServicesResp)
 	if err != nil {
-		logger.Error("[adguardapi][GetAllBlockedServices] Failed to unmarshal JSON response")
+		logger.Error("[adguardapi][fetchAllBlockedServices] Failed to unmarshal JSON response")
 		logger.Error(err)
 		return nil, err
 	}
 
-	logger.Info("[adguardapi][GetAllBlockedServices] Successfully retrieved all blocked services")
-	logger.Debug("[adguardapi][GetAllBlockedServices] Number of services: ", len(allServicesResp.BlockedServices))
+	logger.Info("[adguardapi][fetchAllBlockedServices] Successfully retrieved all blocked services")
+	logger.Debug("[adguardapi][fetchAllBlockedServices] Number of services: ", len(allServicesResp.BlockedServices))
 
 	return allServicesResp.BlockedServices, nil
 }
 
 // UpdateBlockedServices updates the blocked services configuration via the API
-func UpdateBlockedServices(serviceConfig *model.ServiceConfig) error {
+func (c *Client) UpdateBlockedServices(serviceConfig *model.ServiceConfig) error {
+	return c.UpdateBlockedServicesContext(context.Background(), serviceConfig)
+}
 
-	// Marshal the ServiceConfig to JSON
-	jsonData, err := json.Marshal(serviceConfig)
+// UpdateBlockedServicesContext updates the blocked services configuration, tracing the call as part of ctx.
+// The AdGuard requests are cancelled when ctx is.
+func (c *Client) UpdateBlockedServicesContext(ctx context.Context, serviceConfig *model.ServiceConfig) error {
+	ctx, span := tracing.Start(ctx, "adguardapi.UpdateBlockedServices",
+		attribute.String("adguardfilter.operation", "update"),
+		attribute.Int("adguardfilter.service_count", len(serviceConfig.IDs)),
+	)
+	defer span.End()
+
+	logger.Info("[adguardapi][UpdateBlockedServices] Updating blocked services configuration")
+	logger.Debug("[adguardapi][UpdateBlockedServices] Service count: ", len(serviceConfig.IDs))
+
+	c.configMu.Lock()
+	c.snapshotCurrent(ctx, SnapshotReasonUpdate)
+	err := c.sendServiceConfig(ctx, serviceConfig)
+	c.configMu.Unlock()
 	if err != nil {
-		logger.Error("[adguardapi][UpdateBlockedServices] Failed to marshal ServiceConfig to JSON")
-		logger.Error(err)
+		logger.Error("[adguardapi][UpdateBlockedServices] Failed to update blocked services configuration")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	logger.Debug("[adguardapi][UpdateBlockedServices] Request body: " + string(jsonData))
 
-	// Create the PUT request
-	apiURL := authBaseURL + "/control/blocked_services/update"
-	req, err := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonData))
+	logger.Info("[adguardapi][UpdateBlockedServices] Successfully updated blocked services configuration")
+	events.Publish(events.ConfigUpdated, map[string]interface{}{
+		"service_count": len(serviceConfig.IDs),
+		"time_zone":     serviceConfig.Schedule.TimeZone,
+	})
+	return nil
+}
+
+// ErrInvalidTimeZone is returned when a time zone is not a valid IANA name
+var ErrInvalidTimeZone = errors.New("invalid time zone")
+
+// UpdateTimeZone changes only the schedule time zone of the current configuration, leaving the service IDs
+// untouched, and returns the previous time zone
+func (c *Client) UpdateTimeZone(timeZone string) (string, error) {
+	if _, err := time.LoadLocation(timeZone); err != nil || timeZone == "" {
+		logger.Error("[adguardapi][UpdateTimeZone] Invalid time zone: " + timeZone)
+		return "", fmt.Errorf("%w: %q", ErrInvalidTimeZone, timeZone)
+	}
+
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	currentConfig, err := c.getManagedConfig(context.Background())
 	if err != nil {
-		logger.Error("[adguardapi][UpdateBlockedServices] Failed to create PUT request")
-		logger.Error(err)
-		return err
+		logger.Error("[adguardapi][UpdateTimeZone] Failed to get current blocked services")
+		return "", err
 	}
+	c.addSnapshot(currentConfig, SnapshotReasonTimeZone)
 
-	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
+	oldTimeZone := currentConfig.Schedule.TimeZone
+	currentConfig.Schedule.TimeZone = timeZone
 
-	// Perform the authenticated request (will auto re-authenticate if needed)
-	resp, err := DoAuthenticatedRequest(req)
+	logger.Info("[adguardapi][UpdateTimeZone] Changing time zone from '" + oldTimeZone + "' to '" + timeZone + "'")
+
+	err = c.sendServiceConfig(context.Background(), &currentConfig)
 	if err != nil {
-		logger.Error("[adguardapi][UpdateBlockedServices] Failed to update blocked services to: " + apiURL)
-		logger.Error(err)
+		logger.Error("[adguardapi][UpdateTimeZone] Failed to update time zone")
+		return "", err
+	}
+
+	logger.Info("[adguardapi][UpdateTimeZone] Successfully updated time zone")
+	events.Publish(events.ConfigUpdated, map[string]interface{}{
+		"service_count": len(currentConfig.IDs),
+		"time_zone":     timeZone,
+	})
+	return oldTimeZone, nil
+}
+
+// ResetBlockedServices resets all blocked services to the default list
+func (c *Client) ResetBlockedServices() error {
+	return c.ResetBlockedServicesContext(context.Background())
+}
+
+// ResetBlockedServicesContext resets all blocked services to the default list, tracing the call as part of
+// ctx. The AdGuard requests are cancelled when ctx is, e.g. when the shutdown budget runs out.
+func (c *Client) ResetBlockedServicesContext(ctx context.Context) error {
+	defaultConfig := BuildDefaultConfig()
+	ctx, span := tracing.Start(ctx, "adguardapi.ResetBlockedServices",
+		attribute.String("adguardfilter.operation", "reset"),
+		attribute.Int("adguardfilter.service_count", len(defaultConfig.IDs)),
+	)
+	defer span.End()
+
+	logger.Info("[adguardapi][ResetBlockedServices] Resetting blocked services to default configuration")
+	logger.Debug("[adguardapi][ResetBlockedServices] Default service count: ", len(defaultConfig.IDs))
+
+	c.configMu.Lock()
+	c.snapshotCurrent(ctx, SnapshotReasonReset)
+	err := c.sendServiceConfig(ctx, &defaultConfig)
+	c.configMu.Unlock()
+	if err != nil {
+		logger.Error("[adguardapi][ResetBlockedServices] Failed to reset blocked services")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
-	defer resp.Body.Close()
 
-	// Check response status
-	if resp.StatusCode != 200 {
-		// Read error response body for better debugging
-		body, _ := io.ReadAll(resp.Body)
-		logger.Error("[adguardapi][UpdateBlockedServices] Request failed with status: " + resp.Status)
-		logger.Error("[adguardapi][UpdateBlockedServices] Response body: " + string(body))
-		return errors.New("request failed with status: " + resp.Status)
+	logger.Info("[adguardapi][ResetBlockedServices] Successfully reset blocked services to default configuration")
+	events.Publish(events.ConfigReset, map[string]interface{}{
+		"service_count": len(defaultConfig.IDs),
+		"time_zone":     defaultConfig.Schedule.TimeZone,
+	})
+	return nil
+}
+
+// ResetServiceIDs blocks the given service IDs again by merging them back into the current configuration,
+// leaving every other service as it is. IDs that are not part of the default configuration are ignored.
+func (c *Client) ResetServiceIDs(ids []string) error {
+	defaultConfig := BuildDefaultConfig()
+
+	logger.Info("[adguardapi][ResetServiceIDs] Resetting ", len(ids), " service(s) to the default configuration")
+
+	// Only IDs blocked by default are restored
+	isDefault := make(map[string]bool, len(defaultConfig.IDs))
+	for _, id := range defaultConfig.IDs {
+		isDefault[id] = true
 	}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	currentConfig, err := c.getManagedConfig(context.Background())
 	if err != nil {
-		logger.Error("[adguardapi][UpdateBlockedServices] Failed to read response body")
-		logger.Error(err)
+		logger.Error("[adguardapi][ResetServiceIDs] Failed to get current blocked services")
 		return err
 	}
+	c.addSnapshot(currentConfig, SnapshotReasonReset)
 
-	logger.Debug("[adguardapi][UpdateBlockedServices] Response body: " + string(body))
-	logger.Info("[adguardapi][UpdateBlockedServices] Successfully updated blocked services configuration")
+	blocked := make(map[string]bool, len(currentConfig.IDs))
+	for _, id := range currentConfig.IDs {
+		blocked[id] = true
+	}
+	for _, id := range ids {
+		if isDefault[id] && !blocked[id] {
+			currentConfig.IDs = append(currentConfig.IDs, id)
+			blocked[id] = true
+		}
+	}
 
+	err = c.sendServiceConfig(context.Background(), &currentConfig)
+	if err != nil {
+		logger.Error("[adguardapi][ResetServiceIDs] Failed to reset service IDs")
+		return err
+	}
+
+	logger.Info("[adguardapi][ResetServiceIDs] Successfully reset service IDs")
+	events.Publish(events.ConfigReset, map[string]interface{}{
+		"service_count": len(currentConfig.IDs),
+		"time_zone":     currentConfig.Schedule.TimeZone,
+		"scope":         ids,
+	})
 	return nil
 }
 
-// ResetBlockedServices resets all blocked services to the default list
-func ResetBlockedServices() error {
-	// Default blocked service IDs
-	defaultIDs := []string{
-		"tinder", "plenty_of_fish", "onlyfans", "playstation", "nintendo", "tiktok",
-		"aliexpress", "500px", "activision_blizzard", "battle_net", "betway", "blaze",
-		"box", "crunchyroll", "directvgo", "disneyplus", "ebay", "espn", "flickr",
-		"iheartradio", "iqiyi", "kook", "line", "mercado_libre", "ok", "origin", "qq",
-		"riot_games", "signal", "tidal", "tumblr", "ubisoft", "vimeo", "wargaming",
-		"xiaohongshu", "zhihu", "yy", "weibo", "wechat", "voot", "viber", "twitch",
-		"wizz", "shein", "paramountplus", "pluto_tv", "mail_ru", "kakaotalk", "imgur",
-		"hulu", "globoplay", "dailymotion", "clubhouse", "canais_globo", "betano",
-		"bigo_live", "amino", "9gag", "betfair", "bilibili", "bluesky", "claro",
-		"coolapk", "deezer", "kik", "leagueoflegends", "lionsgateplus", "mastodon",
-		"rockstar_games", "temu", "telegram", "soundcloud", "samsung_tv_plus", "looke",
-		"hbomax", "discoveryplus", "gog", "nebula", "facebook", "privacy", "snapchat",
-		"youtube", "roblox", "spotify_video", "spotify",
-	}
-
-	// Override with env var if set (comma-separated list of service IDs)
+// PatchBlockedServices merges a change into the current configuration in a single read-modify-write:
+// the add IDs are blocked, then the remove IDs unblocked, then the time zone changed when not empty.
+// It returns the resulting configuration.
+func (c *Client) PatchBlockedServices(add, remove []string, timeZone string) (model.ServiceConfig, error) {
+	_, patchedConfig, err := c.patchBlockedServices(add, remove, timeZone)
+	return patchedConfig, err
+}
+
+// patchBlockedServices is PatchBlockedServices, also returning the IDs blocked before the change
+func (c *Client) patchBlockedServices(add, remove []string, timeZone string) ([]string, model.ServiceConfig, error) {
+	if timeZone != "" {
+		if _, err := time.LoadLocation(timeZone); err != nil {
+			logger.Error("[adguardapi][PatchBlockedServices] Invalid time zone: " + timeZone)
+			return nil, model.ServiceConfig{}, fmt.Errorf("%w: %q", ErrInvalidTimeZone, timeZone)
+		}
+	}
+
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	currentConfig, err := c.getManagedConfig(context.Background())
+	if err != nil {
+		logger.Error("[adguardapi][PatchBlockedServices] Failed to get current blocked services")
+		return nil, model.ServiceConfig{}, err
+	}
+	c.addSnapshot(currentConfig, SnapshotReasonPatch)
+	previousIDs := append([]string(nil), currentConfig.IDs...)
+
+	blocked := make(map[string]bool, len(currentConfig.IDs)+len(add))
+	for _, id := range currentConfig.IDs {
+		blocked[id] = true
+	}
+	for _, id := range add {
+		if !blocked[id] {
+			currentConfig.IDs = append(currentConfig.IDs, id)
+			blocked[id] = true
+		}
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		removed[id] = true
+	}
+	ids := make([]string, 0, len(currentConfig.IDs))
+	for _, id := range currentConfig.IDs {
+		if !removed[id] {
+			ids = append(ids, id)
+		}
+	}
+	currentConfig.IDs = ids
+
+	if timeZone != "" {
+		currentConfig.Schedule.TimeZone = timeZone
+	}
+
+	logger.Info("[adguardapi][PatchBlockedServices] Adding ", len(add), " and removing ", len(remove), " service(s)")
+
+	err = c.sendServiceConfig(context.Background(), &currentConfig)
+	if err != nil {
+		logger.Error("[adguardapi][PatchBlockedServices] Failed to update blocked services")
+		return nil, model.ServiceConfig{}, err
+	}
+
+	logger.Info("[adguardapi][PatchBlockedServices] Successfully patched blocked services configuration")
+	events.Publish(events.ConfigUpdated, map[string]interface{}{
+		"service_count": len(currentConfig.IDs),
+		"time_zone":     currentConfig.Schedule.TimeZone,
+	})
+	return previousIDs, currentConfig, nil
+}
+
+// Names of the layers of the default list, lowest first
+const (
+	DefaultLayerBuiltin = "builtin"
+	DefaultLayerFile    = "file"
+	DefaultLayerEnv     = "env"
+)
+
+// builtinDefaultIDs are the services blocked by default when neither the defaultsFile nor defaultBlockedServices
+// set the list
+var builtinDefaultIDs = []string{
+	"tinder", "plenty_of_fish", "onlyfans", "playstation", "nintendo", "tiktok",
+	"aliexpress", "500px", "activision_blizzard", "battle_net", "betway", "blaze",
+	"box", "crunchyroll", "directvgo", "disneyplus", "ebay", "espn", "flickr",
+	"iheartradio", "iqiyi", "kook", "line", "mercado_libre", "ok", "origin", "qq",
+	"riot_games", "signal", "tidal", "tumblr", "ubisoft", "vimeo", "wargaming",
+	"xiaohongshu", "zhihu", "yy", "weibo", "wechat", "voot", "viber", "twitch",
+	"wizz", "shein", "paramountplus", "pluto_tv", "mail_ru", "kakaotalk", "imgur",
+	"hulu", "globoplay", "dailymotion", "clubhouse", "canais_globo", "betano",
+	"bigo_live", "amino", "9gag", "betfair", "bilibili", "bluesky", "claro",
+	"coolapk", "deezer", "kik", "leagueoflegends", "lionsgateplus", "mastodon",
+	"rockstar_games", "temu", "telegram", "soundcloud", "samsung_tv_plus", "looke",
+	"hbomax", "discoveryplus", "gog", "nebula", "facebook", "privacy", "snapchat",
+	"youtube", "roblox", "spotify_video", "spotify",
+}
+
+// DefaultLayers returns the layers the default list is resolved from, lowest first: the built-in list,
+// replaced by the ids of the defaultsFile, replaced by defaultBlockedServices (comma-separated), each
+// present only when set
+func DefaultLayers() []config.ListLayer {
+	layers := []config.ListLayer{{Name: DefaultLayerBuiltin, Replace: builtinDefaultIDs}}
+	if fileConfig := loadDefaultsFile(); fileConfig != nil && fileConfig.IDs != nil {
+		layers = append(layers, config.ListLayer{Name: DefaultLayerFile, Replace: fileConfig.IDs})
+	}
 	if envIDs := os.Getenv("defaultBlockedServices"); envIDs != "" {
-		logger.Info("[adguardapi][ResetBlockedServices] Loading default blocked services from environment variable")
-		defaultIDs = strings.Split(envIDs, ",")
-		for i := range defaultIDs {
-			defaultIDs[i] = strings.TrimSpace(defaultIDs[i])
+		logger.Debug("[adguardapi][DefaultLayers] Loading default blocked services from environment variable")
+		ids := strings.Split(envIDs, ",")
+		for i := range ids {
+			ids[i] = strings.TrimSpace(ids[i])
 		}
+		layers = append(layers, config.ListLayer{Name: DefaultLayerEnv, Replace: ids})
+	}
+	return layers
+}
+
+// BuildDefaultConfig builds the default configuration applied by ResetBlockedServices
+func BuildDefaultConfig() model.ServiceConfig {
+	defaultIDs := config.ResolveList(DefaultLayers()).IDs
+	fileConfig := loadDefaultsFile()
+
+	// The weekly windows of the defaults file are restored on reset too, e.g. games allowed on weekends
+	schedule := model.Schedule{}
+	if fileConfig != nil {
+		schedule = fileConfig.Schedule
 	}
+	schedule.TimeZone = DefaultTimeZone()
 
-	defaultConfig := model.ServiceConfig{
-		Schedule: model.Schedule{
-			TimeZone: "America/Chicago",
-		},
-		IDs: defaultIDs,
+	return model.ServiceConfig{
+		Schedule: schedule,
+		IDs:      defaultIDs,
 	}
+}
 
-	logger.Info("[adguardapi][ResetBlockedServices] Resetting blocked services to default configuration")
-	logger.Debug("[adguardapi][ResetBlockedServices] Default service count: ", len(defaultConfig.IDs))
+// DefaultConfigSource reports where the default service IDs come from: "env" when overridden by
+// defaultBlockedServices, "file" when set by the defaultsFile, otherwise "builtin"
+func DefaultConfigSource() string {
+	layers := DefaultLayers()
+	return layers[len(layers)-1].Name
+}
 
-	// Marshal the ServiceConfig to JSON
-	jsonData, err := json.Marshal(defaultConfig)
+// DefaultTimeZone returns the configured defaultTimeZone, then the defaultsFile time zone, falling back
+// to America/Chicago
+func DefaultTimeZone() string {
+	if timeZone := os.Getenv("defaultTimeZone"); timeZone != "" {
+		return timeZone
+	}
+	if fileConfig := loadDefaultsFile(); fileConfig != nil && fileConfig.Schedule.TimeZone != "" {
+		return fileConfig.Schedule.TimeZone
+	}
+	return "America/Chicago"
+}
+
+// sendServiceConfig PUTs the given configuration without the disabled services to the AdGuard update endpoint.
+// The caller must hold c.configMu.
+func (c *Client) sendServiceConfig(ctx context.Context, serviceConfig *model.ServiceConfig) error {
+	// Disabled services stay in the managed configuration but are never sent
+	enforced := c.enforcedConfig(serviceConfig)
+
+	// Marshal the ServiceConfig to JSON, older AdGuard versions take a flat array of IDs and reject a schedule
+	method, endpoint := "PUT", "blocked_services/update"
+	var jsonData []byte
+	var err error
+	if c.APIVersion() == APIVersionLegacy {
+		method, endpoint = "POST", "blocked_services/set"
+		if enforced.IDs == nil {
+			enforced.IDs = []string{}
+		}
+		for _, window := range enforced.Schedule.Days() {
+			if window != nil {
+				logger.Warning("[adguardapi][sendServiceConfig] This AdGuard version doesn't support schedules, sending the IDs only")
+				break
+			}
+		}
+		// Record what AdGuard actually keeps, so drift detection doesn't flag the missing schedule
+		enforced.Schedule = model.Schedule{}
+		jsonData, err = json.Marshal(enforced.IDs)
+	} else {
+		jsonData, err = json.Marshal(&enforced)
+	}
 	if err != nil {
-		logger.Error("[adguardapi][ResetBlockedServices] Failed to marshal default ServiceConfig to JSON")
+		logger.Error("[adguardapi][sendServiceConfig] Failed to marshal ServiceConfig to JSON")
 		logger.Error(err)
 		return err
 	}
+	logger.Debug("[adguardapi][sendServiceConfig] Request body: " + string(jsonData))
 
-	logger.Debug("[adguardapi][ResetBlockedServices] Request body: " + string(jsonData))
-
-	// Create the PUT request
-	apiURL := authBaseURL + "/control/blocked_services/update"
-	req, err := http.NewRequest("PUT", apiURL, bytes.NewBuffer(jsonData))
+	// Create the update request
+	req, err := c.newAdGuardRequestContext(ctx, method, endpoint, jsonData)
 	if err != nil {
-		logger.Error("[adguardapi][ResetBlockedServices] Failed to create PUT request")
+		logger.Error("[adguardapi][sendServiceConfig] Failed to create " + method + " request")
 		logger.Error(err)
 		return err
 	}
 
-	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
-	// Perform the authenticated request (will auto re-authenticate if needed)
-	resp, err := DoAuthenticatedRequest(req)
+	// Perform the authenticated request (will auto re-authenticate if needed).
+	// The update replaces the whole configuration, so it is safe to retry.
+	resp, err := c.DoAuthenticatedRequestWithRetry(req, true)
 	if err != nil {
-		logger.Error("[adguardapi][ResetBlockedServices] Failed to reset blocked services to: " + apiURL)
+		logger.Error("[adguardapi][sendServiceConfig] Failed to send blocked services to: " + req.URL.String())
 		logger.Error(err)
 		return err
 	}
@@ -251,21 +505,28 @@ func ResetBlockedServices() error {
 	if resp.StatusCode != 200 {
 		// Read error response body for better debugging
 		body, _ := io.ReadAll(resp.Body)
-		logger.Error("[adguardapi][ResetBlockedServices] Request failed with status: " + resp.Status)
-		logger.Error("[adguardapi][ResetBlockedServices] Response body: " + string(body))
+		logger.Error("[adguardapi][sendServiceConfig] Request failed with status: " + resp.Status)
+		logger.Error("[adguardapi][sendServiceConfig] Response body: " + string(body))
+		// AdGuard explains why it rejected the configuration in the body, e.g. an unknown service ID
+		if message := strings.TrimSpace(string(body)); message != "" {
+			return fmt.Errorf("request failed with status: %s: %s", resp.Status, message)
+		}
 		return errors.New("request failed with status: " + resp.Status)
 	}
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("[adguardapi][ResetBlockedServices] Failed to read response body")
+		logger.Error("[adguardapi][sendServiceConfig] Failed to read response body")
 		logger.Error(err)
 		return err
 	}
 
-	logger.Debug("[adguardapi][ResetBlockedServices] Response body: " + string(body))
-	logger.Info("[adguardapi][ResetBlockedServices] Successfully reset blocked services to default configuration")
+	logger.Debug("[adguardapi][sendServiceConfig] Response body: " + string(body))
+
+	// Remember what was applied so changes made outside of this service can be detected
+	c.setLastApplied(&enforced)
+	c.recordDisabledInConfig(serviceConfig)
 
 	return nil
 }
@@ -0,0 +1,68 @@
+package adguardapi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrUnknownServiceIDs is returned by ApplyAllowlist when an allowed ID is not in the service catalog
+var ErrUnknownServiceIDs = errors.New("unknown service IDs")
+
+// BuildAllowlistConfig builds the configuration that blocks every service of the catalog except the allowed
+// ones, in the default time zone. It also returns the allowed IDs that are not in the catalog.
+func (c *Client) BuildAllowlistConfig(allowed []string) (model.ServiceConfig, []string, error) {
+	catalog, err := c.GetAllBlockedServices()
+	if err != nil {
+		logger.Error("[adguardapi][BuildAllowlistConfig] Failed to get service catalog")
+		return model.ServiceConfig{}, nil, err
+	}
+
+	isAllowed := make(map[string]bool, len(allowed))
+	for _, id := range allowed {
+		isAllowed[id] = true
+	}
+
+	// The complement of the allowlist against the catalog is what gets blocked
+	serviceConfig := model.ServiceConfig{
+		IDs:      make([]string, 0, len(catalog)),
+		Schedule: model.Schedule{TimeZone: DefaultTimeZone()},
+	}
+	inCatalog := make(map[string]bool, len(catalog))
+	for _, service := range catalog {
+		inCatalog[service.ID] = true
+		if !isAllowed[service.ID] {
+			serviceConfig.IDs = append(serviceConfig.IDs, service.ID)
+		}
+	}
+
+	unknownIDs := make([]string, 0)
+	for _, id := range allowed {
+		if !inCatalog[id] {
+			unknownIDs = append(unknownIDs, id)
+		}
+	}
+
+	return serviceConfig, unknownIDs, nil
+}
+
+// ApplyAllowlist blocks every service of the catalog except the allowed ones
+func (c *Client) ApplyAllowlist(allowed []string) (model.ServiceConfig, error) {
+	serviceConfig, unknownIDs, err := c.BuildAllowlistConfig(allowed)
+	if err != nil {
+		return model.ServiceConfig{}, err
+	}
+	if len(unknownIDs) > 0 {
+		logger.Error("[adguardapi][ApplyAllowlist] Allowlist contains unknown service IDs: " + strings.Join(unknownIDs, ", "))
+		return model.ServiceConfig{}, fmt.Errorf("%w: %s", ErrUnknownServiceIDs, strings.Join(unknownIDs, ", "))
+	}
+
+	logger.Info("[adguardapi][ApplyAllowlist] Allowing ", len(allowed), " service(s), blocking ", len(serviceConfig.IDs))
+	if err := c.UpdateBlockedServices(&serviceConfig); err != nil {
+		return model.ServiceConfig{}, err
+	}
+	return serviceConfig, nil
+}
@@ -1,16 +1,26 @@
 package adguardapi
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/welasco/adguardfilter/common/config"
 	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/retry"
+	"github.com/welasco/adguardfilter/common/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // AuthCredentials holds the credentials for API authentication
@@ -19,48 +29,41 @@ type AuthCredentials struct {
 	Password string `json:"password"`
 }
 
-var (
-	// Global HTTP client with cookie jar for session management
-	httpClient *http.Client
-	// Store credentials for automatic re-authentication
-	authBaseURL  string
-	authUsername string
-	authPassword string
-)
-
-func init() {
-	// Initialize variables if needed
-	authBaseURL = os.Getenv("authBaseURL")
-	authUsername = os.Getenv("authUsername")
-	authPassword = os.Getenv("authPassword")
-}
+// Authenticate performs authentication against the API and stores the session cookie
+func (c *Client) Authenticate(baseURL, username, password string) error {
+	// Initialize HTTP client if not already done
+	if c.httpClient == nil {
+		if err := c.InitHTTPClient(); err != nil {
+			return err
+		}
+	}
 
-// InitHTTPClient initializes the HTTP client with a cookie jar
-func InitHTTPClient() error {
-	jar, err := cookiejar.New(nil)
+	expiry, err := c.login(baseURL, username, password)
 	if err != nil {
-		logger.Error("[adguardapi_auth][InitHTTPClient] Failed to create cookie jar")
-		logger.Error(err)
 		return err
 	}
 
-	httpClient = &http.Client{
-		Jar: jar,
+	logger.Info("[adguardapi_auth][Authenticate] Successfully authenticated. Cookies stored for future requests")
+
+	if !expiry.IsZero() {
+		logger.Debug("[adguardapi_auth][Authenticate] Session expires at: " + expiry.Format(time.RFC3339))
 	}
 
-	logger.Debug("[adguardapi_auth][InitHTTPClient] HTTP client initialized with cookie jar")
+	// Store credentials for automatic re-authentication
+	c.mu.Lock()
+	c.sessionExpiry = expiry
+	c.logins++
+	c.baseURL = baseURL
+	c.username = username
+	c.password = password
+	c.mu.Unlock()
+
 	return nil
 }
 
-// Authenticate performs authentication against the API and stores the session cookie
-func Authenticate(baseURL, username, password string) error {
-	// Initialize HTTP client if not already done
-	if httpClient == nil {
-		if err := InitHTTPClient(); err != nil {
-			return err
-		}
-	}
-
+// login authenticates against AdGuard, storing the session cookie in the client's jar,
+// and returns when the session expires (zero when unknown)
+func (c *Client) login(baseURL, username, password string) (time.Time, error) {
 	// Prepare authentication credentials
 	credentials := AuthCredentials{
 		Name:     username,
@@ -69,77 +72,219 @@ func Authenticate(baseURL, username, password string) error {
 
 	jsonData, err := json.Marshal(credentials)
 	if err != nil {
-		logger.Error("[adguardapi_auth][Authenticate] Failed to marshal credentials")
+		logger.Error("[adguardapi_auth][login] Failed to marshal credentials")
 		logger.Error(err)
-		return err
+		return time.Time{}, err
 	}
 
 	// Create the authentication request
-	loginURL := baseURL + "/control/login"
-	req, err := http.NewRequest("POST", loginURL, bytes.NewBuffer(jsonData))
+	req, err := newRequest(baseURL, "POST", ControlPath("login"), jsonData)
 	if err != nil {
-		logger.Error("[adguardapi_auth][Authenticate] Failed to create authentication request")
+		logger.Error("[adguardapi_auth][login] Failed to create authentication request")
 		logger.Error(err)
-		return err
+		return time.Time{}, err
 	}
 
-	// Set required headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json, text/plain, */*")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36")
-
 	// Perform the request
-	resp, err := httpClient.Do(req)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		logger.Error("[adguardapi_auth][Authenticate] Failed to authenticate to: " + loginURL)
+		logger.Error("[adguardapi_auth][login] Failed to authenticate to: " + req.URL.String())
 		logger.Error(err)
-		return err
+		return time.Time{}, wrapTransportError(err)
 	}
 	defer resp.Body.Close()
 
 	// Check response status
 	if resp.StatusCode != 200 {
-		logger.Error("[adguardapi_auth][Authenticate] Authentication failed with status: " + resp.Status)
-		return errors.New("authentication failed with status: " + resp.Status)
+		logger.Error("[adguardapi_auth][login] Authentication failed with status: " + resp.Status)
+		return time.Time{}, fmt.Errorf("%w: status %s", ErrAuthFailed, resp.Status)
 	}
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logger.Error("[adguardapi_auth][Authenticate] Failed to read response body")
+		logger.Error("[adguardapi_auth][login] Failed to read response body")
 		logger.Error(err)
-		return err
+		return time.Time{}, err
 	}
 
-	logger.Debug("[adguardapi_auth][Authenticate] Authentication response: " + string(body))
+	logger.Debug("[adguardapi_auth][login] Authentication response: " + logger.Redact(string(body)))
 
-	// Verify cookies were set
-	parsedURL, _ := url.Parse(baseURL)
-	cookies := httpClient.Jar.Cookies(parsedURL)
+	// Verify the session cookie is sent on the control API paths. A proxy in front of AdGuard may set cookies of
+	// its own, so any cookie isn't enough: the session one must be there and not scoped to another path.
+	apiURL, _ := url.Parse(baseURL + ControlPath("status"))
+	cookies := c.httpClient.Jar.Cookies(apiURL)
 	if len(cookies) == 0 {
-		logger.Error("[adguardapi_auth][Authenticate] No cookies received from authentication")
-		return errors.New("no cookies received from authentication")
+		logger.Error("[adguardapi_auth][login] No cookies received from authentication")
+		return time.Time{}, fmt.Errorf("%w: %w", ErrAuthFailed, errNoCookies)
 	}
 
-	logger.Info("[adguardapi_auth][Authenticate] Successfully authenticated. Cookies stored for future requests")
+	name := sessionCookieName()
+	var session *http.Cookie
 	for _, cookie := range cookies {
-		logger.Debug("[adguardapi_auth][Authenticate] Cookie: " + cookie.Name + "=" + cookie.Value)
+		logger.Debug("[adguardapi_auth][login] Cookie: " + cookie.Name + "=" + logger.Redact(cookie.Value))
+		if cookie.Name == name {
+			session = cookie
+		}
 	}
+	if session == nil {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == name {
+				logger.Error("[adguardapi_auth][login] Session cookie " + name + " is set for path " + cookie.Path + " and domain " + cookie.Domain + ", so it isn't sent to " + apiURL.Path)
+				return time.Time{}, fmt.Errorf("%w: %w", ErrAuthFailed, errNoSessionCookie)
+			}
+		}
+		logger.Error("[adguardapi_auth][login] No session cookie " + name + " received from authentication, only: " + cookieNames(cookies))
+		return time.Time{}, fmt.Errorf("%w: %w", ErrAuthFailed, errNoSessionCookie)
+	}
+	logger.Info("[adguardapi_auth][login] Using session cookie " + session.Name + " out of " + cookieNames(cookies))
 
-	// Store credentials for automatic re-authentication
-	authBaseURL = baseURL
-	authUsername = username
-	authPassword = password
+	// The jar doesn't expose cookie expiry, so read it from the Set-Cookie header of the session cookie,
+	// a proxy's cookies can expire at other times
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name {
+			return cookieExpiry([]*http.Cookie{cookie}), nil
+		}
+	}
+	return cookieExpiry(resp.Cookies()), nil
+}
 
-	return nil
+// sessionCookieName returns the name of the AdGuard session cookie, sessionCookieName (default agh_session)
+func sessionCookieName() string {
+	if name := os.Getenv("sessionCookieName"); name != "" {
+		return name
+	}
+	return "agh_session"
+}
+
+// cookieNames lists the names of the cookies for logging, never their values
+func cookieNames(cookies []*http.Cookie) string {
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// errNoCookies is returned when the login succeeded but AdGuard set no session cookie
+var errNoCookies = errors.New("no cookies received")
+
+// errNoSessionCookie is returned when the login set cookies but none of them is the session cookie sent on the API paths
+var errNoSessionCookie = errors.New("no session cookie for the API paths received")
+
+// ErrNoCredentials is returned when authBaseURL, authUsername or authPassword are not configured
+var ErrNoCredentials = errors.New("no AdGuard credentials configured")
+
+// AuthenticateWithStoredCredentials authenticates with the client's stored credentials
+func (c *Client) AuthenticateWithStoredCredentials() error {
+	if !c.canReauthenticate() {
+		return ErrNoCredentials
+	}
+	return c.Authenticate(c.credentials())
 }
 
-// GetHTTPClient returns the global HTTP client with cookies
-func GetHTTPClient() (*http.Client, error) {
-	if httpClient == nil {
+// sessionGeneration counts the successful logins, so a request can tell whether the session changed since
+// it was sent
+func (c *Client) sessionGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.logins
+}
+
+// GetSessionExpiry returns when the current session cookie expires, and false when it is unknown
+func (c *Client) GetSessionExpiry() (time.Time, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sessionExpiry, !c.sessionExpiry.IsZero()
+}
+
+// cookieExpiry returns the earliest expiry among the given cookies, preferring Max-Age over Expires,
+// or the zero time when none carries one
+func cookieExpiry(cookies []*http.Cookie) time.Time {
+	var earliest time.Time
+	for _, cookie := range cookies {
+		var expiry time.Time
+		switch {
+		case cookie.MaxAge > 0:
+			expiry = time.Now().Add(time.Duration(cookie.MaxAge) * time.Second)
+		case !cookie.Expires.IsZero():
+			expiry = cookie.Expires
+		default:
+			continue
+		}
+		if earliest.IsZero() || expiry.Before(earliest) {
+			earliest = expiry
+		}
+	}
+	return earliest
+}
+
+// refreshSessionIfExpiring re-authenticates before the session expires, when it is within
+// sessionRefreshWindowSec seconds (default 300) of expiring. Failures are only logged since the
+// request itself still falls back to re-authenticating on a 401/403.
+func (c *Client) refreshSessionIfExpiring() {
+	window := time.Duration(config.GetInt("sessionRefreshWindowSec", 300)) * time.Second
+	expiring := func() bool {
+		expiry, known := c.GetSessionExpiry()
+		return known && time.Until(expiry) < window
+	}
+	if !expiring() || !c.canReauthenticate() {
+		return
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// Another request may have refreshed the session while waiting for the lock
+	if !expiring() {
+		return
+	}
+
+	logger.Info("[adguardapi_auth][refreshSessionIfExpiring] Session is about to expire, re-authenticating proactively")
+	if err := c.AuthenticateWithStoredCredentials(); err != nil {
+		logger.Warning("[adguardapi_auth][refreshSessionIfExpiring] Proactive re-authentication failed, continuing with the current session")
+	}
+}
+
+// Reauthenticate forces a fresh login with the stored credentials, first expiring the session cookies in the
+// jar so a stuck session can't linger if the login fails. It serializes with the proactive session refresh.
+func (c *Client) Reauthenticate() error {
+	if !c.canReauthenticate() {
+		return ErrNoCredentials
+	}
+
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	if c.httpClient != nil && c.httpClient.Jar != nil {
+		apiURL, err := url.Parse(c.BaseURL() + ControlPath("status"))
+		if err == nil {
+			cookies := c.httpClient.Jar.Cookies(apiURL)
+			expired := make([]*http.Cookie, 0, 2*len(cookies))
+			for _, cookie := range cookies {
+				// The jar doesn't tell the path a cookie was set for, so expire it on both candidates
+				for _, path := range []string{"/", strings.TrimSuffix(ControlPath(""), "/")} {
+					expired = append(expired, &http.Cookie{Name: cookie.Name, Path: path, MaxAge: -1})
+				}
+			}
+			c.httpClient.Jar.SetCookies(apiURL, expired)
+			logger.Info("[adguardapi_auth][Reauthenticate] Dropped the session cookies: " + cookieNames(cookies))
+		}
+	}
+
+	c.mu.Lock()
+	c.sessionExpiry = time.Time{}
+	c.mu.Unlock()
+
+	return c.Authenticate(c.credentials())
+}
+
+// GetHTTPClient returns the client's HTTP client with cookies
+func (c *Client) GetHTTPClient() (*http.Client, error) {
+	if c.httpClient == nil {
 		return nil, errors.New("HTTP client not initialized. Call InitHTTPClient or Authenticate first")
 	}
-	return httpClient, nil
+	return c.httpClient, nil
 }
 
 // isAuthError checks if the status code indicates an authentication/authorization error
@@ -147,52 +292,201 @@ func isAuthError(statusCode int) bool {
 	return statusCode == 401 || statusCode == 403
 }
 
+// isLoginPage checks if a successful response is an HTML login page instead of the API's JSON, which some
+// AdGuard versions and auth proxies such as Authelia answer with a 200 once the session expired. Responses
+// typed as HTML count, as well as untyped or non-JSON ones whose body starts with "<"; empty and plain
+// text answers, like the "OK" of an update, don't. The peeked bytes stay readable in resp.Body.
+func isLoginPage(resp *http.Response) bool {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return true
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return false
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	peeked, _ := reader.Peek(512)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{reader, resp.Body}
+	return bytes.HasPrefix(bytes.TrimSpace(peeked), []byte("<"))
+}
+
 // canReauthenticate checks if we have stored credentials for re-authentication
-func canReauthenticate() bool {
-	return authBaseURL != "" && authUsername != "" && authPassword != ""
+func (c *Client) canReauthenticate() bool {
+	baseURL, username, password := c.credentials()
+	return baseURL != "" && username != "" && password != ""
 }
 
-// DoAuthenticatedRequest performs an HTTP request with automatic re-authentication on auth failures
-func DoAuthenticatedRequest(req *http.Request) (*http.Response, error) {
-	// Ensure HTTP client is initialized
-	if httpClient == nil {
-		if err := InitHTTPClient(); err != nil {
+// DoAuthenticatedRequest performs an HTTP request with automatic re-authentication on auth failures.
+// Idempotent requests (GET, HEAD, OPTIONS) are also retried on transient failures.
+func (c *Client) DoAuthenticatedRequest(req *http.Request) (*http.Response, error) {
+	return c.DoAuthenticatedRequestWithRetry(req, isIdempotent(req.Method))
+}
+
+// DoAuthenticatedRequestContext performs an authenticated HTTP request bound to ctx, so it is cancelled with
+// it and traced as a child of the span in ctx
+func (c *Client) DoAuthenticatedRequestContext(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return c.DoAuthenticatedRequest(req.WithContext(ctx))
+}
+
+// DoAuthenticatedRequestWithRetry performs an authenticated HTTP request. When retryTransient is true,
+// network errors and 5xx responses are retried with exponential backoff (httpRetryMax attempts,
+// starting at httpRetryBaseMs). This is separate from the re-authentication retry on 401/403.
+func (c *Client) DoAuthenticatedRequestWithRetry(req *http.Request, retryTransient bool) (*http.Response, error) {
+	maxRetries := 0
+	if retryTransient {
+		maxRetries = config.GetInt("httpRetryMax", 3)
+	}
+	baseDelay := time.Duration(config.GetInt("httpRetryBaseMs", 500)) * time.Millisecond
+
+	// One client span covers the retries, so its latency is what the caller waited for
+	ctx, span := tracing.StartClient(req.Context(), "adguard "+req.Method+" "+req.URL.Path, req.Header,
+		attribute.String("http.request.method", req.Method),
+		attribute.String("url.path", req.URL.Path),
+	)
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	for attempt := 0; ; attempt++ {
+		resp, transient, err := c.doAuthenticatedRequestOnce(req)
+		if !transient || attempt >= maxRetries {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			} else {
+				span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+				if resp.StatusCode >= 400 {
+					span.SetStatus(codes.Error, resp.Status)
+				}
+			}
+			return resp, err
+		}
+
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = "status " + resp.Status
+			resp.Body.Close()
+		}
+
+		delay := retry.Backoff(baseDelay, attempt)
+		logger.Warning("[adguardapi_auth][DoAuthenticatedRequestWithRetry] Transient failure (" + reason + "), retrying " + req.Method + " " + req.URL.Path + " in " + delay.String())
+		select {
+		case <-ctx.Done():
+			// The caller gave up, or the shutdown budget ran out, waiting for the next attempt
+			logger.Warning("[adguardapi_auth][DoAuthenticatedRequestWithRetry] Giving up on " + req.Method + " " + req.URL.Path + ": " + ctx.Err().Error())
+			span.RecordError(ctx.Err())
+			span.SetStatus(codes.Error, ctx.Err().Error())
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if err := rewindBody(req); err != nil {
+			logger.Error("[adguardapi_auth][DoAuthenticatedRequestWithRetry] Failed to rewind request body for retry")
 			return nil, err
 		}
 	}
+}
 
-	// Perform the request
-	resp, err := httpClient.Do(req)
+// doAuthenticatedRequestOnce sends the request once, re-authenticating and resending on an auth failure.
+// The returned flag reports whether the failure is transient and worth retrying.
+func (c *Client) doAuthenticatedRequestOnce(req *http.Request) (*http.Response, bool, error) {
+	// Ensure HTTP client is initialized
+	if c.httpClient == nil {
+		if err := c.InitHTTPClient(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Renew the session before it expires rather than waiting for a 401
+	c.refreshSessionIfExpiring()
+
+	// Perform the request, noting the session it was sent with
+	sentWith := c.sessionGeneration()
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, true, wrapTransportError(err)
 	}
 
-	// Check if we got an authentication error
-	if isAuthError(resp.StatusCode) {
+	// Check if we got an authentication error, or a login page standing in for one
+	loginPage := isLoginPage(resp)
+	if isAuthError(resp.StatusCode) || loginPage {
 		resp.Body.Close() // Close the failed response body
+		reason := "status " + resp.Status
+		if loginPage {
+			reason = "got an HTML login page instead of JSON"
+		}
 
 		// Check if we can re-authenticate
-		if !canReauthenticate() {
+		if !c.canReauthenticate() {
 			logger.Error("[adguardapi_auth][DoAuthenticatedRequest] Authentication failed and no credentials stored for re-authentication")
-			return nil, errors.New("authentication required but no credentials available")
+			return nil, false, fmt.Errorf("%w: authentication required but no credentials available", ErrAuthFailed)
 		}
 
-		logger.Info("[adguardapi_auth][DoAuthenticatedRequest] Session expired (status " + resp.Status + "), attempting re-authentication...")
-
-		// Attempt to re-authenticate
-		if err := Authenticate(authBaseURL, authUsername, authPassword); err != nil {
-			logger.Error("[adguardapi_auth][DoAuthenticatedRequest] Re-authentication failed")
-			return nil, err
+		logger.Info("[adguardapi_auth][DoAuthenticatedRequest] Session expired (" + reason + "), attempting re-authentication...")
+
+		// Attempt to re-authenticate, serialized with the proactive refresh and Reauthenticate so no login
+		// races a jar being cleared. Requests rejected together log in once: the others find a newer session.
+		c.refreshMu.Lock()
+		if c.sessionGeneration() == sentWith {
+			if err := c.AuthenticateWithStoredCredentials(); err != nil {
+				c.refreshMu.Unlock()
+				logger.Error("[adguardapi_auth][DoAuthenticatedRequest] Re-authentication failed")
+				return nil, false, err
+			}
+			logger.Info("[adguardapi_auth][DoAuthenticatedRequest] Re-authentication successful, retrying original request")
+		} else {
+			logger.Info("[adguardapi_auth][DoAuthenticatedRequest] Another request re-authenticated meanwhile, retrying original request")
 		}
+		c.refreshMu.Unlock()
 
-		logger.Info("[adguardapi_auth][DoAuthenticatedRequest] Re-authentication successful, retrying original request")
-
-		// Retry the original request with new cookies
-		resp, err = httpClient.Do(req)
+		// Retry the original request with new cookies, resending the body consumed by the first attempt
+		if err := rewindBody(req); err != nil {
+			return nil, false, err
+		}
+		resp, err = c.httpClient.Do(req)
 		if err != nil {
-			return nil, err
+			return nil, true, wrapTransportError(err)
+		}
+
+		// A proxy with its own login keeps answering with its page, whatever AdGuard's session is
+		if isLoginPage(resp) {
+			resp.Body.Close()
+			logger.Error("[adguardapi_auth][DoAuthenticatedRequest] Still got an HTML login page after re-authentication, check the proxy in front of AdGuard Home")
+			return nil, false, fmt.Errorf("%w: AdGuard Home answered with an HTML login page instead of JSON", ErrAuthFailed)
 		}
 	}
 
-	return resp, nil
+	return resp, resp.StatusCode >= 500, nil
+}
+
+// isIdempotent reports whether requests with the given method are safe to retry by default
+func isIdempotent(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// rewindBody resets the request body so the request can be sent again. It also drops the cookies the
+// HTTP client added to the request from its jar, or the resent request would carry the expired session
+// cookie ahead of the new one.
+func rewindBody(req *http.Request) error {
+	req.Header.Del("Cookie")
+
+	if req.Body == nil || req.GetBody == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
 }
@@ -0,0 +1,68 @@
+package adguardapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshSessionIfExpiring(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxAge     int
+		wantLogins int
+	}{
+		{name: "expiring within the window", maxAge: 60, wantLogins: 2},
+		{name: "expiring after the window", maxAge: 3600, wantLogins: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeAdGuard(t)
+			t.Setenv("sessionRefreshWindowSec", "300")
+			f.mu.Lock()
+			f.maxAge = tt.maxAge
+			f.mu.Unlock()
+
+			if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if _, err := client.GetBlockedServices(); err != nil {
+				t.Fatalf("GetBlockedServices: %v", err)
+			}
+
+			if got := f.loginCount(); got != tt.wantLogins {
+				t.Errorf("got %d logins, want %d", got, tt.wantLogins)
+			}
+			// A proactive refresh happens before the request, which is never rejected
+			if got := f.count("GET blocked_services/get"); got != 1 {
+				t.Errorf("got %d requests, want 1 without a 401", got)
+			}
+		})
+	}
+}
+
+func TestRefreshSessionKeepsSessionOnFailedLogin(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("sessionRefreshWindowSec", "300")
+	f.mu.Lock()
+	f.maxAge = 60
+	f.mu.Unlock()
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	expiry, _ := client.GetSessionExpiry()
+
+	// The stored password no longer works, the request still goes out with the current session
+	client.mu.Lock()
+	client.password = "changed"
+	client.mu.Unlock()
+
+	if _, err := client.GetBlockedServices(); err != nil {
+		t.Fatalf("GetBlockedServices: %v", err)
+	}
+	if got := f.count("POST login"); got != 2 {
+		t.Errorf("got %d login attempts, want the refresh to have been tried", got)
+	}
+	if got, _ := client.GetSessionExpiry(); !got.Equal(expiry) || time.Until(got) > time.Minute {
+		t.Errorf("got session expiry %v, want the current session's %v", got, expiry)
+	}
+}
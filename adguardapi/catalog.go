@@ -0,0 +1,175 @@
+package adguardapi
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// catalogCacheTTL returns how long the blocked services catalog is cached, from catalogCacheTTLSec
+// (default 3600, 0 disables the cache)
+func catalogCacheTTL() time.Duration {
+	return time.Duration(config.GetInt("catalogCacheTTLSec", 3600)) * time.Second
+}
+
+// GetAllBlockedServices retrieves all available blocked services. The catalog only changes across AdGuard
+// upgrades, so it is cached for catalogCacheTTLSec seconds and fetched again lazily once expired.
+func (c *Client) GetAllBlockedServices() ([]model.BlockedService, error) {
+	return c.getServiceCatalog(false)
+}
+
+// RefreshServiceCatalog drops the cached catalog and fetches it again from the API
+func (c *Client) RefreshServiceCatalog() ([]model.BlockedService, error) {
+	return c.getServiceCatalog(true)
+}
+
+// getServiceCatalog returns the cached catalog, fetching it when forceRefresh is set or the cache expired.
+// Holding catalogMu across the fetch lets concurrent callers on a cold cache share one request.
+func (c *Client) getServiceCatalog(forceRefresh bool) ([]model.BlockedService, error) {
+	c.catalogMu.Lock()
+	defer c.catalogMu.Unlock()
+
+	if !forceRefresh && c.catalog != nil && time.Now().Before(c.catalogExpires) {
+		logger.Debug("[adguardapi][getServiceCatalog] Using cached catalog, expires at " + c.catalogExpires.Format(time.RFC3339))
+		return append([]model.BlockedService(nil), c.catalog...), nil
+	}
+
+	services, err := c.fetchAllBlockedServices()
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl := catalogCacheTTL(); ttl > 0 {
+		c.catalog = services
+		c.catalogExpires = time.Now().Add(ttl)
+	} else {
+		c.catalog = nil
+	}
+
+	return append([]model.BlockedService(nil), services...), nil
+}
+
+// Match kinds of a resolved service name
+const (
+	MatchExact = "exact"
+	MatchFuzzy = "fuzzy"
+)
+
+// normalizeServiceName lowercases a service name or ID and drops everything but letters and digits, so
+// "Plenty of Fish", "plenty-of-fish" and the ID plenty_of_fish compare equal
+func normalizeServiceName(name string) string {
+	var normalized strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			normalized.WriteRune(r)
+		}
+	}
+	return normalized.String()
+}
+
+// serviceLookup returns the normalized names and IDs of the catalog mapped to their IDs. It is kept with the
+// cached catalog, so it is only built again once the catalog expires or is refreshed.
+func (c *Client) serviceLookup() (map[string]string, error) {
+	services, err := c.GetAllBlockedServices()
+	if err != nil {
+		return nil, err
+	}
+
+	c.catalogMu.Lock()
+	defer c.catalogMu.Unlock()
+
+	if c.catalogLookup != nil && c.catalog != nil && c.catalogLookupFor.Equal(c.catalogExpires) {
+		return c.catalogLookup, nil
+	}
+
+	lookup := make(map[string]string, 2*len(services))
+	for _, service := range services {
+		lookup[normalizeServiceName(service.ID)] = service.ID
+	}
+	// Names don't take over another service's ID
+	for _, service := range services {
+		if key := normalizeServiceName(service.Name); key != "" {
+			if _, taken := lookup[key]; !taken {
+				lookup[key] = service.ID
+			}
+		}
+	}
+	if c.catalog != nil {
+		c.catalogLookup = lookup
+		c.catalogLookupFor = c.catalogExpires
+	}
+	return lookup, nil
+}
+
+// ResolveServiceNames maps service names such as "YouTube" to their catalog IDs, ignoring case, spaces and
+// punctuation. IDs resolve to themselves. With fuzzy, a name without an exact match takes the closest one
+// within an edit distance of a quarter of its length, when a single service is that close. Names without a
+// match are returned in unmatched, in their original order.
+func (c *Client) ResolveServiceNames(names []string, fuzzy bool) ([]model.ResolvedServiceName, []string, error) {
+	lookup, err := c.serviceLookup()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resolved := []model.ResolvedServiceName{}
+	unmatched := []string{}
+	for _, name := range names {
+		key := normalizeServiceName(name)
+		if id, ok := lookup[key]; ok && key != "" {
+			resolved = append(resolved, model.ResolvedServiceName{Name: name, ID: id, Match: MatchExact})
+			continue
+		}
+		if fuzzy && key != "" {
+			if id, ok := closestService(lookup, key); ok {
+				logger.Debug("[adguardapi][ResolveServiceNames] Matched '" + name + "' to " + id + " fuzzily")
+				resolved = append(resolved, model.ResolvedServiceName{Name: name, ID: id, Match: MatchFuzzy})
+				continue
+			}
+		}
+		unmatched = append(unmatched, name)
+	}
+	return resolved, unmatched, nil
+}
+
+// closestService returns the ID whose normalized name or ID is closest to key, within a distance of a quarter
+// of its length (at least 1), when no other service is as close
+func closestService(lookup map[string]string, key string) (string, bool) {
+	limit := max(len([]rune(key))/4, 1)
+	best, bestDistance, tied := "", limit+1, false
+	for candidate, id := range lookup {
+		distance := editDistance(key, candidate)
+		switch {
+		case distance < bestDistance:
+			best, bestDistance, tied = id, distance, false
+		case distance == bestDistance && id != best:
+			tied = true
+		}
+	}
+	return best, best != "" && !tied
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
@@ -0,0 +1,62 @@
+package adguardapi
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceCatalogCache(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("catalogCacheTTLSec", "3600")
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	fetches := func() int { return f.count("GET blocked_services/all") }
+
+	for range 3 {
+		if _, err := client.GetAllBlockedServices(); err != nil {
+			t.Fatalf("GetAllBlockedServices: %v", err)
+		}
+	}
+	if got := fetches(); got != 1 {
+		t.Errorf("got %d fetches within the TTL, want 1", got)
+	}
+
+	// Once the TTL ran out the next call fetches the catalog again
+	client.catalogMu.Lock()
+	client.catalogExpires = time.Now().Add(-time.Second)
+	client.catalogMu.Unlock()
+	if _, err := client.GetAllBlockedServices(); err != nil {
+		t.Fatalf("GetAllBlockedServices: %v", err)
+	}
+	if got := fetches(); got != 2 {
+		t.Errorf("got %d fetches after the TTL, want 2", got)
+	}
+
+	if _, err := client.RefreshServiceCatalog(); err != nil {
+		t.Fatalf("RefreshServiceCatalog: %v", err)
+	}
+	if _, err := client.GetAllBlockedServices(); err != nil {
+		t.Fatalf("GetAllBlockedServices: %v", err)
+	}
+	if got := fetches(); got != 3 {
+		t.Errorf("got %d fetches after a refresh, want 3", got)
+	}
+}
+
+func TestServiceCatalogCacheDisabled(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("catalogCacheTTLSec", "0")
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	for range 2 {
+		if _, err := client.GetAllBlockedServices(); err != nil {
+			t.Fatalf("GetAllBlockedServices: %v", err)
+		}
+	}
+	if got := f.count("GET blocked_services/all"); got != 2 {
+		t.Errorf("got %d fetches, want every call to fetch without a cache", got)
+	}
+}
@@ -0,0 +1,183 @@
+package adguardapi
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// Client talks to a single AdGuard Home instance, holding its base URL, credentials and session
+type Client struct {
+	// HTTP client with cookie jar for session management
+	httpClient *http.Client
+
+	// Credentials for automatic re-authentication, guarded by mu
+	baseURL  string
+	username string
+	password string
+	// Expiry of the current session cookie, zero when unknown, guarded by mu
+	sessionExpiry time.Time
+	// Successful logins so far, guarded by mu
+	logins uint64
+	mu     sync.RWMutex
+	// Serializes the logins renewing the session: the proactive refresh, the re-authentication after a 401
+	// and Reauthenticate, so concurrent requests log in only once
+	refreshMu sync.Mutex
+
+	// Serializes the read-modify-write of the blocked services configuration
+	configMu sync.Mutex
+	// Serializes the read-modify-write of the user rules list
+	rulesMu sync.Mutex
+
+	// The configuration this client last applied successfully, nil until the first update
+	lastApplied   *model.ServiceConfig
+	lastAppliedAt time.Time
+	lastAppliedMu sync.Mutex
+
+	// Cached blocked services catalog and when it expires, guarded by catalogMu
+	catalog        []model.BlockedService
+	catalogExpires time.Time
+	catalogMu      sync.Mutex
+	// Normalized names and IDs of the cached catalog to their IDs, built for the catalog expiring at
+	// catalogLookupFor, guarded by catalogMu
+	catalogLookup    map[string]string
+	catalogLookupFor time.Time
+
+	// Configurations captured before each change, oldest first, guarded by snapshotsMu.
+	// They are persisted to snapshotsPath when it is set, which is only the case for the default client.
+	snapshots       []model.ConfigSnapshot
+	snapshotsPath   string
+	snapshotsLoaded bool
+	snapshotsMu     sync.Mutex
+
+	// Services left out of every configuration sent to AdGuard, guarded by disabledMu. They are
+	// persisted to disabledPath when it is set, which is only the case for the default client.
+	disabled       map[string]model.DisabledService
+	disabledPath   string
+	disabledLoaded bool
+	disabledMu     sync.Mutex
+
+	// The blocked services API generation detected from the AdGuard version, empty until detected,
+	// guarded by apiVersionMu
+	apiVersion   string
+	apiVersionMu sync.Mutex
+}
+
+// defaultClient backs the package-level functions and is configured from the environment
+var defaultClient *Client
+
+func init() {
+	baseURL := os.Getenv("authBaseURL")
+	if baseURL == "" && MockEnabled() {
+		baseURL = mockBaseURL
+	}
+	defaultClient = &Client{
+		baseURL:       baseURL,
+		username:      config.GetSecret("authUsername"),
+		password:      config.GetSecret("authPassword"),
+		snapshotsPath: os.Getenv("snapshotsPath"),
+		disabledPath:  disabledServicesPath(),
+	}
+}
+
+// NewClient creates a client for the AdGuard instance at baseURL. It doesn't log in until
+// Authenticate is called or the first request is rejected.
+func NewClient(baseURL, username, password string) (*Client, error) {
+	c := &Client{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+	}
+	if err := c.InitHTTPClient(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewClientWithHTTPClient creates a client that sends its requests through httpClient, e.g. one
+// with a custom transport or the client of a test server. A cookie jar is added when it has none.
+func NewClientWithHTTPClient(baseURL, username, password string, httpClient *http.Client) (*Client, error) {
+	if httpClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			logger.Error("[adguardapi_auth][NewClientWithHTTPClient] Failed to create cookie jar")
+			logger.Error(err)
+			return nil, err
+		}
+		httpClient.Jar = jar
+	}
+
+	return &Client{
+		httpClient: httpClient,
+		baseURL:    baseURL,
+		username:   username,
+		password:   password,
+	}, nil
+}
+
+// DefaultClient returns the client used by the package-level functions
+func DefaultClient() *Client {
+	return defaultClient
+}
+
+var (
+	transport     *http.Transport
+	transportOnce sync.Once
+)
+
+// sharedTransport returns the transport of every client, so they reuse their keep-alive connections to AdGuard
+// instead of repeating the TCP and TLS handshakes on every poll. The pool is sized by adguardMaxIdleConns
+// (default 20), adguardMaxIdleConnsPerHost (default 10) and adguardIdleConnTimeoutSec (default 90).
+func sharedTransport() *http.Transport {
+	transportOnce.Do(func() {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+		transport.DisableKeepAlives = false
+		transport.MaxIdleConns = max(config.GetInt("adguardMaxIdleConns", 20), 0)
+		transport.MaxIdleConnsPerHost = max(config.GetInt("adguardMaxIdleConnsPerHost", 10), 0)
+		transport.IdleConnTimeout = time.Duration(max(config.GetInt("adguardIdleConnTimeoutSec", 90), 0)) * time.Second
+		logger.Debug("[adguardapi_auth][sharedTransport] Keeping up to ", transport.MaxIdleConnsPerHost, " idle connection(s) per host, ",
+			transport.MaxIdleConns, " in total, for "+transport.IdleConnTimeout.String())
+	})
+	return transport
+}
+
+// InitHTTPClient initializes the client's HTTP client with a new cookie jar
+func (c *Client) InitHTTPClient() error {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		logger.Error("[adguardapi_auth][InitHTTPClient] Failed to create cookie jar")
+		logger.Error(err)
+		return err
+	}
+
+	c.httpClient = &http.Client{
+		Jar:       jar,
+		Transport: sharedTransport(),
+	}
+	if MockEnabled() {
+		c.httpClient.Transport = sharedMock()
+	}
+
+	logger.Debug("[adguardapi_auth][InitHTTPClient] HTTP client initialized with cookie jar")
+	return nil
+}
+
+// BaseURL returns the AdGuard base URL the client talks to
+func (c *Client) BaseURL() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.baseURL
+}
+
+// credentials returns the stored base URL and credentials
+func (c *Client) credentials() (string, string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.baseURL, c.username, c.password
+}
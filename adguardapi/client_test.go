@@ -0,0 +1,190 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/welasco/adguardfilter/model"
+)
+
+func TestAuthenticate(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if got := f.loginCount(); got != 1 {
+		t.Errorf("got %d logins, want 1", got)
+	}
+	expiry, known := client.GetSessionExpiry()
+	if !known || time.Until(expiry) < 59*time.Minute || time.Until(expiry) > time.Hour {
+		t.Errorf("got session expiry %v (known %v), want in an hour from the cookie's Max-Age", expiry, known)
+	}
+
+	if err := client.Authenticate(f.URL, testUsername, "wrong"); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got error %v with a wrong password, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestFirstRequestLogsIn(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+
+	serviceConfig, err := client.GetBlockedServices()
+	if err != nil {
+		t.Fatalf("GetBlockedServices: %v", err)
+	}
+	if !slices.Equal(serviceConfig.IDs, []string{"youtube", "tiktok"}) {
+		t.Errorf("got IDs %v, want those of the fake", serviceConfig.IDs)
+	}
+	if got := f.loginCount(); got != 1 {
+		t.Errorf("got %d logins, want 1 after the 401", got)
+	}
+}
+
+func TestReauthenticateOnExpiredSession(t *testing.T) {
+	for _, loginPage := range []bool{false, true} {
+		name := "401"
+		if loginPage {
+			name = "login page"
+		}
+		t.Run(name, func(t *testing.T) {
+			f, client := newFakeAdGuard(t)
+			if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			f.mu.Lock()
+			f.loginPage = loginPage
+			f.mu.Unlock()
+			f.expireSession()
+
+			if _, err := client.GetBlockedServices(); err != nil {
+				t.Fatalf("GetBlockedServices: %v", err)
+			}
+			if got := f.loginCount(); got != 2 {
+				t.Errorf("got %d logins, want 2 after the session expired", got)
+			}
+			if got := f.count("GET blocked_services/get"); got != 2 {
+				t.Errorf("got %d requests, want the rejected one and its retry", got)
+			}
+		})
+	}
+}
+
+func TestRequestWithoutCredentials(t *testing.T) {
+	f, _ := newFakeAdGuard(t)
+	client, err := NewClientWithHTTPClient(f.URL, "", "", f.Client())
+	if err != nil {
+		t.Fatalf("NewClientWithHTTPClient: %v", err)
+	}
+
+	if _, err := client.GetBlockedServices(); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got error %v, want %v", err, ErrAuthFailed)
+	}
+	if got := f.count("POST login"); got != 0 {
+		t.Errorf("got %d login attempts, want none without credentials", got)
+	}
+}
+
+func TestUpdateErrorIncludesBody(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	f.mu.Lock()
+	f.updateError = `unknown blocked service "notaservice"`
+	f.mu.Unlock()
+
+	err := client.UpdateBlockedServices(&model.ServiceConfig{IDs: []string{"notaservice"}})
+	if err == nil {
+		t.Fatal("UpdateBlockedServices succeeded, want the 400 of the fake")
+	}
+	if !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), `unknown blocked service "notaservice"`) {
+		t.Errorf("got error %q, want the status and the body of the response", err)
+	}
+	if got := f.count("PUT blocked_services/update"); got != 1 {
+		t.Errorf("got %d updates, want a rejected update not to be retried", got)
+	}
+}
+
+func TestResetBlockedServicesSendsDefaultList(t *testing.T) {
+	tests := []struct {
+		name   string
+		envIDs string
+		want   []string
+	}{
+		{name: "builtin", want: builtinDefaultIDs},
+		{name: "env", envIDs: " roblox, youtube,,roblox ", want: []string{"roblox", "youtube"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, client := newFakeAdGuard(t)
+			t.Setenv("defaultBlockedServices", tt.envIDs)
+			t.Setenv("defaultTimeZone", "Europe/Berlin")
+
+			if err := client.ResetBlockedServices(); err != nil {
+				t.Fatalf("ResetBlockedServices: %v", err)
+			}
+			got := f.currentConfig()
+			if !slices.Equal(got.IDs, tt.want) {
+				t.Errorf("got IDs %v, want %v", got.IDs, tt.want)
+			}
+			if got.Schedule.TimeZone != "Europe/Berlin" {
+				t.Errorf("got time zone %q, want defaultTimeZone", got.Schedule.TimeZone)
+			}
+		})
+	}
+}
+
+func TestServiceConfigScheduleRoundTrip(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	want := model.ServiceConfig{
+		IDs: []string{"roblox", "youtube"},
+		Schedule: model.Schedule{
+			TimeZone: "America/Chicago",
+			Mon:      &model.DayRange{Start: 16 * 3600000, End: 18 * 3600000},
+			Sat:      &model.DayRange{Start: 0, End: dayMillis},
+		},
+	}
+
+	if err := client.UpdateBlockedServices(&want); err != nil {
+		t.Fatalf("UpdateBlockedServices: %v", err)
+	}
+	if got := f.currentConfig(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AdGuard got %+v, want %+v", got, want)
+	}
+	got, err := client.GetBlockedServices()
+	if err != nil {
+		t.Fatalf("GetBlockedServices: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v back, want %+v", got, want)
+	}
+
+	// Days without a window are left out, as AdGuard expects
+	encoded, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	const wantJSON = `{"ids":["roblox","youtube"],"schedule":{"time_zone":"America/Chicago","mon":{"start":57600000,"end":64800000},"sat":{"start":0,"end":86400000}}}`
+	if string(encoded) != wantJSON {
+		t.Errorf("got JSON %s, want %s", encoded, wantJSON)
+	}
+}
+
+func TestGetAllBlockedServices(t *testing.T) {
+	_, client := newFakeAdGuard(t)
+
+	services, err := client.GetAllBlockedServices()
+	if err != nil {
+		t.Fatalf("GetAllBlockedServices: %v", err)
+	}
+	ids := make([]string, 0, len(services))
+	for _, service := range services {
+		ids = append(ids, service.ID)
+	}
+	if want := []string{"youtube", "tiktok", "roblox"}; !slices.Equal(ids, want) {
+		t.Errorf("got services %v, want %v", ids, want)
+	}
+}
@@ -0,0 +1,140 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrClientNotFound is returned when no persistent client with the given name exists in AdGuard
+var ErrClientNotFound = errors.New("client not found")
+
+// GetClients retrieves the persistent clients configured in AdGuard
+func (c *Client) GetClients() ([]map[string]interface{}, error) {
+	// Create the GET request
+	req, err := c.newAdGuardRequest("GET", "clients", nil)
+	if err != nil {
+		logger.Error("[adguardapi][GetClients] Failed to create GET request")
+		logger.Error(err)
+		return nil, err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed)
+	resp, err := c.DoAuthenticatedRequest(req)
+	if err != nil {
+		logger.Error("[adguardapi][GetClients] Failed to get clients from: " + req.URL.String())
+		logger.Error(err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		logger.Error("[adguardapi][GetClients] Request failed with status: " + resp.Status)
+		return nil, errors.New("request failed with status: " + resp.Status)
+	}
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("[adguardapi][GetClients] Failed to read response body")
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Debug("[adguardapi][GetClients] Response body: " + string(body))
+
+	// Unmarshal JSON into ClientsResponse model
+	var clientsResp model.ClientsResponse
+	err = json.Unmarshal(body, &clientsResp)
+	if err != nil {
+		logger.Error("[adguardapi][GetClients] Failed to unmarshal JSON response")
+		logger.Error(err)
+		return nil, err
+	}
+
+	logger.Debug("[adguardapi][GetClients] Number of clients: ", len(clientsResp.Clients))
+
+	return clientsResp.Clients, nil
+}
+
+// SetClientBlockedServices sets the blocked services of a single named client instead of the global list.
+// The client stops using the global blocked services so the list takes effect.
+func (c *Client) SetClientBlockedServices(name string, ids []string) error {
+	logger.Info("[adguardapi][SetClientBlockedServices] Updating blocked services for client '" + name + "'")
+	logger.Debug("[adguardapi][SetClientBlockedServices] Service count: ", len(ids))
+
+	clients, err := c.GetClients()
+	if err != nil {
+		return err
+	}
+
+	// Find the client by name
+	var client map[string]interface{}
+	for _, c := range clients {
+		if clientName, _ := c["name"].(string); clientName == name {
+			client = c
+			break
+		}
+	}
+	if client == nil {
+		logger.Error("[adguardapi][SetClientBlockedServices] Client '" + name + "' not found")
+		return fmt.Errorf("%w: %s", ErrClientNotFound, name)
+	}
+
+	if ids == nil {
+		ids = []string{}
+	}
+	client["blocked_services"] = ids
+	client["use_global_blocked_services"] = false
+
+	// Marshal the ClientUpdateRequest to JSON
+	jsonData, err := json.Marshal(model.ClientUpdateRequest{
+		Name: name,
+		Data: client,
+	})
+	if err != nil {
+		logger.Error("[adguardapi][SetClientBlockedServices] Failed to marshal ClientUpdateRequest to JSON")
+		logger.Error(err)
+		return err
+	}
+	logger.Debug("[adguardapi][SetClientBlockedServices] Request body: " + string(jsonData))
+
+	// Create the POST request
+	req, err := c.newAdGuardRequest("POST", "clients/update", jsonData)
+	if err != nil {
+		logger.Error("[adguardapi][SetClientBlockedServices] Failed to create POST request")
+		logger.Error(err)
+		return err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed).
+	// The update replaces the whole client, so it is safe to retry.
+	resp, err := c.DoAuthenticatedRequestWithRetry(req, true)
+	if err != nil {
+		logger.Error("[adguardapi][SetClientBlockedServices] Failed to update client on: " + req.URL.String())
+		logger.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		logger.Error("[adguardapi][SetClientBlockedServices] Request failed with status: " + resp.Status)
+		logger.Error("[adguardapi][SetClientBlockedServices] Response body: " + string(body))
+		return errors.New("request failed with status: " + resp.Status)
+	}
+
+	logger.Info("[adguardapi][SetClientBlockedServices] Successfully updated blocked services for client '" + name + "'")
+	events.Publish(events.ClientUpdated, map[string]interface{}{
+		"client":        name,
+		"service_count": len(ids),
+	})
+	return nil
+}
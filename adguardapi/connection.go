@@ -0,0 +1,84 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// CheckConnection performs a fresh login against the client's AdGuard and reports diagnostics.
+// It uses a throwaway client so the main session is never replaced, even when the test fails.
+func (c *Client) CheckConnection() model.ConnectionCheck {
+	baseURL, username, password := c.credentials()
+	check := model.ConnectionCheck{
+		BaseURL: baseURL,
+	}
+	if !c.canReauthenticate() {
+		check.Error = ErrNoCredentials.Error()
+		return check
+	}
+
+	probe, err := NewClient(baseURL, username, password)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	probe.httpClient.Timeout = time.Duration(config.GetInt("testConnectionTimeoutSec", 10)) * time.Second
+
+	// Log in, timing the round trip
+	start := time.Now()
+	_, err = probe.login(baseURL, username, password)
+	check.ResponseTimeMs = time.Since(start).Milliseconds()
+
+	switch {
+	case errors.Is(err, ErrAdGuardUnreachable), errors.Is(err, ErrAdGuardTimeout):
+		check.Error = err.Error()
+		return check
+	case errors.Is(err, errNoCookies):
+		check.Reachable = true
+		check.Authenticated = true
+		check.Error = err.Error()
+		return check
+	case err != nil:
+		check.Reachable = true
+		check.Error = err.Error()
+		return check
+	}
+
+	check.Reachable = true
+	check.Authenticated = true
+	check.CookiesReceived = true
+
+	// Read the version with the new session
+	req, err := probe.newAdGuardRequest("GET", "status", nil)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+
+	resp, err := probe.httpClient.Do(req)
+	if err != nil {
+		logger.Warning("[adguardapi][CheckConnection] Logged in, but failed to read the AdGuard status")
+		check.Error = wrapTransportError(err).Error()
+		return check
+	}
+	defer resp.Body.Close()
+
+	var status model.AdGuardStatus
+	if resp.StatusCode != 200 || json.NewDecoder(resp.Body).Decode(&status) != nil {
+		logger.Warning("[adguardapi][CheckConnection] Logged in, but the AdGuard status could not be read: " + resp.Status)
+		check.Error = "failed to read AdGuard status: " + resp.Status
+		return check
+	}
+	if status.Version != nil {
+		check.Version = *status.Version
+		check.APIVersion = apiVersionFor(*status.Version)
+	}
+
+	logger.Info("[adguardapi][CheckConnection] Connection test succeeded, AdGuard version " + check.Version)
+	return check
+}
@@ -0,0 +1,247 @@
+package adguardapi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/welasco/adguardfilter/model"
+)
+
+// The package-level functions below call the matching Client method on the default client,
+// which is configured from authBaseURL, authUsername and authPassword
+
+// InitHTTPClient initializes the default client's HTTP client with a new cookie jar
+func InitHTTPClient() error {
+	return defaultClient.InitHTTPClient()
+}
+
+// Authenticate performs authentication against the API and stores the session cookie
+func Authenticate(baseURL, username, password string) error {
+	return defaultClient.Authenticate(baseURL, username, password)
+}
+
+// AuthenticateWithStoredCredentials authenticates with the credentials loaded from the environment
+func AuthenticateWithStoredCredentials() error {
+	return defaultClient.AuthenticateWithStoredCredentials()
+}
+
+// Reauthenticate forces a fresh login of the default client with its stored credentials
+func Reauthenticate() error {
+	return defaultClient.Reauthenticate()
+}
+
+// GetSessionExpiry returns when the current session cookie expires, and false when it is unknown
+func GetSessionExpiry() (time.Time, bool) {
+	return defaultClient.GetSessionExpiry()
+}
+
+// GetHTTPClient returns the default client's HTTP client with cookies
+func GetHTTPClient() (*http.Client, error) {
+	return defaultClient.GetHTTPClient()
+}
+
+// DoAuthenticatedRequest performs an HTTP request with automatic re-authentication on auth failures
+func DoAuthenticatedRequest(req *http.Request) (*http.Response, error) {
+	return defaultClient.DoAuthenticatedRequest(req)
+}
+
+// DoAuthenticatedRequestContext performs an authenticated HTTP request bound to ctx
+func DoAuthenticatedRequestContext(ctx context.Context, req *http.Request) (*http.Response, error) {
+	return defaultClient.DoAuthenticatedRequestContext(ctx, req)
+}
+
+// DoAuthenticatedRequestWithRetry performs an authenticated HTTP request, optionally retrying transient failures
+func DoAuthenticatedRequestWithRetry(req *http.Request, retryTransient bool) (*http.Response, error) {
+	return defaultClient.DoAuthenticatedRequestWithRetry(req, retryTransient)
+}
+
+// GetBlockedServices retrieves the blocked services configuration from the API
+func GetBlockedServices() (model.ServiceConfig, error) {
+	return defaultClient.GetBlockedServices()
+}
+
+// GetBlockedServicesContext retrieves the blocked services configuration, tracing the call as part of ctx
+func GetBlockedServicesContext(ctx context.Context) (model.ServiceConfig, error) {
+	return defaultClient.GetBlockedServicesContext(ctx)
+}
+
+// GetAllBlockedServices retrieves all available blocked services, cached for catalogCacheTTLSec seconds
+func GetAllBlockedServices() ([]model.BlockedService, error) {
+	return defaultClient.GetAllBlockedServices()
+}
+
+// RefreshServiceCatalog drops the cached catalog and fetches it again from the API
+func RefreshServiceCatalog() ([]model.BlockedService, error) {
+	return defaultClient.RefreshServiceCatalog()
+}
+
+// ResolveServiceNames maps service names to their catalog IDs with the default client
+func ResolveServiceNames(names []string, fuzzy bool) ([]model.ResolvedServiceName, []string, error) {
+	return defaultClient.ResolveServiceNames(names, fuzzy)
+}
+
+// UpdateBlockedServices updates the blocked services configuration via the API
+func UpdateBlockedServices(serviceConfig *model.ServiceConfig) error {
+	return defaultClient.UpdateBlockedServices(serviceConfig)
+}
+
+// UpdateBlockedServicesContext updates the blocked services configuration, tracing the call as part of ctx
+func UpdateBlockedServicesContext(ctx context.Context, serviceConfig *model.ServiceConfig) error {
+	return defaultClient.UpdateBlockedServicesContext(ctx, serviceConfig)
+}
+
+// UpdateTimeZone changes only the schedule time zone and returns the previous one
+func UpdateTimeZone(timeZone string) (string, error) {
+	return defaultClient.UpdateTimeZone(timeZone)
+}
+
+// GetManagedConfig returns the configuration in AdGuard with the disabled services it would block
+func GetManagedConfig() (model.ServiceConfig, error) {
+	return defaultClient.GetManagedConfig()
+}
+
+// PatchBlockedServices merges added and removed IDs and a time zone into the current configuration
+func PatchBlockedServices(add, remove []string, timeZone string) (model.ServiceConfig, error) {
+	return defaultClient.PatchBlockedServices(add, remove, timeZone)
+}
+
+// ServiceGroupIDs returns the IDs of the groups in the service catalog
+func ServiceGroupIDs() ([]string, error) {
+	return defaultClient.ServiceGroupIDs()
+}
+
+// BlockGroup blocks every service of a catalog group and returns the IDs that weren't blocked before
+func BlockGroup(group string) (model.GroupChange, error) {
+	return defaultClient.BlockGroup(group)
+}
+
+// UnblockGroup unblocks every service of a catalog group and returns the IDs that were blocked before
+func UnblockGroup(group string) (model.GroupChange, error) {
+	return defaultClient.UnblockGroup(group)
+}
+
+// BuildAllowlistConfig builds the configuration blocking every catalog service except the allowed ones
+func BuildAllowlistConfig(allowed []string) (model.ServiceConfig, []string, error) {
+	return defaultClient.BuildAllowlistConfig(allowed)
+}
+
+// ApplyAllowlist blocks every service of the catalog except the allowed ones
+func ApplyAllowlist(allowed []string) (model.ServiceConfig, error) {
+	return defaultClient.ApplyAllowlist(allowed)
+}
+
+// ResetBlockedServices resets all blocked services to the default list
+func ResetBlockedServices() error {
+	return defaultClient.ResetBlockedServices()
+}
+
+// ResetBlockedServicesContext resets all blocked services to the default list, tracing the call as part of ctx
+func ResetBlockedServicesContext(ctx context.Context) error {
+	return defaultClient.ResetBlockedServicesContext(ctx)
+}
+
+// ResetServiceIDs blocks the given default service IDs again, leaving every other service as it is
+func ResetServiceIDs(ids []string) error {
+	return defaultClient.ResetServiceIDs(ids)
+}
+
+// GetDisabledServices returns the services left out of every update, sorted by ID
+func GetDisabledServices() []model.DisabledService {
+	return defaultClient.GetDisabledServices()
+}
+
+// DisableService stops enforcing a catalog service without losing it from the managed configuration
+func DisableService(id string) (model.DisabledService, error) {
+	return defaultClient.DisableService(id)
+}
+
+// EnableService enforces a disabled service again
+func EnableService(id string) (model.DisabledService, error) {
+	return defaultClient.EnableService(id)
+}
+
+// EnforcedIDs returns ids without the disabled services
+func EnforcedIDs(ids []string) []string {
+	return defaultClient.EnforcedIDs(ids)
+}
+
+// GetSnapshots returns the configurations captured before each change, newest first
+func GetSnapshots() []model.ConfigSnapshot {
+	return defaultClient.GetSnapshots()
+}
+
+// RollbackConfig restores the newest snapshot and removes it
+func RollbackConfig() (model.ConfigSnapshot, error) {
+	return defaultClient.RollbackConfig()
+}
+
+// CheckDrift compares the configuration last applied by this service with the one currently in AdGuard
+func CheckDrift() (model.Drift, error) {
+	return defaultClient.CheckDrift()
+}
+
+// StartDriftMonitor checks the default client for drift in the background
+func StartDriftMonitor() {
+	defaultClient.StartDriftMonitor()
+}
+
+// CheckConnection performs a fresh login against the configured AdGuard and reports diagnostics
+func CheckConnection() model.ConnectionCheck {
+	return defaultClient.CheckConnection()
+}
+
+// GetStatus retrieves the AdGuard status (version, protection and running state, DNS addresses)
+func GetStatus() (model.AdGuardStatus, error) {
+	return defaultClient.GetStatus()
+}
+
+// SetProtection enables or disables AdGuard protection globally
+func SetProtection(enabled bool, durationMs int) error {
+	return defaultClient.SetProtection(enabled, durationMs)
+}
+
+// GetProtection retrieves the current protection state
+func GetProtection() (model.ProtectionStatus, error) {
+	return defaultClient.GetProtection()
+}
+
+// GetUserRules retrieves the custom user rules, in their original order
+func GetUserRules() ([]string, error) {
+	return defaultClient.GetUserRules()
+}
+
+// SetUserRules replaces the custom user rules
+func SetUserRules(rules []string) error {
+	return defaultClient.SetUserRules(rules)
+}
+
+// AddUserRule appends a custom user rule and returns the updated list
+func AddUserRule(rule string) ([]string, error) {
+	return defaultClient.AddUserRule(rule)
+}
+
+// RemoveUserRule removes a custom user rule and returns the updated list
+func RemoveUserRule(rule string) ([]string, error) {
+	return defaultClient.RemoveUserRule(rule)
+}
+
+// GetClients retrieves the persistent clients configured in AdGuard
+func GetClients() ([]map[string]interface{}, error) {
+	return defaultClient.GetClients()
+}
+
+// SetClientBlockedServices sets the blocked services of a single named client
+func SetClientBlockedServices(name string, ids []string) error {
+	return defaultClient.SetClientBlockedServices(name, ids)
+}
+
+// GetFilterStatus retrieves the filtering status, including the subscribed filter lists
+func GetFilterStatus() (model.FilteringStatus, error) {
+	return defaultClient.GetFilterStatus()
+}
+
+// SetFilterEnabled enables or disables the subscribed filter list with the given URL
+func SetFilterEnabled(url string, enabled bool) error {
+	return defaultClient.SetFilterEnabled(url, enabled)
+}
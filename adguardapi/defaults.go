@@ -0,0 +1,111 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrInvalidSchedule is returned when a schedule window is outside the day or ends before it starts
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// dayMillis is the length of a schedule day in milliseconds, the largest valid window end
+const dayMillis = int64(24 * time.Hour / time.Millisecond)
+
+// The parsed defaultsFile, read on first use and again by ReloadDefaultsFile, guarded by defaultsFileMu
+var (
+	defaultsFileConfig *model.ServiceConfig
+	defaultsFileLoaded bool
+	defaultsFileMu     sync.Mutex
+)
+
+// InvalidScheduleDays returns the days of the schedule whose window is outside 0-86400000 ms or doesn't
+// end after it starts, sorted by name
+func InvalidScheduleDays(schedule model.Schedule) []string {
+	var invalid []string
+	for day, window := range schedule.Days() {
+		if window != nil && (window.Start < 0 || window.End > dayMillis || window.Start >= window.End) {
+			invalid = append(invalid, day)
+		}
+	}
+	sort.Strings(invalid)
+	return invalid
+}
+
+// loadDefaultsFile returns the defaultsFile, a JSON configuration such as
+// {"ids": [...], "schedule": {"time_zone": "...", "sat": {"start": 0, "end": 86400000}}}, reading it on
+// first use. It returns nil when the file isn't set or is invalid, in which case the built-in defaults apply.
+func loadDefaultsFile() *model.ServiceConfig {
+	defaultsFileMu.Lock()
+	defer defaultsFileMu.Unlock()
+
+	if !defaultsFileLoaded {
+		defaultsFileConfig = readDefaultsFile()
+		defaultsFileLoaded = true
+	}
+	return defaultsFileConfig
+}
+
+// ReloadDefaultsFile reads the defaultsFile again, e.g. after it was edited or defaultsFile changed
+func ReloadDefaultsFile() {
+	defaultsFileMu.Lock()
+	defer defaultsFileMu.Unlock()
+
+	defaultsFileConfig = readDefaultsFile()
+	defaultsFileLoaded = true
+}
+
+// readDefaultsFile reads and validates the defaultsFile, returning nil when it isn't set or is invalid
+func readDefaultsFile() *model.ServiceConfig {
+	path := os.Getenv("defaultsFile")
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("[adguardapi][readDefaultsFile] Failed to read defaults file " + path + ", using the built-in defaults")
+		logger.Error(err)
+		return nil
+	}
+
+	var fileConfig model.ServiceConfig
+	if err := json.Unmarshal(data, &fileConfig); err != nil {
+		logger.Error("[adguardapi][readDefaultsFile] Failed to parse defaults file " + path + ", using the built-in defaults")
+		logger.Error(err)
+		return nil
+	}
+
+	if err := validateSchedule(fileConfig.Schedule); err != nil {
+		logger.Error("[adguardapi][readDefaultsFile] Defaults file " + path + " has an invalid schedule, using the built-in defaults")
+		logger.Error(err)
+		return nil
+	}
+	for i := range fileConfig.IDs {
+		fileConfig.IDs[i] = strings.TrimSpace(fileConfig.IDs[i])
+	}
+
+	logger.Info("[adguardapi][readDefaultsFile] Loaded defaults file " + path)
+	return &fileConfig
+}
+
+// validateSchedule checks the time zone and the daily windows of a schedule
+func validateSchedule(schedule model.Schedule) error {
+	if schedule.TimeZone != "" {
+		if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+			return fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, schedule.TimeZone)
+		}
+	}
+	if invalid := InvalidScheduleDays(schedule); len(invalid) > 0 {
+		return fmt.Errorf("%w: window of %s must have 0 <= start < end <= %d ms", ErrInvalidSchedule, strings.Join(invalid, ", "), dayMillis)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package adguardapi
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDefaultLayersPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		file       string // Contents of the defaultsFile, none when empty
+		envIDs     string
+		wantIDs    []string
+		wantSource string
+	}{
+		{name: "builtin", wantIDs: builtinDefaultIDs, wantSource: DefaultLayerBuiltin},
+		{name: "file over builtin", file: `{"ids": ["netflix", "steam"]}`, wantIDs: []string{"netflix", "steam"}, wantSource: DefaultLayerFile},
+		{name: "env over file", file: `{"ids": ["netflix"]}`, envIDs: "steam, roblox", wantIDs: []string{"steam", "roblox"}, wantSource: DefaultLayerEnv},
+		{name: "env over builtin", envIDs: "steam", wantIDs: []string{"steam"}, wantSource: DefaultLayerEnv},
+		{name: "empty file list", file: `{"ids": []}`, wantIDs: []string{}, wantSource: DefaultLayerFile},
+		{name: "unset file list", file: `{"schedule": {"time_zone": "UTC"}}`, wantIDs: builtinDefaultIDs, wantSource: DefaultLayerBuiltin},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Runs after the variables are restored, so the next test reads its own file
+			t.Cleanup(ReloadDefaultsFile)
+
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "defaults.json")
+				if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+			}
+			t.Setenv("defaultsFile", path)
+			t.Setenv("defaultBlockedServices", tt.envIDs)
+			ReloadDefaultsFile()
+
+			if got := BuildDefaultConfig().IDs; !slices.Equal(got, tt.wantIDs) {
+				t.Errorf("got IDs %v, want %v", got, tt.wantIDs)
+			}
+			if got := DefaultConfigSource(); got != tt.wantSource {
+				t.Errorf("got source %q, want %q", got, tt.wantSource)
+			}
+		})
+	}
+}
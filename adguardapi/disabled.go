@@ -0,0 +1,296 @@
+package adguardapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrServiceNotDisabled is returned by EnableService when the service isn't disabled
+var ErrServiceNotDisabled = errors.New("service is not disabled")
+
+// disabledServicesPath returns the file the disabled services are persisted to, from disabledServicesPath
+// (default disabled_services.json)
+func disabledServicesPath() string {
+	if path := os.Getenv("disabledServicesPath"); path != "" {
+		return path
+	}
+	return "disabled_services.json"
+}
+
+// GetDisabledServices returns the disabled services, sorted by ID
+func (c *Client) GetDisabledServices() []model.DisabledService {
+	c.disabledMu.Lock()
+	defer c.disabledMu.Unlock()
+
+	c.loadDisabled()
+	disabled := make([]model.DisabledService, 0, len(c.disabled))
+	for _, service := range c.disabled {
+		disabled = append(disabled, service)
+	}
+	sort.Slice(disabled, func(i, j int) bool { return disabled[i].ID < disabled[j].ID })
+	return disabled
+}
+
+// DisableService stops enforcing a catalog service without losing it from the managed configuration:
+// it is unblocked in AdGuard now and left out of every later update until EnableService is called
+func (c *Client) DisableService(id string) (model.DisabledService, error) {
+	if err := c.checkInCatalog(id); err != nil {
+		return model.DisabledService{}, err
+	}
+
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	managedConfig, err := c.getManagedConfig(context.Background())
+	if err != nil {
+		logger.Error("[adguardapi][DisableService] Failed to get current blocked services")
+		return model.DisabledService{}, err
+	}
+
+	c.disabledMu.Lock()
+	c.loadDisabled()
+	if existing, ok := c.disabled[id]; ok {
+		c.disabledMu.Unlock()
+		logger.Info("[adguardapi][DisableService] Service " + id + " is already disabled")
+		return existing, nil
+	}
+	service := model.DisabledService{
+		ID:         id,
+		InConfig:   containsID(managedConfig.IDs, id),
+		DisabledAt: time.Now().Format(time.RFC3339),
+	}
+	c.disabled[id] = service
+	c.saveDisabled()
+	c.disabledMu.Unlock()
+
+	// Only a blocked service needs AdGuard to change, the update leaves it out now that it is disabled
+	if service.InConfig {
+		if err := c.sendServiceConfig(context.Background(), &managedConfig); err != nil {
+			logger.Error("[adguardapi][DisableService] Failed to unblock service " + id + ", keeping it enabled")
+			c.disabledMu.Lock()
+			delete(c.disabled, id)
+			c.saveDisabled()
+			c.disabledMu.Unlock()
+			return model.DisabledService{}, err
+		}
+		events.Publish(events.ConfigUpdated, map[string]interface{}{
+			"service_count": len(managedConfig.IDs) - 1,
+			"time_zone":     managedConfig.Schedule.TimeZone,
+			"disabled":      id,
+		})
+	}
+
+	logger.Info("[adguardapi][DisableService] Disabled service " + id)
+	return service, nil
+}
+
+// EnableService enforces a disabled service again, blocking it in AdGuard when the managed configuration does
+func (c *Client) EnableService(id string) (model.DisabledService, error) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	c.disabledMu.Lock()
+	c.loadDisabled()
+	service, ok := c.disabled[id]
+	c.disabledMu.Unlock()
+	if !ok {
+		logger.Error("[adguardapi][EnableService] Service " + id + " is not disabled")
+		return model.DisabledService{}, fmt.Errorf("%w: %s", ErrServiceNotDisabled, id)
+	}
+
+	managedConfig, err := c.getManagedConfig(context.Background())
+	if err != nil {
+		logger.Error("[adguardapi][EnableService] Failed to get current blocked services")
+		return model.DisabledService{}, err
+	}
+
+	c.disabledMu.Lock()
+	delete(c.disabled, id)
+	c.saveDisabled()
+	c.disabledMu.Unlock()
+
+	if service.InConfig {
+		if err := c.sendServiceConfig(context.Background(), &managedConfig); err != nil {
+			logger.Error("[adguardapi][EnableService] Failed to block service " + id + " again, keeping it disabled")
+			c.disabledMu.Lock()
+			c.disabled[id] = service
+			c.saveDisabled()
+			c.disabledMu.Unlock()
+			return model.DisabledService{}, err
+		}
+		events.Publish(events.ConfigUpdated, map[string]interface{}{
+			"service_count": len(managedConfig.IDs),
+			"time_zone":     managedConfig.Schedule.TimeZone,
+			"enabled":       id,
+		})
+	}
+
+	logger.Info("[adguardapi][EnableService] Enabled service " + id)
+	return service, nil
+}
+
+// EnforcedIDs returns ids without the disabled services, the IDs an update with them sends to AdGuard
+func (c *Client) EnforcedIDs(ids []string) []string {
+	c.disabledMu.Lock()
+	defer c.disabledMu.Unlock()
+
+	c.loadDisabled()
+	enforced := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, disabled := c.disabled[id]; !disabled {
+			enforced = append(enforced, id)
+		}
+	}
+	return enforced
+}
+
+// checkInCatalog returns ErrUnknownServiceIDs when id is not a service of the catalog
+func (c *Client) checkInCatalog(id string) error {
+	catalog, err := c.GetAllBlockedServices()
+	if err != nil {
+		logger.Error("[adguardapi][checkInCatalog] Failed to get service catalog")
+		return err
+	}
+	for _, service := range catalog {
+		if service.ID == id {
+			return nil
+		}
+	}
+	logger.Error("[adguardapi][checkInCatalog] Unknown service ID: " + id)
+	return fmt.Errorf("%w: %s", ErrUnknownServiceIDs, id)
+}
+
+// GetManagedConfig returns the configuration in AdGuard with the disabled services it would block, the
+// configuration updates are computed from
+func (c *Client) GetManagedConfig() (model.ServiceConfig, error) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	return c.getManagedConfig(context.Background())
+}
+
+// getManagedConfig returns the configuration in AdGuard with the disabled services it would block added
+// back, the starting point of every read-modify-write. The caller must hold configMu.
+func (c *Client) getManagedConfig(ctx context.Context) (model.ServiceConfig, error) {
+	managedConfig, err := c.GetBlockedServicesContext(ctx)
+	if err != nil {
+		return model.ServiceConfig{}, err
+	}
+
+	c.disabledMu.Lock()
+	defer c.disabledMu.Unlock()
+
+	c.loadDisabled()
+	for id, service := range c.disabled {
+		if service.InConfig && !containsID(managedConfig.IDs, id) {
+			managedConfig.IDs = append(managedConfig.IDs, id)
+		}
+	}
+	return managedConfig, nil
+}
+
+// enforcedConfig returns the configuration to send to AdGuard, without the disabled services
+func (c *Client) enforcedConfig(serviceConfig *model.ServiceConfig) model.ServiceConfig {
+	enforced := model.ServiceConfig{
+		IDs:      c.EnforcedIDs(serviceConfig.IDs),
+		Schedule: serviceConfig.Schedule,
+	}
+	if left := len(serviceConfig.IDs) - len(enforced.IDs); left > 0 {
+		logger.Debug("[adguardapi][enforcedConfig] Left out ", left, " disabled service(s)")
+	}
+	return enforced
+}
+
+// recordDisabledInConfig records which disabled services the applied managed configuration blocks, so
+// enabling them blocks them again. The caller must hold configMu.
+func (c *Client) recordDisabledInConfig(serviceConfig *model.ServiceConfig) {
+	c.disabledMu.Lock()
+	defer c.disabledMu.Unlock()
+
+	c.loadDisabled()
+	changed := false
+	for id, service := range c.disabled {
+		if inConfig := containsID(serviceConfig.IDs, id); inConfig != service.InConfig {
+			service.InConfig = inConfig
+			c.disabled[id] = service
+			changed = true
+		}
+	}
+	if changed {
+		c.saveDisabled()
+	}
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []string, id string) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDisabled reads the disabled services file once, when disabledPath is set. The caller must hold disabledMu.
+func (c *Client) loadDisabled() {
+	if c.disabled == nil {
+		c.disabled = make(map[string]model.DisabledService)
+	}
+	if c.disabledLoaded || c.disabledPath == "" {
+		return
+	}
+	c.disabledLoaded = true
+
+	data, err := os.ReadFile(c.disabledPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("[adguardapi][loadDisabled] Failed to read disabled services file")
+			logger.Error(err)
+		}
+		return
+	}
+
+	var loaded []model.DisabledService
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		logger.Error("[adguardapi][loadDisabled] Failed to parse disabled services file")
+		logger.Error(err)
+		return
+	}
+	for _, service := range loaded {
+		c.disabled[service.ID] = service
+	}
+	logger.Info("[adguardapi][loadDisabled] Loaded ", len(loaded), " disabled service(s)")
+}
+
+// saveDisabled writes the disabled services file atomically, when disabledPath is set. The caller must hold disabledMu.
+func (c *Client) saveDisabled() {
+	if c.disabledPath == "" {
+		return
+	}
+
+	disabled := make([]model.DisabledService, 0, len(c.disabled))
+	for _, service := range c.disabled {
+		disabled = append(disabled, service)
+	}
+	sort.Slice(disabled, func(i, j int) bool { return disabled[i].ID < disabled[j].ID })
+
+	data, err := json.MarshalIndent(disabled, "", "  ")
+	if err == nil {
+		tmpPath := c.disabledPath + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, c.disabledPath)
+		}
+	}
+	if err != nil {
+		logger.Error("[adguardapi][saveDisabled] Failed to persist disabled services, they are kept in memory only")
+		logger.Error(err)
+	}
+}
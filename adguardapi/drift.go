@@ -0,0 +1,122 @@
+package adguardapi
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/servicelist"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// setLastApplied records the configuration that was just applied to AdGuard
+func (c *Client) setLastApplied(serviceConfig *model.ServiceConfig) {
+	c.lastAppliedMu.Lock()
+	defer c.lastAppliedMu.Unlock()
+
+	applied := *serviceConfig
+	applied.IDs = append([]string(nil), serviceConfig.IDs...)
+	c.lastApplied = &applied
+	c.lastAppliedAt = time.Now()
+}
+
+// CheckDrift compares the configuration last applied by this service with the one currently in AdGuard
+func (c *Client) CheckDrift() (model.Drift, error) {
+	c.lastAppliedMu.Lock()
+	var expected *model.ServiceConfig
+	if c.lastApplied != nil {
+		applied := *c.lastApplied
+		expected = &applied
+	}
+	appliedAt := c.lastAppliedAt
+	c.lastAppliedMu.Unlock()
+
+	drift := model.Drift{
+		Missing:   []string{},
+		Extra:     []string{},
+		CheckedAt: time.Now().Format(time.RFC3339),
+	}
+	if expected == nil {
+		return drift, nil
+	}
+
+	actual, err := c.GetBlockedServices()
+	if err != nil {
+		logger.Error("[adguardapi][CheckDrift] Failed to get current blocked services")
+		return model.Drift{}, err
+	}
+
+	drift.Known = true
+	drift.LastAppliedAt = appliedAt.Format(time.RFC3339)
+	drift.ExpectedTimeZone = expected.Schedule.TimeZone
+	drift.ActualTimeZone = actual.Schedule.TimeZone
+	drift.Extra, drift.Missing = servicelist.DiffServiceIDs(expected.IDs, actual.IDs)
+	drift.Drifted = len(drift.Missing) > 0 || len(drift.Extra) > 0 || drift.ExpectedTimeZone != drift.ActualTimeZone
+
+	return drift, nil
+}
+
+// StartDriftMonitor checks for drift every driftCheckIntervalSec seconds (default 300, 0 disables) in the
+// background, logging and notifying whenever AdGuard starts to diverge from the applied configuration
+func (c *Client) StartDriftMonitor() {
+	interval := time.Duration(config.GetInt("driftCheckIntervalSec", 300)) * time.Second
+	if interval <= 0 {
+		logger.Info("[adguardapi][StartDriftMonitor] Drift monitor disabled")
+		return
+	}
+
+	logger.Info("[adguardapi][StartDriftMonitor] Checking for drift every " + interval.String())
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// Only report a drift once, until it changes or is resolved
+		lastReported := ""
+		for range ticker.C {
+			drift, err := c.CheckDrift()
+			if err != nil {
+				logger.Warning("[adguardapi][StartDriftMonitor] Drift check failed, will retry at the next interval")
+				continue
+			}
+
+			if !drift.Drifted {
+				if lastReported != "" {
+					logger.Info("[adguardapi][StartDriftMonitor] AdGuard matches the applied configuration again")
+				}
+				lastReported = ""
+				continue
+			}
+
+			signature := driftSignature(drift)
+			if signature == lastReported {
+				continue
+			}
+			lastReported = signature
+
+			logger.Warning("[adguardapi][StartDriftMonitor] AdGuard configuration drifted: missing [" + strings.Join(drift.Missing, ", ") + "], extra [" + strings.Join(drift.Extra, ", ") + "], time zone '" + drift.ActualTimeZone + "' (expected '" + drift.ExpectedTimeZone + "')")
+
+			details := map[string]interface{}{
+				"missing":            drift.Missing,
+				"extra":              drift.Extra,
+				"expected_time_zone": drift.ExpectedTimeZone,
+				"actual_time_zone":   drift.ActualTimeZone,
+			}
+			notify.Notify(notify.EventDriftDetected, "Blocked services were changed outside of AdGuardFilter", details)
+			events.Publish(events.DriftDetected, details)
+		}
+	}()
+}
+
+// driftSignature identifies a drift so the same one isn't reported twice
+func driftSignature(drift model.Drift) string {
+	missing := append([]string(nil), drift.Missing...)
+	extra := append([]string(nil), drift.Extra...)
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return strings.Join(missing, ",") + "|" + strings.Join(extra, ",") + "|" + drift.ActualTimeZone
+}
@@ -0,0 +1,26 @@
+package adguardapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	// ErrAdGuardUnreachable is returned when AdGuard Home cannot be reached
+	ErrAdGuardUnreachable = errors.New("AdGuard Home unreachable")
+	// ErrAdGuardTimeout is returned when a request to AdGuard Home times out
+	ErrAdGuardTimeout = errors.New("AdGuard Home request timed out")
+	// ErrAuthFailed is returned when authenticating against AdGuard Home fails
+	ErrAuthFailed = errors.New("AdGuard Home authentication failed")
+)
+
+// wrapTransportError classifies an error returned by the HTTP client as a timeout or an unreachable AdGuard
+func wrapTransportError(err error) error {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return fmt.Errorf("%w: %w", ErrAdGuardTimeout, err)
+	}
+	return fmt.Errorf("%w: %w", ErrAdGuardUnreachable, err)
+}
@@ -0,0 +1,148 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrFilterNotFound is returned when no subscribed filter list has the given URL
+var ErrFilterNotFound = errors.New("filter not found")
+
+// GetFilterStatus retrieves the filtering status from /control/filtering/status, including the
+// subscribed filter lists and the custom user rules
+func (c *Client) GetFilterStatus() (model.FilteringStatus, error) {
+	// Create the GET request
+	req, err := c.newAdGuardRequest("GET", "filtering/status", nil)
+	if err != nil {
+		logger.Error("[adguardapi][GetFilterStatus] Failed to create GET request")
+		logger.Error(err)
+		return model.FilteringStatus{}, err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed)
+	resp, err := c.DoAuthenticatedRequest(req)
+	if err != nil {
+		logger.Error("[adguardapi][GetFilterStatus] Failed to get filtering status from: " + req.URL.String())
+		logger.Error(err)
+		return model.FilteringStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		logger.Error("[adguardapi][GetFilterStatus] Request failed with status: " + resp.Status)
+		return model.FilteringStatus{}, errors.New("request failed with status: " + resp.Status)
+	}
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("[adguardapi][GetFilterStatus] Failed to read response body")
+		logger.Error(err)
+		return model.FilteringStatus{}, err
+	}
+
+	logger.Debug("[adguardapi][GetFilterStatus] Response body: " + string(body))
+
+	// Unmarshal JSON into FilteringStatus model
+	var filteringStatus model.FilteringStatus
+	err = json.Unmarshal(body, &filteringStatus)
+	if err != nil {
+		logger.Error("[adguardapi][GetFilterStatus] Failed to unmarshal JSON response")
+		logger.Error(err)
+		return model.FilteringStatus{}, err
+	}
+
+	if filteringStatus.Filters == nil {
+		filteringStatus.Filters = []model.Filter{}
+	}
+	if filteringStatus.WhitelistFilters == nil {
+		filteringStatus.WhitelistFilters = []model.Filter{}
+	}
+
+	logger.Debug("[adguardapi][GetFilterStatus] Number of filters: ", len(filteringStatus.Filters))
+
+	return filteringStatus, nil
+}
+
+// SetFilterEnabled enables or disables the subscribed filter list (blocklist or allowlist) with the
+// given URL via /control/filtering/set_url, keeping its name and URL
+func (c *Client) SetFilterEnabled(url string, enabled bool) error {
+	logger.Info("[adguardapi][SetFilterEnabled] Setting filter '" + url + "' enabled state")
+
+	filteringStatus, err := c.GetFilterStatus()
+	if err != nil {
+		return err
+	}
+
+	// set_url replaces the filter settings, so send back its current name
+	var setURLRequest *model.SetFilterURLRequest
+	for _, filter := range filteringStatus.Filters {
+		if filter.URL == url {
+			setURLRequest = &model.SetFilterURLRequest{URL: url, Whitelist: false}
+			setURLRequest.Data = model.FilterURLData{Name: filter.Name, URL: url, Enabled: enabled}
+			break
+		}
+	}
+	if setURLRequest == nil {
+		for _, filter := range filteringStatus.WhitelistFilters {
+			if filter.URL == url {
+				setURLRequest = &model.SetFilterURLRequest{URL: url, Whitelist: true}
+				setURLRequest.Data = model.FilterURLData{Name: filter.Name, URL: url, Enabled: enabled}
+				break
+			}
+		}
+	}
+	if setURLRequest == nil {
+		logger.Error("[adguardapi][SetFilterEnabled] Filter '" + url + "' not found")
+		return ErrFilterNotFound
+	}
+
+	// Marshal the request to JSON
+	jsonData, err := json.Marshal(setURLRequest)
+	if err != nil {
+		logger.Error("[adguardapi][SetFilterEnabled] Failed to marshal request to JSON")
+		logger.Error(err)
+		return err
+	}
+	logger.Debug("[adguardapi][SetFilterEnabled] Request body: " + string(jsonData))
+
+	// Create the POST request
+	req, err := c.newAdGuardRequest("POST", "filtering/set_url", jsonData)
+	if err != nil {
+		logger.Error("[adguardapi][SetFilterEnabled] Failed to create POST request")
+		logger.Error(err)
+		return err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed).
+	// The request replaces the filter settings, so it is safe to retry.
+	resp, err := c.DoAuthenticatedRequestWithRetry(req, true)
+	if err != nil {
+		logger.Error("[adguardapi][SetFilterEnabled] Failed to update filter on: " + req.URL.String())
+		logger.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		logger.Error("[adguardapi][SetFilterEnabled] Request failed with status: " + resp.Status)
+		logger.Error("[adguardapi][SetFilterEnabled] Response body: " + string(body))
+		return errors.New("request failed with status: " + resp.Status)
+	}
+
+	logger.Info("[adguardapi][SetFilterEnabled] Successfully updated filter '" + url + "'")
+	events.Publish(events.FilterUpdated, map[string]interface{}{
+		"url":       url,
+		"enabled":   enabled,
+		"whitelist": setURLRequest.Whitelist,
+	})
+	return nil
+}
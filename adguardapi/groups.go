@@ -0,0 +1,96 @@
+package adguardapi
+
+import (
+	"errors"
+	"fmt"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/servicelist"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrUnknownGroup is returned when a service group is not in the catalog
+var ErrUnknownGroup = errors.New("unknown service group")
+
+// ServiceGroupIDs returns the IDs of the groups in the catalog, in the order of GET /api/v1/getservicelist
+func (c *Client) ServiceGroupIDs() ([]string, error) {
+	catalog, err := c.GetAllBlockedServices()
+	if err != nil {
+		logger.Error("[adguardapi][ServiceGroupIDs] Failed to get service catalog")
+		return nil, err
+	}
+
+	groups := servicelist.GroupServices(catalog)
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	return ids, nil
+}
+
+// groupMembers returns the service IDs of a catalog group, grouped like GET /api/v1/getservicelist
+func (c *Client) groupMembers(group string) ([]string, error) {
+	catalog, err := c.GetAllBlockedServices()
+	if err != nil {
+		logger.Error("[adguardapi][groupMembers] Failed to get service catalog")
+		return nil, err
+	}
+
+	for _, category := range servicelist.GroupServices(catalog) {
+		if category.ID == group {
+			ids := make([]string, 0, len(category.Services))
+			for _, service := range category.Services {
+				ids = append(ids, service.ID)
+			}
+			return ids, nil
+		}
+	}
+	logger.Error("[adguardapi][groupMembers] Unknown service group: " + group)
+	return nil, fmt.Errorf("%w: %s", ErrUnknownGroup, group)
+}
+
+// BlockGroup blocks every service of a catalog group, e.g. social_network, and returns the IDs that
+// weren't blocked before
+func (c *Client) BlockGroup(group string) (model.GroupChange, error) {
+	return c.changeGroup(group, true)
+}
+
+// UnblockGroup unblocks every service of a catalog group and returns the IDs that were blocked before
+func (c *Client) UnblockGroup(group string) (model.GroupChange, error) {
+	return c.changeGroup(group, false)
+}
+
+// changeGroup adds or removes all members of a group in a single read-modify-write
+func (c *Client) changeGroup(group string, block bool) (model.GroupChange, error) {
+	members, err := c.groupMembers(group)
+	if err != nil {
+		return model.GroupChange{}, err
+	}
+
+	var add, remove []string
+	if block {
+		add = members
+	} else {
+		remove = members
+	}
+	previousIDs, patchedConfig, err := c.patchBlockedServices(add, remove, "")
+	if err != nil {
+		logger.Error("[adguardapi][changeGroup] Failed to change service group " + group)
+		return model.GroupChange{}, err
+	}
+
+	added, removed := servicelist.DiffServiceIDs(previousIDs, patchedConfig.IDs)
+	affected := added
+	if !block {
+		affected = removed
+	}
+	logger.Info("[adguardapi][changeGroup] Group "+group+" changed, affecting ", len(affected), " of ", len(members), " service(s)")
+
+	return model.GroupChange{
+		Group:        group,
+		Blocked:      block,
+		Members:      members,
+		Affected:     affected,
+		ServiceCount: len(patchedConfig.IDs),
+	}, nil
+}
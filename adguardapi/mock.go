@@ -0,0 +1,248 @@
+package adguardapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/servicelist"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// mockBaseURL is the base URL of the default client in mock mode when authBaseURL isn't set
+const mockBaseURL = "http://adguard.mock"
+
+// mockVersion is the AdGuard version the mock reports, recent enough for the current blocked services API
+const mockVersion = "v0.107.52"
+
+// MockEnabled reports whether adguardMock is set, i.e. every request meant for AdGuard is answered by an
+// in-memory fake instead, to develop the frontend or try the API without an AdGuard instance
+func MockEnabled() bool {
+	return config.GetBool("adguardMock", false)
+}
+
+// NewMockClient creates a client for an in-memory fake AdGuard Home of its own, starting from the default
+// configuration, regardless of adguardMock
+func NewMockClient() (*Client, error) {
+	return NewClientWithHTTPClient(mockBaseURL, "", "", &http.Client{Transport: newMockAdGuard()})
+}
+
+// mockAdGuard is an in-memory AdGuard Home answering the endpoints this package uses. Its state starts
+// from the default configuration and lives until the process exits.
+type mockAdGuard struct {
+	mu                sync.Mutex
+	blockedServices   model.ServiceConfig
+	clients           []map[string]interface{}
+	filtering         model.FilteringStatus
+	protectionEnabled bool
+	protectionUntil   time.Time
+}
+
+var (
+	mockInstance     *mockAdGuard
+	mockInstanceOnce sync.Once
+)
+
+// sharedMock returns the fake AdGuard shared by every client in mock mode, so their changes are consistent
+func sharedMock() *mockAdGuard {
+	mockInstanceOnce.Do(func() {
+		logger.Warning("[adguardapi_mock][sharedMock] adguardMock is set, AdGuard requests are answered by an in-memory fake")
+		mockInstance = newMockAdGuard()
+	})
+	return mockInstance
+}
+
+// newMockAdGuard creates a fake AdGuard with the default configuration, one persistent client and one blocklist
+func newMockAdGuard() *mockAdGuard {
+	return &mockAdGuard{
+		blockedServices: BuildDefaultConfig(),
+		clients: []map[string]interface{}{
+			{
+				"name":                        "kids-tablet",
+				"ids":                         []string{"192.168.1.50"},
+				"use_global_blocked_services": true,
+				"blocked_services":            []string{},
+			},
+		},
+		filtering: model.FilteringStatus{
+			Enabled:  true,
+			Interval: 24,
+			Filters: []model.Filter{
+				{ID: 1, URL: "https://adguardteam.github.io/HostlistsRegistry/assets/filter_1.txt", Name: "AdGuard DNS filter", RulesCount: 50000, Enabled: true},
+			},
+			WhitelistFilters: []model.Filter{},
+			UserRules:        []string{},
+		},
+		protectionEnabled: true,
+	}
+}
+
+// RoundTrip answers req like AdGuard Home would
+func (m *mockAdGuard) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	logger.Debug("[adguardapi_mock][RoundTrip] " + req.Method + " " + req.URL.Path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	endpoint := strings.TrimPrefix(strings.TrimSuffix(req.URL.Path, "/"), ControlPath(""))
+	switch req.Method + " " + endpoint {
+	case "POST login":
+		resp := m.respond(req, http.StatusOK, "OK")
+		resp.Header.Add("Set-Cookie", (&http.Cookie{
+			Name:    "agh_session",
+			Value:   "mock",
+			Path:    "/",
+			Expires: time.Now().Add(30 * 24 * time.Hour),
+		}).String())
+		return resp, nil
+	case "GET status":
+		return m.respondJSON(req, m.status())
+	case "POST protection":
+		var protection model.ProtectionConfig
+		if err := json.Unmarshal(body, &protection); err != nil {
+			return m.respond(req, http.StatusBadRequest, err.Error()), nil
+		}
+		m.protectionEnabled = protection.Enabled
+		m.protectionUntil = time.Time{}
+		if !protection.Enabled && protection.Duration > 0 {
+			m.protectionUntil = time.Now().Add(time.Duration(protection.Duration) * time.Millisecond)
+		}
+		return m.respond(req, http.StatusOK, "OK"), nil
+	case "GET blocked_services/all":
+		return m.respondJSON(req, model.AllBlockedServicesResponse{
+			BlockedServices: servicelist.GetBlockedServices(),
+			Groups:          servicelist.GetServiceGroups(),
+		})
+	case "GET blocked_services/get":
+		return m.respondJSON(req, m.blockedServices)
+	case "PUT blocked_services/update":
+		var serviceConfig model.ServiceConfig
+		if err := json.Unmarshal(body, &serviceConfig); err != nil {
+			return m.respond(req, http.StatusBadRequest, err.Error()), nil
+		}
+		if serviceConfig.IDs == nil {
+			serviceConfig.IDs = []string{}
+		}
+		m.blockedServices = serviceConfig
+		return m.respond(req, http.StatusOK, ""), nil
+	case "GET blocked_services/list":
+		return m.respondJSON(req, m.blockedServices.IDs)
+	case "POST blocked_services/set":
+		var ids []string
+		if err := json.Unmarshal(body, &ids); err != nil {
+			return m.respond(req, http.StatusBadRequest, err.Error()), nil
+		}
+		m.blockedServices.IDs = append([]string{}, ids...)
+		return m.respond(req, http.StatusOK, "OK"), nil
+	case "GET clients":
+		return m.respondJSON(req, model.ClientsResponse{Clients: m.clients})
+	case "POST clients/update":
+		var update model.ClientUpdateRequest
+		if err := json.Unmarshal(body, &update); err != nil {
+			return m.respond(req, http.StatusBadRequest, err.Error()), nil
+		}
+		for i, client := range m.clients {
+			if client["name"] == update.Name {
+				m.clients[i] = update.Data
+				return m.respond(req, http.StatusOK, "OK"), nil
+			}
+		}
+		return m.respond(req, http.StatusBadRequest, "client not found"), nil
+	case "GET filtering/status":
+		return m.respondJSON(req, m.filtering)
+	case "POST filtering/set_url":
+		var setURL model.SetFilterURLRequest
+		if err := json.Unmarshal(body, &setURL); err != nil {
+			return m.respond(req, http.StatusBadRequest, err.Error()), nil
+		}
+		filters := m.filtering.Filters
+		if setURL.Whitelist {
+			filters = m.filtering.WhitelistFilters
+		}
+		for i := range filters {
+			if filters[i].URL == setURL.URL {
+				filters[i].Name = setURL.Data.Name
+				filters[i].URL = setURL.Data.URL
+				filters[i].Enabled = setURL.Data.Enabled
+				return m.respond(req, http.StatusOK, "OK"), nil
+			}
+		}
+		return m.respond(req, http.StatusBadRequest, "filter not found"), nil
+	case "POST filtering/set_rules":
+		var rules model.SetRulesRequest
+		if err := json.Unmarshal(body, &rules); err != nil {
+			return m.respond(req, http.StatusBadRequest, err.Error()), nil
+		}
+		m.filtering.UserRules = append([]string{}, rules.Rules...)
+		return m.respond(req, http.StatusOK, "OK"), nil
+	}
+
+	logger.Warning("[adguardapi_mock][RoundTrip] No mock for " + req.Method + " " + req.URL.Path)
+	return m.respond(req, http.StatusNotFound, "404 page not found"), nil
+}
+
+// status returns the mock's /control/status, re-enabling protection once a pause has ended
+func (m *mockAdGuard) status() model.AdGuardStatus {
+	if !m.protectionUntil.IsZero() && time.Now().After(m.protectionUntil) {
+		m.protectionEnabled = true
+		m.protectionUntil = time.Time{}
+	}
+
+	version := mockVersion
+	running := true
+	protectionEnabled := m.protectionEnabled
+	status := model.AdGuardStatus{
+		Version:           &version,
+		DNSAddresses:      []string{"127.0.0.1"},
+		ProtectionEnabled: &protectionEnabled,
+		Running:           &running,
+	}
+	if !m.protectionUntil.IsZero() {
+		remaining := time.Until(m.protectionUntil).Milliseconds()
+		status.ProtectionDisabledDuration = &remaining
+	}
+	return status
+}
+
+// respondJSON answers req with value encoded as JSON
+func (m *mockAdGuard) respondJSON(req *http.Request, value interface{}) (*http.Response, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	resp := m.respond(req, http.StatusOK, string(encoded))
+	resp.Header.Set("Content-Type", "application/json")
+	return resp, nil
+}
+
+// respond answers req with status and a plain text body
+func (m *mockAdGuard) respond(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
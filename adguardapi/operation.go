@@ -0,0 +1,65 @@
+package adguardapi
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// ErrOperationInProgress is returned by BeginOperation when another operation didn't finish in time
+var ErrOperationInProgress = errors.New("another blocked services operation is in progress")
+
+var (
+	// operationLock serializes whole operations on the blocked services, e.g. a timer reset with its retries
+	// or an update together with its reset timer. configMu only covers a single write. It is a channel
+	// so waiting for it can time out.
+	operationLock = make(chan struct{}, 1)
+
+	// currentOperation names the operation holding operationLock, for the in-progress error
+	currentOperation   string
+	currentOperationMu sync.Mutex
+)
+
+// BeginOperation waits up to timeout for the running operation to finish and returns the function ending
+// this one. It returns ErrOperationInProgress and the name of the running operation when the wait times out.
+func BeginOperation(name string, timeout time.Duration) (func(), string, error) {
+	select {
+	case operationLock <- struct{}{}:
+		return startOperation(name), "", nil
+	case <-time.After(timeout):
+		currentOperationMu.Lock()
+		running := currentOperation
+		currentOperationMu.Unlock()
+
+		logger.Warning("[adguardapi][BeginOperation] Rejected " + name + " while " + running + " is in progress")
+		return nil, running, ErrOperationInProgress
+	}
+}
+
+// WaitOperation waits for the running operation to finish, however long it takes, and returns the function
+// ending this one. Resets use it since they must never be dropped.
+func WaitOperation(name string) func() {
+	operationLock <- struct{}{}
+	return startOperation(name)
+}
+
+// startOperation records the operation that acquired operationLock and returns the function releasing it
+func startOperation(name string) func() {
+	currentOperationMu.Lock()
+	currentOperation = name
+	currentOperationMu.Unlock()
+	logger.Debug("[adguardapi][startOperation] Started " + name)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			currentOperationMu.Lock()
+			currentOperation = ""
+			currentOperationMu.Unlock()
+			<-operationLock
+			logger.Debug("[adguardapi][startOperation] Finished " + name)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// SetProtection globally enables or disables AdGuard filtering. When disabling, a durationMs greater
+// than 0 makes AdGuard re-enable protection on its own after that many milliseconds.
+func (c *Client) SetProtection(enabled bool, durationMs int) error {
+	logger.Info("[adguardapi][SetProtection] Setting protection enabled: ", enabled, ", duration ms: ", durationMs)
+
+	// Marshal the ProtectionConfig to JSON
+	jsonData, err := json.Marshal(model.ProtectionConfig{
+		Enabled:  enabled,
+		Duration: durationMs,
+	})
+	if err != nil {
+		logger.Error("[adguardapi][SetProtection] Failed to marshal ProtectionConfig to JSON")
+		logger.Error(err)
+		return err
+	}
+	logger.Debug("[adguardapi][SetProtection] Request body: " + string(jsonData))
+
+	// Create the POST request
+	req, err := c.newAdGuardRequest("POST", "protection", jsonData)
+	if err != nil {
+		logger.Error("[adguardapi][SetProtection] Failed to create POST request")
+		logger.Error(err)
+		return err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed).
+	// Setting the protection state is idempotent, so it is safe to retry.
+	resp, err := c.DoAuthenticatedRequestWithRetry(req, true)
+	if err != nil {
+		logger.Error("[adguardapi][SetProtection] Failed to set protection on: " + req.URL.String())
+		logger.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		logger.Error("[adguardapi][SetProtection] Request failed with status: " + resp.Status)
+		logger.Error("[adguardapi][SetProtection] Response body: " + string(body))
+		return errors.New("request failed with status: " + resp.Status)
+	}
+
+	logger.Info("[adguardapi][SetProtection] Successfully set protection state")
+	events.Publish(events.ProtectionChanged, map[string]interface{}{
+		"enabled":     enabled,
+		"duration_ms": durationMs,
+	})
+	return nil
+}
+
+// GetProtection retrieves the current protection state from /control/status
+func (c *Client) GetProtection() (model.ProtectionStatus, error) {
+	status, err := c.GetStatus()
+	if err != nil {
+		logger.Error("[adguardapi][GetProtection] Failed to get protection state")
+		return model.ProtectionStatus{}, err
+	}
+
+	var protectionStatus model.ProtectionStatus
+	if status.ProtectionEnabled != nil {
+		protectionStatus.ProtectionEnabled = *status.ProtectionEnabled
+	}
+	if status.ProtectionDisabledDuration != nil {
+		protectionStatus.ProtectionDisabledDuration = *status.ProtectionDisabledDuration
+	}
+
+	logger.Debug("[adguardapi][GetProtection] Protection enabled: ", protectionStatus.ProtectionEnabled)
+
+	return protectionStatus, nil
+}
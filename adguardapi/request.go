@@ -0,0 +1,94 @@
+package adguardapi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/version"
+)
+
+// defaultUserAgent identifies this service and its version to AdGuard when userAgent is not set
+var defaultUserAgent = "adguardfilter/" + version.Version()
+
+// ControlPath returns the path of an AdGuard control API endpoint, e.g. "status" or "blocked_services/get",
+// under adguardControlPath (default /control), for AdGuard served under a rewritten path by a proxy
+func ControlPath(endpoint string) string {
+	prefix := strings.TrimSuffix(os.Getenv("adguardControlPath"), "/")
+	if prefix == "" {
+		prefix = "/control"
+	} else if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return prefix + "/" + strings.TrimPrefix(endpoint, "/")
+}
+
+// newAdGuardRequest builds a request to an endpoint of the client's AdGuard control API, e.g. "status"
+func (c *Client) newAdGuardRequest(method, endpoint string, body []byte) (*http.Request, error) {
+	return c.newAdGuardRequestContext(context.Background(), method, endpoint, body)
+}
+
+// newAdGuardRequestContext builds a request to an endpoint of the client's AdGuard control API carrying ctx,
+// whose trace the request joins
+func (c *Client) newAdGuardRequestContext(ctx context.Context, method, endpoint string, body []byte) (*http.Request, error) {
+	req, err := newRequest(c.BaseURL(), method, ControlPath(endpoint), body)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// newRequest builds a request to an AdGuard instance with the headers shared by every call: Accept,
+// Content-Type for a JSON body, the userAgent and any adguardExtraHeaders
+func newRequest(baseURL, method, path string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json, text/plain, */*")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	userAgent := os.Getenv("userAgent")
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	for name, value := range extraHeaders() {
+		req.Header.Set(name, value)
+	}
+
+	return req, nil
+}
+
+// extraHeaders parses adguardExtraHeaders, a semicolon-separated list of "Name: value" pairs
+func extraHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(os.Getenv("adguardExtraHeaders"), ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		name, value, found := strings.Cut(pair, ":")
+		if !found || strings.TrimSpace(name) == "" {
+			logger.Warning("[adguardapi][extraHeaders] Ignoring malformed header in adguardExtraHeaders, expected 'Name: value'")
+			continue
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		logger.Debug("[adguardapi][extraHeaders] Adding header " + name + ": " + logger.RedactHeader(name, value))
+		headers[name] = value
+	}
+	return headers
+}
@@ -0,0 +1,78 @@
+package adguardapi
+
+import "testing"
+
+func TestControlPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		controlPath string
+		endpoint    string
+		want        string
+	}{
+		{name: "default", endpoint: "status", want: "/control/status"},
+		{name: "default nested", endpoint: "blocked_services/get", want: "/control/blocked_services/get"},
+		{name: "custom", controlPath: "/adguard/control", endpoint: "status", want: "/adguard/control/status"},
+		{name: "custom with trailing slash", controlPath: "/adguard/control/", endpoint: "status", want: "/adguard/control/status"},
+		{name: "custom without leading slash", controlPath: "adguard/control", endpoint: "status", want: "/adguard/control/status"},
+		{name: "endpoint with leading slash", controlPath: "/adguard/control/", endpoint: "/blocked_services/update", want: "/adguard/control/blocked_services/update"},
+		{name: "prefix only", controlPath: "/adguard/control", endpoint: "", want: "/adguard/control/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("adguardControlPath", tt.controlPath)
+			if got := ControlPath(tt.endpoint); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientUsesControlPath(t *testing.T) {
+	for _, controlPath := range []string{"/adguard/control", "/adguard/control/"} {
+		t.Run(controlPath, func(t *testing.T) {
+			// The fake serves the endpoints under ControlPath, so it answers 404 anywhere else
+			t.Setenv("adguardControlPath", controlPath)
+			f, client := newFakeAdGuard(t)
+
+			if _, err := client.GetBlockedServices(); err != nil {
+				t.Fatalf("GetBlockedServices: %v", err)
+			}
+			if got := f.count("GET blocked_services/get"); got != 2 {
+				t.Errorf("got %d requests under %s, want the 401 and its retry", got, ControlPath(""))
+			}
+
+			req, err := client.newAdGuardRequest("GET", "status", nil)
+			if err != nil {
+				t.Fatalf("newAdGuardRequest: %v", err)
+			}
+			if want := f.URL + "/adguard/control/status"; req.URL.String() != want {
+				t.Errorf("got URL %s, want %s", req.URL, want)
+			}
+		})
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: "adguardfilter/dev"},
+		{name: "custom", userAgent: "family-filter/1.0", want: "family-filter/1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, client := newFakeAdGuard(t)
+			t.Setenv("userAgent", tt.userAgent)
+
+			req, err := client.newAdGuardRequest("GET", "status", nil)
+			if err != nil {
+				t.Fatalf("newAdGuardRequest: %v", err)
+			}
+			if got := req.Header.Get("User-Agent"); got != tt.want {
+				t.Errorf("got User-Agent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package adguardapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientFailuresThenSucceed(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("httpRetryMax", "3")
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	f.mu.Lock()
+	f.failures = 2
+	f.mu.Unlock()
+
+	serviceConfig, err := client.GetBlockedServices()
+	if err != nil {
+		t.Fatalf("GetBlockedServices: %v", err)
+	}
+	if len(serviceConfig.IDs) != 2 {
+		t.Errorf("got IDs %v, want the 2 of the fake", serviceConfig.IDs)
+	}
+	if got := f.count("GET blocked_services/get"); got != 3 {
+		t.Errorf("got %d requests, want 2 failures and 1 success", got)
+	}
+}
+
+func TestRetryGivesUpAfterMaxRetries(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("httpRetryMax", "2")
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	f.mu.Lock()
+	f.failures = 10
+	f.mu.Unlock()
+
+	if _, err := client.GetBlockedServices(); err == nil {
+		t.Fatal("GetBlockedServices succeeded, want the 503 after the retries")
+	}
+	if got := f.count("GET blocked_services/get"); got != 3 {
+		t.Errorf("got %d requests, want 1 attempt and 2 retries", got)
+	}
+}
+
+func TestRetrySkipsNonIdempotentRequests(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("httpRetryMax", "3")
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	f.mu.Lock()
+	f.failures = 1
+	f.mu.Unlock()
+
+	req, err := client.newAdGuardRequest("POST", "blocked_services/set", []byte("[]"))
+	if err != nil {
+		t.Fatalf("newAdGuardRequest: %v", err)
+	}
+	resp, err := client.DoAuthenticatedRequest(req)
+	if err != nil {
+		t.Fatalf("DoAuthenticatedRequest: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, want the 503 without a retry", resp.StatusCode)
+	}
+	if got := f.count("POST blocked_services/set"); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestRetryStopsWhenContextCancelled(t *testing.T) {
+	f, client := newFakeAdGuard(t)
+	t.Setenv("httpRetryMax", "3")
+	t.Setenv("httpRetryBaseMs", "10000")
+	if err := client.Authenticate(f.URL, testUsername, testPassword); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	f.mu.Lock()
+	f.failures = 10
+	f.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetBlockedServicesContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %s, want it to stop waiting for the backoff once cancelled", elapsed)
+	}
+	if got := f.count("GET blocked_services/get"); got != 1 {
+		t.Errorf("got %d requests, want no retry after the cancellation", got)
+	}
+}
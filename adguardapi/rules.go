@@ -0,0 +1,170 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+var (
+	// ErrInvalidRule is returned when a rule is malformed or AdGuard rejects it
+	ErrInvalidRule = errors.New("invalid rule")
+	// ErrRuleNotFound is returned when removing a rule that is not in the list
+	ErrRuleNotFound = errors.New("rule not found")
+)
+
+// GetUserRules retrieves the custom user rules from /control/filtering/status, in their original order
+func (c *Client) GetUserRules() ([]string, error) {
+	filteringStatus, err := c.GetFilterStatus()
+	if err != nil {
+		logger.Error("[adguardapi][GetUserRules] Failed to get user rules")
+		return nil, err
+	}
+
+	if filteringStatus.UserRules == nil {
+		filteringStatus.UserRules = []string{}
+	}
+
+	logger.Debug("[adguardapi][GetUserRules] Number of user rules: ", len(filteringStatus.UserRules))
+
+	return filteringStatus.UserRules, nil
+}
+
+// SetUserRules replaces the custom user rules. Comments and empty lines are kept as they are.
+func (c *Client) SetUserRules(rules []string) error {
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	return c.setUserRules(rules)
+}
+
+// AddUserRule appends a rule to the custom user rules and returns the resulting list.
+// Adding a rule that is already present leaves the list unchanged.
+func (c *Client) AddUserRule(rule string) ([]string, error) {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return nil, fmt.Errorf("%w: rule must not be empty", ErrInvalidRule)
+	}
+
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	rules, err := c.GetUserRules()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range rules {
+		if existing == rule {
+			logger.Info("[adguardapi][AddUserRule] Rule already present: " + rule)
+			return rules, nil
+		}
+	}
+
+	rules = append(rules, rule)
+	if err := c.setUserRules(rules); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// RemoveUserRule removes every occurrence of a rule from the custom user rules and returns the resulting list
+func (c *Client) RemoveUserRule(rule string) ([]string, error) {
+	rule = strings.TrimSpace(rule)
+
+	c.rulesMu.Lock()
+	defer c.rulesMu.Unlock()
+
+	rules, err := c.GetUserRules()
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := make([]string, 0, len(rules))
+	for _, existing := range rules {
+		if existing != rule {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == len(rules) {
+		return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, rule)
+	}
+
+	if err := c.setUserRules(remaining); err != nil {
+		return nil, err
+	}
+
+	return remaining, nil
+}
+
+// setUserRules POSTs the rules to /control/filtering/set_rules. The caller must hold c.rulesMu.
+func (c *Client) setUserRules(rules []string) error {
+	logger.Info("[adguardapi][SetUserRules] Updating user rules")
+	logger.Debug("[adguardapi][SetUserRules] Rule count: ", len(rules))
+
+	// A rule spanning several lines would be split into separate rules by AdGuard
+	for _, rule := range rules {
+		if strings.ContainsAny(rule, "\r\n") {
+			return fmt.Errorf("%w: rule must be a single line: %q", ErrInvalidRule, rule)
+		}
+	}
+
+	if rules == nil {
+		rules = []string{}
+	}
+
+	// Marshal the rules to JSON
+	jsonData, err := json.Marshal(model.SetRulesRequest{Rules: rules})
+	if err != nil {
+		logger.Error("[adguardapi][SetUserRules] Failed to marshal rules to JSON")
+		logger.Error(err)
+		return err
+	}
+	logger.Debug("[adguardapi][SetUserRules] Request body: " + string(jsonData))
+
+	// Create the POST request
+	req, err := c.newAdGuardRequest("POST", "filtering/set_rules", jsonData)
+	if err != nil {
+		logger.Error("[adguardapi][SetUserRules] Failed to create POST request")
+		logger.Error(err)
+		return err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed).
+	// The request replaces the whole list, so it is safe to retry.
+	resp, err := c.DoAuthenticatedRequestWithRetry(req, true)
+	if err != nil {
+		logger.Error("[adguardapi][SetUserRules] Failed to set user rules on: " + req.URL.String())
+		logger.Error(err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		body, _ := io.ReadAll(resp.Body)
+		logger.Error("[adguardapi][SetUserRules] Request failed with status: " + resp.Status)
+		logger.Error("[adguardapi][SetUserRules] Response body: " + string(body))
+
+		// AdGuard answers 400 with a plain text explanation when it cannot parse a rule
+		if resp.StatusCode == http.StatusBadRequest {
+			return fmt.Errorf("%w: %s", ErrInvalidRule, strings.TrimSpace(string(body)))
+		}
+		return errors.New("request failed with status: " + resp.Status)
+	}
+
+	logger.Info("[adguardapi][SetUserRules] Successfully updated user rules")
+	events.Publish(events.RulesUpdated, map[string]interface{}{
+		"rule_count": len(rules),
+	})
+	return nil
+}
@@ -0,0 +1,70 @@
+package adguardapi
+
+import (
+	"time"
+
+	"github.com/welasco/adguardfilter/model"
+)
+
+// weekdayNames maps time.Weekday to the day keys of model.Schedule
+var weekdayNames = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// pauseWindow is one day's schedule window, where AdGuard pauses the blocking of the services
+type pauseWindow struct {
+	start time.Time
+	end   time.Time
+}
+
+// ScheduleState reports whether the schedule pauses the blocking at now, in location, and when that next
+// changes. The windows are wall-clock times, like AdGuard applies them, so they keep their local hours
+// across DST changes. changes is false when the state never changes: no day has a window, or every day
+// is paused from midnight to midnight.
+func ScheduleState(schedule model.Schedule, location *time.Location, now time.Time) (paused bool, next time.Time, changes bool) {
+	now = now.In(location)
+	days := schedule.Days()
+
+	// The windows of today and the next seven days, which always include the next transition. Windows
+	// touching at midnight are merged, the blocking stays paused across them.
+	var windows []pauseWindow
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(now.Year(), now.Month(), now.Day()+offset, 0, 0, 0, 0, location)
+		window := days[weekdayNames[day.Weekday()]]
+		if window == nil || window.Start >= window.End {
+			continue
+		}
+		start, end := wallClock(day, window.Start), wallClock(day, window.End)
+		if last := len(windows) - 1; last >= 0 && !windows[last].end.Before(start) {
+			windows[last].end = end
+			continue
+		}
+		windows = append(windows, pauseWindow{start: start, end: end})
+	}
+	if len(windows) == 0 {
+		return false, time.Time{}, false
+	}
+
+	for _, window := range windows {
+		if now.Before(window.start) {
+			return false, window.start, true
+		}
+		if now.Before(window.end) {
+			// A window running through the whole horizon means every day is fully paused
+			if offset := window.end.Sub(now); offset > 7*24*time.Hour {
+				return true, time.Time{}, false
+			}
+			return true, window.end, true
+		}
+	}
+	return false, time.Time{}, false
+}
+
+// wallClock returns the time on day at the milliseconds since midnight of a schedule window, as a
+// wall-clock time so a window keeps its local hours on DST change days. 86400000 is the next midnight.
+func wallClock(day time.Time, millis int64) time.Time {
+	clock := time.Duration(millis) * time.Millisecond
+	hours := int(clock / time.Hour)
+	minutes := int(clock % time.Hour / time.Minute)
+	seconds := int(clock % time.Minute / time.Second)
+	nanos := int(clock % time.Second)
+	return time.Date(day.Year(), day.Month(), day.Day(), hours, minutes, seconds, nanos, day.Location())
+}
@@ -0,0 +1,176 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+const (
+	testUsername = "admin"
+	testPassword = "secret"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "adguardapi-test")
+	if err != nil {
+		panic(err)
+	}
+	logger.Init(filepath.Join(dir, "test.log"), "Inf")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeAdGuard is an AdGuard Home served by httptest, answering the login and blocked services endpoints.
+// Its fields are guarded by mu and can be changed between requests to inject failures.
+type fakeAdGuard struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	config   model.ServiceConfig
+	catalog  []model.BlockedService
+	session  string         // Value of the valid session cookie, empty when none is
+	maxAge   int            // Max-Age of the session cookies set on login
+	logins   int            // Successful logins so far
+	requests map[string]int // Requests by "METHOD endpoint", logins included
+
+	failures    int    // Number of upcoming requests answered with a 503
+	loginPage   bool   // Answer unauthenticated requests with a 200 HTML login page instead of a 401
+	updateError string // Reject updates with a 400 and this body
+}
+
+// newFakeAdGuard starts a fake AdGuard Home and returns it with a client logging in to it as testUsername.
+// The server is closed when the test ends.
+func newFakeAdGuard(t *testing.T) (*fakeAdGuard, *Client) {
+	t.Helper()
+	t.Setenv("adguardApiVersion", APIVersionCurrent)
+	t.Setenv("httpRetryBaseMs", "1")
+
+	f := &fakeAdGuard{
+		config: model.ServiceConfig{
+			IDs:      []string{"youtube", "tiktok"},
+			Schedule: model.Schedule{TimeZone: "UTC"},
+		},
+		catalog: []model.BlockedService{
+			{ID: "youtube", Name: "YouTube"},
+			{ID: "tiktok", Name: "TikTok"},
+			{ID: "roblox", Name: "Roblox"},
+		},
+		maxAge:   3600,
+		requests: make(map[string]int),
+	}
+	f.Server = httptest.NewServer(f)
+	t.Cleanup(f.Close)
+
+	client, err := NewClientWithHTTPClient(f.URL, testUsername, testPassword, f.Client())
+	if err != nil {
+		t.Fatalf("NewClientWithHTTPClient: %v", err)
+	}
+	return f, client
+}
+
+// ServeHTTP answers r like AdGuard Home would
+func (f *fakeAdGuard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	endpoint := strings.TrimPrefix(r.URL.Path, ControlPath(""))
+	key := r.Method + " " + endpoint
+	f.requests[key]++
+
+	if key == "POST login" {
+		var credentials AuthCredentials
+		if err := json.NewDecoder(r.Body).Decode(&credentials); err != nil || credentials.Name != testUsername || credentials.Password != testPassword {
+			http.Error(w, "invalid username or password", http.StatusForbidden)
+			return
+		}
+		f.logins++
+		f.session = "session-" + strconv.Itoa(f.logins)
+		http.SetCookie(w, &http.Cookie{Name: "agh_session", Value: f.session, Path: "/", MaxAge: f.maxAge})
+		w.Write([]byte("OK"))
+		return
+	}
+
+	if f.failures > 0 {
+		f.failures--
+		http.Error(w, "bad gateway", http.StatusServiceUnavailable)
+		return
+	}
+
+	if cookie, err := r.Cookie("agh_session"); err != nil || f.session == "" || cookie.Value != f.session {
+		if f.loginPage {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte("<!DOCTYPE html><html><body>Login</body></html>"))
+			return
+		}
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch key {
+	case "GET status":
+		writeJSON(w, map[string]interface{}{"version": mockVersion, "running": true})
+	case "GET blocked_services/get":
+		writeJSON(w, f.config)
+	case "PUT blocked_services/update":
+		if f.updateError != "" {
+			http.Error(w, f.updateError, http.StatusBadRequest)
+			return
+		}
+		var serviceConfig model.ServiceConfig
+		if err := json.NewDecoder(r.Body).Decode(&serviceConfig); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.config = serviceConfig
+	case "GET blocked_services/all":
+		writeJSON(w, model.AllBlockedServicesResponse{BlockedServices: f.catalog, Groups: []model.ServiceGroup{}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// expireSession invalidates the current session, as AdGuard does when it restarts or the session times out
+func (f *fakeAdGuard) expireSession() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.session = ""
+}
+
+// count returns the number of requests received for "METHOD endpoint"
+func (f *fakeAdGuard) count(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[key]
+}
+
+// loginCount returns the number of successful logins
+func (f *fakeAdGuard) loginCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins
+}
+
+// currentConfig returns the configuration the fake holds
+func (f *fakeAdGuard) currentConfig() model.ServiceConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.config
+}
+
+// writeJSON answers with value encoded as JSON
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,180 @@
+package adguardapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ErrNoSnapshot is returned by RollbackConfig when there is no snapshot to restore
+var ErrNoSnapshot = errors.New("no configuration snapshot to roll back to")
+
+// Reasons recorded with a snapshot, the change it was taken before
+const (
+	SnapshotReasonUpdate   = "update"
+	SnapshotReasonReset    = "reset"
+	SnapshotReasonPatch    = "patch"
+	SnapshotReasonTimeZone = "time_zone"
+)
+
+// snapshotLimit returns how many snapshots are kept, from snapshotLimit (default 10, 0 disables them)
+func snapshotLimit() int {
+	return config.GetInt("snapshotLimit", 10)
+}
+
+// snapshotCurrent fetches the configuration from AdGuard and keeps it as a snapshot, so even changes made
+// in the AdGuard UI can be rolled back. The caller must hold configMu. A failure only skips the snapshot.
+func (c *Client) snapshotCurrent(ctx context.Context, reason string) {
+	if snapshotLimit() <= 0 {
+		return
+	}
+
+	currentConfig, err := c.getManagedConfig(ctx)
+	if err != nil {
+		logger.Warning("[adguardapi][snapshotCurrent] Failed to get current blocked services, no snapshot taken before " + reason)
+		logger.Warning(err)
+		return
+	}
+	c.addSnapshot(currentConfig, reason)
+}
+
+// addSnapshot keeps a copy of serviceConfig as the newest snapshot, dropping the oldest beyond snapshotLimit
+func (c *Client) addSnapshot(serviceConfig model.ServiceConfig, reason string) {
+	limit := snapshotLimit()
+	if limit <= 0 {
+		return
+	}
+
+	now := time.Now()
+	snapshot := model.ConfigSnapshot{
+		ID:        strconv.FormatInt(now.UnixNano(), 36),
+		Timestamp: now.Format(time.RFC3339),
+		Reason:    reason,
+		Config: model.ServiceConfig{
+			IDs:      append([]string{}, serviceConfig.IDs...),
+			Schedule: serviceConfig.Schedule,
+		},
+	}
+
+	c.snapshotsMu.Lock()
+	defer c.snapshotsMu.Unlock()
+
+	c.loadSnapshots()
+	c.snapshots = append(c.snapshots, snapshot)
+	if len(c.snapshots) > limit {
+		c.snapshots = append([]model.ConfigSnapshot{}, c.snapshots[len(c.snapshots)-limit:]...)
+	}
+	c.saveSnapshots()
+
+	logger.Debug("[adguardapi][addSnapshot] Took snapshot " + snapshot.ID + " before " + reason + " with " + strconv.Itoa(len(snapshot.Config.IDs)) + " service(s)")
+}
+
+// GetSnapshots returns the kept snapshots, newest first
+func (c *Client) GetSnapshots() []model.ConfigSnapshot {
+	c.snapshotsMu.Lock()
+	defer c.snapshotsMu.Unlock()
+
+	c.loadSnapshots()
+	snapshots := make([]model.ConfigSnapshot, 0, len(c.snapshots))
+	for i := len(c.snapshots) - 1; i >= 0; i-- {
+		snapshots = append(snapshots, c.snapshots[i])
+	}
+	return snapshots
+}
+
+// RollbackConfig restores the newest snapshot and removes it, so calling it again goes one change further back.
+// It returns the restored snapshot.
+func (c *Client) RollbackConfig() (model.ConfigSnapshot, error) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+
+	c.snapshotsMu.Lock()
+	c.loadSnapshots()
+	if len(c.snapshots) == 0 {
+		c.snapshotsMu.Unlock()
+		logger.Error("[adguardapi][RollbackConfig] No snapshot to roll back to")
+		return model.ConfigSnapshot{}, ErrNoSnapshot
+	}
+	snapshot := c.snapshots[len(c.snapshots)-1]
+	c.snapshotsMu.Unlock()
+
+	logger.Info("[adguardapi][RollbackConfig] Rolling back to snapshot " + snapshot.ID + " taken at " + snapshot.Timestamp + " before " + snapshot.Reason)
+
+	serviceConfig := snapshot.Config
+	if err := c.sendServiceConfig(context.Background(), &serviceConfig); err != nil {
+		logger.Error("[adguardapi][RollbackConfig] Failed to restore snapshot " + snapshot.ID)
+		return model.ConfigSnapshot{}, err
+	}
+
+	// Only drop the snapshot once it is restored, a failed rollback can be retried
+	c.snapshotsMu.Lock()
+	for i := len(c.snapshots) - 1; i >= 0; i-- {
+		if c.snapshots[i].ID == snapshot.ID {
+			c.snapshots = append(c.snapshots[:i], c.snapshots[i+1:]...)
+			break
+		}
+	}
+	c.saveSnapshots()
+	c.snapshotsMu.Unlock()
+
+	logger.Info("[adguardapi][RollbackConfig] Successfully rolled back blocked services configuration")
+	events.Publish(events.ConfigUpdated, map[string]interface{}{
+		"service_count": len(serviceConfig.IDs),
+		"time_zone":     serviceConfig.Schedule.TimeZone,
+		"rollback":      snapshot.ID,
+	})
+	return snapshot, nil
+}
+
+// loadSnapshots reads the snapshots file once, when snapshotsPath is set. The caller must hold snapshotsMu.
+func (c *Client) loadSnapshots() {
+	if c.snapshotsLoaded || c.snapshotsPath == "" {
+		return
+	}
+	c.snapshotsLoaded = true
+
+	data, err := os.ReadFile(c.snapshotsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("[adguardapi][loadSnapshots] Failed to read snapshots file")
+			logger.Error(err)
+		}
+		return
+	}
+
+	var loaded []model.ConfigSnapshot
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		logger.Error("[adguardapi][loadSnapshots] Failed to parse snapshots file")
+		logger.Error(err)
+		return
+	}
+	c.snapshots = append(loaded, c.snapshots...)
+	logger.Info("[adguardapi][loadSnapshots] Loaded ", len(loaded), " snapshot(s)")
+}
+
+// saveSnapshots writes the snapshots file atomically, when snapshotsPath is set. The caller must hold snapshotsMu.
+func (c *Client) saveSnapshots() {
+	if c.snapshotsPath == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(c.snapshots, "", "  ")
+	if err == nil {
+		tmpPath := c.snapshotsPath + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, c.snapshotsPath)
+		}
+	}
+	if err != nil {
+		logger.Error("[adguardapi][saveSnapshots] Failed to persist snapshots, they are kept in memory only")
+		logger.Error(err)
+	}
+}
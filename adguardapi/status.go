@@ -0,0 +1,57 @@
+package adguardapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// GetStatus retrieves the AdGuard status (version, protection and running state, DNS addresses)
+func (c *Client) GetStatus() (model.AdGuardStatus, error) {
+	// Create the GET request
+	req, err := c.newAdGuardRequest("GET", "status", nil)
+	if err != nil {
+		logger.Error("[adguardapi][GetStatus] Failed to create GET request")
+		logger.Error(err)
+		return model.AdGuardStatus{}, err
+	}
+
+	// Perform the authenticated request (will auto re-authenticate if needed)
+	resp, err := c.DoAuthenticatedRequest(req)
+	if err != nil {
+		logger.Error("[adguardapi][GetStatus] Failed to get status from: " + req.URL.String())
+		logger.Error(err)
+		return model.AdGuardStatus{}, err
+	}
+	defer resp.Body.Close()
+
+	// Check response status
+	if resp.StatusCode != 200 {
+		logger.Error("[adguardapi][GetStatus] Request failed with status: " + resp.Status)
+		return model.AdGuardStatus{}, errors.New("request failed with status: " + resp.Status)
+	}
+
+	// Read response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.Error("[adguardapi][GetStatus] Failed to read response body")
+		logger.Error(err)
+		return model.AdGuardStatus{}, err
+	}
+
+	logger.Debug("[adguardapi][GetStatus] Response body: " + string(body))
+
+	// Unmarshal JSON into AdGuardStatus model
+	var status model.AdGuardStatus
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		logger.Error("[adguardapi][GetStatus] Failed to unmarshal JSON response")
+		logger.Error(err)
+		return model.AdGuardStatus{}, err
+	}
+
+	return status, nil
+}
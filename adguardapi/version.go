@@ -0,0 +1,82 @@
+package adguardapi
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// The blocked services API generations of AdGuard Home, selected by adguardApiVersion
+const (
+	// APIVersionLegacy is GET /control/blocked_services/list and POST /control/blocked_services/set with a
+	// flat array of IDs, from before v0.107.37. It has no schedule.
+	APIVersionLegacy = "legacy"
+	// APIVersionCurrent is GET /control/blocked_services/get and PUT /control/blocked_services/update with
+	// an object holding the ids and the schedule
+	APIVersionCurrent = "current"
+)
+
+// scheduleMinVersion is the first AdGuard Home release with the current blocked services API
+var scheduleMinVersion = [3]int{0, 107, 37}
+
+// APIVersion returns the blocked services API generation to talk to AdGuard with. adguardApiVersion
+// picks it when set to legacy or current, otherwise (auto, the default) it is detected from the version
+// in /control/status once. When the status can't be read, current is assumed until a later probe works.
+func (c *Client) APIVersion() string {
+	switch setting := strings.ToLower(os.Getenv("adguardApiVersion")); setting {
+	case APIVersionLegacy, APIVersionCurrent:
+		return setting
+	case "", "auto":
+	default:
+		logger.Warning("[adguardapi][APIVersion] Invalid adguardApiVersion '" + setting + "', detecting the version instead")
+	}
+
+	c.apiVersionMu.Lock()
+	defer c.apiVersionMu.Unlock()
+	if c.apiVersion != "" {
+		return c.apiVersion
+	}
+
+	status, err := c.GetStatus()
+	if err != nil || status.Version == nil {
+		logger.Warning("[adguardapi][APIVersion] Failed to detect the AdGuard version, assuming the current API")
+		return APIVersionCurrent
+	}
+	c.apiVersion = apiVersionFor(*status.Version)
+	logger.Info("[adguardapi][APIVersion] AdGuard Home " + *status.Version + " detected, using the " + c.apiVersion + " blocked services API")
+	return c.apiVersion
+}
+
+// apiVersionFor returns the API generation of an AdGuard Home version such as v0.107.52. Versions that
+// don't parse, e.g. edge builds, are assumed to be recent.
+func apiVersionFor(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) != 3 {
+		return APIVersionCurrent
+	}
+
+	var parsed [3]int
+	for i, part := range parts {
+		// Drop pre-release and build suffixes, e.g. 0.108.0-b.5
+		if end := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+			part = part[:end]
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return APIVersionCurrent
+		}
+		parsed[i] = n
+	}
+
+	for i := range parsed {
+		if parsed[i] != scheduleMinVersion[i] {
+			if parsed[i] < scheduleMinVersion[i] {
+				return APIVersionLegacy
+			}
+			return APIVersionCurrent
+		}
+	}
+	return APIVersionCurrent
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiApplyAllowlist blocks every service of the catalog except the given ones, and blocks everything again
+// when the timer expires
+//
+// @Summary Allow only some services for a while
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param dryRun query bool false "Return the configuration without applying it"
+// @Param body body model.AllowlistRequest true "Services to allow and when to block everything again"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "timer_id, reset_after, allowed, blocked_count, added, removed"
+// @Failure 400 {object} model.ErrorResponse "Invalid body or unknown service IDs"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 429 {object} model.ErrorResponse "Unblock cooldown active"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/allowlist [post]
+func ApiApplyAllowlist(c *fiber.Ctx) error {
+	var request model.AllowlistRequest
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("[api][ApiApplyAllowlist] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	// An allowlist without a timer would leave the services allowed indefinitely
+	errs := fieldErrors{}
+	if request.IDs == nil {
+		errs["ids"] = "is required and must be an array, use [] to block every service"
+	}
+	if request.ResetAfter == "" && request.ResetAfterMin <= 0 {
+		errs["reset_after_min"] = "must be greater than 0, or set reset_after"
+	}
+	if invalid, err := respondFieldErrors(c, "ApiApplyAllowlist", errs); invalid {
+		return err
+	}
+
+	resetAfter := time.Duration(request.ResetAfterMin) * time.Minute
+	if request.ResetAfter != "" {
+		var err error
+		resetAfter, err = time.ParseDuration(request.ResetAfter)
+		if err != nil || resetAfter <= 0 {
+			logger.Error("[api][ApiApplyAllowlist] Invalid reset_after: " + request.ResetAfter)
+			return respondError(c, fiber.StatusBadRequest, "reset_after must be a positive duration", fiber.Map{
+				"example": "1h30m",
+			})
+		}
+	}
+	if maxReset, maxResetMinutes := maxResetDuration(); maxReset > 0 && resetAfter > maxReset {
+		logger.Error("[api][ApiApplyAllowlist] Reset duration exceeds the maximum: " + resetAfter.String())
+		return respondError(c, fiber.StatusBadRequest, "Reset duration exceeds the maximum allowed duration", fiber.Map{
+			"max_reset_minutes": maxResetMinutes,
+		})
+	}
+
+	if blocked, err := checkCooldown(c, "ApiApplyAllowlist"); blocked {
+		return err
+	}
+
+	// The blocked list is the complement of the allowlist against the catalog
+	serviceConfig, unknownIDs, err := backend.BuildAllowlistConfig(request.IDs)
+	if err != nil {
+		logger.Error("[api][ApiApplyAllowlist] Failed to build the allowlist configuration")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get service catalog", err)
+	}
+	if len(unknownIDs) > 0 {
+		logger.Error("[api][ApiApplyAllowlist] Allowlist contains ", len(unknownIDs), " unknown service ID(s)")
+		return respondError(c, fiber.StatusBadRequest, "Unknown service IDs", fiber.Map{
+			"unknown_ids": unknownIDs,
+		})
+	}
+
+	if isDryRun(c) {
+		logger.Info("[api][ApiApplyAllowlist] Dry run requested, not applying allowlist")
+		return respondDryRun(c, &serviceConfig, fiber.Map{
+			"allowed":     request.IDs,
+			"reset_after": resetAfter.String(),
+		})
+	}
+
+	changes := fetchChanges("ApiApplyAllowlist", serviceConfig.IDs)
+	err = backend.UpdateBlockedServicesContext(c.UserContext(), &serviceConfig)
+	recordAudit(c, audit.Entry{
+		Action:        audit.ActionUpdate,
+		ServiceCount:  len(serviceConfig.IDs),
+		ResetAfterMin: request.ResetAfterMin,
+		ResetAfter:    request.ResetAfter,
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][ApiApplyAllowlist] Failed to apply allowlist")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to apply allowlist", err)
+	}
+
+	logger.Info("[api][ApiApplyAllowlist] Allowed ", len(request.IDs), " service(s), blocked ", len(serviceConfig.IDs))
+
+	if !multiTimerMode() {
+		stopActiveTimers("ApiApplyAllowlist")
+	}
+
+	timerID := uniqueResetTimerID(ResetTimerPrefix + "allowlist")
+	_, err = timer.NewTimer(timerID,
+		timer.WithDuration(resetAfter),
+		timer.WithCallback(blockAllAfterAllowlist),
+		timer.WithMetadata(timerMetadata(c, "allowlist", serviceConfig)),
+		resetWarning(),
+	)
+	summary := appliedConfigSummary{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(serviceConfig.IDs),
+		TimeZone:     serviceConfig.Schedule.TimeZone,
+	}
+	if err != nil {
+		logger.Error("[api][ApiApplyAllowlist] Failed to create timer")
+		logger.Error(err)
+		logAppliedConfig("ApiApplyAllowlist", summary)
+		return respondSuccess(c, "Allowlist applied, but timer creation failed", fiber.Map{
+			"timer_error": err.Error(),
+		}, changes.toMap())
+	}
+
+	summary.TimerSet = true
+	summary.TimerID = timerID
+	summary.ResetAt = time.Now().Add(resetAfter).Format(time.RFC3339)
+	logAppliedConfig("ApiApplyAllowlist", summary)
+	notify.Notify(notify.EventTimerCreated, "Allowlist applied, every service is blocked again in "+resetAfter.String(), map[string]interface{}{
+		"timer_id":      timerID,
+		"reset_after":   resetAfter.String(),
+		"allowed":       request.IDs,
+		"service_count": len(serviceConfig.IDs),
+	})
+
+	return respondSuccess(c, "Allowlist applied, every service is blocked again in "+resetAfter.String(), fiber.Map{
+		"timer_id":      timerID,
+		"reset_after":   resetAfter.String(),
+		"allowed":       request.IDs,
+		"blocked_count": len(serviceConfig.IDs),
+	}, changes.toMap())
+}
+
+// blockAllAfterAllowlist is the allowlist timer callback blocking every service again. When AdGuard can't
+// be reached it falls back to the default reset, which retries and becomes a pending reset if needed.
+func blockAllAfterAllowlist(t *timer.Timer) {
+	logger.Info("[api][blockAllAfterAllowlist] Allowlist timer '" + t.GetID() + "' expired, blocking every service")
+
+	// An empty allowlist blocks the whole catalog
+	endOperation := adguardapi.WaitOperation("allowlist end")
+	serviceConfig, err := backend.ApplyAllowlist([]string{})
+	recordAudit(nil, audit.Entry{
+		Action:       audit.ActionReset,
+		ClientIP:     "timer",
+		ServiceCount: len(serviceConfig.IDs),
+	}, nil, err)
+	endOperation()
+
+	if err != nil {
+		logger.Error("[api][blockAllAfterAllowlist] Failed to block every service, falling back to the default reset")
+		logger.Error(err)
+		resetWithRetry(t.GetID(), nil)
+		return
+	}
+
+	logAppliedConfig("blockAllAfterAllowlist", appliedConfigSummary{
+		Action:       audit.ActionReset,
+		ServiceCount: len(serviceConfig.IDs),
+		TimeZone:     serviceConfig.Schedule.TimeZone,
+		TimerID:      t.GetID(),
+	})
+	notify.Notify(notify.EventTimerExpired, "Allowlist ended, every service is blocked again", map[string]interface{}{
+		"timer_id": t.GetID(),
+	})
+	recordTimerReset()
+}
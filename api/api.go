@@ -1,50 +1,148 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	"github.com/welasco/adguardfilter/common/config"
 	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/profile"
+	"github.com/welasco/adguardfilter/common/retry"
+	"github.com/welasco/adguardfilter/common/servicelist"
 	"github.com/welasco/adguardfilter/common/timer"
 	"github.com/welasco/adguardfilter/model"
 )
 
-// ApiGetServiceList retrieves the list of available services from the API
+// ResetTimerPrefix prefixes the IDs of the timers that reset the blocked services to the default
+// configuration, keeping them apart from other timers such as recurring schedule windows
+const ResetTimerPrefix = "reset-blocked-services-"
+
+// ApiGetServiceList retrieves the list of available services from the API, grouped by category.
+// ?flat=true returns the plain list instead.
+//
+// @Summary List available services
+// @Tags services
+// @Produce json
+// @Param flat query bool false "Return the plain list instead of groups"
+// @Param If-None-Match header string false "ETag of a previous response, answers 304 when the list is unchanged"
+// @Success 200 {object} model.ServiceListResponse
+// @Success 304 "Not modified"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/getservicelist [get]
 func ApiGetServiceList(c *fiber.Ctx) error {
-	serviceList, err := adguardapi.GetAllBlockedServices()
+	serviceList, err := backend.GetAllBlockedServices()
 	if err != nil {
 		logger.Error("[api][ApiGetServiceList] Failed to get service list")
 		logger.Error(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to get service list",
-		})
+		return respondUpstreamError(c, "Failed to get service list", err)
 	}
 
 	logger.Info("[api][ApiGetServiceList] Successfully retrieved service list")
-	return c.JSON(&serviceList)
+	if c.QueryBool("flat") {
+		return c.JSON(&serviceList)
+	}
+
+	groups := servicelist.GroupServices(serviceList)
+	logger.Debug("[api][ApiGetServiceList] Number of groups: ", len(groups))
+
+	return c.JSON(model.ServiceListResponse{
+		Count:  len(serviceList),
+		Groups: groups,
+	})
+}
+
+// ApiRefreshServiceCatalog drops the cached service catalog and fetches it again from AdGuard
+//
+// @Summary Refresh the cached service catalog
+// @Tags services
+// @Produce json
+// @Success 200 {object} model.SuccessResponse
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/catalog/refresh [post]
+func ApiRefreshServiceCatalog(c *fiber.Ctx) error {
+	serviceList, err := backend.RefreshServiceCatalog()
+	if err != nil {
+		logger.Error("[api][ApiRefreshServiceCatalog] Failed to refresh service catalog")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to refresh service catalog", err)
+	}
+
+	logger.Info("[api][ApiRefreshServiceCatalog] Service catalog refreshed")
+	return respondSuccess(c, "Service catalog refreshed", fiber.Map{
+		"count":        len(serviceList),
+		"refreshed_at": time.Now().Format(time.RFC3339),
+	})
 }
 
 // ApiGetBlockedServices retrieves the blocked services configuration from the API
+//
+// @Summary Get the blocked services
+// @Tags blocked services
+// @Produce json
+// @Param If-None-Match header string false "ETag of a previous response, answers 304 when the configuration is unchanged"
+// @Success 200 {object} model.ServiceConfig
+// @Success 304 "Not modified"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/getblockedservices [get]
 func ApiGetBlockedServices(c *fiber.Ctx) error {
 
 	// Unmarshal JSON into ServiceConfig model
-	serviceConfig, err := adguardapi.GetBlockedServices()
+	serviceConfig, err := backend.GetBlockedServicesContext(c.UserContext())
 	if err != nil {
 		logger.Error("[adguardapi][ApiGetBlockedServices] Failed to get blocked services")
 		logger.Error(err)
-		return err
+		return respondUpstreamError(c, "Failed to get blocked services", err)
 	}
 
 	logger.Info("[adguardapi][ApiGetBlockedServices] Successfully retrieved blocked services configuration")
 	logger.Debug("[adguardapi][ApiGetBlockedServices] Number of blocked service IDs: ", len(serviceConfig.IDs))
 	logger.Debug("[adguardapi][ApiGetBlockedServices] Timezone: " + serviceConfig.Schedule.TimeZone)
 
+	// The ETag is the configuration's hash, which the update endpoints accept in If-Match
+	etag := ConfigETag(serviceConfig)
+	c.Set(fiber.HeaderETag, etag)
+	if ifNoneMatch := c.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
 	return c.JSON(&serviceConfig)
 }
 
 // ApiUpdateBlockedServicesMin updates the blocked services configuration via the API
+//
+// @Summary Update blocked services with a reset after a duration
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body model.ResetServiceMinConfig true "Services to block and reset_after_min or reset_after"
+// @Param Idempotency-Key header string false "Replays the first response when the same write is retried"
+// @Param dryRun query bool false "Return the config that would be applied without applying it"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 409 {object} model.ErrorResponse "Idempotent request still in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 422 {object} model.ErrorResponse "Idempotency-Key reused with a different body"
+// @Failure 429 {object} model.ErrorResponse "Unblock cooldown active"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/updateblockedservicesmin [put]
+// @Router /api/v1/updateblockedservicesmin [post]
 func ApiUpdateBlockedServicesMin(c *fiber.Ctx) error {
 	// Parse request body into ResetServiceMinConfig model
 	var resetServiceConfig model.ResetServiceMinConfig
@@ -52,77 +150,231 @@ func ApiUpdateBlockedServicesMin(c *fiber.Ctx) error {
 	if err != nil {
 		logger.Error("[api][ApiUpdateBlockedServicesMin] Failed to parse request body")
 		logger.Error(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Failed to parse request body",
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	// Validate the body. A request without a reset applies permanently, unless defaultResetPolicy=midnight
+	// resets it at midnight.
+	errs := validateServiceConfigBody(c, &resetServiceConfig.ServiceConfig)
+	untilMidnight := resetServiceConfig.ResetAfter == "" && resetServiceConfig.ResetAfterMin == 0 && defaultResetPolicy() == ResetPolicyMidnight
+	validateResetTo(resetServiceConfig.ResetTo, errs)
+	validateUpdateMode(resetServiceConfig.Mode, errs)
+	if invalid, err := respondFieldErrors(c, "ApiUpdateBlockedServicesMin", errs); invalid {
+		return err
+	}
+
+	// Resolve the reset duration, reset_after takes precedence over reset_after_min
+	resetAfter := time.Duration(resetServiceConfig.ResetAfterMin) * time.Minute
+	var midnight time.Time
+	if untilMidnight {
+		midnight, err = nextMidnight(time.Now())
+		if err != nil {
+			logger.Error("[api][ApiUpdateBlockedServicesMin] Invalid defaultTimeZone for the midnight reset")
+			logger.Error(err)
+			return respondError(c, fiber.StatusInternalServerError, "Invalid defaultTimeZone for the midnight reset", nil)
+		}
+		resetAfter = time.Until(midnight).Round(time.Second)
+		logger.Info("[api][ApiUpdateBlockedServicesMin] No reset given, defaultResetPolicy resets at midnight: " + midnight.Format(time.RFC3339))
+	}
+	if resetServiceConfig.ResetAfter != "" {
+		resetAfter, err = time.ParseDuration(resetServiceConfig.ResetAfter)
+		if err != nil || resetAfter <= 0 {
+			logger.Error("[api][ApiUpdateBlockedServicesMin] Invalid reset_after: " + resetServiceConfig.ResetAfter)
+			return respondError(c, fiber.StatusBadRequest, "reset_after must be a positive duration", fiber.Map{
+				"example": "1h30m",
+			})
+		}
+	}
+
+	// Temporary access must stay temporary, so cap how far away the reset may be. The midnight reset is
+	// brought forward to the cap instead, the client didn't ask for a duration.
+	if maxReset, _ := maxResetDuration(); untilMidnight && maxReset > 0 && resetAfter > maxReset {
+		logger.Warning("[api][ApiUpdateBlockedServicesMin] Midnight is beyond maxResetMinutes, resetting after " + maxReset.String())
+		untilMidnight = false
+		resetAfter = maxReset
+	}
+	if maxReset, maxResetMinutes := maxResetDuration(); maxReset > 0 && resetAfter > maxReset {
+		logger.Error("[api][ApiUpdateBlockedServicesMin] Reset duration exceeds the maximum: " + resetAfter.String())
+		return respondError(c, fiber.StatusBadRequest, "Reset duration exceeds the maximum allowed duration", fiber.Map{
+			"max_reset_minutes": maxResetMinutes,
+		})
+	}
+
+	// Refuse a new unblock window right after a reset, unless made by an admin. A permanent update opens no
+	// window and isn't held back.
+	if resetAfter > 0 {
+		if blocked, err := checkCooldown(c, "ApiUpdateBlockedServicesMin"); blocked {
+			return err
+		}
+	}
+
+	// Merge the ids into the blocked services when asked to, before anything uses the configuration
+	mode, err := applyUpdateMode("ApiUpdateBlockedServicesMin", resetServiceConfig.Mode, &resetServiceConfig.ServiceConfig)
+	if err != nil {
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the blocked services to merge into", err)
+	}
+
+	// In dry-run mode return the config that would be applied without sending it
+	if isDryRun(c) {
+		logger.Info("[api][ApiUpdateBlockedServicesMin] Dry run requested, not applying configuration")
+		return respondDryRun(c, &resetServiceConfig.ServiceConfig, fiber.Map{
+			"reset_after_min": resetServiceConfig.ResetAfterMin,
+			"reset_after":     resetAfter.String(),
+			"mode":            mode,
 		})
 	}
 
+	// With reset_to=previous, capture what the timer restores before the update replaces it
+	var previous *model.ServiceConfig
+	if resetServiceConfig.ResetTo == ResetToPrevious {
+		previous, err = capturePreviousConfig("ApiUpdateBlockedServicesMin")
+		if err != nil {
+			logger.Error(err)
+			return respondUpstreamError(c, "Failed to get the configuration to restore", err)
+		}
+	}
+	resetTarget := resetTargetOf(previous)
+
+	// Capture the current configuration so the response can report what changed
+	changes := fetchChanges("ApiUpdateBlockedServicesMin", resetServiceConfig.ServiceConfig.IDs)
+
 	// Update blocked services via the API
-	err = adguardapi.UpdateBlockedServices(&resetServiceConfig.ServiceConfig)
+	err = backend.UpdateBlockedServicesContext(c.UserContext(), &resetServiceConfig.ServiceConfig)
+	recordAudit(c, audit.Entry{
+		Action:        audit.ActionUpdate,
+		ServiceCount:  len(resetServiceConfig.ServiceConfig.IDs),
+		ResetAfterMin: resetServiceConfig.ResetAfterMin,
+		ResetAfter:    resetServiceConfig.ResetAfter,
+	}, changes, err)
 	if err != nil {
 		logger.Error("[api][ApiUpdateBlockedServicesMin] Failed to update blocked services")
 		logger.Error(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update blocked services",
-		})
+		return respondUpstreamError(c, "Failed to update blocked services", err)
 	}
 
 	logger.Info("[api][ApiUpdateBlockedServicesMin] Successfully updated blocked services")
 
 	// If a reset duration is specified, set a timer to reset the configuration
-	if resetServiceConfig.ResetAfterMin > 0 {
-		// Stop all existing timers to ensure only one timer is active
-		activeTimers := timer.GetAllActiveTimers()
-		if len(activeTimers) > 0 {
-			logger.Info("[api][ApiUpdateBlockedServicesMin] Stopping ", len(activeTimers), " existing timer(s) before creating new one")
-			timer.StopAllTimers()
-			logger.Info("[api][ApiUpdateBlockedServicesMin] All existing timers stopped")
+	if resetAfter > 0 {
+		// Stop all existing timers to ensure only one timer is active, unless timers are independent
+		if !multiTimerMode() {
+			stopActiveTimers("ApiUpdateBlockedServicesMin")
 		}
 
-		timerID := fmt.Sprintf("reset-blocked-services-%d", resetServiceConfig.ResetAfterMin)
+		// Describe the duration in whole minutes when it was given that way
+		description := "in " + resetAfter.String()
+		timerID := ResetTimerPrefix + resetAfter.String()
+		expiry := timer.WithDuration(resetAfter)
+		switch {
+		case untilMidnight:
+			description = "at midnight (" + midnight.Format(time.RFC3339) + ")"
+			timerID = ResetTimerPrefix + "midnight"
+			expiry = timer.WithDeadline(midnight)
+		case resetServiceConfig.ResetAfter == "" && resetServiceConfig.ResetAfterMin > 0:
+			description = fmt.Sprintf("in %d minutes", resetServiceConfig.ResetAfterMin)
+			timerID = fmt.Sprintf(ResetTimerPrefix+"%d", resetServiceConfig.ResetAfterMin)
+		}
+
+		timerID = uniqueResetTimerID(timerID)
 
-		logger.Info("[api][ApiUpdateBlockedServicesMin] Creating timer to reset blocked services after ", resetServiceConfig.ResetAfterMin, " minutes")
+		logger.Info("[api][ApiUpdateBlockedServicesMin] Creating timer to reset blocked services " + description)
 
 		// Create a timer with the ResetBlockedServices callback
-		_, err := timer.NewTimerWithDuration(timerID, resetServiceConfig.ResetAfterMin, func() {
-			logger.Info("[api][Timer Callback] Resetting blocked services to default configuration")
-			err := adguardapi.ResetBlockedServices()
-			if err != nil {
-				logger.Error("[api][Timer Callback] Failed to reset blocked services")
-				logger.Error(err)
-			} else {
-				logger.Info("[api][Timer Callback] Successfully reset blocked services to default")
-			}
-		})
+		callback, scope := newResetCallback(resetServiceConfig.ServiceConfig.IDs)
+		metadata := timerMetadata(c, "updateblockedservicesmin", resetServiceConfig.ServiceConfig)
+		if previous != nil {
+			callback, metadata = withRestoreConfig(metadata, *previous)
+		}
+		_, err := timer.NewTimer(timerID,
+			expiry,
+			timer.WithCallback(callback),
+			timer.WithScope(scope),
+			timer.WithMetadata(metadata),
+			resetWarning(),
+		)
 
 		if err != nil {
 			logger.Error("[api][ApiUpdateBlockedServicesMin] Failed to create timer")
 			logger.Error(err)
+			logAppliedConfig("ApiUpdateBlockedServicesMin", appliedConfigSummary{
+				Action:       audit.ActionUpdate,
+				ServiceCount: len(resetServiceConfig.ServiceConfig.IDs),
+				TimeZone:     resetServiceConfig.ServiceConfig.Schedule.TimeZone,
+			})
 			// Don't fail the request, just log the error
-			return c.JSON(fiber.Map{
-				"success":     true,
-				"message":     "Blocked services updated, but timer creation failed",
+			return respondSuccess(c, "Blocked services updated, but timer creation failed", fiber.Map{
 				"timer_error": err.Error(),
-			})
+			}, changes.toMap())
 		}
 
 		logger.Info("[api][ApiUpdateBlockedServicesMin] Timer created successfully with ID: " + timerID)
-
-		return c.JSON(fiber.Map{
-			"success":         true,
-			"message":         fmt.Sprintf("Blocked services updated and will reset to default in %d minutes", resetServiceConfig.ResetAfterMin),
+		logAppliedConfig("ApiUpdateBlockedServicesMin", appliedConfigSummary{
+			Action:       audit.ActionUpdate,
+			ServiceCount: len(resetServiceConfig.ServiceConfig.IDs),
+			TimeZone:     resetServiceConfig.ServiceConfig.Schedule.TimeZone,
+			TimerSet:     true,
+			TimerID:      timerID,
+			ResetAt:      time.Now().Add(resetAfter).Format(time.RFC3339),
+		})
+		notify.Notify(notify.EventTimerCreated, "Services unblocked, reset to "+resetTarget+" "+description, map[string]interface{}{
 			"timer_id":        timerID,
 			"reset_after_min": resetServiceConfig.ResetAfterMin,
+			"reset_after":     resetAfter.String(),
+			"service_count":   len(resetServiceConfig.ServiceConfig.IDs),
 		})
+
+		return respondSuccess(c, "Blocked services updated and will reset to "+resetTarget+" "+description, fiber.Map{
+			"timer_id":        timerID,
+			"reset_after_min": resetServiceConfig.ResetAfterMin,
+			"reset_after":     resetAfter.String(),
+			"reset_to":        resetTarget,
+			"mode":            mode,
+			"scope":           scope,
+		}, midnightFields(untilMidnight, midnight), changes.toMap())
 	}
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": "Blocked services updated (no reset timer set)",
+	logAppliedConfig("ApiUpdateBlockedServicesMin", appliedConfigSummary{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(resetServiceConfig.ServiceConfig.IDs),
+		TimeZone:     resetServiceConfig.ServiceConfig.Schedule.TimeZone,
 	})
+
+	return respondSuccess(c, "Blocked services updated (no reset timer set)", changes.toMap())
+}
+
+// midnightFields reports the midnight reset of an update that didn't set one, when defaultResetPolicy added it
+func midnightFields(untilMidnight bool, midnight time.Time) fiber.Map {
+	if !untilMidnight {
+		return nil
+	}
+	return fiber.Map{
+		"reset_policy":    ResetPolicyMidnight,
+		"reset_date_time": midnight.Format(time.RFC3339),
+	}
 }
 
 // ApiUpdateBlockedServicesDateTime updates the blocked services configuration and sets a timer with a specific deadline
+//
+// @Summary Update blocked services with a reset at a date and time
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body model.ResetServiceDateTimeConfig true "Services to block and reset_date_time"
+// @Param Idempotency-Key header string false "Replays the first response when the same write is retried"
+// @Param dryRun query bool false "Return the config that would be applied without applying it"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 409 {object} model.ErrorResponse "Idempotent request still in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 422 {object} model.ErrorResponse "Idempotency-Key reused with a different body"
+// @Failure 429 {object} model.ErrorResponse "Unblock cooldown active"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/updateblockedservicesdatetime [put]
+// @Router /api/v1/updateblockedservicesdatetime [post]
 func ApiUpdateBlockedServicesDateTime(c *fiber.Ctx) error {
 	// Parse request body into ResetServiceDateTimeConfig model
 	var resetServiceConfig model.ResetServiceDateTimeConfig
@@ -130,166 +382,829 @@ func ApiUpdateBlockedServicesDateTime(c *fiber.Ctx) error {
 	if err != nil {
 		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Failed to parse request body")
 		logger.Error(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Failed to parse request body",
-		})
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
 	}
 
-	// Validate that reset_date_time is provided
+	// Validate the body, including that reset_date_time is provided
+	errs := validateServiceConfigBody(c, &resetServiceConfig.ServiceConfig)
 	if resetServiceConfig.ResetDateTime == "" {
-		logger.Error("[api][ApiUpdateBlockedServicesDateTime] reset_date_time is required")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "reset_date_time is required",
-		})
+		errs["reset_date_time"] = "is required"
 	}
-
-	// Parse the datetime string (supports multiple formats from JavaScript)
-	var deadline time.Time
-
-	// Try parsing common datetime formats from JavaScript
-	formats := []string{
-		time.RFC3339,                // "2025-10-12T15:30:00Z"
-		"2006-01-02T15:04:05Z07:00", // ISO 8601 with timezone
-		"2006-01-02T15:04:05",       // ISO 8601 without timezone
-		"2006-01-02 15:04:05",       // Common format
-		time.RFC3339Nano,            // With nanoseconds
+	validateResetTo(resetServiceConfig.ResetTo, errs)
+	validateUpdateMode(resetServiceConfig.Mode, errs)
+	if invalid, err := respondFieldErrors(c, "ApiUpdateBlockedServicesDateTime", errs); invalid {
+		return err
 	}
 
-	parseError := fmt.Errorf("invalid datetime format")
-	for _, format := range formats {
-		deadline, err = time.Parse(format, resetServiceConfig.ResetDateTime)
-		if err == nil {
-			parseError = nil
-			break
-		}
+	// Resolve the time zone used for a datetime without an explicit offset
+	timeZone := resetServiceConfig.TimeZone
+	if timeZone == "" {
+		timeZone = adguardapi.DefaultTimeZone()
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Invalid timezone: " + timeZone)
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Invalid timezone: "+timeZone, nil)
 	}
 
-	if parseError != nil {
+	// Parse the datetime string (supports multiple formats from JavaScript)
+	deadline, err := parseDeadline(resetServiceConfig.ResetDateTime, location)
+	if err != nil {
 		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Failed to parse reset_date_time: " + resetServiceConfig.ResetDateTime)
 		logger.Error(err)
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":   "Invalid datetime format. Use ISO 8601 format (e.g., 2025-10-12T15:30:00Z)",
+		return respondError(c, fiber.StatusBadRequest, "Invalid datetime format. Use ISO 8601 format (e.g., 2025-10-12T15:30:00Z)", fiber.Map{
 			"example": time.Now().Add(1 * time.Hour).Format(time.RFC3339),
 		})
 	}
+	logger.Debug("[api][ApiUpdateBlockedServicesDateTime] Resolved reset_date_time to: " + deadline.Format(time.RFC3339))
 
 	// Check if the deadline is in the future
 	if deadline.Before(time.Now()) {
 		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Deadline is in the past: " + deadline.Format(time.RFC3339))
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error":           "Deadline must be in the future",
+		return respondError(c, fiber.StatusBadRequest, "Deadline must be in the future", fiber.Map{
 			"provided_time":   deadline.Format(time.RFC3339),
 			"current_time":    time.Now().Format(time.RFC3339),
 			"time_difference": time.Until(deadline).String(),
 		})
 	}
 
+	// Temporary access must stay temporary, so cap how far away the deadline may be
+	if maxReset, maxResetMinutes := maxResetDuration(); maxReset > 0 && time.Until(deadline) > maxReset {
+		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Deadline exceeds the maximum: " + deadline.Format(time.RFC3339))
+		return respondError(c, fiber.StatusBadRequest, "reset_date_time exceeds the maximum allowed duration", fiber.Map{
+			"max_reset_minutes": maxResetMinutes,
+			"latest_allowed":    time.Now().Add(maxReset).Format(time.RFC3339),
+		})
+	}
+
+	// Reject deadlines the timer would refuse before applying anything
+	if err := timer.CheckDeadline(deadline); err != nil {
+		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Deadline beyond the timer horizon: " + deadline.Format(time.RFC3339))
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, err.Error(), fiber.Map{
+			"max_timer_horizon_hours": int64(timer.MaxHorizon().Hours()),
+		})
+	}
+
+	// Refuse a new unblock window right after a reset, unless made by an admin. The deadline is required, so
+	// every request opens one.
+	if blocked, err := checkCooldown(c, "ApiUpdateBlockedServicesDateTime"); blocked {
+		return err
+	}
+
+	// Merge the ids into the blocked services when asked to, before anything uses the configuration
+	mode, err := applyUpdateMode("ApiUpdateBlockedServicesDateTime", resetServiceConfig.Mode, &resetServiceConfig.ServiceConfig)
+	if err != nil {
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the blocked services to merge into", err)
+	}
+
+	// In dry-run mode return the config that would be applied without sending it
+	if isDryRun(c) {
+		logger.Info("[api][ApiUpdateBlockedServicesDateTime] Dry run requested, not applying configuration")
+		return respondDryRun(c, &resetServiceConfig.ServiceConfig, fiber.Map{
+			"reset_date_time":     deadline.Format(time.RFC3339),
+			"reset_date_time_utc": deadline.UTC().Format(time.RFC3339),
+			"mode":                mode,
+		})
+	}
+
+	// With reset_to=previous, capture what the timer restores before the update replaces it
+	var previous *model.ServiceConfig
+	if resetServiceConfig.ResetTo == ResetToPrevious {
+		previous, err = capturePreviousConfig("ApiUpdateBlockedServicesDateTime")
+		if err != nil {
+			logger.Error(err)
+			return respondUpstreamError(c, "Failed to get the configuration to restore", err)
+		}
+	}
+	resetTarget := resetTargetOf(previous)
+
+	// Capture the current configuration so the response can report what changed
+	changes := fetchChanges("ApiUpdateBlockedServicesDateTime", resetServiceConfig.ServiceConfig.IDs)
+
 	// Update blocked services via the API
-	err = adguardapi.UpdateBlockedServices(&resetServiceConfig.ServiceConfig)
+	err = backend.UpdateBlockedServicesContext(c.UserContext(), &resetServiceConfig.ServiceConfig)
+	recordAudit(c, audit.Entry{
+		Action:        audit.ActionUpdate,
+		ServiceCount:  len(resetServiceConfig.ServiceConfig.IDs),
+		ResetDateTime: deadline.Format(time.RFC3339),
+	}, changes, err)
 	if err != nil {
 		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Failed to update blocked services")
 		logger.Error(err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to update blocked services",
-		})
+		return respondUpstreamError(c, "Failed to update blocked services", err)
 	}
 
 	logger.Info("[api][ApiUpdateBlockedServicesDateTime] Successfully updated blocked services")
 
-	// Stop all existing timers to ensure only one timer is active
-	activeTimers := timer.GetAllActiveTimers()
-	if len(activeTimers) > 0 {
-		logger.Info("[api][ApiUpdateBlockedServicesDateTime] Stopping ", len(activeTimers), " existing timer(s) before creating new one")
-		timer.StopAllTimers()
-		logger.Info("[api][ApiUpdateBlockedServicesDateTime] All existing timers stopped")
+	// Stop all existing timers to ensure only one timer is active, unless timers are independent
+	if !multiTimerMode() {
+		stopActiveTimers("ApiUpdateBlockedServicesDateTime")
 	}
 
 	// Create a timer with the deadline
-	timerID := fmt.Sprintf("reset-blocked-services-%d", time.Now().Unix())
+	timerID := uniqueResetTimerID(fmt.Sprintf(ResetTimerPrefix+"%d", time.Now().Unix()))
 	durationUntilReset := time.Until(deadline)
 
 	logger.Info("[api][ApiUpdateBlockedServicesDateTime] Creating timer to reset blocked services at: " + deadline.Format(time.RFC3339))
 	logger.Debug("[api][ApiUpdateBlockedServicesDateTime] Duration until reset: " + durationUntilReset.String())
 
 	// Create a timer with the ResetBlockedServices callback
-	_, err = timer.NewTimerWithDeadline(timerID, deadline, func() {
-		logger.Info("[api][Timer Callback] Resetting blocked services to default configuration (scheduled deadline reached)")
-		err := adguardapi.ResetBlockedServices()
-		if err != nil {
-			logger.Error("[api][Timer Callback] Failed to reset blocked services")
-			logger.Error(err)
-		} else {
-			logger.Info("[api][Timer Callback] Successfully reset blocked services to default")
-		}
-	})
+	callback, scope := newResetCallback(resetServiceConfig.ServiceConfig.IDs)
+	metadata := timerMetadata(c, "updateblockedservicesdatetime", resetServiceConfig.ServiceConfig)
+	if previous != nil {
+		callback, metadata = withRestoreConfig(metadata, *previous)
+	}
+	_, err = timer.NewTimer(timerID,
+		timer.WithDeadline(deadline),
+		timer.WithCallback(callback),
+		timer.WithScope(scope),
+		timer.WithMetadata(metadata),
+		resetWarning(),
+	)
 
 	if err != nil {
 		logger.Error("[api][ApiUpdateBlockedServicesDateTime] Failed to create timer")
 		logger.Error(err)
+		logAppliedConfig("ApiUpdateBlockedServicesDateTime", appliedConfigSummary{
+			Action:       audit.ActionUpdate,
+			ServiceCount: len(resetServiceConfig.ServiceConfig.IDs),
+			TimeZone:     resetServiceConfig.ServiceConfig.Schedule.TimeZone,
+		})
 		// Don't fail the request, just log the error
-		return c.JSON(fiber.Map{
-			"success":     true,
-			"message":     "Blocked services updated, but timer creation failed",
+		return respondSuccess(c, "Blocked services updated, but timer creation failed", fiber.Map{
 			"timer_error": err.Error(),
-		})
+		}, changes.toMap())
 	}
 
 	logger.Info("[api][ApiUpdateBlockedServicesDateTime] Timer created successfully with ID: " + timerID)
+	logAppliedConfig("ApiUpdateBlockedServicesDateTime", appliedConfigSummary{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(resetServiceConfig.ServiceConfig.IDs),
+		TimeZone:     resetServiceConfig.ServiceConfig.Schedule.TimeZone,
+		TimerSet:     true,
+		TimerID:      timerID,
+		ResetAt:      deadline.Format(time.RFC3339),
+	})
+	notify.Notify(notify.EventTimerCreated, "Services unblocked, reset to "+resetTarget+" at "+deadline.Format(time.RFC3339), map[string]interface{}{
+		"timer_id":        timerID,
+		"reset_date_time": deadline.Format(time.RFC3339),
+		"service_count":   len(resetServiceConfig.ServiceConfig.IDs),
+	})
+
+	return respondSuccess(c, "Blocked services updated and will reset to "+resetTarget+" at specified time", fiber.Map{
+		"timer_id":            timerID,
+		"reset_to":            resetTarget,
+		"mode":                mode,
+		"reset_date_time":     deadline.Format(time.RFC3339),
+		"reset_date_time_utc": deadline.UTC().Format(time.RFC3339),
+		"time_until_reset":    durationUntilReset.String(),
+		"current_time":        time.Now().Format(time.RFC3339),
+		"scope":               scope,
+	}, changes.toMap())
+}
+
+// ApiResetBlockedServices stops any active timer and resets the blocked services to the default configuration
+//
+// @Summary Reset the blocked services to the default configuration
+// @Tags blocked services
+// @Produce json
+// @Param dryRun query bool false "Return the config that would be applied without applying it"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/resetblockedservices [put]
+// @Router /api/v1/resetblockedservices [post]
+func ApiResetBlockedServices(c *fiber.Ctx) error {
+	defaultConfig := adguardapi.BuildDefaultConfig()
+
+	// In dry-run mode return the default config without sending it
+	if isDryRun(c) {
+		logger.Info("[api][ApiResetBlockedServices] Dry run requested, not resetting configuration")
+		return respondDryRun(c, &defaultConfig, nil)
+	}
+
+	changes := fetchChanges("ApiResetBlockedServices", defaultConfig.IDs)
+	err := backend.ResetBlockedServicesContext(c.UserContext())
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionReset,
+		ServiceCount: len(defaultConfig.IDs),
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][ApiResetBlockedServices] Failed to reset blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to reset blocked services", err)
+	}
+
+	logger.Info("[api][ApiResetBlockedServices] Successfully reset blocked services to default")
+	ClearPendingReset()
+
+	// Stop the timers only now that the reset made them redundant; after a failed reset they still have to
+	// block the services again
+	stoppedTimers := stopActiveTimers("ApiResetBlockedServices")
+
+	return respondSuccess(c, "Blocked services reset to default", fiber.Map{
+		"timers_stopped": stoppedTimers,
+	}, changes.toMap())
+}
+
+// ApiUpdateTimeZone changes the schedule time zone without touching the blocked service IDs
+//
+// @Summary Change the schedule time zone
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body model.TimeZoneRequest true "New IANA time zone"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/timezone [patch]
+func ApiUpdateTimeZone(c *fiber.Ctx) error {
+	var timeZoneRequest model.TimeZoneRequest
+	err := c.BodyParser(&timeZoneRequest)
+	if err != nil {
+		logger.Error("[api][ApiUpdateTimeZone] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	oldTimeZone, err := backend.UpdateTimeZone(timeZoneRequest.TimeZone)
+	if errors.Is(err, adguardapi.ErrInvalidTimeZone) {
+		return respondError(c, fiber.StatusBadRequest, "Invalid time_zone: "+timeZoneRequest.TimeZone, nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiUpdateTimeZone] Failed to update time zone")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update time zone", err)
+	}
+
+	logger.Info("[api][ApiUpdateTimeZone] Successfully updated time zone to " + timeZoneRequest.TimeZone)
+
+	return respondSuccess(c, "Time zone updated", fiber.Map{
+		"old_time_zone": oldTimeZone,
+		"new_time_zone": timeZoneRequest.TimeZone,
+	})
+}
+
+// ApiPatchBlockedServices merges added and removed service IDs and an optional time zone into the
+// current configuration, instead of replacing it
+//
+// @Summary Add or remove blocked services
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body model.BlockedServicesPatch true "IDs to add and remove, optional time zone"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.ServiceConfig
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/blockedservices [patch]
+func ApiPatchBlockedServices(c *fiber.Ctx) error {
+	var patchRequest model.BlockedServicesPatch
+	err := c.BodyParser(&patchRequest)
+	if err != nil {
+		logger.Error("[api][ApiPatchBlockedServices] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	// Validate the request
+	errs := fieldErrors{}
+	if len(patchRequest.Add) == 0 && len(patchRequest.Remove) == 0 && patchRequest.TimeZone == "" {
+		errs["add"] = "at least one of add, remove or time_zone is required"
+	}
+	for field, ids := range map[string][]string{"add": patchRequest.Add, "remove": patchRequest.Remove} {
+		for i, id := range ids {
+			if id == "" {
+				errs[field+"["+strconv.Itoa(i)+"]"] = "must not be empty"
+			}
+		}
+	}
+	if invalid, err := respondFieldErrors(c, "ApiPatchBlockedServices", errs); invalid {
+		return err
+	}
+
+	serviceConfig, err := backend.PatchBlockedServices(patchRequest.Add, patchRequest.Remove, patchRequest.TimeZone)
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(serviceConfig.IDs),
+	}, &serviceChanges{Added: patchRequest.Add, Removed: patchRequest.Remove}, err)
+	if errors.Is(err, adguardapi.ErrInvalidTimeZone) {
+		return respondError(c, fiber.StatusBadRequest, "Invalid time_zone: "+patchRequest.TimeZone, nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiPatchBlockedServices] Failed to patch blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update blocked services", err)
+	}
+
+	logger.Info("[api][ApiPatchBlockedServices] Successfully patched blocked services")
+
+	return c.JSON(&serviceConfig)
+}
+
+// ApiGetDrift compares the configuration last applied by this service with the one currently in AdGuard
+//
+// @Summary Check for changes made directly in AdGuard
+// @Tags status
+// @Produce json
+// @Success 200 {object} model.Drift
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/drift [get]
+func ApiGetDrift(c *fiber.Ctx) error {
+	drift, err := backend.CheckDrift()
+	if err != nil {
+		logger.Error("[api][ApiGetDrift] Failed to check drift")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to check drift", err)
+	}
+
+	logger.Debug("[api][ApiGetDrift] Drifted: ", drift.Drifted)
+
+	return c.JSON(&drift)
+}
+
+// ApiGetStatus returns the AdGuard status: version, protection and running state, and DNS addresses
+//
+// @Summary Get the AdGuard status
+// @Tags status
+// @Produce json
+// @Success 200 {object} model.AdGuardStatus
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/status [get]
+func ApiGetStatus(c *fiber.Ctx) error {
+	status, err := backend.GetStatus()
+	if err != nil {
+		logger.Error("[api][ApiGetStatus] Failed to get AdGuard status")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get AdGuard status", err)
+	}
+
+	return c.JSON(&status)
+}
+
+// ApiTestConnection tests connectivity and credentials against AdGuard with a fresh login.
+// It answers 200 with the diagnostics even when the test fails, so setups can show what went wrong.
+//
+// @Summary Test the connection to AdGuard
+// @Tags status
+// @Produce json
+// @Success 200 {object} model.ConnectionCheck
+// @Security ApiKeyAuth
+// @Router /api/v1/testconnection [get]
+// @Router /api/v1/testconnection [post]
+func ApiTestConnection(c *fiber.Ctx) error {
+	check := backend.CheckConnection()
+	if check.Error != "" {
+		logger.Warning("[api][ApiTestConnection] Connection test failed: " + check.Error)
+	}
+
+	return c.JSON(&check)
+}
+
+// ApiReauthenticate drops the AdGuard session and logs in again with the stored credentials, to recover from
+// a stuck session without a restart. When adminApiKey is configured only admin requests may do it.
+//
+// @Summary Force a fresh login to AdGuard
+// @Tags status
+// @Produce json
+// @Success 200 {object} model.SuccessResponse
+// @Failure 403 {object} model.ErrorResponse "Admin API key required"
+// @Failure 409 {object} model.ErrorResponse "No AdGuard credentials configured"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/reauth [post]
+func ApiReauthenticate(c *fiber.Ctx) error {
+	if config.GetSecret("adminApiKey") != "" && !isAdmin(c) {
+		logger.Warning("[api][ApiReauthenticate] Rejected re-authentication without the admin API key from " + ClientIP(c))
+		return respondError(c, fiber.StatusForbidden, "Re-authenticating requires the admin API key", nil)
+	}
+
+	logger.Info("[api][ApiReauthenticate] Forcing a fresh login to AdGuard, requested by " + ClientIP(c))
+	err := backend.Reauthenticate()
+	if errors.Is(err, adguardapi.ErrNoCredentials) {
+		return respondError(c, fiber.StatusConflict, "No AdGuard credentials are configured", nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiReauthenticate] Re-authentication failed")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to log in to AdGuard: "+err.Error(), err)
+	}
+
+	fields := fiber.Map{"cookie_obtained": true}
+	if expiry, known := backend.GetSessionExpiry(); known {
+		fields["session_expires_at"] = expiry.Format(time.RFC3339)
+	}
+	return respondSuccess(c, "Logged in to AdGuard with a new session", fields)
+}
+
+// ApiGetDefaults returns the default configuration that a reset applies
+//
+// @Summary Get the default configuration a reset applies
+// @Tags blocked services
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /api/v1/defaults [get]
+func ApiGetDefaults(c *fiber.Ctx) error {
+	defaultConfig := adguardapi.BuildDefaultConfig()
+
+	logger.Debug("[api][ApiGetDefaults] Default service count: ", len(defaultConfig.IDs))
+
+	return c.JSON(fiber.Map{
+		"config": defaultConfig,
+		"count":  len(defaultConfig.IDs),
+		"source": adguardapi.DefaultConfigSource(),
+	})
+}
+
+// ApiGetResolvedDefaults returns the default list with the layer each ID comes from: the built-in list, the
+// defaultsFile and defaultBlockedServices, or with ?profile=name the layers of that profile's default list
+//
+// @Summary Get the resolved default list and the layer of each service
+// @Tags blocked services
+// @Produce json
+// @Param profile query string false "Profile whose default list to resolve instead of the global one"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} model.ErrorResponse "Unknown profile"
+// @Security ApiKeyAuth
+// @Router /api/v1/defaults/resolved [get]
+func ApiGetResolvedDefaults(c *fiber.Ctx) error {
+	layers := adguardapi.DefaultLayers()
+	name := c.Query("profile")
+	if name != "" {
+		p, ok := profile.Get(name)
+		if !ok {
+			return respondError(c, fiber.StatusNotFound, "Unknown profile: "+name, nil)
+		}
+		layers = p.Layers()
+	}
+
+	resolved := config.ResolveList(layers)
+	logger.Debug("[api][ApiGetResolvedDefaults] Resolved ", len(resolved.IDs), " default service(s) from layers: "+strings.Join(resolved.Layers, ", "))
+
+	response := fiber.Map{
+		"ids":     resolved.IDs,
+		"count":   len(resolved.IDs),
+		"sources": resolved.Sources,
+		"layers":  resolved.Layers,
+	}
+	if name != "" {
+		response["profile"] = name
+	}
+	return c.JSON(response)
+}
+
+// ApiGetAudit returns the most recent audit log entries (?limit=N, default 50), newest first
+//
+// @Summary Get the most recent audit log entries
+// @Tags audit
+// @Produce json
+// @Param limit query int false "Number of entries" default(50)
+// @Success 200 {object} map[string]interface{}
+// @Failure 500 {object} model.ErrorResponse "Audit log unreadable"
+// @Security ApiKeyAuth
+// @Router /api/v1/audit [get]
+func ApiGetAudit(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 50)
+
+	entries, err := audit.ReadRecent(limit)
+	if err != nil {
+		logger.Error("[api][ApiGetAudit] Failed to read audit log")
+		logger.Error(err)
+		return respondError(c, fiber.StatusInternalServerError, "Failed to read audit log", nil)
+	}
+
+	logger.Debug("[api][ApiGetAudit] Returning ", len(entries), " audit entries")
 
 	return c.JSON(fiber.Map{
-		"success":          true,
-		"message":          "Blocked services updated and will reset to default at specified time",
-		"timer_id":         timerID,
-		"reset_date_time":  deadline.Format(time.RFC3339),
-		"time_until_reset": durationUntilReset.String(),
-		"current_time":     time.Now().Format(time.RFC3339),
+		"enabled": audit.Enabled(),
+		"count":   len(entries),
+		"entries": entries,
 	})
 }
 
 // ApiGetTimer retrieves information about the currently active timer
+//
+// @Summary Get the active reset timer
+// @Tags timers
+// @Produce json
+// @Param format query string false "human adds time_remaining_human and expire_time_local"
+// @Success 200 {object} model.TimerResponse
+// @Security ApiKeyAuth
+// @Router /api/v1/gettimer [get]
 func ApiGetTimer(c *fiber.Ctx) error {
-	// Get all active timers (should be at most one)
-	activeTimers := timer.GetAllActiveTimers()
+	// Get all active reset timers (should be at most one)
+	activeTimers := timer.GetActiveTimersWithPrefix(ResetTimerPrefix)
 
 	logger.Debug("[api][ApiGetTimer] Number of active timers: ", len(activeTimers))
 
 	// Check if there's an active timer
 	if len(activeTimers) == 0 {
 		logger.Info("[api][ApiGetTimer] No active timer found")
-		return c.JSON(fiber.Map{
-			"is_active": false,
-			"message":   "No active timer",
+		return c.JSON(model.TimerResponse{
+			IsActive: false,
+			Message:  "No active timer",
 		})
 	}
 
 	// Get the first (and only) active timer
 	timerID := activeTimers[0]
-	activeTimer, exists := timer.GetTimer(timerID)
-	if !exists || !activeTimer.IsActive() {
+	details, exists := timerDetails(timerID, wantsHumanFormat(c))
+	if !exists || !details.IsActive {
 		logger.Warning("[api][ApiGetTimer] Timer '" + timerID + "' is not active or not found")
-		return c.JSON(fiber.Map{
-			"is_active": false,
-			"message":   "No active timer",
+		return c.JSON(model.TimerResponse{
+			IsActive: false,
+			Message:  "No active timer",
 		})
 	}
 
-	// Calculate remaining time
-	expireTime := activeTimer.GetExpireTime()
-	timeRemaining := time.Until(expireTime)
-
 	logger.Info("[api][ApiGetTimer] Active timer found: " + timerID)
-	logger.Debug("[api][ApiGetTimer] Expire time: " + expireTime.Format(time.RFC3339))
-	logger.Debug("[api][ApiGetTimer] Time remaining: " + timeRemaining.String())
+	logger.Debug("[api][ApiGetTimer] Expire time: " + details.ExpireTime)
+	logger.Debug("[api][ApiGetTimer] Time remaining: " + details.TimeRemaining)
 
 	// Format response
-	return c.JSON(fiber.Map{
-		"is_active":      true,
-		"timer_id":       timerID,
-		"expire_time":    expireTime.Format(time.RFC3339),
-		"current_time":   time.Now().Format(time.RFC3339),
-		"time_remaining": timeRemaining.String(),
-		"seconds_left":   int64(timeRemaining.Seconds()),
-		"minutes_left":   int64(timeRemaining.Minutes()),
-		"message":        "Active timer found",
+	details.CurrentTime = time.Now().Format(time.RFC3339)
+	details.Message = "Active timer found"
+	return c.JSON(details)
+}
+
+// stopActiveTimers stops all active reset timers, sends a cancellation notification for each one
+// and returns how many were stopped
+func stopActiveTimers(caller string) int {
+	activeTimers := timer.GetActiveTimersWithPrefix(ResetTimerPrefix)
+	if len(activeTimers) == 0 {
+		return 0
+	}
+
+	logger.Info("[api]["+caller+"] Stopping ", len(activeTimers), " existing timer(s)")
+	timer.StopTimersWithPrefix(ResetTimerPrefix)
+	logger.Info("[api][" + caller + "] All existing timers stopped")
+
+	for _, timerID := range activeTimers {
+		notify.Notify(notify.EventTimerCancelled, "Timer '"+timerID+"' was cancelled", map[string]interface{}{
+			"timer_id": timerID,
+		})
+	}
+
+	return len(activeTimers)
+}
+
+// resetAfterTimer is the timer callback that resets the blocked services to the default configuration
+func resetAfterTimer(t *timer.Timer) {
+	resetWithRetry(t.GetID(), nil)
+}
+
+// resetWithRetry resets the blocked services for the timer timerID to the default configuration, or only
+// the given scope of service IDs when it is not nil. A failed reset would leave services unblocked indefinitely,
+// so it is retried with backoff (resetRetryMax attempts starting at resetRetryBaseMs) and, if AdGuard
+// is still unreachable, recorded as a pending reset that is retried every resetFollowUpMin minutes.
+func resetWithRetry(timerID string, scope []string) {
+	logger.Info("[api][resetAfterTimer] Timer '" + timerID + "' expired")
+
+	// Hold off updates until the reset and its retries are done, so they can't interleave
+	endOperation := adguardapi.WaitOperation("timer reset")
+	defer endOperation()
+	notify.Notify(notify.EventTimerExpired, "Timer expired, resetting blocked services to default", map[string]interface{}{
+		"timer_id": timerID,
+		"scope":    scope,
 	})
+
+	maxRetries := config.GetInt("resetRetryMax", 3)
+	baseDelay := time.Duration(config.GetInt("resetRetryBaseMs", 2000)) * time.Millisecond
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retry.Backoff(baseDelay, attempt-1)
+			logger.Warning("[api][resetAfterTimer] Retrying reset in " + delay.String() + " (attempt " + fmt.Sprint(attempt+1) + ")")
+			time.Sleep(delay)
+		}
+
+		lastErr = applyReset("resetAfterTimer", timerID, scope)
+		if lastErr == nil {
+			recordTimerReset()
+			return
+		}
+	}
+
+	// Keep trying in the background so the reset is not silently dropped
+	markPendingReset(timerID, scope, maxRetries+1, lastErr)
+	notify.Notify(notify.EventResetFailed, "Failed to reset blocked services to default, the reset is pending", map[string]interface{}{
+		"attempts":          maxRetries + 1,
+		"follow_up_minutes": config.GetInt("resetFollowUpMin", 5),
+	})
+}
+
+// ResetAfterWindow resets the blocked services to default when the window of the timer timerID closes,
+// retrying a failure and leaving the reset pending after the last retry
+func ResetAfterWindow(timerID string) {
+	resetWithRetry(timerID, nil)
+}
+
+// parseDeadline parses a datetime in one of the formats sent by JavaScript clients. A datetime
+// without an explicit offset is interpreted in location rather than UTC.
+func parseDeadline(value string, location *time.Location) (time.Time, error) {
+	// Formats carrying their own offset
+	formats := []string{
+		time.RFC3339,                // "2025-10-12T15:30:00Z"
+		"2006-01-02T15:04:05Z07:00", // ISO 8601 with timezone
+		time.RFC3339Nano,            // With nanoseconds
+	}
+	for _, format := range formats {
+		if deadline, err := time.Parse(format, value); err == nil {
+			return deadline, nil
+		}
+	}
+
+	// Naive formats, interpreted as local time in the given location
+	naiveFormats := []string{
+		"2006-01-02T15:04:05", // ISO 8601 without timezone
+		"2006-01-02T15:04",    // HTML datetime-local input
+		"2006-01-02 15:04:05", // Common format
+	}
+	for _, format := range naiveFormats {
+		if deadline, err := time.ParseInLocation(format, value, location); err == nil {
+			return deadline, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid datetime format: %s", value)
+}
+
+// isDryRun reports whether the request asked for a dry run via ?dryRun=true
+func isDryRun(c *fiber.Ctx) bool {
+	return c.QueryBool("dryRun", false)
+}
+
+// respondDryRun returns the config that would be sent to AdGuard along with the
+// IDs it would add to and remove from the current configuration. Disabled services are left out of
+// both, as the update would leave them out.
+func respondDryRun(c *fiber.Ctx, serviceConfig *model.ServiceConfig, extra fiber.Map) error {
+	currentConfig, err := backend.GetBlockedServices()
+	if err != nil {
+		logger.Error("[api][respondDryRun] Failed to get current blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get current blocked services", err)
+	}
+
+	enforcedConfig := *serviceConfig
+	enforcedConfig.IDs = backend.EnforcedIDs(serviceConfig.IDs)
+	added, removed := servicelist.DiffServiceIDs(currentConfig.IDs, enforcedConfig.IDs)
+	logger.Debug("[api][respondDryRun] Dry run would add ", len(added), " and remove ", len(removed), " service(s)")
+
+	return c.JSON(mergeMap(fiber.Map{
+		"dry_run": true,
+		"config":  &enforcedConfig,
+		"added":   added,
+		"removed": removed,
+	}, extra))
+}
+
+// serviceChanges holds the service IDs added and removed by an update
+type serviceChanges struct {
+	Added   []string
+	Removed []string
+}
+
+// toMap returns the changes as response fields, or nil when the changes are unknown
+func (sc *serviceChanges) toMap() fiber.Map {
+	if sc == nil {
+		return nil
+	}
+	return fiber.Map{
+		"added":   sc.Added,
+		"removed": sc.Removed,
+	}
+}
+
+// applyReset resets the default configuration, or only scope when it is not nil, and audits the attempt
+func applyReset(caller string, timerID string, scope []string) error {
+	var err error
+	serviceCount := len(scope)
+	if scope == nil {
+		logger.Info("[api][" + caller + "] Resetting blocked services to default configuration")
+		err = backend.ResetBlockedServices()
+		serviceCount = len(adguardapi.BuildDefaultConfig().IDs)
+	} else {
+		logger.Info("[api]["+caller+"] Resetting ", len(scope), " service(s) of the timer scope")
+		err = backend.ResetServiceIDs(scope)
+	}
+	recordAudit(nil, audit.Entry{
+		Action:       audit.ActionReset,
+		ClientIP:     "timer",
+		ServiceCount: serviceCount,
+	}, nil, err)
+	if err != nil {
+		logger.Error("[api][" + caller + "] Failed to reset blocked services")
+		logger.Error(err)
+		return err
+	}
+
+	logger.Info("[api][" + caller + "] Successfully reset blocked services to default")
+	logAppliedConfig(caller, appliedConfigSummary{
+		Action:       audit.ActionReset,
+		ServiceCount: serviceCount,
+		TimerID:      timerID,
+	})
+	return nil
+}
+
+// fetchChanges compares the current AdGuard configuration against the IDs about to be applied
+// and returns the added/removed IDs. It returns nil if the current configuration is unavailable
+// so the update can still proceed without a diff.
+func fetchChanges(caller string, newIDs []string) *serviceChanges {
+	currentConfig, err := backend.GetBlockedServices()
+	if err != nil {
+		logger.Warning("[api][" + caller + "] Failed to get current blocked services, response will not include changes")
+		logger.Warning(err)
+		return nil
+	}
+
+	// Disabled services are never sent, so they don't count as changes
+	added, removed := servicelist.DiffServiceIDs(currentConfig.IDs, backend.EnforcedIDs(newIDs))
+	logger.Debug("[api]["+caller+"] Update adds ", len(added), " and removes ", len(removed), " service(s)")
+
+	return &serviceChanges{
+		Added:   added,
+		Removed: removed,
+	}
+}
+
+// appliedConfigSummary is the compact record of an applied configuration logged at Info level
+type appliedConfigSummary struct {
+	Action       string `json:"action"`
+	ServiceCount int    `json:"service_count"`
+	TimeZone     string `json:"time_zone,omitempty"`
+	TimerSet     bool   `json:"timer_set"`
+	TimerID      string `json:"timer_id,omitempty"`
+	ResetAt      string `json:"reset_at,omitempty"`
+}
+
+// logAppliedConfig logs a one-line JSON summary of an applied configuration, so operators get a running record
+// without enabling Debug. It never includes request bodies or credentials.
+func logAppliedConfig(caller string, summary appliedConfigSummary) {
+	line, err := json.Marshal(summary)
+	if err != nil {
+		logger.Warning("[api][" + caller + "] Failed to marshal applied config summary")
+		return
+	}
+	logger.Info("[api][" + caller + "] Applied config: " + string(line))
+}
+
+// LocalsClientIP is the fiber.Ctx local holding the client address resolved by the transport middleware,
+// which honors X-Forwarded-For only from trusted proxies
+const LocalsClientIP = "clientIP"
+
+// ClientIP returns the resolved client address of the request, falling back to the direct peer
+func ClientIP(c *fiber.Ctx) string {
+	if ip, ok := c.Locals(LocalsClientIP).(string); ok && ip != "" {
+		return ip
+	}
+	return c.IP()
+}
+
+// recordAudit writes an audit entry for a mutating request, filling in the client IP,
+// the changed IDs and the outcome
+func recordAudit(c *fiber.Ctx, entry audit.Entry, changes *serviceChanges, err error) {
+	if c != nil {
+		entry.ClientIP = ClientIP(c)
+	}
+	if changes != nil {
+		entry.Added = changes.Added
+		entry.Removed = changes.Removed
+	}
+
+	entry.Outcome = audit.OutcomeSuccess
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+
+	audit.Record(entry)
+}
+
+// mergeMap copies the entries of extra into response and returns response
+func mergeMap(response fiber.Map, extra fiber.Map) fiber.Map {
+	for key, value := range extra {
+		response[key] = value
+	}
+	return response
 }
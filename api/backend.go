@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// AdGuardBackend is the AdGuard Home instance the handlers manage. *adguardapi.Client implements it over
+// HTTP; adguardapi.NewMockClient returns one backed by an in-memory fake, for trying the handlers without
+// an instance.
+type AdGuardBackend interface {
+	BaseURL() string
+	CheckConnection() model.ConnectionCheck
+	GetStatus() (model.AdGuardStatus, error)
+	Reauthenticate() error
+	GetSessionExpiry() (time.Time, bool)
+
+	GetBlockedServices() (model.ServiceConfig, error)
+	GetBlockedServicesContext(ctx context.Context) (model.ServiceConfig, error)
+	UpdateBlockedServices(serviceConfig *model.ServiceConfig) error
+	UpdateBlockedServicesContext(ctx context.Context, serviceConfig *model.ServiceConfig) error
+	ResetBlockedServices() error
+	ResetBlockedServicesContext(ctx context.Context) error
+	ResetServiceIDs(ids []string) error
+	PatchBlockedServices(add, remove []string, timeZone string) (model.ServiceConfig, error)
+	UpdateTimeZone(timeZone string) (string, error)
+	GetManagedConfig() (model.ServiceConfig, error)
+	CheckDrift() (model.Drift, error)
+
+	GetAllBlockedServices() ([]model.BlockedService, error)
+	RefreshServiceCatalog() ([]model.BlockedService, error)
+	ResolveServiceNames(names []string, fuzzy bool) ([]model.ResolvedServiceName, []string, error)
+	ServiceGroupIDs() ([]string, error)
+	BlockGroup(group string) (model.GroupChange, error)
+	UnblockGroup(group string) (model.GroupChange, error)
+	BuildAllowlistConfig(allowed []string) (model.ServiceConfig, []string, error)
+	ApplyAllowlist(allowed []string) (model.ServiceConfig, error)
+
+	GetDisabledServices() []model.DisabledService
+	DisableService(id string) (model.DisabledService, error)
+	EnableService(id string) (model.DisabledService, error)
+	EnforcedIDs(ids []string) []string
+
+	GetSnapshots() []model.ConfigSnapshot
+	RollbackConfig() (model.ConfigSnapshot, error)
+
+	SetProtection(enabled bool, durationMs int) error
+	GetProtection() (model.ProtectionStatus, error)
+	GetUserRules() ([]string, error)
+	SetUserRules(rules []string) error
+	AddUserRule(rule string) ([]string, error)
+	RemoveUserRule(rule string) ([]string, error)
+	SetClientBlockedServices(name string, ids []string) error
+	GetFilterStatus() (model.FilteringStatus, error)
+	SetFilterEnabled(url string, enabled bool) error
+}
+
+var _ AdGuardBackend = (*adguardapi.Client)(nil)
+
+// backend is the AdGuard instance the handlers use, the default client configured from the environment
+// unless SetBackend replaced it
+var backend AdGuardBackend = adguardapi.DefaultClient()
+
+// SetBackend makes the handlers manage b instead of the default client. transport.Setup calls it before
+// the routes are served.
+func SetBackend(b AdGuardBackend) {
+	backend = b
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// maxBatchTimers is the most windows a single batch may create
+const maxBatchTimers = 20
+
+// batchWindow is a validated batch entry: when its window ends and the default services it unblocks
+type batchWindow struct {
+	deadline time.Time
+	scope    []string
+}
+
+// resolveBatchDeadline returns when a batch entry's window ends, or the field and message describing
+// why it is invalid. reset_after takes precedence over reset_after_min, and a duration can't be
+// combined with reset_date_time.
+func resolveBatchDeadline(entry model.BatchTimerEntry, now time.Time) (time.Time, string, string) {
+	hasDuration := entry.ResetAfter != "" || entry.ResetAfterMin > 0
+	if hasDuration && entry.ResetDateTime != "" {
+		return time.Time{}, "reset_date_time", "can't be combined with reset_after_min or reset_after"
+	}
+
+	var deadline time.Time
+	switch {
+	case entry.ResetAfter != "":
+		resetAfter, err := time.ParseDuration(entry.ResetAfter)
+		if err != nil || resetAfter <= 0 {
+			return time.Time{}, "reset_after", "must be a positive duration, e.g. 1h30m"
+		}
+		deadline = now.Add(resetAfter)
+	case entry.ResetAfterMin > 0:
+		deadline = now.Add(time.Duration(entry.ResetAfterMin) * time.Minute)
+	case entry.ResetDateTime != "":
+		timeZone := entry.TimeZone
+		if timeZone == "" {
+			timeZone = adguardapi.DefaultTimeZone()
+		}
+		location, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return time.Time{}, "timezone", "is not a valid IANA time zone"
+		}
+		deadline, err = parseDeadline(entry.ResetDateTime, location)
+		if err != nil {
+			return time.Time{}, "reset_date_time", "must be an ISO 8601 datetime, e.g. " + now.Add(time.Hour).Format(time.RFC3339)
+		}
+		if !deadline.After(now) {
+			return time.Time{}, "reset_date_time", "must be in the future"
+		}
+	default:
+		return time.Time{}, "reset_after_min", "must be greater than 0, or set reset_after or reset_date_time"
+	}
+
+	// Temporary access must stay temporary, so cap how far away the reset may be
+	if maxReset, maxResetMinutes := maxResetDuration(); maxReset > 0 && deadline.Sub(now) > maxReset {
+		return time.Time{}, "reset_after_min", "exceeds the maximum of " + strconv.Itoa(maxResetMinutes) + " minutes"
+	}
+	if err := timer.CheckDeadline(deadline); err != nil {
+		return time.Time{}, "reset_after_min", err.Error()
+	}
+	return deadline, "", ""
+}
+
+// combineBatchConfigs returns the configuration applying every entry at once: a service stays blocked
+// only if every entry blocks it. The schedule is the first entry's.
+func combineBatchConfigs(entries []model.BatchTimerEntry) model.ServiceConfig {
+	blockedBy := make(map[string]int)
+	for _, entry := range entries {
+		seen := make(map[string]bool, len(entry.ServiceConfig.IDs))
+		for _, id := range entry.ServiceConfig.IDs {
+			if !seen[id] {
+				seen[id] = true
+				blockedBy[id]++
+			}
+		}
+	}
+
+	combined := model.ServiceConfig{
+		IDs:      []string{},
+		Schedule: entries[0].ServiceConfig.Schedule,
+	}
+	for _, id := range entries[0].ServiceConfig.IDs {
+		if blockedBy[id] == len(entries) {
+			combined.IDs = append(combined.IDs, id)
+			blockedBy[id] = 0
+		}
+	}
+	return combined
+}
+
+// ApiCreateBatchTimers applies several unblock windows in one call, each with its own reset timer, e.g.
+// gaming until 5pm and social media until 8pm. Requires multiTimerMode.
+//
+// @Summary Create several unblock windows at once
+// @Tags timers
+// @Accept json
+// @Produce json
+// @Param body body []model.BatchTimerEntry true "Windows, each ending after reset_after_min, reset_after or at reset_date_time"
+// @Param Idempotency-Key header string false "Replays the first response when the same write is retried"
+// @Param dryRun query bool false "Return the config and timers that would be created without applying them"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "timer_ids, timers, added, removed"
+// @Failure 400 {object} model.ErrorResponse "Invalid body, overlapping windows or multiTimerMode disabled"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 429 {object} model.ErrorResponse "Unblock cooldown active"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/timers/batch [post]
+func ApiCreateBatchTimers(c *fiber.Ctx) error {
+	// Each window resets only its own services, which needs independent timers
+	if !multiTimerMode() {
+		logger.Error("[api][ApiCreateBatchTimers] Batch timers require multiTimerMode")
+		return respondError(c, fiber.StatusBadRequest, "Batch timers require multiTimerMode=true", nil)
+	}
+
+	var entries []model.BatchTimerEntry
+	if err := c.BodyParser(&entries); err != nil {
+		logger.Error("[api][ApiCreateBatchTimers] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body, expected an array of windows", nil)
+	}
+	if len(entries) == 0 || len(entries) > maxBatchTimers {
+		logger.Error("[api][ApiCreateBatchTimers] Invalid number of windows: ", len(entries))
+		return respondError(c, fiber.StatusBadRequest, "The batch must have between 1 and "+strconv.Itoa(maxBatchTimers)+" windows", nil)
+	}
+
+	// Validate every entry, and that no two windows unblock the same service: the first one to end would
+	// block it again while the other is still open
+	now := time.Now()
+	errs := fieldErrors{}
+	windows := make([]batchWindow, len(entries))
+	unblockedBy := make(map[string]int)
+	for i, entry := range entries {
+		field := "[" + strconv.Itoa(i) + "]"
+		for name, message := range validateServiceConfig(&entry.ServiceConfig, field+".config") {
+			errs[name] = message
+		}
+
+		deadline, name, message := resolveBatchDeadline(entry, now)
+		if name != "" {
+			errs[field+"."+name] = message
+		}
+
+		_, scope := newResetCallback(entry.ServiceConfig.IDs)
+		var overlapping []string
+		for _, id := range scope {
+			if other, ok := unblockedBy[id]; ok {
+				overlapping = append(overlapping, id+" (also in ["+strconv.Itoa(other)+"])")
+				continue
+			}
+			unblockedBy[id] = i
+		}
+		if len(overlapping) > 0 {
+			errs[field+".config.ids"] = "unblocks services of another window: " + strings.Join(overlapping, ", ")
+		}
+
+		windows[i] = batchWindow{deadline: deadline, scope: scope}
+	}
+	if invalid, err := respondFieldErrors(c, "ApiCreateBatchTimers", errs); invalid {
+		return err
+	}
+
+	// Refuse new unblock windows right after a reset, unless made by an admin
+	if blocked, err := checkCooldown(c, "ApiCreateBatchTimers"); blocked {
+		return err
+	}
+
+	combined := combineBatchConfigs(entries)
+	planned := make([]fiber.Map, len(windows))
+	for i, window := range windows {
+		planned[i] = fiber.Map{
+			"reset_date_time": window.deadline.Format(time.RFC3339),
+			"scope":           window.scope,
+		}
+	}
+
+	// In dry-run mode return the config and windows without applying anything
+	if isDryRun(c) {
+		logger.Info("[api][ApiCreateBatchTimers] Dry run requested, not applying configuration")
+		return respondDryRun(c, &combined, fiber.Map{
+			"timers": planned,
+		})
+	}
+
+	changes := fetchChanges("ApiCreateBatchTimers", combined.IDs)
+	err := backend.UpdateBlockedServicesContext(c.UserContext(), &combined)
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(combined.IDs),
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][ApiCreateBatchTimers] Failed to update blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update blocked services", err)
+	}
+
+	logger.Info("[api][ApiCreateBatchTimers] Successfully updated blocked services, creating ", len(windows), " timer(s)")
+
+	// One timer per window, each blocking again only the services it unblocked
+	timerIDs := []string{}
+	timerErrors := fiber.Map{}
+	for i, window := range windows {
+		timerID := uniqueResetTimerID(fmt.Sprintf(ResetTimerPrefix+"batch-%d", i+1))
+		callback, _ := newResetCallback(entries[i].ServiceConfig.IDs)
+		_, err := timer.NewTimer(timerID,
+			timer.WithDeadline(window.deadline),
+			timer.WithCallback(callback),
+			timer.WithScope(window.scope),
+			timer.WithMetadata(timerMetadata(c, "timers/batch", combined)),
+			resetWarning(),
+		)
+		if err != nil {
+			logger.Error("[api][ApiCreateBatchTimers] Failed to create timer for window " + strconv.Itoa(i))
+			logger.Error(err)
+			timerErrors[strconv.Itoa(i)] = err.Error()
+			continue
+		}
+
+		logger.Info("[api][ApiCreateBatchTimers] Timer created successfully with ID: " + timerID)
+		planned[i]["timer_id"] = timerID
+		timerIDs = append(timerIDs, timerID)
+	}
+
+	logAppliedConfig("ApiCreateBatchTimers", appliedConfigSummary{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(combined.IDs),
+		TimeZone:     combined.Schedule.TimeZone,
+		TimerSet:     len(timerIDs) > 0,
+		TimerID:      strings.Join(timerIDs, ","),
+	})
+	notify.Notify(notify.EventTimerCreated, "Services unblocked with "+strconv.Itoa(len(timerIDs))+" reset timer(s)", map[string]interface{}{
+		"timer_ids":     timerIDs,
+		"service_count": len(combined.IDs),
+	})
+
+	// Don't fail the request when a timer couldn't be created, the configuration is already applied
+	message := "Blocked services updated with " + strconv.Itoa(len(timerIDs)) + " reset timer(s)"
+	response := fiber.Map{
+		"timer_ids": timerIDs,
+		"timers":    planned,
+	}
+	if len(timerErrors) > 0 {
+		message = "Blocked services updated, but " + strconv.Itoa(len(timerErrors)) + " timer(s) failed"
+		response["timer_errors"] = timerErrors
+	}
+	return respondSuccess(c, message, response, changes.toMap())
+}
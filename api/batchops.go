@@ -0,0 +1,183 @@
+package api
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// maxBatchOperations is the most operations a single batch may run
+const maxBatchOperations = 20
+
+// The operations of POST /api/v1/batch
+const (
+	BatchOpGet         = "get"
+	BatchOpUpdate      = "update"
+	BatchOpReset       = "reset"
+	BatchOpAdd         = "add"
+	BatchOpRemove      = "remove"
+	BatchOpStartTimer  = "start_timer"
+	BatchOpCancelTimer = "cancel_timer"
+)
+
+// batchDispatcher serves the operations of a batch through the app's router, set by SetBatchDispatcher
+var batchDispatcher fasthttp.RequestHandler
+
+// SetBatchDispatcher sets the handler batch operations are served by, the app's once its routes are
+// registered. Operations then pass the same middleware as a direct request: the API key, the IP allowlist
+// and serializeOperation.
+func SetBatchDispatcher(handler fasthttp.RequestHandler) {
+	batchDispatcher = handler
+}
+
+// batchRequest is an operation translated to the request of its endpoint
+type batchRequest struct {
+	method string
+	path   string
+	body   []byte
+}
+
+// translateOperation returns the endpoint request of a batch operation, or the field and message
+// describing why it is invalid
+func translateOperation(operation model.BatchOperation) (batchRequest, string, string) {
+	switch operation.Op {
+	case BatchOpGet:
+		return batchRequest{method: fiber.MethodGet, path: "/api/v1/getblockedservices"}, "", ""
+	case BatchOpReset:
+		return batchRequest{method: fiber.MethodPost, path: "/api/v1/resetblockedservices"}, "", ""
+	case BatchOpAdd, BatchOpRemove:
+		if len(operation.IDs) == 0 {
+			return batchRequest{}, "ids", "is required"
+		}
+		body, _ := json.Marshal(map[string][]string{operation.Op: operation.IDs})
+		return batchRequest{method: fiber.MethodPatch, path: "/api/v1/blockedservices", body: body}, "", ""
+	case BatchOpCancelTimer:
+		if operation.TimerID == "" {
+			return batchRequest{}, "timer_id", "is required"
+		}
+		return batchRequest{method: fiber.MethodDelete, path: "/api/v1/timer/" + url.PathEscape(operation.TimerID)}, "", ""
+	case BatchOpUpdate, BatchOpStartTimer:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Body, &fields); err != nil || fields == nil {
+			return batchRequest{}, "body", "must be an object"
+		}
+		// A timer without an update merges no IDs, which keeps the configuration and only starts the reset timer
+		if operation.Op == BatchOpStartTimer {
+			fields["config"] = json.RawMessage(`{"ids":[]}`)
+			fields["mode"] = json.RawMessage(`"` + UpdateModeMerge + `"`)
+		}
+		path := "/api/v1/updateblockedservicesmin"
+		if _, ok := fields["reset_date_time"]; ok {
+			path = "/api/v1/updateblockedservicesdatetime"
+		}
+		body, _ := json.Marshal(fields)
+		return batchRequest{method: fiber.MethodPost, path: path, body: body}, "", ""
+	default:
+		return batchRequest{}, "op", "must be one of get, update, reset, add, remove, start_timer, cancel_timer"
+	}
+}
+
+// dispatchOperation serves an operation's request like the client had sent it, with its credentials and
+// address, and returns the status and body of the response
+func dispatchOperation(c *fiber.Ctx, prefix string, request batchRequest) (int, []byte) {
+	var req fasthttp.Request
+	req.Header.SetMethod(request.method)
+	req.SetRequestURI(prefix + request.path)
+	req.Header.SetHost(string(c.Request().Host()))
+	for _, header := range []string{"X-API-Key", fiber.HeaderAuthorization, fiber.HeaderXForwardedFor} {
+		if value := c.Get(header); value != "" {
+			req.Header.Set(header, value)
+		}
+	}
+	if request.body != nil {
+		req.Header.SetContentType(fiber.MIMEApplicationJSON)
+		req.SetBody(request.body)
+	}
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, c.Context().RemoteAddr(), nil)
+	batchDispatcher(&ctx)
+
+	return ctx.Response.StatusCode(), append([]byte(nil), ctx.Response.Body()...)
+}
+
+// ApiBatch runs several operations in one round trip, in order, e.g. update, read back and start a timer.
+// Each operation is served by its endpoint, so it behaves exactly like a direct request; other requests
+// may still run between two operations. The batch stops at the first failed operation unless
+// continueOnError is set.
+//
+// @Summary Run several operations in one request
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body []model.BatchOperation true "Operations to run in order"
+// @Param continueOnError query bool false "Run the remaining operations after one fails"
+// @Success 200 {object} model.BatchResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid body or operation"
+// @Security ApiKeyAuth
+// @Router /api/v1/batch [post]
+func ApiBatch(c *fiber.Ctx) error {
+	var operations []model.BatchOperation
+	if err := c.BodyParser(&operations); err != nil {
+		logger.Error("[api][ApiBatch] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body, expected an array of operations", nil)
+	}
+	if len(operations) == 0 || len(operations) > maxBatchOperations {
+		logger.Error("[api][ApiBatch] Invalid number of operations: ", len(operations))
+		return respondError(c, fiber.StatusBadRequest, "The batch must have between 1 and "+strconv.Itoa(maxBatchOperations)+" operations", nil)
+	}
+
+	// Validate every operation before running the first one
+	errs := fieldErrors{}
+	requests := make([]batchRequest, len(operations))
+	for i, operation := range operations {
+		request, name, message := translateOperation(operation)
+		if name != "" {
+			errs["["+strconv.Itoa(i)+"]."+name] = message
+		}
+		requests[i] = request
+	}
+	if invalid, err := respondFieldErrors(c, "ApiBatch", errs); invalid {
+		return err
+	}
+
+	// The operation paths sit under the same route prefix as the batch
+	prefix := strings.TrimSuffix(c.Route().Path, "/api/v1/batch")
+	continueOnError := c.QueryBool("continueOnError")
+
+	response := model.BatchResponse{
+		Success: true,
+		Results: []model.BatchOperationResult{},
+	}
+	for i, request := range requests {
+		status, body := dispatchOperation(c, prefix, request)
+		if !json.Valid(body) {
+			body, _ = json.Marshal(string(body))
+		}
+		response.Results = append(response.Results, model.BatchOperationResult{
+			Op:     operations[i].Op,
+			Status: status,
+			Body:   body,
+		})
+		response.Completed++
+
+		if status >= fiber.StatusBadRequest {
+			response.Success = false
+			logger.Warning("[api][ApiBatch] Operation " + strconv.Itoa(i) + " (" + operations[i].Op + ") failed with status " + strconv.Itoa(status))
+			if !continueOnError {
+				break
+			}
+		}
+	}
+
+	logger.Info("[api][ApiBatch] Ran ", response.Completed, " of ", len(operations), " operation(s), success: ", response.Success)
+
+	return c.JSON(&response)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiSetClientBlockedServices sets the blocked services of a single AdGuard client
+//
+// @Summary Set the blocked services of a client
+// @Tags clients
+// @Accept json
+// @Produce json
+// @Param name path string true "Persistent client name"
+// @Param body body model.ClientBlockedServicesRequest true "Service IDs"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 404 {object} model.ErrorResponse "Client not found"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/clients/{name}/blockedservices [put]
+func ApiSetClientBlockedServices(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	// Parse request body into ClientBlockedServicesRequest model
+	var clientRequest model.ClientBlockedServicesRequest
+	err := c.BodyParser(&clientRequest)
+	if err != nil || clientRequest.IDs == nil {
+		logger.Error("[api][ApiSetClientBlockedServices] Failed to parse request body")
+		return respondError(c, fiber.StatusBadRequest, "Request body must contain an ids list", nil)
+	}
+
+	err = backend.SetClientBlockedServices(name, clientRequest.IDs)
+	if errors.Is(err, adguardapi.ErrClientNotFound) {
+		logger.Warning("[api][ApiSetClientBlockedServices] Client '" + name + "' not found")
+		return respondError(c, fiber.StatusNotFound, "Client '"+name+"' not found", nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiSetClientBlockedServices] Failed to update client blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update client blocked services", err)
+	}
+
+	logger.Info("[api][ApiSetClientBlockedServices] Successfully updated blocked services for client '" + name + "'")
+
+	return respondSuccess(c, "Blocked services updated for client '"+name+"'", fiber.Map{
+		"client": name,
+		"ids":    clientRequest.IDs,
+	})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/mqtt"
+	"github.com/welasco/adguardfilter/common/tracing"
+)
+
+// EffectiveConfig returns the non-secret settings in effect, with the defaults applied. Credentials and
+// API keys are never included, only whether they are configured.
+func EffectiveConfig() fiber.Map {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "3000"
+	}
+	_, maxResetMinutes := maxResetDuration()
+
+	return fiber.Map{
+		"adguard_base_url":        redactURL(backend.BaseURL()),
+		"credentials_configured":  config.GetSecret("authUsername") != "" && config.GetSecret("authPassword") != "",
+		"api_key_enabled":         config.GetSecret("apiKey") != "",
+		"admin_api_key_enabled":   config.GetSecret("adminApiKey") != "",
+		"port":                    port,
+		"bind_address":            os.Getenv("bindAddress"),
+		"route_prefix":            os.Getenv("routePrefix"),
+		"serve_static":            config.GetBool("serveStatic", true),
+		"trust_proxy":             os.Getenv("trustProxy"),
+		"ip_allowlist_enabled":    os.Getenv("allowedIPs") != "",
+		"default_time_zone":       adguardapi.DefaultTimeZone(),
+		"default_services_source": adguardapi.DefaultConfigSource(),
+		"default_services_count":  len(adguardapi.BuildDefaultConfig().IDs),
+		"log_level":               logger.GetLevel(),
+		"multi_timer_mode":        multiTimerMode(),
+		"max_reset_minutes":       maxResetMinutes,
+		"max_timer_horizon_hours": config.GetInt("maxTimerHorizonHours", 0),
+		"unblock_cooldown_min":    config.GetInt("unblockCooldownMinutes", 0),
+		"reset_on_shutdown":       config.GetBool("resetOnShutdown", true),
+		"default_reset_policy":    defaultResetPolicy(),
+		"webhook_configured":      config.GetSecret("webhookURL") != "",
+		"mqtt_enabled":            mqtt.Enabled(),
+		"tracing_enabled":         tracing.Enabled(),
+		"adguard_mock":            adguardapi.MockEnabled(),
+		"timeouts": fiber.Map{
+			"read_sec":            config.GetInt("readTimeoutSec", 10),
+			"write_sec":           config.GetInt("writeTimeoutSec", 0),
+			"idle_sec":            config.GetInt("idleTimeoutSec", 60),
+			"test_connection_sec": config.GetInt("testConnectionTimeoutSec", 10),
+			"webhook_sec":         config.GetInt("webhookTimeoutSec", 5),
+		},
+	}
+}
+
+// redactURL drops a password embedded in a URL
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Redacted()
+}
+
+// ApiGetConfig returns the effective runtime configuration, so users can confirm their .env took effect
+//
+// @Summary Get the effective runtime configuration
+// @Tags status
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /api/v1/config [get]
+func ApiGetConfig(c *fiber.Ctx) error {
+	logger.Debug("[api][ApiGetConfig] Returning effective configuration")
+	return c.JSON(EffectiveConfig())
+}
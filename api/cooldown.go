@@ -0,0 +1,70 @@
+package api
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// LocalsAdmin is the fiber.Ctx local set to true by the auth middleware when the request
+// carries the admin API key
+const LocalsAdmin = "admin"
+
+var (
+	// When a reset timer last reset the blocked services, zero until the first one fires
+	lastTimerReset   time.Time
+	lastTimerResetMu sync.Mutex
+)
+
+// recordTimerReset starts the unblock cooldown
+func recordTimerReset() {
+	lastTimerResetMu.Lock()
+	defer lastTimerResetMu.Unlock()
+	lastTimerReset = time.Now()
+}
+
+// cooldownRemaining returns how long until a new unblock window is allowed, after a reset timer fired
+// less than unblockCooldownMinutes ago (default 0, disabled)
+func cooldownRemaining() time.Duration {
+	cooldown := time.Duration(config.GetInt("unblockCooldownMinutes", 0)) * time.Minute
+	if cooldown <= 0 {
+		return 0
+	}
+
+	lastTimerResetMu.Lock()
+	defer lastTimerResetMu.Unlock()
+	if lastTimerReset.IsZero() {
+		return 0
+	}
+	return time.Until(lastTimerReset.Add(cooldown))
+}
+
+// isAdmin reports whether the request was authenticated with the admin API key
+func isAdmin(c *fiber.Ctx) bool {
+	admin, _ := c.Locals(LocalsAdmin).(bool)
+	return admin
+}
+
+// checkCooldown answers 429 and returns true when the request must wait for the unblock cooldown.
+// Requests made with the admin API key bypass it.
+func checkCooldown(c *fiber.Ctx, caller string) (bool, error) {
+	remaining := cooldownRemaining()
+	if remaining <= 0 {
+		return false, nil
+	}
+	if isAdmin(c) {
+		logger.Info("[api][" + caller + "] Unblock cooldown bypassed with the admin API key")
+		return false, nil
+	}
+
+	logger.Warning("[api][" + caller + "] Rejected unblock during cooldown, " + remaining.Round(time.Second).String() + " remaining")
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(remaining.Seconds())+1))
+	return true, respondError(c, fiber.StatusTooManyRequests, "A new unblock window is not allowed yet", fiber.Map{
+		"seconds_remaining": int64(remaining.Seconds()) + 1,
+		"next_allowed_at":   time.Now().Add(remaining).Format(time.RFC3339),
+	})
+}
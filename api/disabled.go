@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetDisabledServices lists the services kept in the configuration but not enforced
+//
+// @Summary List the disabled services
+// @Tags blocked services
+// @Produce json
+// @Success 200 {object} model.DisabledServicesResponse
+// @Security ApiKeyAuth
+// @Router /api/v1/services/disabled [get]
+func ApiGetDisabledServices(c *fiber.Ctx) error {
+	disabled := backend.GetDisabledServices()
+	logger.Debug("[api][ApiGetDisabledServices] Returning ", len(disabled), " disabled service(s)")
+
+	return c.JSON(model.DisabledServicesResponse{
+		Count:    len(disabled),
+		Disabled: disabled,
+	})
+}
+
+// ApiDisableService stops enforcing a service without removing it from the configuration, so it can be
+// enabled again later without re-finding its ID
+//
+// @Summary Disable a service without removing it
+// @Tags blocked services
+// @Produce json
+// @Param id path string true "Service ID, e.g. youtube"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "service"
+// @Failure 404 {object} model.ErrorResponse "Service not in the catalog"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/services/{id}/disable [post]
+func ApiDisableService(c *fiber.Ctx) error {
+	// The ID is kept after the request, so it must not share fasthttp's reused buffer
+	id := utils.CopyString(c.Params("id"))
+
+	service, err := backend.DisableService(id)
+	if errors.Is(err, adguardapi.ErrUnknownServiceIDs) {
+		return respondError(c, fiber.StatusNotFound, "Unknown service ID: "+id, nil)
+	}
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionDisable,
+		ServiceCount: 1,
+	}, nil, err)
+	if err != nil {
+		logger.Error("[api][ApiDisableService] Failed to disable service " + id)
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to disable service", err)
+	}
+
+	logger.Info("[api][ApiDisableService] Disabled service " + id)
+
+	return respondSuccess(c, "Service "+id+" disabled", fiber.Map{
+		"service": service,
+	})
+}
+
+// ApiEnableService enforces a disabled service again, blocking it when the configuration does
+//
+// @Summary Enable a disabled service
+// @Tags blocked services
+// @Produce json
+// @Param id path string true "Service ID, e.g. youtube"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "service, blocked"
+// @Failure 404 {object} model.ErrorResponse "Service not disabled"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/services/{id}/enable [post]
+func ApiEnableService(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	service, err := backend.EnableService(id)
+	if errors.Is(err, adguardapi.ErrServiceNotDisabled) {
+		return respondError(c, fiber.StatusNotFound, "Service "+id+" is not disabled", nil)
+	}
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionEnable,
+		ServiceCount: 1,
+	}, nil, err)
+	if err != nil {
+		logger.Error("[api][ApiEnableService] Failed to enable service " + id)
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to enable service", err)
+	}
+
+	logger.Info("[api][ApiEnableService] Enabled service " + id)
+
+	return respondSuccess(c, "Service "+id+" enabled", fiber.Map{
+		"service": service,
+		"blocked": service.InConfig,
+	})
+}
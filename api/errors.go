@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/welasco/adguardfilter/adguardapi"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// Error codes for failures talking to AdGuard Home
+const (
+	ErrCodeAdGuardUnreachable = "adguard_unreachable"
+	ErrCodeAdGuardTimeout     = "adguard_timeout"
+	ErrCodeAdGuardAuthFailed  = "adguard_auth_failed"
+)
+
+// ErrorHandler formats every error returned by a handler or middleware as the JSON error envelope
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return respondError(c, fiberErr.Code, fiberErr.Message, nil)
+	}
+
+	logger.Error("[api][ErrorHandler] Unhandled error on " + c.Method() + " " + c.Path())
+	logger.Error(err)
+	return respondUpstreamError(c, "Internal server error", err)
+}
+
+// respondError writes the JSON error envelope {"error": {"code", "message", "details"}}, with the code
+// derived from the status (e.g. 404 becomes "not_found")
+func respondError(c *fiber.Ctx, status int, message string, details fiber.Map) error {
+	return writeError(c, status, codeForStatus(status), message, details)
+}
+
+// respondUpstreamError writes the JSON error envelope for a failed AdGuard call. Unreachable and
+// authentication failures map to 502, timeouts to 504 and anything else to 500.
+func respondUpstreamError(c *fiber.Ctx, message string, err error) error {
+	switch {
+	case errors.Is(err, adguardapi.ErrAdGuardTimeout):
+		return writeError(c, fiber.StatusGatewayTimeout, ErrCodeAdGuardTimeout, message, nil)
+	case errors.Is(err, adguardapi.ErrAdGuardUnreachable):
+		return writeError(c, fiber.StatusBadGateway, ErrCodeAdGuardUnreachable, message, nil)
+	case errors.Is(err, adguardapi.ErrAuthFailed):
+		return writeError(c, fiber.StatusBadGateway, ErrCodeAdGuardAuthFailed, message, nil)
+	default:
+		return respondError(c, fiber.StatusInternalServerError, message, nil)
+	}
+}
+
+// writeError writes the JSON error envelope with an explicit code
+func writeError(c *fiber.Ctx, status int, code string, message string, details fiber.Map) error {
+	return c.Status(status).JSON(model.ErrorResponse{
+		Error: model.ErrorBody{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+// respondSuccess writes a success response {"success": true, "message", ...} with the fields of data
+func respondSuccess(c *fiber.Ctx, message string, data ...fiber.Map) error {
+	response := model.SuccessResponse{
+		Success: true,
+		Message: message,
+		Data:    fiber.Map{},
+	}
+	for _, fields := range data {
+		for key, value := range fields {
+			response.Data[key] = value
+		}
+	}
+	return c.JSON(response)
+}
+
+// codeForStatus turns an HTTP status into a snake case error code, e.g. "Bad Request" into "bad_request"
+func codeForStatus(status int) string {
+	return strings.ReplaceAll(strings.ToLower(utils.StatusMessage(status)), " ", "_")
+}
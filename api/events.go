@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/timer"
+)
+
+// sseHeartbeatInterval is how often a comment line is sent to keep proxies from closing idle streams
+const sseHeartbeatInterval = 15 * time.Second
+
+// PublishTimerEvents forwards reset timer state changes to the event bus
+func PublishTimerEvents() {
+	eventTypes := map[string]string{
+		timer.EventCreated:   events.TimerCreated,
+		timer.EventExpired:   events.TimerExpired,
+		timer.EventCancelled: events.TimerCancelled,
+		timer.EventWarning:   events.TimerWarning,
+	}
+
+	timer.AddObserver(func(event timer.Event) {
+		if !strings.HasPrefix(event.TimerID, ResetTimerPrefix) {
+			return
+		}
+		events.Publish(eventTypes[event.Type], map[string]interface{}{
+			"timer_id":    event.TimerID,
+			"expire_time": event.ExpireTime.Format(time.RFC3339),
+		})
+	})
+}
+
+// ApiEvents streams timer and configuration events as Server-Sent Events
+//
+// @Summary Stream timer and configuration events
+// @Tags events
+// @Produce text/event-stream
+// @Success 200 {string} string "Server-Sent Events stream"
+// @Security ApiKeyAuth
+// @Router /api/v1/events [get]
+func ApiEvents(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	clientIP := ClientIP(c)
+	subscription, unsubscribe := events.Subscribe(16)
+	logger.Info("[api][ApiEvents] Client subscribed from " + clientIP)
+
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case event, ok := <-subscription:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					logger.Error("[api][ApiEvents] Failed to marshal event: " + event.Type)
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+
+			// A failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				logger.Info("[api][ApiEvents] Client disconnected from " + clientIP)
+				return
+			}
+		}
+	}))
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetFilters returns the subscribed AdGuard filter lists with their rule counts
+//
+// @Summary List the subscribed filter lists
+// @Tags filters
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/filters [get]
+func ApiGetFilters(c *fiber.Ctx) error {
+	filteringStatus, err := backend.GetFilterStatus()
+	if err != nil {
+		logger.Error("[api][ApiGetFilters] Failed to get filter lists")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get filter lists", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"enabled":           filteringStatus.Enabled,
+		"interval":          filteringStatus.Interval,
+		"filters":           filteringStatus.Filters,
+		"whitelist_filters": filteringStatus.WhitelistFilters,
+	})
+}
+
+// ApiSetFilterEnabled enables or disables a subscribed filter list by URL
+//
+// @Summary Enable or disable a filter list
+// @Tags filters
+// @Accept json
+// @Produce json
+// @Param body body model.FilterToggleRequest true "Filter URL and state"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 404 {object} model.ErrorResponse "Filter not found"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/filters [patch]
+func ApiSetFilterEnabled(c *fiber.Ctx) error {
+	// Parse request body into FilterToggleRequest model
+	var toggleRequest model.FilterToggleRequest
+	err := c.BodyParser(&toggleRequest)
+	if err != nil {
+		logger.Error("[api][ApiSetFilterEnabled] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	// Validate the request
+	if toggleRequest.URL == "" || toggleRequest.Enabled == nil {
+		logger.Error("[api][ApiSetFilterEnabled] Missing url or enabled field")
+		return respondError(c, fiber.StatusBadRequest, "url and enabled are required", nil)
+	}
+
+	err = backend.SetFilterEnabled(toggleRequest.URL, *toggleRequest.Enabled)
+	if errors.Is(err, adguardapi.ErrFilterNotFound) {
+		logger.Warning("[api][ApiSetFilterEnabled] Filter '" + toggleRequest.URL + "' not found")
+		return respondError(c, fiber.StatusNotFound, "Filter '"+toggleRequest.URL+"' not found", nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiSetFilterEnabled] Failed to update filter")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update filter", err)
+	}
+
+	logger.Info("[api][ApiSetFilterEnabled] Successfully updated filter '" + toggleRequest.URL + "'")
+
+	return respondSuccess(c, "Filter updated", fiber.Map{
+		"url":     toggleRequest.URL,
+		"enabled": *toggleRequest.Enabled,
+	})
+}
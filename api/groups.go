@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiBlockGroup blocks every service of a catalog group at once, e.g. all social media for the night
+//
+// @Summary Block all services of a group
+// @Tags blocked services
+// @Produce json
+// @Param group path string true "Group ID from GET /api/v1/getservicelist, e.g. social_network"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "group, members, affected, service_count"
+// @Failure 404 {object} model.ErrorResponse "Unknown group, details list the valid_groups"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/groups/{group}/block [post]
+func ApiBlockGroup(c *fiber.Ctx) error {
+	return changeGroup(c, "ApiBlockGroup", true)
+}
+
+// ApiUnblockGroup unblocks every service of a catalog group at once
+//
+// @Summary Unblock all services of a group
+// @Tags blocked services
+// @Produce json
+// @Param group path string true "Group ID from GET /api/v1/getservicelist, e.g. gaming"
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "group, members, affected, service_count"
+// @Failure 404 {object} model.ErrorResponse "Unknown group, details list the valid_groups"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/groups/{group}/unblock [post]
+func ApiUnblockGroup(c *fiber.Ctx) error {
+	return changeGroup(c, "ApiUnblockGroup", false)
+}
+
+// changeGroup blocks or unblocks the group in the path and answers with the affected IDs
+func changeGroup(c *fiber.Ctx, caller string, block bool) error {
+	// The group is kept after the request, so it must not share fasthttp's reused buffer
+	group := utils.CopyString(c.Params("group"))
+
+	var change model.GroupChange
+	var err error
+	if block {
+		change, err = backend.BlockGroup(group)
+	} else {
+		change, err = backend.UnblockGroup(group)
+	}
+	if errors.Is(err, adguardapi.ErrUnknownGroup) {
+		validGroups, _ := backend.ServiceGroupIDs()
+		return respondError(c, fiber.StatusNotFound, "Unknown group: "+group, fiber.Map{
+			"valid_groups": validGroups,
+		})
+	}
+
+	changes := &serviceChanges{Added: []string{}, Removed: []string{}}
+	if block {
+		changes.Added = change.Affected
+	} else {
+		changes.Removed = change.Affected
+	}
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ServiceCount: change.ServiceCount,
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][" + caller + "] Failed to change group " + group)
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update blocked services", err)
+	}
+
+	message := "Group " + group + " unblocked"
+	if block {
+		message = "Group " + group + " blocked"
+	}
+	logger.Info("[api][" + caller + "] " + message)
+
+	return respondSuccess(c, message, fiber.Map{
+		"group":         change.Group,
+		"members":       change.Members,
+		"affected":      change.Affected,
+		"service_count": change.ServiceCount,
+	})
+}
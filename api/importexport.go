@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiExportConfig returns the current blocked services configuration in the format accepted by ApiImportConfig
+//
+// @Summary Export the blocked services configuration
+// @Tags blocked services
+// @Produce json
+// @Param download query bool false "Offer the configuration as a file download"
+// @Success 200 {object} model.ServiceConfig
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/export [get]
+func ApiExportConfig(c *fiber.Ctx) error {
+	serviceConfig, err := backend.GetBlockedServicesContext(c.UserContext())
+	if err != nil {
+		logger.Error("[api][ApiExportConfig] Failed to get blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get blocked services", err)
+	}
+
+	logger.Info("[api][ApiExportConfig] Exporting configuration with ", len(serviceConfig.IDs), " service(s)")
+
+	// Offer the snapshot as a file when requested, e.g. from a browser
+	if c.QueryBool("download") {
+		c.Attachment("adguardfilter-" + time.Now().Format("20060102-150405") + ".json")
+	}
+
+	return c.JSON(&serviceConfig)
+}
+
+// ApiImportConfig validates a full ServiceConfig and applies it verbatim. Service IDs are checked against
+// the AdGuard catalog unless ?validateIds=false.
+//
+// @Summary Import a blocked services configuration
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body model.ServiceConfig true "Configuration as returned by the export"
+// @Param validateIds query bool false "Check the IDs against the AdGuard catalog" default(true)
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/import [post]
+func ApiImportConfig(c *fiber.Ctx) error {
+	// Decode strictly so a body of the wrong shape is rejected instead of silently applying an empty list
+	var serviceConfig model.ServiceConfig
+	decoder := json.NewDecoder(bytes.NewReader(c.Body()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&serviceConfig); err != nil {
+		logger.Error("[api][ApiImportConfig] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Request body must be a service config with ids and schedule", fiber.Map{
+			"reason": err.Error(),
+		})
+	}
+
+	// Validate the configuration
+	if serviceConfig.IDs == nil {
+		return respondError(c, fiber.StatusBadRequest, "ids is required", nil)
+	}
+	if serviceConfig.Schedule.TimeZone != "" {
+		if _, err := time.LoadLocation(serviceConfig.Schedule.TimeZone); err != nil {
+			return respondError(c, fiber.StatusBadRequest, "Invalid schedule.time_zone: "+serviceConfig.Schedule.TimeZone, nil)
+		}
+	}
+
+	seen := make(map[string]bool, len(serviceConfig.IDs))
+	for _, id := range serviceConfig.IDs {
+		if id == "" || seen[id] {
+			return respondError(c, fiber.StatusBadRequest, "ids must be unique and non-empty", fiber.Map{
+				"id": id,
+			})
+		}
+		seen[id] = true
+	}
+
+	if c.QueryBool("validateIds", true) {
+		catalog, err := backend.GetAllBlockedServices()
+		if err != nil {
+			logger.Error("[api][ApiImportConfig] Failed to get service catalog")
+			logger.Error(err)
+			return respondUpstreamError(c, "Failed to get service catalog to validate ids", err)
+		}
+
+		known := make(map[string]bool, len(catalog))
+		for _, service := range catalog {
+			known[service.ID] = true
+		}
+
+		unknownIDs := make([]string, 0)
+		for _, id := range serviceConfig.IDs {
+			if !known[id] {
+				unknownIDs = append(unknownIDs, id)
+			}
+		}
+		if len(unknownIDs) > 0 {
+			logger.Error("[api][ApiImportConfig] Import contains ", len(unknownIDs), " unknown service ID(s)")
+			return respondError(c, fiber.StatusBadRequest, "Unknown service IDs", fiber.Map{
+				"unknown_ids": unknownIDs,
+			})
+		}
+	}
+
+	// In dry-run mode return the config that would be applied without sending it
+	if isDryRun(c) {
+		logger.Info("[api][ApiImportConfig] Dry run requested, not applying configuration")
+		return respondDryRun(c, &serviceConfig, nil)
+	}
+
+	changes := fetchChanges("ApiImportConfig", serviceConfig.IDs)
+	err := backend.UpdateBlockedServicesContext(c.UserContext(), &serviceConfig)
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionImport,
+		ServiceCount: len(serviceConfig.IDs),
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][ApiImportConfig] Failed to apply imported configuration")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to apply imported configuration", err)
+	}
+
+	logger.Info("[api][ApiImportConfig] Successfully imported configuration with ", len(serviceConfig.IDs), " service(s)")
+
+	return respondSuccess(c, "Configuration imported", fiber.Map{
+		"config": serviceConfig,
+	}, changes.toMap())
+}
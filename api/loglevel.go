@@ -0,0 +1,69 @@
+package api
+
+import (
+	"github.com/welasco/adguardfilter/common/config"
+
+	"github.com/gofiber/fiber/v2"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetLogLevel returns the current log level
+//
+// @Summary Get the log level
+// @Tags logging
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /api/v1/loglevel [get]
+func ApiGetLogLevel(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"level": logger.GetLevel(),
+	})
+}
+
+// ApiSetLogLevel changes the log level at runtime, e.g. to Debug while reproducing a problem.
+// When adminApiKey is configured only admin requests may change it.
+//
+// @Summary Change the log level
+// @Tags logging
+// @Accept json
+// @Produce json
+// @Param body body model.LogLevelRequest true "New level"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 403 {object} model.ErrorResponse "Admin API key required"
+// @Security ApiKeyAuth
+// @Router /api/v1/loglevel [put]
+func ApiSetLogLevel(c *fiber.Ctx) error {
+	if config.GetSecret("adminApiKey") != "" && !isAdmin(c) {
+		logger.Warning("[api][ApiSetLogLevel] Rejected log level change without the admin API key from " + ClientIP(c))
+		return respondError(c, fiber.StatusForbidden, "Changing the log level requires the admin API key", nil)
+	}
+
+	// Parse request body into LogLevelRequest model
+	var levelRequest model.LogLevelRequest
+	err := c.BodyParser(&levelRequest)
+	if err != nil {
+		logger.Error("[api][ApiSetLogLevel] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	previous := logger.GetLevel()
+	err = logger.SetLevel(levelRequest.Level)
+	if err != nil {
+		logger.Error("[api][ApiSetLogLevel] Invalid log level '" + levelRequest.Level + "'")
+		return respondError(c, fiber.StatusBadRequest, err.Error(), fiber.Map{
+			"allowed": []string{"Err", "Warn", "Inf", "Deb"},
+		})
+	}
+
+	// Logged as a warning so the change shows up at every level but Err
+	logger.Warning("[api][ApiSetLogLevel] Log level changed from " + previous + " to " + logger.GetLevel() + " by " + ClientIP(c))
+
+	return respondSuccess(c, "Log level changed", fiber.Map{
+		"level":          logger.GetLevel(),
+		"previous_level": previous,
+	})
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/servicelist"
+	"github.com/welasco/adguardfilter/model"
+)
+
+var (
+	// pendingReset is the reset that couldn't reach AdGuard at its scheduled time, nil when none
+	pendingReset *model.PendingReset
+	// pendingRevision changes whenever pendingReset is replaced or widened, so an attempt that raced a newer
+	// failure doesn't clear it
+	pendingRevision   int
+	reconcilerRunning bool
+	pendingResetMu    sync.Mutex
+)
+
+// pendingResetPath returns the file the pending reset marker is persisted to, so it survives a restart
+func pendingResetPath() string {
+	if path := os.Getenv("pendingResetPath"); path != "" {
+		return path
+	}
+	return "pending_reset.json"
+}
+
+// GetPendingReset returns the reset waiting for AdGuard to come back, and false when there is none
+func GetPendingReset() (model.PendingReset, bool) {
+	pendingResetMu.Lock()
+	defer pendingResetMu.Unlock()
+
+	if pendingReset == nil {
+		return model.PendingReset{}, false
+	}
+	pending := *pendingReset
+	pending.Scope = copyScope(pendingReset.Scope)
+	return pending, true
+}
+
+// ClearPendingReset drops the pending reset marker, e.g. after a full reset made it redundant
+func ClearPendingReset() {
+	pendingResetMu.Lock()
+	defer pendingResetMu.Unlock()
+
+	if pendingReset == nil {
+		return
+	}
+	pendingReset = nil
+	pendingRevision++
+	removePendingReset()
+	logger.Info("[api][ClearPendingReset] Pending reset cleared")
+}
+
+// ResumePendingReset loads a pending reset left by a previous run and attempts it right away
+func ResumePendingReset() {
+	data, err := os.ReadFile(pendingResetPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("[api][ResumePendingReset] Failed to read pending reset file")
+			logger.Error(err)
+		}
+		return
+	}
+
+	var loaded model.PendingReset
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		logger.Error("[api][ResumePendingReset] Failed to parse pending reset file")
+		logger.Error(err)
+		return
+	}
+
+	pendingResetMu.Lock()
+	pendingReset = &loaded
+	pendingRevision++
+	pendingResetMu.Unlock()
+
+	logger.Warning("[api][ResumePendingReset] A reset has been pending since " + loaded.Since + ", retrying it")
+	startReconciler(0)
+}
+
+// markPendingReset records a reset that failed all its retries, merging it with one that is already pending,
+// and starts retrying it every resetFollowUpMin minutes
+func markPendingReset(timerID string, scope []string, attempts int, err error) {
+	recordPendingReset(timerID, scope, attempts, err)
+
+	interval := time.Duration(config.GetInt("resetFollowUpMin", 5)) * time.Minute
+	if interval <= 0 {
+		logger.Error("[api][markPendingReset] Reset failed and follow-up retries are disabled, blocked services were NOT reset until the next start or a manual reset")
+		return
+	}
+
+	logger.Warning("[api][markPendingReset] Reset failed, retrying it every " + interval.String() + " until AdGuard is back")
+	startReconciler(interval)
+}
+
+// recordPendingReset records and persists a reset that is due, merging it with one that is already pending,
+// without retrying it
+func recordPendingReset(timerID string, scope []string, attempts int, err error) {
+	pendingResetMu.Lock()
+	defer pendingResetMu.Unlock()
+
+	now := time.Now().Format(time.RFC3339)
+	if pendingReset == nil {
+		pendingReset = &model.PendingReset{
+			TimerID: timerID,
+			Scope:   copyScope(scope),
+			Since:   now,
+		}
+	} else {
+		pendingReset.Scope = mergeScope(pendingReset.Scope, scope)
+	}
+	pendingReset.Attempts += attempts
+	if attempts > 0 {
+		pendingReset.LastAttempt = now
+	}
+	if err != nil {
+		pendingReset.LastError = err.Error()
+	}
+	pendingRevision++
+	savePendingReset(*pendingReset)
+}
+
+// startReconciler retries the pending reset in the background after delay, unless it is already being retried
+func startReconciler(delay time.Duration) {
+	pendingResetMu.Lock()
+	defer pendingResetMu.Unlock()
+
+	if reconcilerRunning {
+		return
+	}
+	reconcilerRunning = true
+	go reconcilePendingReset(delay)
+}
+
+// reconcilePendingReset attempts the pending reset until it succeeds or is cleared, every resetFollowUpMin
+// minutes. With resetFollowUpMin set to 0 it gives up after one attempt.
+func reconcilePendingReset(delay time.Duration) {
+	interval := time.Duration(config.GetInt("resetFollowUpMin", 5)) * time.Minute
+
+	for {
+		time.Sleep(delay)
+		delay = interval
+
+		pendingResetMu.Lock()
+		if pendingReset == nil {
+			reconcilerRunning = false
+			pendingResetMu.Unlock()
+			return
+		}
+		pending := *pendingReset
+		pending.Scope = copyScope(pendingReset.Scope)
+		revision := pendingRevision
+		pendingResetMu.Unlock()
+
+		endOperation := adguardapi.WaitOperation("pending reset")
+		err := applyReset("reconcilePendingReset", pending.TimerID, pending.Scope)
+		endOperation()
+
+		pendingResetMu.Lock()
+		switch {
+		case pendingReset == nil:
+			reconcilerRunning = false
+			pendingResetMu.Unlock()
+			return
+		case err == nil && pendingRevision == revision:
+			logger.Info("[api][reconcilePendingReset] Pending reset since "+pending.Since+" succeeded after ", pending.Attempts+1, " attempt(s)")
+			pendingReset = nil
+			pendingRevision++
+			reconcilerRunning = false
+			removePendingReset()
+			pendingResetMu.Unlock()
+			recordTimerReset()
+			return
+		case err != nil:
+			pendingReset.Attempts++
+			pendingReset.LastAttempt = time.Now().Format(time.RFC3339)
+			pendingReset.LastError = err.Error()
+			savePendingReset(*pendingReset)
+		}
+
+		if interval <= 0 {
+			logger.Error("[api][reconcilePendingReset] Pending reset failed and follow-up retries are disabled")
+			reconcilerRunning = false
+			pendingResetMu.Unlock()
+			return
+		}
+		pendingResetMu.Unlock()
+	}
+}
+
+// savePendingReset writes the pending reset marker atomically. A failure is only logged, the reset
+// is still retried for as long as the service runs.
+func savePendingReset(pending model.PendingReset) {
+	data, err := json.MarshalIndent(pending, "", "  ")
+	if err == nil {
+		path := pendingResetPath()
+		tmpPath := path + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+	}
+	if err != nil {
+		logger.Error("[api][savePendingReset] Failed to persist pending reset, it will not survive a restart")
+		logger.Error(err)
+	}
+}
+
+// removePendingReset deletes the pending reset marker file
+func removePendingReset() {
+	if err := os.Remove(pendingResetPath()); err != nil && !os.IsNotExist(err) {
+		logger.Error("[api][removePendingReset] Failed to remove pending reset file")
+		logger.Error(err)
+	}
+}
+
+// mergeScope combines two reset scopes, nil (the whole configuration) wins over any list
+func mergeScope(a, b []string) []string {
+	if a == nil || b == nil {
+		return nil
+	}
+
+	added, _ := servicelist.DiffServiceIDs(a, b)
+	return append(copyScope(a), added...)
+}
+
+// copyScope copies a reset scope, keeping nil apart from an empty list
+func copyScope(scope []string) []string {
+	if scope == nil {
+		return nil
+	}
+	return append([]string{}, scope...)
+}
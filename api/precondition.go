@@ -0,0 +1,64 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ConfigETag returns the ETag of a blocked services configuration, a hash of its services and schedule
+// that doesn't depend on the order of the IDs
+func ConfigETag(serviceConfig model.ServiceConfig) string {
+	serviceConfig.IDs = slices.Sorted(slices.Values(serviceConfig.IDs))
+	encoded, _ := json.Marshal(serviceConfig)
+	sum := sha256.Sum256(encoded)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether a comma-separated If-Match or If-None-Match header lists etag, or is "*".
+// Weak tags compare like strong ones, the hash is the same either way.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckIfMatch rejects an update with 412 Precondition Failed when its If-Match header doesn't match the
+// ETag of the configuration in AdGuard, i.e. it changed since the client read it, so one admin's change never
+// silently overwrites another's. The configuration is fetched fresh for the check, which runs after
+// serializeOperation so nothing changes it before the update. Requests without If-Match pass unchanged.
+func CheckIfMatch(c *fiber.Ctx) error {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if ifMatch == "" {
+		return c.Next()
+	}
+
+	currentConfig, err := backend.GetBlockedServicesContext(c.UserContext())
+	if err != nil {
+		logger.Error("[api][CheckIfMatch] Failed to get the current configuration to check If-Match")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the current configuration to check If-Match", err)
+	}
+
+	etag := ConfigETag(currentConfig)
+	if !etagMatches(ifMatch, etag) {
+		logger.Warning("[api][CheckIfMatch] Rejecting " + c.Method() + " " + c.Path() + ", If-Match " + ifMatch + " doesn't match the current configuration " + etag)
+		c.Set(fiber.HeaderETag, etag)
+		return respondError(c, fiber.StatusPreconditionFailed, "The blocked services changed since they were read, get them again and retry", fiber.Map{
+			"current_etag": etag,
+		})
+	}
+
+	logger.Debug("[api][CheckIfMatch] If-Match matches the current configuration " + etag)
+	return c.Next()
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/welasco/adguardfilter/adguardapi"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/profile"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetProfiles lists the household member profiles with today's use of their time budgets
+//
+// @Summary List the profiles and their time budgets
+// @Tags profiles
+// @Produce json
+// @Success 200 {object} model.ProfilesResponse
+// @Security ApiKeyAuth
+// @Router /api/v1/profiles [get]
+func ApiGetProfiles(c *fiber.Ctx) error {
+	status := profile.Status()
+	logger.Debug("[api][ApiGetProfiles] Number of profiles: ", status.Count)
+
+	return c.JSON(&status)
+}
+
+// ApiUnblockProfile unblocks some of a profile's services on its AdGuard client for a while, taking the
+// time from their daily budgets. The duration is cut to what is left of the budgets, and a service
+// without time left today rejects the request.
+//
+// @Summary Unblock services of a profile within its daily budgets
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Param name path string true "Profile name"
+// @Param body body model.ProfileUnblockRequest true "Services to unblock and for how long"
+// @Success 200 {object} model.SuccessResponse "profile, client, ids, minutes, requested_minutes, capped, until, refunded_minutes"
+// @Failure 400 {object} model.ErrorResponse "Invalid body or services the profile doesn't block"
+// @Failure 404 {object} model.ErrorResponse "Unknown profile or AdGuard client"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 429 {object} model.ErrorResponse "Daily budget exhausted, details list the exhausted services and budgets_reset_at, or unblock cooldown"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/profiles/{name}/unblock [post]
+func ApiUnblockProfile(c *fiber.Ctx) error {
+	// The name is kept after the request, so it must not share fasthttp's reused buffer
+	name := utils.CopyString(c.Params("name"))
+
+	var request model.ProfileUnblockRequest
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("[api][ApiUnblockProfile] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	errs := fieldErrors{}
+	if len(request.IDs) == 0 {
+		errs["ids"] = "is required and must list at least one service of the profile"
+	}
+	if request.ResetAfterMin <= 0 {
+		errs["reset_after_min"] = "must be greater than 0"
+	}
+	if maxReset, maxResetMinutes := maxResetDuration(); maxReset > 0 && time.Duration(request.ResetAfterMin)*time.Minute > maxReset {
+		errs["reset_after_min"] = "must be at most " + strconv.Itoa(maxResetMinutes)
+	}
+	if invalid, err := respondFieldErrors(c, "ApiUnblockProfile", errs); invalid {
+		return err
+	}
+
+	// Refuse a new unblock window right after a reset, unless made by an admin
+	if blocked, err := checkCooldown(c, "ApiUnblockProfile"); blocked {
+		return err
+	}
+
+	grant, err := profile.Unblock(name, request.IDs, request.ResetAfterMin)
+	var exhausted *profile.BudgetExhaustedError
+	switch {
+	case errors.Is(err, profile.ErrUnknownProfile):
+		return respondError(c, fiber.StatusNotFound, "Unknown profile: "+name, nil)
+	case errors.Is(err, profile.ErrNotInProfile):
+		return respondError(c, fiber.StatusBadRequest, "The profile doesn't block some of the services", fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.As(err, &exhausted):
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(time.Until(exhausted.ResetsAt).Seconds())+1))
+		return respondError(c, fiber.StatusTooManyRequests, "Today's time budget is used up for "+strings.Join(exhausted.IDs, ", ")+", it resets at "+exhausted.ResetsAt.Format(time.RFC3339), fiber.Map{
+			"exhausted":        exhausted.IDs,
+			"budgets_reset_at": exhausted.ResetsAt.Format(time.RFC3339),
+		})
+	case errors.Is(err, adguardapi.ErrClientNotFound):
+		return respondError(c, fiber.StatusNotFound, "AdGuard client of profile "+name+" not found", nil)
+	case err != nil:
+		return respondUpstreamError(c, "Failed to unblock the services of the profile", err)
+	}
+
+	message := "Unblocked " + strings.Join(grant.IDs, ", ") + " for " + name + " for " + strconv.Itoa(grant.Minutes) + " minute(s)"
+	if grant.Capped {
+		message += ", capped to the remaining daily budget"
+	}
+	notify.Notify(notify.EventTimerCreated, message, map[string]interface{}{
+		"timer_id": profile.TimerPrefix + name,
+		"profile":  name,
+		"ids":      grant.IDs,
+		"until":    grant.Until.Format(time.RFC3339),
+	})
+
+	return respondSuccess(c, message, fiber.Map{
+		"profile":           name,
+		"client":            grant.Profile.ClientName(),
+		"ids":               grant.IDs,
+		"minutes":           grant.Minutes,
+		"requested_minutes": request.ResetAfterMin,
+		"capped":            grant.Capped,
+		"until":             grant.Until.Format(time.RFC3339),
+		"refunded_minutes":  grant.Refunded,
+	})
+}
+
+// ApiResetProfile applies a profile's default list to its AdGuard client, ending its unblock window early
+// and giving the unused minutes back to the budgets
+//
+// @Summary Apply the default list of a profile
+// @Tags profiles
+// @Produce json
+// @Param name path string true "Profile name"
+// @Success 200 {object} model.SuccessResponse "profile, refunded_minutes"
+// @Failure 404 {object} model.ErrorResponse "Unknown profile or AdGuard client"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/profiles/{name}/reset [post]
+func ApiResetProfile(c *fiber.Ctx) error {
+	name := c.Params("name")
+
+	refunded, err := profile.Reset(name)
+	switch {
+	case errors.Is(err, profile.ErrUnknownProfile):
+		return respondError(c, fiber.StatusNotFound, "Unknown profile: "+name, nil)
+	case errors.Is(err, adguardapi.ErrClientNotFound):
+		return respondError(c, fiber.StatusNotFound, "AdGuard client of profile "+name+" not found", nil)
+	case err != nil:
+		return respondUpstreamError(c, "Failed to apply the default list of the profile", err)
+	}
+
+	return respondSuccess(c, "Default list of "+name+" applied", fiber.Map{
+		"profile":          name,
+		"refunded_minutes": refunded,
+	})
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiSetProtection globally enables or disables AdGuard filtering, optionally for a limited time
+//
+// @Summary Enable or disable protection
+// @Tags protection
+// @Accept json
+// @Produce json
+// @Param body body model.ProtectionRequest true "Protection state"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/protection [post]
+func ApiSetProtection(c *fiber.Ctx) error {
+	// Parse request body into ProtectionRequest model
+	var protectionRequest model.ProtectionRequest
+	err := c.BodyParser(&protectionRequest)
+	if err != nil {
+		logger.Error("[api][ApiSetProtection] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	// Validate the request
+	if protectionRequest.Enabled == nil {
+		logger.Error("[api][ApiSetProtection] Missing enabled field")
+		return respondError(c, fiber.StatusBadRequest, "enabled is required", nil)
+	}
+	if protectionRequest.DurationMinutes < 0 {
+		logger.Error("[api][ApiSetProtection] Negative duration_minutes")
+		return respondError(c, fiber.StatusBadRequest, "duration_minutes must not be negative", nil)
+	}
+	if *protectionRequest.Enabled && protectionRequest.DurationMinutes > 0 {
+		logger.Error("[api][ApiSetProtection] duration_minutes set while enabling protection")
+		return respondError(c, fiber.StatusBadRequest, "duration_minutes is only valid when disabling protection", nil)
+	}
+
+	durationMs := int((time.Duration(protectionRequest.DurationMinutes) * time.Minute).Milliseconds())
+	err = backend.SetProtection(*protectionRequest.Enabled, durationMs)
+	if err != nil {
+		logger.Error("[api][ApiSetProtection] Failed to set protection")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to set protection", err)
+	}
+
+	logger.Info("[api][ApiSetProtection] Successfully set protection state")
+
+	// Read back the state AdGuard reports so the response reflects what was applied
+	protectionStatus, err := backend.GetProtection()
+	if err != nil {
+		logger.Warning("[api][ApiSetProtection] Protection updated, but failed to read back the protection state")
+		return respondSuccess(c, "Protection updated, but the resulting state could not be read", fiber.Map{
+			"protection_enabled": *protectionRequest.Enabled,
+		})
+	}
+
+	return respondSuccess(c, "Protection updated", fiber.Map{
+		"protection_enabled":   protectionStatus.ProtectionEnabled,
+		"disabled_for_seconds": protectionStatus.ProtectionDisabledDuration / 1000,
+	})
+}
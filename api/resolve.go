@@ -0,0 +1,73 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// maxResolveNames caps how many names one resolve request may look up
+const maxResolveNames = 500
+
+// ApiResolveServiceNames maps service names such as "YouTube" to the IDs the other endpoints take, for voice
+// assistants and automations that only know the names. Case, spaces and punctuation are ignored, and with
+// "fuzzy": true small typos match too. Names without a match are listed in unmatched rather than failing.
+//
+// @Summary Resolve service names to IDs
+// @Tags blocked services
+// @Accept json
+// @Produce json
+// @Param body body model.ResolveServiceNamesRequest true "Service names"
+// @Success 200 {object} model.ResolveServiceNamesResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/resolve [post]
+func ApiResolveServiceNames(c *fiber.Ctx) error {
+	var request model.ResolveServiceNamesRequest
+	if err := c.BodyParser(&request); err != nil {
+		logger.Error("[api][ApiResolveServiceNames] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	errs := fieldErrors{}
+	switch {
+	case len(request.Names) == 0:
+		errs["names"] = "is required and must list at least one service name"
+	case len(request.Names) > maxResolveNames:
+		errs["names"] = "must list at most " + strconv.Itoa(maxResolveNames) + " names"
+	}
+	if invalid, err := respondFieldErrors(c, "ApiResolveServiceNames", errs); invalid {
+		return err
+	}
+
+	resolved, unmatched, err := backend.ResolveServiceNames(request.Names, request.Fuzzy)
+	if err != nil {
+		logger.Error("[api][ApiResolveServiceNames] Failed to get the service catalog")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the service catalog", err)
+	}
+
+	ids := make([]string, 0, len(resolved))
+	seen := make(map[string]bool, len(resolved))
+	for _, match := range resolved {
+		if !seen[match.ID] {
+			seen[match.ID] = true
+			ids = append(ids, match.ID)
+		}
+	}
+	if len(unmatched) > 0 {
+		logger.Info("[api][ApiResolveServiceNames] No service matches: " + strings.Join(unmatched, ", "))
+	}
+
+	return c.JSON(model.ResolveServiceNamesResponse{
+		IDs:       ids,
+		Resolved:  resolved,
+		Unmatched: unmatched,
+	})
+}
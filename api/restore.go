@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/retry"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// What an expiring timer puts back, from the reset_to field of an update
+const (
+	ResetToDefault  = "default"  // The default configuration, see GET /api/v1/defaults
+	ResetToPrevious = "previous" // The configuration in AdGuard right before the update
+)
+
+// Timer metadata keys of a timer restoring the previous configuration
+const (
+	metadataResetTo       = "reset_to"
+	metadataRestoreConfig = "restore_config"
+)
+
+// validateResetTo checks the reset_to field of an update, which may be empty for the default
+func validateResetTo(resetTo string, errs fieldErrors) {
+	switch resetTo {
+	case "", ResetToDefault:
+	case ResetToPrevious:
+		// Independent timers reset only their own services, restoring a whole configuration would undo the others
+		if multiTimerMode() {
+			errs["reset_to"] = "previous is not supported with multiTimerMode"
+		}
+	default:
+		errs["reset_to"] = "must be default or previous"
+	}
+}
+
+// restoreConfigOf returns the configuration a reset timer restores, and false when it resets to default
+func restoreConfigOf(t *timer.Timer) (model.ServiceConfig, bool) {
+	metadata := t.GetMetadata()
+	if metadata[metadataResetTo] != ResetToPrevious {
+		return model.ServiceConfig{}, false
+	}
+
+	var restoreConfig model.ServiceConfig
+	if err := json.Unmarshal([]byte(metadata[metadataRestoreConfig]), &restoreConfig); err != nil {
+		logger.Error("[api][restoreConfigOf] Invalid restore_config on timer '" + t.GetID() + "', it resets to default")
+		logger.Error(err)
+		return model.ServiceConfig{}, false
+	}
+	return restoreConfig, true
+}
+
+// RestoreConfig returns the configuration the active reset timer restores, and false when none is active or
+// it resets to default. The shutdown reset uses it to put back what the timer would have.
+func RestoreConfig() (model.ServiceConfig, bool) {
+	for _, timerID := range timer.GetActiveTimersWithPrefix(ResetTimerPrefix) {
+		if t, ok := timer.GetTimer(timerID); ok {
+			if restoreConfig, ok := restoreConfigOf(t); ok {
+				return restoreConfig, true
+			}
+		}
+	}
+	return model.ServiceConfig{}, false
+}
+
+// capturePreviousConfig returns the configuration to restore for reset_to=previous, fetched from AdGuard before
+// the update is applied. When the update replaces an active timer, its configuration is only temporary, so the
+// replaced timer's target is kept instead: its restore config, or nil for the default.
+func capturePreviousConfig(caller string) (*model.ServiceConfig, error) {
+	if activeTimers := timer.GetActiveTimersWithPrefix(ResetTimerPrefix); len(activeTimers) > 0 {
+		if restoreConfig, ok := RestoreConfig(); ok {
+			logger.Info("[api][" + caller + "] Keeping the configuration restored by the replaced timer")
+			return &restoreConfig, nil
+		}
+		logger.Info("[api][" + caller + "] The replaced timer resets to default, so this one does too")
+		return nil, nil
+	}
+
+	currentConfig, err := backend.GetBlockedServices()
+	if err != nil {
+		logger.Error("[api][" + caller + "] Failed to get the configuration to restore")
+		return nil, err
+	}
+	logger.Info("[api]["+caller+"] Captured the previous configuration with ", len(currentConfig.IDs), " service(s) to restore")
+	return &currentConfig, nil
+}
+
+// resetTargetOf returns the reset_to an update's timer ends up with: previous when there is a configuration to restore
+func resetTargetOf(previous *model.ServiceConfig) string {
+	if previous != nil {
+		return ResetToPrevious
+	}
+	return ResetToDefault
+}
+
+// withRestoreConfig sets up a reset timer's callback and metadata to restore previous instead of the default
+func withRestoreConfig(metadata map[string]string, previous model.ServiceConfig) (timer.Callback, map[string]string) {
+	encoded, _ := json.Marshal(previous)
+	metadata[metadataResetTo] = ResetToPrevious
+	metadata[metadataRestoreConfig] = string(encoded)
+
+	return func(t *timer.Timer) { restoreWithRetry(t.GetID(), previous) }, metadata
+}
+
+// restoreWithRetry restores the configuration captured before an update, retrying like resetWithRetry.
+// If AdGuard stays unreachable the pending reset that takes over resets to default.
+func restoreWithRetry(timerID string, previous model.ServiceConfig) {
+	logger.Info("[api][restoreWithRetry] Timer '" + timerID + "' expired, restoring the previous configuration")
+
+	// Hold off updates until the restore and its retries are done, so they can't interleave
+	endOperation := adguardapi.WaitOperation("timer reset")
+	defer endOperation()
+	notify.Notify(notify.EventTimerExpired, "Timer expired, restoring the previous blocked services", map[string]interface{}{
+		"timer_id": timerID,
+		"reset_to": ResetToPrevious,
+	})
+
+	maxRetries := config.GetInt("resetRetryMax", 3)
+	baseDelay := time.Duration(config.GetInt("resetRetryBaseMs", 2000)) * time.Millisecond
+
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			delay := retry.Backoff(baseDelay, attempt-1)
+			logger.Warning("[api][restoreWithRetry] Retrying restore in " + delay.String() + " (attempt " + fmt.Sprint(attempt+1) + ")")
+			time.Sleep(delay)
+		}
+
+		lastErr = backend.UpdateBlockedServices(&previous)
+		recordAudit(nil, audit.Entry{
+			Action:       audit.ActionReset,
+			ClientIP:     "timer",
+			ServiceCount: len(previous.IDs),
+		}, nil, lastErr)
+		if lastErr == nil {
+			logger.Info("[api][restoreWithRetry] Successfully restored the previous configuration")
+			logAppliedConfig("restoreWithRetry", appliedConfigSummary{
+				Action:       audit.ActionReset,
+				ServiceCount: len(previous.IDs),
+				TimeZone:     previous.Schedule.TimeZone,
+				TimerID:      timerID,
+			})
+			recordTimerReset()
+			return
+		}
+		logger.Error("[api][restoreWithRetry] Failed to restore the previous configuration")
+		logger.Error(lastErr)
+	}
+
+	logger.Error("[api][restoreWithRetry] Giving up on the previous configuration, the pending reset restores the default")
+	markPendingReset(timerID, nil, maxRetries+1, lastErr)
+	notify.Notify(notify.EventResetFailed, "Failed to restore the previous blocked services, a reset to default is pending", map[string]interface{}{
+		"attempts":          maxRetries + 1,
+		"follow_up_minutes": config.GetInt("resetFollowUpMin", 5),
+	})
+}
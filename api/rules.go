@@ -0,0 +1,160 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetRules returns the custom AdGuard user rules
+//
+// @Summary List the custom user rules
+// @Tags rules
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/rules [get]
+func ApiGetRules(c *fiber.Ctx) error {
+	rules, err := backend.GetUserRules()
+	if err != nil {
+		logger.Error("[api][ApiGetRules] Failed to get user rules")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get user rules", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"count": len(rules),
+		"rules": rules,
+	})
+}
+
+// ApiSetRules replaces the custom AdGuard user rules
+//
+// @Summary Replace the custom user rules
+// @Tags rules
+// @Accept json
+// @Produce json
+// @Param body body model.SetRulesRequest true "New rules"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/rules [put]
+func ApiSetRules(c *fiber.Ctx) error {
+	var setRulesRequest model.SetRulesRequest
+	err := c.BodyParser(&setRulesRequest)
+	if err != nil || setRulesRequest.Rules == nil {
+		logger.Error("[api][ApiSetRules] Failed to parse request body")
+		return respondError(c, fiber.StatusBadRequest, "Request body must contain a rules list", nil)
+	}
+
+	err = backend.SetUserRules(setRulesRequest.Rules)
+	if err != nil {
+		return respondRulesError(c, "ApiSetRules", err)
+	}
+
+	logger.Info("[api][ApiSetRules] Successfully replaced user rules")
+
+	return respondSuccess(c, "User rules replaced", fiber.Map{
+		"count": len(setRulesRequest.Rules),
+	})
+}
+
+// ApiAddRule appends a custom AdGuard user rule
+//
+// @Summary Add a custom user rule
+// @Tags rules
+// @Accept json
+// @Produce json
+// @Param body body model.UserRuleRequest true "Rule to add"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/rules [post]
+func ApiAddRule(c *fiber.Ctx) error {
+	var ruleRequest model.UserRuleRequest
+	err := c.BodyParser(&ruleRequest)
+	if err != nil {
+		logger.Error("[api][ApiAddRule] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	rules, err := backend.AddUserRule(ruleRequest.Rule)
+	if err != nil {
+		return respondRulesError(c, "ApiAddRule", err)
+	}
+
+	logger.Info("[api][ApiAddRule] Successfully added user rule: " + ruleRequest.Rule)
+
+	return respondSuccess(c, "User rule added", fiber.Map{
+		"count": len(rules),
+	})
+}
+
+// ApiDeleteRule removes a custom AdGuard user rule, given in the body or the rule query parameter
+//
+// @Summary Remove a custom user rule
+// @Tags rules
+// @Accept json
+// @Produce json
+// @Param rule query string false "Rule to remove, instead of the body"
+// @Param body body model.UserRuleRequest false "Rule to remove"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Failure 404 {object} model.ErrorResponse "Rule not found"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/rules [delete]
+func ApiDeleteRule(c *fiber.Ctx) error {
+	var ruleRequest model.UserRuleRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&ruleRequest); err != nil {
+			logger.Error("[api][ApiDeleteRule] Failed to parse request body")
+			logger.Error(err)
+			return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+		}
+	}
+	if ruleRequest.Rule == "" {
+		ruleRequest.Rule = c.Query("rule")
+	}
+	if ruleRequest.Rule == "" {
+		return respondError(c, fiber.StatusBadRequest, "rule is required", nil)
+	}
+
+	rules, err := backend.RemoveUserRule(ruleRequest.Rule)
+	if err != nil {
+		return respondRulesError(c, "ApiDeleteRule", err)
+	}
+
+	logger.Info("[api][ApiDeleteRule] Successfully removed user rule: " + ruleRequest.Rule)
+
+	return respondSuccess(c, "User rule removed", fiber.Map{
+		"count": len(rules),
+	})
+}
+
+// respondRulesError maps a user rules error to the matching HTTP status
+func respondRulesError(c *fiber.Ctx, caller string, err error) error {
+	switch {
+	case errors.Is(err, adguardapi.ErrInvalidRule):
+		logger.Error("[api][" + caller + "] " + err.Error())
+		return respondError(c, fiber.StatusBadRequest, err.Error(), nil)
+	case errors.Is(err, adguardapi.ErrRuleNotFound):
+		logger.Warning("[api][" + caller + "] " + err.Error())
+		return respondError(c, fiber.StatusNotFound, err.Error(), nil)
+	default:
+		logger.Error("[api][" + caller + "] Failed to update user rules")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to update user rules", err)
+	}
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// savedTimersPath returns the file the reset timers are saved to on shutdown with resetOnShutdown disabled
+func savedTimersPath() string {
+	if path := os.Getenv("savedTimersPath"); path != "" {
+		return path
+	}
+	return "saved_timers.json"
+}
+
+// SaveResetTimers saves the active reset timers so ResumeResetTimers re-arms them at the next start, and returns
+// how many were saved. The caller stops the timers afterwards. When the file can't be written the timers are
+// recorded as a pending reset instead, so the next start still resets rather than leaving services unblocked.
+func SaveResetTimers() int {
+	var saved []model.SavedTimer
+	for _, timerID := range timer.GetActiveTimersWithPrefix(ResetTimerPrefix) {
+		t, ok := timer.GetTimer(timerID)
+		if !ok {
+			continue
+		}
+		saved = append(saved, model.SavedTimer{
+			ID:         t.GetID(),
+			ExpireTime: t.GetExpireTime(),
+			Scope:      t.GetScope(),
+			Metadata:   t.GetMetadata(),
+		})
+	}
+	if len(saved) == 0 {
+		return 0
+	}
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		path := savedTimersPath()
+		tmpPath := path + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+	}
+	if err != nil {
+		logger.Error("[api][SaveResetTimers] Failed to save the reset timers, recording their resets as pending instead")
+		logger.Error(err)
+		for _, savedTimer := range saved {
+			recordPendingReset(savedTimer.ID, savedTimer.Scope, 0, err)
+		}
+		return 0
+	}
+
+	logger.Info("[api][SaveResetTimers] Saved ", len(saved), " reset timer(s) to "+savedTimersPath())
+	return len(saved)
+}
+
+// ResumeResetTimers re-arms the reset timers saved by the last shutdown. A timer that expired while the
+// service was down fires right away.
+func ResumeResetTimers() {
+	path := savedTimersPath()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("[api][ResumeResetTimers] Failed to read saved timers file")
+			logger.Error(err)
+		}
+		return
+	}
+
+	var saved []model.SavedTimer
+	if err := json.Unmarshal(data, &saved); err != nil {
+		logger.Error("[api][ResumeResetTimers] Failed to parse saved timers file")
+		logger.Error(err)
+		return
+	}
+
+	// The timers are registered again, the next shutdown saves them anew
+	if err := os.Remove(path); err != nil {
+		logger.Error("[api][ResumeResetTimers] Failed to remove saved timers file")
+		logger.Error(err)
+	}
+
+	for _, savedTimer := range saved {
+		expiry := timer.WithDeadline(savedTimer.ExpireTime)
+		if !savedTimer.ExpireTime.After(time.Now()) {
+			// Fire through the timer anyway, so the reset shows up in the history and the events like any other
+			logger.Warning("[api][ResumeResetTimers] Timer '" + savedTimer.ID + "' expired at " + savedTimer.ExpireTime.Format(time.RFC3339) + " while stopped, resetting now")
+			expiry = timer.WithDuration(time.Millisecond)
+		}
+
+		_, err := timer.NewTimer(savedTimer.ID,
+			expiry,
+			timer.WithCallback(savedTimerCallback(savedTimer)),
+			timer.WithScope(savedTimer.Scope),
+			timer.WithMetadata(savedTimer.Metadata),
+			resetWarning(),
+		)
+		if err != nil {
+			logger.Error("[api][ResumeResetTimers] Failed to re-arm timer '" + savedTimer.ID + "', recording its reset as pending")
+			logger.Error(err)
+			markPendingReset(savedTimer.ID, savedTimer.Scope, 0, err)
+			continue
+		}
+		logger.Info("[api][ResumeResetTimers] Re-armed timer '" + savedTimer.ID + "', expiring at " + savedTimer.ExpireTime.Format(time.RFC3339))
+	}
+}
+
+// savedTimerCallback returns the callback a saved timer was created with, from what its metadata and scope
+// say it resets to
+func savedTimerCallback(savedTimer model.SavedTimer) timer.Callback {
+	switch {
+	case savedTimer.Metadata[metadataResetTo] == ResetToPrevious:
+		return func(t *timer.Timer) {
+			if previous, ok := restoreConfigOf(t); ok {
+				restoreWithRetry(t.GetID(), previous)
+				return
+			}
+			resetWithRetry(t.GetID(), nil)
+		}
+	case savedTimer.Metadata["endpoint"] == "allowlist":
+		return blockAllAfterAllowlist
+	case savedTimer.Scope != nil:
+		return func(t *timer.Timer) { resetWithRetry(t.GetID(), t.GetScope()) }
+	default:
+		return resetAfterTimer
+	}
+}
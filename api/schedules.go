@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/schedule"
+)
+
+// ApiGetSchedules returns all recurring unblock schedules
+//
+// @Summary List the recurring unblock schedules
+// @Tags schedules
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Security ApiKeyAuth
+// @Router /api/v1/schedules [get]
+func ApiGetSchedules(c *fiber.Ctx) error {
+	schedules := schedule.List()
+
+	logger.Debug("[api][ApiGetSchedules] Number of schedules: ", len(schedules))
+
+	return c.JSON(fiber.Map{
+		"count":     len(schedules),
+		"schedules": schedules,
+	})
+}
+
+// ApiCreateSchedule creates a recurring daily window that applies a set of blocked services
+//
+// @Summary Create a recurring unblock schedule
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param body body schedule.Schedule true "Daily window"
+// @Success 201 {object} model.SuccessResponse
+// @Failure 400 {object} model.ErrorResponse "Invalid request"
+// @Security ApiKeyAuth
+// @Router /api/v1/schedules [post]
+func ApiCreateSchedule(c *fiber.Ctx) error {
+	var newSchedule schedule.Schedule
+	err := c.BodyParser(&newSchedule)
+	if err != nil {
+		logger.Error("[api][ApiCreateSchedule] Failed to parse request body")
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadRequest, "Failed to parse request body", nil)
+	}
+
+	created, err := schedule.Add(newSchedule)
+	if errors.Is(err, schedule.ErrInvalidSchedule) {
+		logger.Error("[api][ApiCreateSchedule] " + err.Error())
+		return respondError(c, fiber.StatusBadRequest, err.Error(), nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiCreateSchedule] Failed to create schedule")
+		logger.Error(err)
+		return respondError(c, fiber.StatusInternalServerError, "Failed to create schedule", nil)
+	}
+
+	logger.Info("[api][ApiCreateSchedule] Created schedule '" + created.ID + "'")
+
+	c.Status(fiber.StatusCreated)
+	return respondSuccess(c, "Schedule created", fiber.Map{
+		"schedule": created,
+	})
+}
+
+// ApiDeleteSchedule removes a recurring schedule by ID
+//
+// @Summary Delete a recurring unblock schedule
+// @Tags schedules
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Success 200 {object} model.SuccessResponse
+// @Failure 404 {object} model.ErrorResponse "Schedule not found"
+// @Security ApiKeyAuth
+// @Router /api/v1/schedules/{id} [delete]
+func ApiDeleteSchedule(c *fiber.Ctx) error {
+	id := c.Params("id")
+
+	found, err := schedule.Remove(id)
+	if !found {
+		logger.Warning("[api][ApiDeleteSchedule] Schedule '" + id + "' not found")
+		return respondError(c, fiber.StatusNotFound, "Schedule not found", nil)
+	}
+	if err != nil {
+		logger.Error("[api][ApiDeleteSchedule] Failed to delete schedule '" + id + "'")
+		logger.Error(err)
+		return respondError(c, fiber.StatusInternalServerError, "Failed to delete schedule", nil)
+	}
+
+	logger.Info("[api][ApiDeleteSchedule] Deleted schedule '" + id + "'")
+
+	return respondSuccess(c, "Schedule deleted")
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/durationfmt"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// The schedule states of a blocked service
+const (
+	ScheduleBlocked       = "blocked"        // Blocked, until the next window pauses it
+	SchedulePaused        = "paused"         // Unblocked by a schedule window, until it closes
+	ScheduleAlwaysBlocked = "always_blocked" // The schedule has no windows
+)
+
+// scheduleLocation returns the time zone of a schedule's windows. AdGuard reads an empty or Local zone
+// in its own time zone, which this service can't see, so defaultTimeZone stands in for it.
+func scheduleLocation(schedule model.Schedule) (*time.Location, error) {
+	timeZone := schedule.TimeZone
+	if timeZone == "" || timeZone == "Local" {
+		timeZone = adguardapi.DefaultTimeZone()
+	}
+	return time.LoadLocation(timeZone)
+}
+
+// ApiGetScheduleStatus reports for each blocked service whether the AdGuard schedule pauses its blocking
+// right now, and when that next changes, e.g. "YouTube is blocked until 4pm"
+//
+// @Summary Get when the schedule next pauses or resumes the blocking
+// @Tags blocked services
+// @Produce json
+// @Success 200 {object} model.ScheduleStatus
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/schedulestatus [get]
+func ApiGetScheduleStatus(c *fiber.Ctx) error {
+	currentConfig, err := backend.GetBlockedServicesContext(c.UserContext())
+	if err != nil {
+		logger.Error("[api][ApiGetScheduleStatus] Failed to get blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get blocked services", err)
+	}
+
+	location, err := scheduleLocation(currentConfig.Schedule)
+	if err != nil {
+		logger.Error("[api][ApiGetScheduleStatus] Unknown schedule time zone: " + currentConfig.Schedule.TimeZone)
+		logger.Error(err)
+		return respondError(c, fiber.StatusBadGateway, "AdGuard Home has an unknown schedule time zone: "+currentConfig.Schedule.TimeZone, nil)
+	}
+
+	now := time.Now().In(location)
+	paused, next, changes := adguardapi.ScheduleState(currentConfig.Schedule, location, now)
+	status := model.ScheduleStatus{
+		TimeZone:    location.String(),
+		CurrentTime: now.Format(time.RFC3339),
+		Paused:      paused,
+		Services:    []model.ServiceScheduleStatus{},
+	}
+
+	// No window in any day (or every day paused all day) means the state never changes
+	var until *string
+	if changes {
+		transition := next.Format(time.RFC3339)
+		until = &transition
+		status.NextTransition = until
+		status.TimeUntilTransition = durationfmt.Human(next.Sub(now))
+		status.SecondsUntilTransition = int64(next.Sub(now).Seconds())
+	}
+	for _, window := range currentConfig.Schedule.Days() {
+		if window != nil {
+			status.Scheduled = true
+			break
+		}
+	}
+
+	// The schedule is global, so every blocked service shares its state
+	state := ScheduleBlocked
+	switch {
+	case !status.Scheduled:
+		state = ScheduleAlwaysBlocked
+	case paused:
+		state = SchedulePaused
+	}
+	for _, id := range currentConfig.IDs {
+		status.Services = append(status.Services, model.ServiceScheduleStatus{
+			ID:      id,
+			State:   state,
+			Blocked: !paused,
+			Until:   until,
+		})
+	}
+
+	logger.Debug("[api][ApiGetScheduleStatus] Paused: ", paused, ", next transition: ", status.TimeUntilTransition)
+
+	return c.JSON(&status)
+}
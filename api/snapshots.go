@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetSnapshots lists the configurations captured before each change, newest first
+//
+// @Summary List the configuration snapshots
+// @Tags blocked services
+// @Produce json
+// @Success 200 {object} model.SnapshotsResponse
+// @Security ApiKeyAuth
+// @Router /api/v1/snapshots [get]
+func ApiGetSnapshots(c *fiber.Ctx) error {
+	snapshots := backend.GetSnapshots()
+	logger.Debug("[api][ApiGetSnapshots] Returning ", len(snapshots), " snapshot(s)")
+
+	return c.JSON(model.SnapshotsResponse{
+		Count:     len(snapshots),
+		Snapshots: snapshots,
+	})
+}
+
+// ApiRollback restores the configuration from before the last change, as it was in AdGuard
+//
+// @Summary Roll back to the previous configuration
+// @Tags blocked services
+// @Produce json
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.SuccessResponse "snapshot, added, removed"
+// @Failure 404 {object} model.ErrorResponse "No snapshot to roll back to"
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/rollback [post]
+func ApiRollback(c *fiber.Ctx) error {
+	// Capture the current configuration so the response can report what changed
+	var changes *serviceChanges
+	if snapshots := backend.GetSnapshots(); len(snapshots) > 0 {
+		changes = fetchChanges("ApiRollback", snapshots[0].Config.IDs)
+	}
+
+	snapshot, err := backend.RollbackConfig()
+	if errors.Is(err, adguardapi.ErrNoSnapshot) {
+		return respondError(c, fiber.StatusNotFound, "No snapshot to roll back to", nil)
+	}
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionRollback,
+		ServiceCount: len(snapshot.Config.IDs),
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][ApiRollback] Failed to roll back blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to roll back blocked services", err)
+	}
+
+	logger.Info("[api][ApiRollback] Rolled back to snapshot " + snapshot.ID)
+	logAppliedConfig("ApiRollback", appliedConfigSummary{
+		Action:       audit.ActionRollback,
+		ServiceCount: len(snapshot.Config.IDs),
+		TimeZone:     snapshot.Config.Schedule.TimeZone,
+	})
+
+	return respondSuccess(c, "Blocked services rolled back to the snapshot taken at "+snapshot.Timestamp, fiber.Map{
+		"snapshot": snapshot,
+	}, changes.toMap())
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// ApplyDefaultOnStartup enforces the default configuration at startup when applyDefaultOnStartup is set, so a
+// fresh AdGuard install gets the household baseline without waiting for the first reset. It only applies
+// when AdGuard blocks nothing yet, unless forceDefaultOnStartup is set too, to never clobber a setup made
+// by hand. A failure is logged and startup continues.
+func ApplyDefaultOnStartup() {
+	if !config.GetBool("applyDefaultOnStartup", false) {
+		return
+	}
+
+	// A reset left pending by the last run applies the default already
+	if _, pending := GetPendingReset(); pending {
+		logger.Info("[api][ApplyDefaultOnStartup] A reset is pending, leaving the default to it")
+		return
+	}
+
+	currentConfig, err := backend.GetManagedConfig()
+	if err != nil {
+		logger.Error("[api][ApplyDefaultOnStartup] Failed to get the current blocked services, not applying the default")
+		logger.Error(err)
+		return
+	}
+	if len(currentConfig.IDs) > 0 && !config.GetBool("forceDefaultOnStartup", false) {
+		logger.Info("[api][ApplyDefaultOnStartup] AdGuard already blocks ", len(currentConfig.IDs), " service(s), leaving them (set forceDefaultOnStartup to apply the default anyway)")
+		return
+	}
+
+	defaultConfig := adguardapi.BuildDefaultConfig()
+	changes := fetchChanges("ApplyDefaultOnStartup", defaultConfig.IDs)
+	err = backend.ResetBlockedServices()
+	recordAudit(nil, audit.Entry{
+		Action:       audit.ActionReset,
+		ClientIP:     "startup",
+		ServiceCount: len(defaultConfig.IDs),
+	}, changes, err)
+	if err != nil {
+		logger.Error("[api][ApplyDefaultOnStartup] Failed to apply the default configuration")
+		logger.Error(err)
+		return
+	}
+
+	logger.Info("[api][ApplyDefaultOnStartup] Applied the " + adguardapi.DefaultConfigSource() + " default configuration at startup, blocking: " + strings.Join(defaultConfig.IDs, ", "))
+	logAppliedConfig("ApplyDefaultOnStartup", appliedConfigSummary{
+		Action:       audit.ActionReset,
+		ServiceCount: len(defaultConfig.IDs),
+		TimeZone:     defaultConfig.Schedule.TimeZone,
+	})
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/servicelist"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// unblockProfile returns the service IDs kept blocked while toggled to unblocked, from the comma-separated
+// unblockProfile (default empty, every service unblocked)
+func unblockProfile() []string {
+	ids := []string{}
+	for _, id := range strings.Split(os.Getenv("unblockProfile"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// currentState compares the AdGuard configuration with the default set and finds the soonest reset timer.
+// While a reset is pending and AdGuard can't be reached it still returns the state, marked unreachable.
+func currentState() (model.StateResponse, error) {
+	state := model.StateResponse{}
+	if pending, exists := GetPendingReset(); exists {
+		state.PendingReset = &pending
+	}
+
+	for _, timerID := range timer.GetActiveTimersWithPrefix(ResetTimerPrefix) {
+		details, exists := timerDetails(timerID, false)
+		if !exists || !details.IsActive {
+			continue
+		}
+		if state.ActiveTimer == nil || details.SecondsLeft < state.ActiveTimer.SecondsLeft {
+			state.ActiveTimer = &model.StateTimer{
+				TimerID:     details.TimerID,
+				ExpireTime:  details.ExpireTime,
+				SecondsLeft: details.SecondsLeft,
+			}
+		}
+	}
+
+	currentConfig, err := backend.GetBlockedServices()
+	if err != nil {
+		// The services are still unblocked until the pending reset gets through, which is what a dashboard needs to show
+		if state.PendingReset != nil && (errors.Is(err, adguardapi.ErrAdGuardUnreachable) || errors.Is(err, adguardapi.ErrAdGuardTimeout)) {
+			logger.Warning("[api][currentState] AdGuard is unreachable with a reset pending, returning the degraded state")
+			state.Unblocked = true
+			return state, nil
+		}
+		return model.StateResponse{}, err
+	}
+
+	// Unblocked means anything differs from what a reset would apply, disabled services aside
+	added, removed := servicelist.DiffServiceIDs(backend.EnforcedIDs(adguardapi.BuildDefaultConfig().IDs), currentConfig.IDs)
+	servicesBlocked := len(currentConfig.IDs)
+	state.Unblocked = len(added) > 0 || len(removed) > 0
+	state.ServicesBlocked = &servicesBlocked
+	state.AdGuardReachable = true
+
+	return state, nil
+}
+
+// ApiGetState returns the compact unblock state, stable for Home Assistant templating. A reset that is
+// pending because AdGuard was down shows up in pending_reset.
+//
+// @Summary Get the compact unblock state
+// @Tags home assistant
+// @Produce json
+// @Success 200 {object} model.StateResponse
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/state [get]
+func ApiGetState(c *fiber.Ctx) error {
+	state, err := currentState()
+	if err != nil {
+		logger.Error("[api][ApiGetState] Failed to get the current state")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the current state", err)
+	}
+
+	return c.JSON(state)
+}
+
+// ApiToggle flips between the default configuration and the unblock profile. Unblocking starts a reset
+// timer of toggleResetMinutes (default 60, 0 for none) so the switch can't be left on by accident.
+//
+// @Summary Toggle between blocked and unblocked
+// @Tags home assistant
+// @Produce json
+// @Param If-Match header string false "ETag from getblockedservices, answers 412 when the configuration changed since"
+// @Success 200 {object} model.StateResponse
+// @Failure 412 {object} model.ErrorResponse "Configuration changed since the If-Match ETag was read"
+// @Failure 429 {object} model.ErrorResponse "Unblock cooldown active"
+// @Failure 502 {object} model.ErrorResponse "AdGuard Home unreachable or authentication failed"
+// @Failure 504 {object} model.ErrorResponse "AdGuard Home timed out"
+// @Security ApiKeyAuth
+// @Router /api/v1/toggle [post]
+func ApiToggle(c *fiber.Ctx) error {
+	state, err := currentState()
+	if err != nil {
+		logger.Error("[api][ApiToggle] Failed to get the current state")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the current state", err)
+	}
+
+	if state.Unblocked {
+		err = toggleBlock(c)
+	} else {
+		// A rejected unblock has already been answered, e.g. 429 during the cooldown
+		var responded bool
+		if responded, err = toggleUnblock(c); responded {
+			return err
+		}
+	}
+	if err != nil {
+		logger.Error("[api][ApiToggle] Failed to toggle blocked services")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to toggle blocked services", err)
+	}
+
+	state, err = currentState()
+	if err != nil {
+		logger.Error("[api][ApiToggle] Failed to get the new state")
+		logger.Error(err)
+		return respondUpstreamError(c, "Failed to get the new state", err)
+	}
+	return c.JSON(state)
+}
+
+// toggleBlock stops the reset timers and applies the default configuration
+func toggleBlock(c *fiber.Ctx) error {
+	logger.Info("[api][toggleBlock] Toggling to blocked")
+	stopActiveTimers("toggleBlock")
+
+	changes := fetchChanges("toggleBlock", adguardapi.BuildDefaultConfig().IDs)
+	err := backend.ResetBlockedServicesContext(c.UserContext())
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionReset,
+		ServiceCount: len(adguardapi.BuildDefaultConfig().IDs),
+	}, changes, err)
+	if err != nil {
+		return err
+	}
+
+	ClearPendingReset()
+	logAppliedConfig("toggleBlock", appliedConfigSummary{
+		Action:       audit.ActionReset,
+		ServiceCount: len(adguardapi.BuildDefaultConfig().IDs),
+	})
+	return nil
+}
+
+// toggleUnblock applies the unblock profile and starts its reset timer. It returns true when it has
+// already answered the request.
+func toggleUnblock(c *fiber.Ctx) (bool, error) {
+	logger.Info("[api][toggleUnblock] Toggling to unblocked")
+	if blocked, err := checkCooldown(c, "toggleUnblock"); blocked {
+		return true, err
+	}
+
+	serviceConfig := model.ServiceConfig{
+		IDs:      unblockProfile(),
+		Schedule: model.Schedule{TimeZone: adguardapi.DefaultTimeZone()},
+	}
+	changes := fetchChanges("toggleUnblock", serviceConfig.IDs)
+	err := backend.UpdateBlockedServicesContext(c.UserContext(), &serviceConfig)
+	recordAudit(c, audit.Entry{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(serviceConfig.IDs),
+	}, changes, err)
+	if err != nil {
+		return false, err
+	}
+
+	resetAfter := time.Duration(config.GetInt("toggleResetMinutes", 60)) * time.Minute
+	if maxReset, _ := maxResetDuration(); maxReset > 0 && resetAfter > maxReset {
+		resetAfter = maxReset
+	}
+	summary := appliedConfigSummary{
+		Action:       audit.ActionUpdate,
+		ServiceCount: len(serviceConfig.IDs),
+		TimeZone:     serviceConfig.Schedule.TimeZone,
+	}
+	if resetAfter <= 0 {
+		logger.Warning("[api][toggleUnblock] toggleResetMinutes is 0, services stay unblocked until toggled back")
+		logAppliedConfig("toggleUnblock", summary)
+		return false, nil
+	}
+
+	if !multiTimerMode() {
+		stopActiveTimers("toggleUnblock")
+	}
+
+	timerID := uniqueResetTimerID(ResetTimerPrefix + "toggle")
+	callback, scope := newResetCallback(serviceConfig.IDs)
+	t, err := timer.NewTimer(timerID,
+		timer.WithDuration(resetAfter),
+		timer.WithCallback(callback),
+		timer.WithScope(scope),
+		timer.WithMetadata(timerMetadata(c, "toggle", serviceConfig)),
+		resetWarning(),
+	)
+	if err != nil {
+		// The services are unblocked either way, report the state rather than failing
+		logger.Error("[api][toggleUnblock] Failed to create timer")
+		logger.Error(err)
+		logAppliedConfig("toggleUnblock", summary)
+		return false, nil
+	}
+
+	summary.TimerSet = true
+	summary.TimerID = timerID
+	summary.ResetAt = t.GetExpireTime().Format(time.RFC3339)
+	logAppliedConfig("toggleUnblock", summary)
+
+	notify.Notify(notify.EventTimerCreated, "Services unblocked, reset to default in "+resetAfter.String(), map[string]interface{}{
+		"timer_id":      timerID,
+		"reset_after":   resetAfter.String(),
+		"service_count": len(serviceConfig.IDs),
+	})
+	return false, nil
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/timer"
+)
+
+// ApiTimerWebSocketUpgrade only lets WebSocket upgrade requests reach the timer stream
+//
+// @Summary Stream the remaining time over a WebSocket
+// @Tags timers
+// @Produce json
+// @Success 101 {string} string "Switching Protocols"
+// @Failure 426 {object} model.ErrorResponse "Not a WebSocket upgrade request"
+// @Security ApiKeyAuth
+// @Router /api/v1/timer/ws [get]
+func ApiTimerWebSocketUpgrade(c *fiber.Ctx) error {
+	if websocket.IsWebSocketUpgrade(c) {
+		return c.Next()
+	}
+	return fiber.ErrUpgradeRequired
+}
+
+// ApiTimerWebSocket pushes the remaining time of the active reset timer every second, plus a
+// "created", "expired" or "cancelled" message whenever a reset timer changes state
+var ApiTimerWebSocket = websocket.New(func(conn *websocket.Conn) {
+	logger.Info("[api][ApiTimerWebSocket] Client connected from " + conn.RemoteAddr().String())
+
+	// Receive timer state changes instead of polling for them
+	events := make(chan timer.Event, 8)
+	observerID := timer.AddObserver(func(event timer.Event) {
+		if !strings.HasPrefix(event.TimerID, ResetTimerPrefix) {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+		}
+	})
+	defer timer.RemoveObserver(observerID)
+
+	// Detect client disconnects by reading until the connection fails
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(message fiber.Map) bool {
+		if err := conn.WriteJSON(message); err != nil {
+			logger.Debug("[api][ApiTimerWebSocket] Failed to write to client: " + err.Error())
+			return false
+		}
+		return true
+	}
+
+	// Send the current state right away
+	if message, active := timerTick(); active {
+		if !send(message) {
+			return
+		}
+	} else if !send(fiber.Map{"type": "inactive"}) {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			logger.Info("[api][ApiTimerWebSocket] Client disconnected from " + conn.RemoteAddr().String())
+			return
+		case event := <-events:
+			if !send(fiber.Map{
+				"type":        event.Type,
+				"timer_id":    event.TimerID,
+				"expire_time": event.ExpireTime.Format(time.RFC3339),
+			}) {
+				return
+			}
+		case <-ticker.C:
+			if message, active := timerTick(); active && !send(message) {
+				return
+			}
+		}
+	}
+})
+
+// timerTick builds the countdown message for the active reset timer, if there is one
+func timerTick() (fiber.Map, bool) {
+	activeTimers := timer.GetActiveTimersWithPrefix(ResetTimerPrefix)
+	if len(activeTimers) == 0 {
+		return nil, false
+	}
+
+	activeTimer, exists := timer.GetTimer(activeTimers[0])
+	if !exists || !activeTimer.IsActive() {
+		return nil, false
+	}
+
+	timeRemaining := time.Until(activeTimer.GetExpireTime())
+	return fiber.Map{
+		"type":           "tick",
+		"timer_id":       activeTimer.GetID(),
+		"expire_time":    activeTimer.GetExpireTime().Format(time.RFC3339),
+		"time_remaining": timeRemaining.Round(time.Second).String(),
+		"seconds_left":   int64(timeRemaining.Seconds()),
+	}, true
+}
@@ -0,0 +1,380 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/config"
+	"github.com/welasco/adguardfilter/common/durationfmt"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/notify"
+	"github.com/welasco/adguardfilter/common/servicelist"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// multiTimerMode reports whether reset timers run independently (multiTimerMode=true). In that mode
+// creating a timer doesn't stop the others and each timer only resets the services its update unblocked.
+func multiTimerMode() bool {
+	return config.GetBool("multiTimerMode", false)
+}
+
+// maxResetDuration returns the longest a reset may be scheduled ahead, from maxResetMinutes (default 1440),
+// and the configured minutes. A zero duration means there is no limit.
+func maxResetDuration() (time.Duration, int) {
+	maxResetMinutes := config.GetInt("maxResetMinutes", 1440)
+	if maxResetMinutes <= 0 {
+		return 0, 0
+	}
+	return time.Duration(maxResetMinutes) * time.Minute, maxResetMinutes
+}
+
+// Values of defaultResetPolicy, what an update without reset_after_min or reset_after does
+const (
+	ResetPolicyPermanent = "permanent" // Applied permanently, without a reset timer
+	ResetPolicyMidnight  = "midnight"  // Reset at the next midnight in the defaultTimeZone
+)
+
+// defaultResetPolicy returns the defaultResetPolicy env var, permanent when unset or unknown
+func defaultResetPolicy() string {
+	switch policy := strings.ToLower(os.Getenv("defaultResetPolicy")); policy {
+	case "", ResetPolicyPermanent:
+		return ResetPolicyPermanent
+	case ResetPolicyMidnight:
+		return policy
+	default:
+		logger.Warning("[api][defaultResetPolicy] Unknown defaultResetPolicy '" + policy + "', using " + ResetPolicyPermanent)
+		return ResetPolicyPermanent
+	}
+}
+
+// nextMidnight returns the start of the day after now in the defaultTimeZone. The date arithmetic is done
+// in local time, so it is midnight on days a DST change makes 23 or 25 hours long, and the first instant of
+// the day where the change skips midnight itself.
+func nextMidnight(now time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(adguardapi.DefaultTimeZone())
+	if err != nil {
+		return time.Time{}, err
+	}
+	local := now.In(location)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, location), nil
+}
+
+// uniqueResetTimerID makes the timer ID unique in multi-timer mode so a new timer never replaces another one
+func uniqueResetTimerID(timerID string) string {
+	if !multiTimerMode() {
+		return timerID
+	}
+	return timerID + "-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// newResetCallback returns the callback for a reset timer created by an update applying ids, and its scope.
+// In multi-timer mode the scope is the default services the update unblocked, otherwise it is nil
+// and the whole configuration is reset.
+func newResetCallback(ids []string) (timer.Callback, []string) {
+	if !multiTimerMode() {
+		return resetAfterTimer, nil
+	}
+
+	// The default services missing from the update are the ones it unblocked
+	unblocked, _ := servicelist.DiffServiceIDs(ids, adguardapi.BuildDefaultConfig().IDs)
+
+	return func(t *timer.Timer) { resetWithRetry(t.GetID(), unblocked) }, unblocked
+}
+
+// resetWarning returns the option sending a "window ending soon" notification timerWarningMinutes
+// (default 5, 0 disables) before a reset timer expires
+func resetWarning() timer.TimerOption {
+	lead := time.Duration(config.GetInt("timerWarningMinutes", 5)) * time.Minute
+	return timer.WithWarning(lead, func(t *timer.Timer) {
+		notify.Notify(notify.EventTimerWarning, "Unblock window ends in "+lead.String(), map[string]interface{}{
+			"timer_id":    t.GetID(),
+			"expire_time": t.GetExpireTime().Format(time.RFC3339),
+			"scope":       t.GetScope(),
+		})
+	})
+}
+
+// wantsHumanFormat reports whether the request asked for the human-friendly timer fields (?format=human)
+func wantsHumanFormat(c *fiber.Ctx) bool {
+	return c.Query("format") == "human"
+}
+
+// addHumanTimerFields adds time_remaining_human and expire_time_local, the expiry in the defaultTimeZone, to timer details
+func addHumanTimerFields(details *model.TimerResponse, activeTimer *timer.Timer) {
+	expireTime := activeTimer.GetExpireTime()
+	location, err := time.LoadLocation(adguardapi.DefaultTimeZone())
+	if err != nil {
+		logger.Warning("[api][addHumanTimerFields] Invalid defaultTimeZone, using UTC")
+		location = time.UTC
+	}
+
+	details.TimeRemainingHuman = durationfmt.Human(time.Until(expireTime))
+	details.ExpireTimeLocal = expireTime.In(location).Format(time.RFC3339)
+	details.TimeZone = location.String()
+}
+
+// timerDetails describes a timer for the timer endpoints, returning false when it doesn't exist.
+// human adds the human-friendly fields.
+func timerDetails(timerID string, human bool) (model.TimerResponse, bool) {
+	activeTimer, exists := timer.GetTimer(timerID)
+	if !exists {
+		return model.TimerResponse{}, false
+	}
+
+	// Calculate remaining time
+	expireTime := activeTimer.GetExpireTime()
+	timeRemaining := time.Until(expireTime)
+
+	startTime := activeTimer.GetStartTime()
+	details := model.TimerResponse{
+		IsActive:         activeTimer.IsActive(),
+		TimerID:          timerID,
+		StartTime:        startTime.Format(time.RFC3339),
+		ExpireTime:       expireTime.Format(time.RFC3339),
+		Duration:         activeTimer.GetDuration().String(),
+		TimeRemaining:    timeRemaining.String(),
+		ISO8601Remaining: durationfmt.ISO8601(timeRemaining),
+		SecondsLeft:      int64(timeRemaining.Seconds()),
+		MinutesLeft:      int64(timeRemaining.Minutes()),
+		HoursLeft:        durationfmt.Hours(max(timeRemaining, 0)),
+		ProgressPercent:  durationfmt.Progress(startTime, expireTime, time.Now()),
+		Scope:            activeTimer.GetScope(),
+		Metadata:         activeTimer.GetMetadata(),
+	}
+	if human {
+		addHumanTimerFields(&details, activeTimer)
+	}
+	return details, true
+}
+
+// metadataAppliedConfig is the timer metadata key holding the configuration the timer's update applied
+const metadataAppliedConfig = "applied_config"
+
+// timerMetadata describes who created a reset timer through which endpoint, and the configuration its
+// update applied, which the timer history reports once the timer is done
+func timerMetadata(c *fiber.Ctx, endpoint string, applied model.ServiceConfig) map[string]string {
+	encoded, _ := json.Marshal(applied)
+	return map[string]string{
+		"source":              "api",
+		"endpoint":            endpoint,
+		"requested_by":        ClientIP(c),
+		metadataAppliedConfig: string(encoded),
+	}
+}
+
+// ApiGetTimers returns all active reset timers with the services they reset, soonest first
+//
+// @Summary List the active reset timers
+// @Tags timers
+// @Produce json
+// @Param format query string false "human adds time_remaining_human and expire_time_local"
+// @Success 200 {object} model.TimersResponse
+// @Security ApiKeyAuth
+// @Router /api/v1/timers [get]
+func ApiGetTimers(c *fiber.Ctx) error {
+	activeTimers := timer.GetActiveTimersWithPrefix(ResetTimerPrefix)
+
+	logger.Debug("[api][ApiGetTimers] Number of active timers: ", len(activeTimers))
+
+	timers := make([]model.TimerResponse, 0, len(activeTimers))
+	for _, timerID := range activeTimers {
+		if details, ok := timerDetails(timerID, wantsHumanFormat(c)); ok && details.IsActive {
+			timers = append(timers, details)
+		}
+	}
+
+	sort.Slice(timers, func(i, j int) bool {
+		return timers[i].SecondsLeft < timers[j].SecondsLeft
+	})
+
+	return c.JSON(model.TimersResponse{
+		Count:          len(timers),
+		MultiTimerMode: multiTimerMode(),
+		CurrentTime:    time.Now().Format(time.RFC3339),
+		Timers:         timers,
+	})
+}
+
+// ApiGetTimerHistory returns the most recently completed reset timers (?limit=N, default 20), most recent
+// first, with whether they expired or were cancelled and the configuration they applied
+//
+// @Summary List the completed reset timers
+// @Tags timers
+// @Produce json
+// @Param limit query int false "Number of timers" default(20)
+// @Success 200 {object} model.TimerHistoryResponse
+// @Security ApiKeyAuth
+// @Router /api/v1/timer/history [get]
+func ApiGetTimerHistory(c *fiber.Ctx) error {
+	limit := max(c.QueryInt("limit", 20), 0)
+
+	entries := timer.History(func(entry timer.HistoryEntry) bool {
+		return strings.HasPrefix(entry.ID, ResetTimerPrefix)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	timers := make([]model.TimerHistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		timers = append(timers, historyDetails(entry))
+	}
+
+	logger.Debug("[api][ApiGetTimerHistory] Returning ", len(timers), " completed timer(s)")
+
+	return c.JSON(model.TimerHistoryResponse{
+		Count:  len(timers),
+		Limit:  limit,
+		Timers: timers,
+	})
+}
+
+// historyDetails builds the response for a completed timer, moving the applied configuration out of the metadata
+func historyDetails(entry timer.HistoryEntry) model.TimerHistoryEntry {
+	details := model.TimerHistoryEntry{
+		TimerID:    entry.ID,
+		StartTime:  entry.StartTime.Format(time.RFC3339),
+		ExpireTime: entry.ExpireTime.Format(time.RFC3339),
+		EndTime:    entry.EndTime.Format(time.RFC3339),
+		Duration:   entry.Duration.String(),
+		Outcome:    entry.Outcome,
+		Scope:      entry.Scope,
+		Metadata:   map[string]string{},
+	}
+	for key, value := range entry.Metadata {
+		if key != metadataAppliedConfig {
+			details.Metadata[key] = value
+		}
+	}
+	var applied model.ServiceConfig
+	if err := json.Unmarshal([]byte(entry.Metadata[metadataAppliedConfig]), &applied); err == nil {
+		details.AppliedConfig = &applied
+	}
+	return details
+}
+
+// ApiGetTimerByID returns the details of a single timer by ID
+//
+// @Summary Get a reset timer by ID
+// @Tags timers
+// @Produce json
+// @Param id path string true "Timer ID"
+// @Param format query string false "human adds time_remaining_human and expire_time_local"
+// @Success 200 {object} model.TimerResponse
+// @Failure 404 {object} model.ErrorResponse "Timer not found"
+// @Security ApiKeyAuth
+// @Router /api/v1/timer/{id} [get]
+func ApiGetTimerByID(c *fiber.Ctx) error {
+	timerID := c.Params("id")
+
+	details, exists := timerDetails(timerID, wantsHumanFormat(c))
+	if !exists {
+		logger.Warning("[api][ApiGetTimerByID] Timer '" + timerID + "' not found")
+		return respondError(c, fiber.StatusNotFound, "Timer not found", nil)
+	}
+
+	logger.Debug("[api][ApiGetTimerByID] Timer found: " + timerID)
+
+	details.CurrentTime = time.Now().Format(time.RFC3339)
+	return c.JSON(details)
+}
+
+// ApiCancelTimer stops a reset timer without resetting, so the services stay as they are until the next
+// reset. Pending expiry warnings are dropped with it.
+//
+// @Summary Cancel a reset timer without resetting
+// @Tags timers
+// @Produce json
+// @Param id path string true "Timer ID"
+// @Success 200 {object} model.SuccessResponse "timer_id"
+// @Failure 404 {object} model.ErrorResponse "Timer not found"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Security ApiKeyAuth
+// @Router /api/v1/timer/{id} [delete]
+func ApiCancelTimer(c *fiber.Ctx) error {
+	// The ID is kept after the request, so it must not share fasthttp's reused buffer
+	timerID := utils.CopyString(c.Params("id"))
+
+	if !strings.HasPrefix(timerID, ResetTimerPrefix) || timer.StopTimer(timerID) != nil {
+		logger.Warning("[api][ApiCancelTimer] Timer '" + timerID + "' not found")
+		return respondError(c, fiber.StatusNotFound, "Timer not found", nil)
+	}
+
+	logger.Info("[api][ApiCancelTimer] Timer '" + timerID + "' cancelled, blocked services left unchanged")
+	notify.Notify(notify.EventTimerCancelled, "Timer '"+timerID+"' was cancelled", map[string]interface{}{
+		"timer_id": timerID,
+	})
+
+	return respondSuccess(c, "Timer cancelled, blocked services left unchanged", fiber.Map{
+		"timer_id": timerID,
+	})
+}
+
+// ApiRestartTimer starts a reset timer over from now with its full duration, e.g. to give a fresh hour
+// instead of adding minutes to a nearly expired window. Without ?id the only active reset timer is
+// restarted; with several, in multiTimerMode, the ID is required.
+//
+// @Summary Restart a reset timer with its full duration
+// @Tags timers
+// @Produce json
+// @Param id query string false "Timer ID, required when several reset timers are active"
+// @Success 200 {object} model.SuccessResponse "timer_id, duration, previous_expire_time, expire_time"
+// @Failure 400 {object} model.ErrorResponse "Several timers are active, details list the timer_ids"
+// @Failure 404 {object} model.ErrorResponse "No active reset timer"
+// @Failure 409 {object} model.ErrorResponse "Another operation is in progress"
+// @Security ApiKeyAuth
+// @Router /api/v1/timer/restart [post]
+func ApiRestartTimer(c *fiber.Ctx) error {
+	timerID := c.Query("id")
+	if timerID == "" {
+		activeTimers := timer.GetActiveTimersWithPrefix(ResetTimerPrefix)
+		switch len(activeTimers) {
+		case 0:
+			logger.Warning("[api][ApiRestartTimer] No active reset timer to restart")
+			return respondError(c, fiber.StatusNotFound, "No active timer", nil)
+		case 1:
+			timerID = activeTimers[0]
+		default:
+			sort.Strings(activeTimers)
+			return respondError(c, fiber.StatusBadRequest, "Several timers are active, set ?id to the one to restart", fiber.Map{
+				"timer_ids": activeTimers,
+			})
+		}
+	}
+
+	previous, exists := timer.GetTimer(timerID)
+	if !strings.HasPrefix(timerID, ResetTimerPrefix) || !exists {
+		logger.Warning("[api][ApiRestartTimer] Timer '" + timerID + "' not found")
+		return respondError(c, fiber.StatusNotFound, "Timer not found", nil)
+	}
+	previousExpireTime := previous.GetExpireTime()
+
+	restarted, err := timer.Restart(timerID)
+	if err != nil {
+		// The timer expired in the meantime
+		return respondError(c, fiber.StatusNotFound, "Timer not found", nil)
+	}
+
+	expireTime := restarted.GetExpireTime().Format(time.RFC3339)
+	logger.Info("[api][ApiRestartTimer] Timer '" + timerID + "' restarted, now expires at: " + expireTime)
+	notify.Notify(notify.EventTimerCreated, "Timer restarted, blocked services reset in "+restarted.GetDuration().String(), map[string]interface{}{
+		"timer_id":    timerID,
+		"expire_time": expireTime,
+		"restarted":   true,
+	})
+
+	return respondSuccess(c, "Timer restarted with its full duration", fiber.Map{
+		"timer_id":             timerID,
+		"duration":             restarted.GetDuration().String(),
+		"previous_expire_time": previousExpireTime.Format(time.RFC3339),
+		"expire_time":          expireTime,
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// How an update treats the ids it is sent, from the mode field or defaultUpdateMode
+const (
+	UpdateModeReplace = "replace" // The ids replace the whole list
+	UpdateModeMerge   = "merge"   // The ids are added to the services already blocked
+)
+
+// defaultUpdateMode returns the update mode used when a request has no mode, from defaultUpdateMode
+// (default replace)
+func defaultUpdateMode() string {
+	switch mode := strings.ToLower(os.Getenv("defaultUpdateMode")); mode {
+	case "", UpdateModeReplace:
+		return UpdateModeReplace
+	case UpdateModeMerge:
+		return UpdateModeMerge
+	default:
+		logger.Warning("[api][defaultUpdateMode] Invalid defaultUpdateMode '" + mode + "', using replace")
+		return UpdateModeReplace
+	}
+}
+
+// validateUpdateMode checks the mode field of an update, which may be empty for defaultUpdateMode
+func validateUpdateMode(mode string, errs fieldErrors) {
+	switch mode {
+	case "", UpdateModeReplace, UpdateModeMerge:
+	default:
+		errs["mode"] = "must be replace or merge"
+	}
+}
+
+// applyUpdateMode resolves the mode of an update and, for merge, adds the services blocked right now to
+// serviceConfig, keeping their order first. A merge without a schedule keeps the current one.
+func applyUpdateMode(caller string, mode string, serviceConfig *model.ServiceConfig) (string, error) {
+	if mode == "" {
+		mode = defaultUpdateMode()
+	}
+	if mode != UpdateModeMerge {
+		return mode, nil
+	}
+
+	currentConfig, err := backend.GetManagedConfig()
+	if err != nil {
+		logger.Error("[api][" + caller + "] Failed to get the blocked services to merge into")
+		return mode, err
+	}
+
+	merged := append([]string{}, currentConfig.IDs...)
+	for _, id := range serviceConfig.IDs {
+		if !slices.Contains(merged, id) {
+			merged = append(merged, id)
+		}
+	}
+	logger.Info("[api]["+caller+"] Merging ", len(serviceConfig.IDs), " service(s) into ", len(currentConfig.IDs), " blocked service(s)")
+	serviceConfig.IDs = merged
+
+	if scheduleIsEmpty(serviceConfig.Schedule) {
+		serviceConfig.Schedule = currentConfig.Schedule
+	}
+	return mode, nil
+}
+
+// scheduleIsEmpty reports whether a schedule has neither a time zone nor a window
+func scheduleIsEmpty(schedule model.Schedule) bool {
+	if schedule.TimeZone != "" {
+		return false
+	}
+	for _, window := range schedule.Days() {
+		if window != nil {
+			return false
+		}
+	}
+	return true
+}
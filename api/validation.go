@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/adguardapi"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// fieldErrors maps a request field (e.g. "config.ids") to what is wrong with it
+type fieldErrors map[string]string
+
+// updateBodyFields records which fields of an update body were sent, since BodyParser leaves missing
+// fields at their zero value
+type updateBodyFields struct {
+	Config *json.RawMessage `json:"config"`
+}
+
+// validateServiceConfigBody checks the config object of an update body: it must be present with an explicit
+// ids array, so a missing field never wipes every block, and a valid schedule
+func validateServiceConfigBody(c *fiber.Ctx, serviceConfig *model.ServiceConfig) fieldErrors {
+	// Form bodies can't be inspected as JSON, the parsed ids are checked below instead
+	var sent updateBodyFields
+	if json.Unmarshal(c.Body(), &sent) == nil && sent.Config == nil {
+		return fieldErrors{"config": "is required"}
+	}
+
+	return validateServiceConfig(serviceConfig, "config")
+}
+
+// validateServiceConfig checks that a config has an explicit ids array without empty IDs and a valid
+// schedule, reporting the problems under the given field name
+func validateServiceConfig(serviceConfig *model.ServiceConfig, field string) fieldErrors {
+	errs := fieldErrors{}
+
+	if serviceConfig.IDs == nil {
+		errs[field+".ids"] = "is required and must be an array, use [] to unblock every service"
+	}
+	for i, id := range serviceConfig.IDs {
+		if id == "" {
+			errs[field+".ids["+strconv.Itoa(i)+"]"] = "must not be empty"
+		}
+	}
+
+	if timeZone := serviceConfig.Schedule.TimeZone; timeZone != "" {
+		if _, err := time.LoadLocation(timeZone); err != nil {
+			errs[field+".schedule.time_zone"] = "is not a valid IANA time zone"
+		}
+	}
+	for _, day := range adguardapi.InvalidScheduleDays(serviceConfig.Schedule) {
+		errs[field+".schedule."+day] = "must start before it ends, within 0-86400000 milliseconds since midnight"
+	}
+
+	return errs
+}
+
+// respondFieldErrors answers 400 with the per-field messages and returns true when there are any
+func respondFieldErrors(c *fiber.Ctx, caller string, errs fieldErrors) (bool, error) {
+	if len(errs) == 0 {
+		return false, nil
+	}
+
+	for field, message := range errs {
+		logger.Error("[api][" + caller + "] Invalid field " + field + ": " + message)
+	}
+	return true, respondError(c, fiber.StatusBadRequest, "Invalid request body", fiber.Map{
+		"fields": errs,
+	})
+}
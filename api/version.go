@@ -0,0 +1,24 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/common/version"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// ApiGetVersion returns the build version of AdGuardFilter, to include in bug reports
+//
+// @Summary Get the build version
+// @Tags status
+// @Produce json
+// @Success 200 {object} model.VersionInfo
+// @Security ApiKeyAuth
+// @Router /api/v1/version [get]
+func ApiGetVersion(c *fiber.Ctx) error {
+	return c.JSON(&model.VersionInfo{
+		Version:   version.Version(),
+		Commit:    version.Commit(),
+		BuildDate: version.BuildDate(),
+		GoVersion: version.GoVersion(),
+	})
+}
@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// Actions recorded in the audit log
+const (
+	ActionUpdate   = "update"
+	ActionReset    = "reset"
+	ActionImport   = "import"
+	ActionRollback = "rollback"
+	ActionDisable  = "disable"
+	ActionEnable   = "enable"
+)
+
+// Outcomes recorded in the audit log
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry is a single line of the audit log
+type Entry struct {
+	Timestamp     string   `json:"timestamp"`
+	Action        string   `json:"action"`
+	ClientIP      string   `json:"client_ip,omitempty"`
+	ServiceCount  int      `json:"service_count"`
+	Added         []string `json:"added,omitempty"`
+	Removed       []string `json:"removed,omitempty"`
+	ResetAfterMin int      `json:"reset_after_min,omitempty"`
+	ResetAfter    string   `json:"reset_after,omitempty"`
+	ResetDateTime string   `json:"reset_date_time,omitempty"`
+	Outcome       string   `json:"outcome"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// mu serializes all access to the audit file
+var mu sync.Mutex
+
+// Enabled reports whether an audit log path is configured via auditLogPath
+func Enabled() bool {
+	return os.Getenv("auditLogPath") != ""
+}
+
+// Record appends the entry to the audit log as a JSON line, creating the file if missing.
+// It does nothing when auditLogPath is not set.
+func Record(entry Entry) {
+	path := os.Getenv("auditLogPath")
+	if path == "" {
+		return
+	}
+
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().Format(time.RFC3339)
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logger.Error("[audit][Record] Failed to marshal audit entry")
+		logger.Error(err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		logger.Error("[audit][Record] Failed to open audit log: " + path)
+		logger.Error(err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		logger.Error("[audit][Record] Failed to write audit entry")
+		logger.Error(err)
+		return
+	}
+
+	logger.Debug("[audit][Record] Recorded audit entry: " + string(line))
+}
+
+// ReadRecent returns up to limit of the most recent audit entries, newest first
+func ReadRecent(limit int) ([]Entry, error) {
+	entries := []Entry{}
+
+	path := os.Getenv("auditLogPath")
+	if path == "" {
+		return entries, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		logger.Error("[audit][ReadRecent] Failed to open audit log: " + path)
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logger.Warning("[audit][ReadRecent] Skipping malformed audit line")
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		logger.Error("[audit][ReadRecent] Failed to read audit log: " + path)
+		return nil, err
+	}
+
+	// Keep only the newest entries and return them newest first
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// GetInt returns the integer value of the environment variable, or def if it is unset or invalid
+func GetInt(name string, def int) int {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		logger.Warning("[config][GetInt] Invalid integer for " + name + ": " + value + ", using default " + strconv.Itoa(def))
+		return def
+	}
+
+	return parsed
+}
+
+// GetBool returns the boolean value of the environment variable, or def if it is unset or invalid
+func GetBool(name string, def bool) bool {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return def
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warning("[config][GetBool] Invalid boolean for " + name + ": " + value + ", using default " + strconv.FormatBool(def))
+		return def
+	}
+
+	return parsed
+}
+
+// GetSecret returns the value of a credential environment variable. Following the Docker secrets convention,
+// when name_FILE is set the value is read from that file instead, with surrounding whitespace trimmed.
+func GetSecret(name string) string {
+	path := strings.TrimSpace(os.Getenv(name + "_FILE"))
+	if path == "" {
+		return os.Getenv(name)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("[config][GetSecret] Failed to read " + name + "_FILE: " + path)
+		logger.Error(err)
+		return ""
+	}
+
+	return strings.TrimSpace(string(content))
+}
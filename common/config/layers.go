@@ -0,0 +1,59 @@
+package config
+
+import "slices"
+
+// ListLayer is one source of a list of service IDs, such as the built-in defaults, the defaults file or a
+// profile. A layer with Replace set replaces the list of the layers below it, then adds and removes IDs.
+type ListLayer struct {
+	Name    string   `json:"name"`
+	Replace []string `json:"replace,omitempty"` // nil keeps the list of the layers below
+	Add     []string `json:"add,omitempty"`
+	Remove  []string `json:"remove,omitempty"`
+}
+
+// ResolvedList is a list of service IDs resolved from its layers
+type ResolvedList struct {
+	IDs     []string          `json:"ids"`
+	Sources map[string]string `json:"sources"` // Name of the layer each ID comes from
+	Layers  []string          `json:"layers"`  // Names of the layers applied, lowest first
+}
+
+// ResolveList applies the layers from the lowest to the highest: each one replaces, then extends, then trims
+// the list built so far. IDs keep the order they were first listed in and come from the layer that listed
+// them first, so an ID added again by a higher layer keeps its source.
+func ResolveList(layers []ListLayer) ResolvedList {
+	resolved := ResolvedList{
+		IDs:     []string{},
+		Sources: make(map[string]string),
+		Layers:  make([]string, 0, len(layers)),
+	}
+	add := func(id string, layer string) {
+		if _, listed := resolved.Sources[id]; id == "" || listed {
+			return
+		}
+		resolved.IDs = append(resolved.IDs, id)
+		resolved.Sources[id] = layer
+	}
+
+	for _, layer := range layers {
+		resolved.Layers = append(resolved.Layers, layer.Name)
+		if layer.Replace != nil {
+			resolved.IDs = []string{}
+			clear(resolved.Sources)
+			for _, id := range layer.Replace {
+				add(id, layer.Name)
+			}
+		}
+		for _, id := range layer.Add {
+			add(id, layer.Name)
+		}
+		for _, id := range layer.Remove {
+			delete(resolved.Sources, id)
+		}
+		resolved.IDs = slices.DeleteFunc(resolved.IDs, func(id string) bool {
+			_, listed := resolved.Sources[id]
+			return !listed
+		})
+	}
+	return resolved
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestResolveList(t *testing.T) {
+	builtin := ListLayer{Name: "builtin", Replace: []string{"youtube", "tiktok", "roblox"}}
+
+	tests := []struct {
+		name        string
+		layers      []ListLayer
+		wantIDs     []string
+		wantSources map[string]string
+	}{
+		{
+			name:        "builtin only",
+			layers:      []ListLayer{builtin},
+			wantIDs:     []string{"youtube", "tiktok", "roblox"},
+			wantSources: map[string]string{"youtube": "builtin", "tiktok": "builtin", "roblox": "builtin"},
+		},
+		{
+			name: "env over file over builtin",
+			layers: []ListLayer{
+				builtin,
+				{Name: "file", Replace: []string{"netflix", "youtube"}},
+				{Name: "env", Replace: []string{"steam", "netflix"}},
+			},
+			wantIDs:     []string{"steam", "netflix"},
+			wantSources: map[string]string{"steam": "env", "netflix": "env"},
+		},
+		{
+			name: "file over builtin",
+			layers: []ListLayer{
+				builtin,
+				{Name: "file", Replace: []string{"netflix"}},
+			},
+			wantIDs:     []string{"netflix"},
+			wantSources: map[string]string{"netflix": "file"},
+		},
+		{
+			name: "unset list keeps the lower layers",
+			layers: []ListLayer{
+				builtin,
+				{Name: "file", Replace: nil},
+			},
+			wantIDs:     []string{"youtube", "tiktok", "roblox"},
+			wantSources: map[string]string{"youtube": "builtin", "tiktok": "builtin", "roblox": "builtin"},
+		},
+		{
+			name: "empty list replaces the lower layers",
+			layers: []ListLayer{
+				builtin,
+				{Name: "file", Replace: []string{}},
+			},
+			wantIDs:     []string{},
+			wantSources: map[string]string{},
+		},
+		{
+			name: "empty env list over a file",
+			layers: []ListLayer{
+				builtin,
+				{Name: "file", Replace: []string{"netflix"}},
+				{Name: "env", Replace: []string{}},
+			},
+			wantIDs:     []string{},
+			wantSources: map[string]string{},
+		},
+		{
+			name: "profile adds and removes",
+			layers: []ListLayer{
+				builtin,
+				{Name: "profile:kids", Add: []string{"steam", "youtube"}, Remove: []string{"tiktok"}},
+			},
+			wantIDs:     []string{"youtube", "roblox", "steam"},
+			wantSources: map[string]string{"youtube": "builtin", "roblox": "builtin", "steam": "profile:kids"},
+		},
+		{
+			name: "removed then added again by a higher layer",
+			layers: []ListLayer{
+				builtin,
+				{Name: "profile:teen", Remove: []string{"roblox"}},
+				{Name: "env", Add: []string{"roblox"}},
+			},
+			wantIDs:     []string{"youtube", "tiktok", "roblox"},
+			wantSources: map[string]string{"youtube": "builtin", "tiktok": "builtin", "roblox": "env"},
+		},
+		{
+			name: "blank and duplicate IDs dropped",
+			layers: []ListLayer{
+				{Name: "env", Replace: []string{"steam", "", "steam", "netflix"}, Add: []string{"netflix", ""}},
+			},
+			wantIDs:     []string{"steam", "netflix"},
+			wantSources: map[string]string{"steam": "env", "netflix": "env"},
+		},
+		{
+			name:        "no layers",
+			layers:      nil,
+			wantIDs:     []string{},
+			wantSources: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ResolveList(tt.layers)
+			if !slices.Equal(got.IDs, tt.wantIDs) || got.IDs == nil {
+				t.Errorf("got IDs %#v, want %#v", got.IDs, tt.wantIDs)
+			}
+			if !maps.Equal(got.Sources, tt.wantSources) {
+				t.Errorf("got sources %v, want %v", got.Sources, tt.wantSources)
+			}
+
+			wantLayers := make([]string, 0, len(tt.layers))
+			for _, layer := range tt.layers {
+				wantLayers = append(wantLayers, layer.Name)
+			}
+			if !slices.Equal(got.Layers, wantLayers) {
+				t.Errorf("got layers %v, want %v", got.Layers, wantLayers)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// envFile is the file loaded at startup by godotenv
+const envFile = ".env"
+
+// environmentNames holds the variables the real environment set before envFile was loaded. They take
+// precedence over the file, at startup and on every reload.
+var environmentNames = make(map[string]bool)
+
+// init loads envFile at startup, without overriding the real environment, once it recorded which names that
+// sets. It runs before the packages reading the configuration, which all import this one. A missing file is
+// ignored, and so is a broken one as the logger isn't set up yet.
+func init() {
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		environmentNames[name] = true
+	}
+	_ = godotenv.Load(envFile)
+}
+
+// ReloadEnvFile reads the .env file again and applies its values, returning the names of the variables
+// that changed, sorted. Values in the file replace the ones it set before, but never a variable of the real
+// environment, as at startup. A missing file changes nothing.
+func ReloadEnvFile() ([]string, error) {
+	values, err := godotenv.Read(envFile)
+	if os.IsNotExist(err) {
+		logger.Debug("[config][ReloadEnvFile] No " + envFile + " file to reload")
+		return nil, nil
+	}
+	if err != nil {
+		logger.Error("[config][ReloadEnvFile] Failed to read " + envFile)
+		return nil, err
+	}
+
+	var changed []string
+	for name, value := range values {
+		if environmentNames[name] {
+			continue
+		}
+		if current, ok := os.LookupEnv(name); ok && current == value {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			logger.Error("[config][ReloadEnvFile] Failed to set " + name)
+			return changed, err
+		}
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
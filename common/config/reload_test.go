@@ -0,0 +1,36 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReloadEnvFileKeepsRealEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	if err := os.WriteFile(filepath.Join(dir, envFile), []byte("reloadReal=file\nreloadFile=new\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	// reloadReal comes from the real environment, reloadFile from the .env file loaded at startup
+	t.Setenv("reloadReal", "real")
+	t.Setenv("reloadFile", "old")
+	environmentNames["reloadReal"] = true
+	t.Cleanup(func() { delete(environmentNames, "reloadReal") })
+
+	changed, err := ReloadEnvFile()
+	if err != nil {
+		t.Fatalf("ReloadEnvFile: %v", err)
+	}
+	if !slices.Equal(changed, []string{"reloadFile"}) {
+		t.Errorf("got changed %v, want [reloadFile]", changed)
+	}
+	if got := os.Getenv("reloadReal"); got != "real" {
+		t.Errorf("got reloadReal=%q, want the real environment's value to win over the file", got)
+	}
+	if got := os.Getenv("reloadFile"); got != "new" {
+		t.Errorf("got reloadFile=%q, want the file's new value", got)
+	}
+}
@@ -0,0 +1,90 @@
+package durationfmt
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Human formats a duration for people, e.g. "1 hour, 2 minutes", dropping the seconds
+// once it is an hour or longer
+func Human(d time.Duration) string {
+	if d < time.Second {
+		return "less than a second"
+	}
+
+	d = d.Round(time.Second)
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"day", 24 * time.Hour},
+		{"hour", time.Hour},
+		{"minute", time.Minute},
+		{"second", time.Second},
+	}
+
+	// Decided up front, d only holds the remainder once the larger units are counted
+	dropSeconds := d >= time.Hour
+	var parts []string
+	for _, unit := range units {
+		if unit.size == time.Second && dropSeconds {
+			break
+		}
+		count := int64(d / unit.size)
+		d -= time.Duration(count) * unit.size
+		if count == 0 {
+			continue
+		}
+		part := strconv.FormatInt(count, 10) + " " + unit.name
+		if count > 1 {
+			part += "s"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ISO8601 formats a duration as an ISO 8601 duration in whole seconds, e.g. "PT1H2M3S". Days are left
+// as hours since their length varies with daylight saving time. Zero and negative durations are "PT0S".
+func ISO8601(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d <= 0 {
+		return "PT0S"
+	}
+
+	hours := int64(d / time.Hour)
+	minutes := int64(d % time.Hour / time.Minute)
+	seconds := int64(d % time.Minute / time.Second)
+
+	var b strings.Builder
+	b.WriteString("PT")
+	if hours > 0 {
+		b.WriteString(strconv.FormatInt(hours, 10) + "H")
+	}
+	if minutes > 0 {
+		b.WriteString(strconv.FormatInt(minutes, 10) + "M")
+	}
+	if seconds > 0 {
+		b.WriteString(strconv.FormatInt(seconds, 10) + "S")
+	}
+	return b.String()
+}
+
+// Hours returns the duration in hours rounded to two decimals, e.g. 1.5 for 90 minutes
+func Hours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
+
+// Progress returns how much of the span from start to end has elapsed at now, in percent rounded to
+// one decimal and clamped to 0-100
+func Progress(start, end, now time.Time) float64 {
+	total := end.Sub(start)
+	if total <= 0 {
+		return 100
+	}
+
+	percent := float64(now.Sub(start)) / float64(total) * 100
+	return math.Round(math.Max(0, math.Min(100, percent))*10) / 10
+}
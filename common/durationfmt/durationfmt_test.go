@@ -0,0 +1,104 @@
+package durationfmt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHuman(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "less than a second"},
+		{-time.Minute, "less than a second"},
+		{999 * time.Millisecond, "less than a second"},
+		{time.Second, "1 second"},
+		{1400 * time.Millisecond, "1 second"},
+		{45 * time.Second, "45 seconds"},
+		{59600 * time.Millisecond, "1 minute"},
+		{time.Minute, "1 minute"},
+		{90 * time.Second, "1 minute, 30 seconds"},
+		{2*time.Minute + time.Second, "2 minutes, 1 second"},
+		{time.Hour, "1 hour"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1 hour, 2 minutes"},
+		{time.Hour + 30*time.Second, "1 hour"},
+		{25 * time.Hour, "1 day, 1 hour"},
+		{48*time.Hour + 5*time.Minute, "2 days, 5 minutes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d.String(), func(t *testing.T) {
+			if got := Human(tt.d); got != tt.want {
+				t.Errorf("Human(%s) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestISO8601(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "PT0S"},
+		{-time.Hour, "PT0S"},
+		{400 * time.Millisecond, "PT0S"},
+		{500 * time.Millisecond, "PT1S"},
+		{45 * time.Second, "PT45S"},
+		{time.Minute, "PT1M"},
+		{90 * time.Second, "PT1M30S"},
+		{time.Hour, "PT1H"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "PT1H2M3S"},
+		{time.Hour + 3*time.Second, "PT1H3S"},
+		{50 * time.Hour, "PT50H"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.d.String(), func(t *testing.T) {
+			if got := ISO8601(tt.d); got != tt.want {
+				t.Errorf("ISO8601(%s) = %q, want %q", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHours(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want float64
+	}{
+		{0, 0},
+		{30 * time.Second, 0.01},
+		{90 * time.Minute, 1.5},
+		{100 * time.Minute, 1.67},
+	}
+	for _, tt := range tests {
+		if got := Hours(tt.d); got != tt.want {
+			t.Errorf("Hours(%s) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestProgress(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		now  time.Time
+		end  time.Time
+		want float64
+	}{
+		{name: "not started", now: start.Add(-time.Minute), end: end, want: 0},
+		{name: "started", now: start, end: end, want: 0},
+		{name: "a third", now: start.Add(20 * time.Minute), end: end, want: 33.3},
+		{name: "ended", now: end.Add(time.Minute), end: end, want: 100},
+		{name: "empty span", now: start, end: start, want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Progress(start, tt.end, tt.now); got != tt.want {
+				t.Errorf("Progress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
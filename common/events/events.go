@@ -0,0 +1,94 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// Event types published on the bus
+const (
+	TimerCreated   = "timer_created"
+	TimerExpired   = "timer_expired"
+	TimerCancelled = "timer_cancelled"
+	TimerWarning   = "timer_warning"
+	ConfigUpdated  = "config_updated"
+	ConfigReset    = "config_reset"
+
+	ProtectionChanged = "protection_changed"
+	RulesUpdated      = "rules_updated"
+	FilterUpdated     = "filter_updated"
+	ClientUpdated     = "client_updated"
+	DriftDetected     = "drift_detected"
+)
+
+// Event is a message delivered to every subscriber
+type Event struct {
+	Type      string                 `json:"type"`
+	Timestamp string                 `json:"timestamp"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+var (
+	subscribers      = make(map[int]chan Event)
+	nextSubscriberID int
+	subscribersMu    sync.Mutex
+)
+
+// Publish delivers an event to all subscribers. Subscribers that are not keeping up
+// miss the event rather than blocking the publisher.
+func Publish(eventType string, data map[string]interface{}) {
+	event := Event{
+		Type:      eventType,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Data:      data,
+	}
+
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	for id, ch := range subscribers {
+		select {
+		case ch <- event:
+		default:
+			logger.Warning("[events][Publish] Subscriber ", id, " is not keeping up, dropped event: "+eventType)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving all published events and a function that unsubscribes.
+// The channel is closed when unsubscribing or when CloseAll is called.
+func Subscribe(buffer int) (<-chan Event, func()) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	nextSubscriberID++
+	id := nextSubscriberID
+	ch := make(chan Event, buffer)
+	subscribers[id] = ch
+
+	logger.Debug("[events][Subscribe] Added subscriber ", id)
+
+	return ch, func() {
+		subscribersMu.Lock()
+		defer subscribersMu.Unlock()
+
+		if ch, exists := subscribers[id]; exists {
+			delete(subscribers, id)
+			close(ch)
+			logger.Debug("[events][Subscribe] Removed subscriber ", id)
+		}
+	}
+}
+
+// CloseAll closes every subscriber channel so long-lived streams end, e.g. on shutdown
+func CloseAll() {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+
+	for id, ch := range subscribers {
+		delete(subscribers, id)
+		close(ch)
+	}
+}
@@ -1,14 +1,21 @@
 package logger
 
 import (
+	"errors"
 	"io"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
 )
 
 var l log.Logger
 
-var level int
+// level is read by every log call and changed at runtime by SetLevel
+var level atomic.Int32
+
+// levelAliases maps the long level names accepted by SetLevel to loglevelstr entries
+var levelAliases = map[string]string{"error": "Err", "warning": "Warn", "info": "Inf", "debug": "Deb"}
 
 // array of log levels to match the config file and the const
 var loglevelstr = []string{"Err", "Warn", "Inf", "Deb"}
@@ -29,7 +36,7 @@ func Init(file string, llevel string) {
 
 	for i, v := range loglevelstr {
 		if v == llevel {
-			level = i
+			level.Store(int32(i))
 		}
 	}
 
@@ -47,26 +54,48 @@ func Init(file string, llevel string) {
 	l.SetFlags(log.LstdFlags)
 }
 
+// SetLevel changes the log level at runtime. It accepts the config names (Err, Warn, Inf, Deb)
+// and error, warning, info or debug, case-insensitively.
+func SetLevel(llevel string) error {
+	name := strings.TrimSpace(llevel)
+	if alias, ok := levelAliases[strings.ToLower(name)]; ok {
+		name = alias
+	}
+
+	for i, v := range loglevelstr {
+		if strings.EqualFold(v, name) {
+			level.Store(int32(i))
+			return nil
+		}
+	}
+	return errors.New("unknown log level: " + llevel)
+}
+
+// GetLevel returns the current log level name (Err, Warn, Inf or Deb)
+func GetLevel() string {
+	return loglevelstr[level.Load()]
+}
+
 func Error(msg ...interface{}) {
-	if level >= Err {
+	if level.Load() >= Err {
 		l.Println("ERROR:", msg)
 	}
 }
 
 func Warning(msg ...interface{}) {
-	if level >= Warn {
+	if level.Load() >= Warn {
 		l.Println("WARNING:", msg)
 	}
 }
 
 func Info(msg ...interface{}) {
-	if level >= Inf {
+	if level.Load() >= Inf {
 		l.Println("INFO:", msg)
 	}
 }
 
 func Debug(msg ...interface{}) {
-	if level >= Deb {
+	if level.Load() >= Deb {
 		l.Println("DEBUG:", msg)
 	}
 }
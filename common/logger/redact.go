@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+// redactedValue replaces secrets in log lines
+const redactedValue = "****"
+
+// sensitiveHeaders are the headers whose values are credentials
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// unsafeSecrets reports whether secrets may be logged in clear (logUnsafeSecrets=true), for local debugging only
+func unsafeSecrets() bool {
+	return strings.EqualFold(strings.TrimSpace(os.Getenv("logUnsafeSecrets")), "true")
+}
+
+// Redact masks a secret such as a cookie value or a login response, unless logUnsafeSecrets=true
+func Redact(secret string) string {
+	if secret == "" || unsafeSecrets() {
+		return secret
+	}
+	return redactedValue
+}
+
+// RedactHeader masks the value of a credential header (Authorization, Cookie, X-API-Key...) and
+// returns other header values unchanged
+func RedactHeader(name, value string) string {
+	if !sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+		return value
+	}
+	return Redact(value)
+}
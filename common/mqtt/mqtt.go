@@ -0,0 +1,198 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/config"
+	"github.com/welasco/adguardfilter/common/events"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/timer"
+)
+
+// qos is the quality of service of every published message, at least once so retained state isn't lost
+const qos = 1
+
+// publishTimeout bounds how long the event loop waits for the broker to acknowledge a message
+const publishTimeout = 5 * time.Second
+
+var (
+	client      paho.Client
+	topicPrefix string
+	timerPrefix string
+
+	// stateMu keeps state read and published by the event loop and a reconnect from arriving out of order
+	stateMu sync.Mutex
+)
+
+// Enabled reports whether an MQTT broker is configured (mqttBrokerURL)
+func Enabled() bool {
+	return os.Getenv("mqttBrokerURL") != ""
+}
+
+// Start connects to the broker in the background and publishes the timer and blocked services state
+// as retained messages under mqttTopicPrefix (default "adguardfilter"). Only timers whose ID starts with
+// resetTimerPrefix count as active. It does nothing when mqttBrokerURL is not set, and an unreachable
+// broker never blocks the service: the connection is retried every mqttRetryIntervalSec seconds (default 30).
+func Start(resetTimerPrefix string) {
+	if !Enabled() {
+		logger.Debug("[mqtt][Start] mqttBrokerURL is not set, MQTT publishing disabled")
+		return
+	}
+
+	topicPrefix = strings.TrimSuffix(os.Getenv("mqttTopicPrefix"), "/")
+	if topicPrefix == "" {
+		topicPrefix = "adguardfilter"
+	}
+	timerPrefix = resetTimerPrefix
+
+	clientID := os.Getenv("mqttClientID")
+	if clientID == "" {
+		clientID = "adguardfilter"
+	}
+	retryInterval := time.Duration(config.GetInt("mqttRetryIntervalSec", 30)) * time.Second
+
+	opts := paho.NewClientOptions().
+		AddBroker(os.Getenv("mqttBrokerURL")).
+		SetClientID(clientID).
+		SetUsername(config.GetSecret("mqttUsername")).
+		SetPassword(config.GetSecret("mqttPassword")).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(retryInterval).
+		SetMaxReconnectInterval(retryInterval).
+		SetWill(topic("status"), "offline", qos, true).
+		SetOnConnectHandler(onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			logger.Warning("[mqtt][Start] Connection to the broker lost, reconnecting")
+			logger.Warning(err)
+		})
+
+	client = paho.NewClient(opts)
+
+	// With SetConnectRetry the token only completes once connected, so it is not waited on
+	logger.Info("[mqtt][Start] Connecting to MQTT broker with topic prefix '" + topicPrefix + "'")
+	client.Connect()
+
+	subscription, _ := events.Subscribe(32)
+	go func() {
+		for event := range subscription {
+			handleEvent(event)
+		}
+	}()
+}
+
+// Stop publishes the offline status and disconnects from the broker
+func Stop() {
+	if client == nil || !client.IsConnectionOpen() {
+		return
+	}
+
+	send(topic("status"), "offline", true)
+	client.Disconnect(uint(publishTimeout / time.Millisecond))
+	logger.Info("[mqtt][Stop] Disconnected from MQTT broker")
+}
+
+// onConnect marks the service online and publishes the whole state, the broker may have restarted without it
+// or changes may have been missed while disconnected
+func onConnect(_ paho.Client) {
+	logger.Info("[mqtt][onConnect] Connected to MQTT broker")
+	send(topic("status"), "online", true)
+
+	publishTimerState()
+	publishServiceCount()
+}
+
+// handleEvent publishes the state an event bus message changed, and the event itself to <prefix>/event
+func handleEvent(event events.Event) {
+	switch event.Type {
+	case events.TimerCreated, events.TimerExpired, events.TimerCancelled:
+		publishTimerState()
+	case events.ConfigUpdated, events.ConfigReset:
+		if count, ok := event.Data["service_count"].(int); ok {
+			stateMu.Lock()
+			send(topic("services/count"), strconv.Itoa(count), true)
+			stateMu.Unlock()
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("[mqtt][handleEvent] Failed to marshal event: " + event.Type)
+		return
+	}
+	send(topic("event"), string(payload), false)
+}
+
+// publishTimerState publishes whether a reset timer is active, how many there are and when the soonest expires
+func publishTimerState() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	var soonest time.Time
+	activeTimers := timer.GetActiveTimersWithPrefix(timerPrefix)
+	for _, timerID := range activeTimers {
+		t, exists := timer.GetTimer(timerID)
+		if !exists {
+			continue
+		}
+		if expireTime := t.GetExpireTime(); soonest.IsZero() || expireTime.Before(soonest) {
+			soonest = expireTime
+		}
+	}
+
+	expireTime := ""
+	if !soonest.IsZero() {
+		expireTime = soonest.Format(time.RFC3339)
+	}
+
+	send(topic("timer/active"), strconv.FormatBool(len(activeTimers) > 0), true)
+	send(topic("timer/count"), strconv.Itoa(len(activeTimers)), true)
+	send(topic("timer/expire_time"), expireTime, true)
+}
+
+// publishServiceCount publishes the number of blocked services currently configured in AdGuard
+func publishServiceCount() {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	currentConfig, err := adguardapi.GetBlockedServices()
+	if err != nil {
+		logger.Warning("[mqtt][publishServiceCount] Failed to get blocked services, services/count is published on the next change")
+		logger.Warning(err)
+		return
+	}
+	send(topic("services/count"), strconv.Itoa(len(currentConfig.IDs)), true)
+}
+
+// send publishes a message when connected. While disconnected it is dropped, the whole state
+// is published again on reconnect.
+func send(t string, payload string, retain bool) {
+	if client == nil || !client.IsConnectionOpen() {
+		logger.Debug("[mqtt][send] Not connected, skipping publish to " + t)
+		return
+	}
+
+	token := client.Publish(t, qos, retain, payload)
+	if !token.WaitTimeout(publishTimeout) {
+		logger.Warning("[mqtt][send] Timed out publishing to " + t)
+		return
+	}
+	if err := token.Error(); err != nil {
+		logger.Warning("[mqtt][send] Failed to publish to " + t)
+		logger.Warning(err)
+		return
+	}
+	logger.Debug("[mqtt][send] Published to " + t + ": " + payload)
+}
+
+// topic returns the full topic for a subtopic below the prefix
+func topic(subtopic string) string {
+	return topicPrefix + "/" + subtopic
+}
@@ -0,0 +1,90 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// Events sent to the webhook
+const (
+	EventTimerCreated   = "timer_created"
+	EventTimerExpired   = "timer_expired"
+	EventTimerCancelled = "timer_cancelled"
+	EventTimerWarning   = "timer_warning"
+	EventResetFailed    = "reset_failed"
+	EventDriftDetected  = "drift_detected"
+)
+
+// Payload is the JSON body POSTed to the webhook
+type Payload struct {
+	Event     string                 `json:"event"`
+	Message   string                 `json:"message"`
+	Timestamp string                 `json:"timestamp"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	// Content and Text repeat the message so Discord and Slack-compatible webhooks render it as-is
+	Content string `json:"content"`
+	Text    string `json:"text"`
+}
+
+// Notify POSTs the event to the configured webhookURL in the background.
+// It returns immediately and never blocks the caller; delivery failures are only logged.
+func Notify(event string, message string, details map[string]interface{}) {
+	webhookURL := config.GetSecret("webhookURL")
+	if webhookURL == "" {
+		return
+	}
+
+	payload := Payload{
+		Event:     event,
+		Message:   message,
+		Timestamp: time.Now().Format(time.RFC3339),
+		Details:   details,
+		Content:   message,
+		Text:      message,
+	}
+
+	go send(webhookURL, payload)
+}
+
+// send delivers the payload to the webhook with its own timeout
+func send(webhookURL string, payload Payload) {
+	timeout := time.Duration(config.GetInt("webhookTimeoutSec", 5)) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		logger.Error("[notify][send] Failed to marshal payload for event: " + payload.Event)
+		logger.Error(err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.Error("[notify][send] Failed to create webhook request")
+		logger.Error(err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Warning("[notify][send] Failed to deliver event '" + payload.Event + "' to webhook")
+		logger.Warning(err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		logger.Warning("[notify][send] Webhook returned status " + resp.Status + " for event: " + payload.Event)
+		return
+	}
+
+	logger.Debug("[notify][send] Delivered event '" + payload.Event + "' to webhook")
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "notify-test")
+	if err != nil {
+		panic(err)
+	}
+	logger.Init(filepath.Join(dir, "test.log"), "Inf")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// webhookRequest is a request received by the test webhook
+type webhookRequest struct {
+	method      string
+	contentType string
+	body        []byte
+}
+
+// newWebhook starts a webhook recording its requests on the returned channel and sets webhookURL to it
+func newWebhook(t *testing.T) <-chan webhookRequest {
+	t.Helper()
+	received := make(chan webhookRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- webhookRequest{method: r.Method, contentType: r.Header.Get("Content-Type"), body: body}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("webhookURL", server.URL)
+	return received
+}
+
+func TestNotifyPayload(t *testing.T) {
+	received := newWebhook(t)
+
+	before := time.Now().Truncate(time.Second)
+	Notify(EventTimerExpired, "Timer 'reset' expired", map[string]interface{}{"timer_id": "reset", "services": 3})
+
+	var req webhookRequest
+	select {
+	case req = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook wasn't called")
+	}
+
+	if req.method != http.MethodPost || req.contentType != "application/json" {
+		t.Errorf("got %s with Content-Type %q, want a JSON POST", req.method, req.contentType)
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	timestamp, err := time.Parse(time.RFC3339, payload["timestamp"].(string))
+	if err != nil || timestamp.Before(before) || timestamp.After(time.Now()) {
+		t.Errorf("got timestamp %v, want the RFC 3339 time of the event", payload["timestamp"])
+	}
+	delete(payload, "timestamp")
+
+	want := map[string]interface{}{
+		"event":   "timer_expired",
+		"message": "Timer 'reset' expired",
+		"content": "Timer 'reset' expired",
+		"text":    "Timer 'reset' expired",
+		"details": map[string]interface{}{"timer_id": "reset", "services": float64(3)},
+	}
+	if !reflect.DeepEqual(payload, want) {
+		t.Errorf("got payload %v, want %v", payload, want)
+	}
+}
+
+func TestNotifyOmitsEmptyDetails(t *testing.T) {
+	received := newWebhook(t)
+
+	Notify(EventResetFailed, "Reset failed", nil)
+
+	select {
+	case req := <-received:
+		var payload map[string]interface{}
+		if err := json.Unmarshal(req.body, &payload); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if _, exists := payload["details"]; exists {
+			t.Errorf("got details %v, want them left out", payload["details"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook wasn't called")
+	}
+}
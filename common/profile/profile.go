@@ -0,0 +1,553 @@
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// TimerPrefix prefixes the IDs of the timers ending the unblock windows of profiles
+const TimerPrefix = "profile-"
+
+// retryDelay is how long a window whose default list couldn't be applied waits before trying again
+const retryDelay = time.Minute
+
+var (
+	// ErrUnknownProfile is returned when no profile with the given name is configured
+	ErrUnknownProfile = errors.New("unknown profile")
+	// ErrNotInProfile is returned when unblocking services the profile doesn't block
+	ErrNotInProfile = errors.New("services not blocked by the profile")
+)
+
+// BudgetExhaustedError is returned by Unblock when a service has no time left in today's budget
+type BudgetExhaustedError struct {
+	IDs      []string
+	ResetsAt time.Time
+}
+
+func (e *BudgetExhaustedError) Error() string {
+	return "daily budget exhausted for: " + strings.Join(e.IDs, ", ")
+}
+
+// Profile is a household member: the services blocked for their AdGuard client by default, and how many
+// minutes a day each service may be unblocked
+type Profile struct {
+	Name    string         `json:"name"`
+	Client  string         `json:"client,omitempty"`  // AdGuard persistent client, the name when empty
+	IDs     []string       `json:"ids"`               // Services blocked by default
+	Add     []string       `json:"add,omitempty"`     // Services blocked on top of ids, or of the global default list without ids
+	Remove  []string       `json:"remove,omitempty"`  // Services left out of ids, or of the global default list without ids
+	Budgets map[string]int `json:"budgets,omitempty"` // Daily minutes per service, unlimited when missing
+}
+
+// Layers returns the layers the profile's default list is resolved from. A profile with only add or
+// remove starts from the global default list; one with ids replaces it.
+func (p Profile) Layers() []config.ListLayer {
+	layer := config.ListLayer{Name: "profile:" + p.Name, Replace: p.IDs, Add: p.Add, Remove: p.Remove}
+	if p.IDs == nil && (len(p.Add) > 0 || len(p.Remove) > 0) {
+		return append(adguardapi.DefaultLayers(), layer)
+	}
+	if layer.Replace == nil {
+		layer.Replace = []string{}
+	}
+	return []config.ListLayer{layer}
+}
+
+// DefaultIDs returns the services blocked for the profile by default, resolved from its layers
+func (p Profile) DefaultIDs() []string {
+	return config.ResolveList(p.Layers()).IDs
+}
+
+// ClientName returns the AdGuard persistent client the profile applies to
+func (p Profile) ClientName() string {
+	if p.Client != "" {
+		return p.Client
+	}
+	return p.Name
+}
+
+// Grant is an unblock started by Unblock
+type Grant struct {
+	Profile  Profile
+	IDs      []string
+	Minutes  int // Unblocked for, at most what was requested
+	Capped   bool
+	Until    time.Time
+	Refunded int // Unused minutes of the replaced window given back to the budgets
+}
+
+// window is a running unblock, persisted so a restart re-arms it
+type window struct {
+	IDs     []string  `json:"ids"`
+	Until   time.Time `json:"until"`
+	Minutes int       `json:"minutes"`
+	Date    string    `json:"date"` // Day the minutes were charged to
+}
+
+// usage is the persisted use of the budgets, counted per day in the default time zone
+type usage struct {
+	Date   string                    `json:"date"`
+	Used   map[string]map[string]int `json:"used"` // Profile name to service ID to minutes
+	Active map[string]window         `json:"active"`
+}
+
+var (
+	profiles []Profile
+	state    usage
+	mu       sync.Mutex
+)
+
+// Init loads the profiles and their budget use, and re-arms the unblock windows a restart interrupted.
+// Windows that ended while the service was down apply the default list right away.
+func Init() error {
+	loaded, err := loadProfiles()
+	if err != nil {
+		logger.Error("[profile][Init] Failed to load profiles from: " + profilesPath())
+		logger.Error(err)
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	profiles = loaded
+	state = loadUsage()
+	rollOver(time.Now())
+
+	for name, active := range state.Active {
+		p, ok := find(name)
+		if !ok {
+			logger.Warning("[profile][Init] Dropping the unblock window of removed profile '" + name + "'")
+			delete(state.Active, name)
+			continue
+		}
+		if active.Until.After(time.Now()) {
+			logger.Info("[profile][Init] Re-arming the unblock window of profile '" + name + "' until: " + active.Until.Format(time.RFC3339))
+			arm(p.Name, active.Until, active.Until)
+			continue
+		}
+		if err := applyDefault(p, "Init"); err != nil {
+			arm(p.Name, active.Until, time.Now().Add(retryDelay))
+			continue
+		}
+		delete(state.Active, name)
+	}
+	save()
+
+	logger.Info("[profile][Init] Loaded ", len(loaded), " profile(s) from: "+profilesPath())
+	return nil
+}
+
+// Get returns the profile with the given name
+func Get(name string) (Profile, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	return find(name)
+}
+
+// Status returns every profile with today's use of its budgets and its running unblock window
+func Status() model.ProfilesResponse {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	rollOver(now)
+
+	response := model.ProfilesResponse{
+		Count:          len(profiles),
+		TimeZone:       location().String(),
+		BudgetsResetAt: ResetsAt(now).Format(time.RFC3339),
+		Profiles:       make([]model.ProfileStatus, 0, len(profiles)),
+	}
+	for _, p := range profiles {
+		status := model.ProfileStatus{
+			Name:    p.Name,
+			Client:  p.ClientName(),
+			IDs:     p.DefaultIDs(),
+			Budgets: []model.ServiceBudget{},
+		}
+		used := state.Used[p.Name]
+		for _, id := range budgetIDs(p) {
+			status.Budgets = append(status.Budgets, model.ServiceBudget{
+				ID:               id,
+				DailyMinutes:     p.Budgets[id],
+				UsedMinutes:      used[id],
+				RemainingMinutes: max(p.Budgets[id]-used[id], 0),
+			})
+		}
+		if active, ok := state.Active[p.Name]; ok {
+			status.Unblocked = &model.ProfileWindow{
+				IDs:     active.IDs,
+				Until:   active.Until.Format(time.RFC3339),
+				Minutes: active.Minutes,
+			}
+		}
+		response.Profiles = append(response.Profiles, status)
+	}
+	return response
+}
+
+// Unblock unblocks some of a profile's services on its client for up to minutes, capped to what is left
+// of their daily budgets, and charges the minutes to the budgets up front. A running window of the
+// profile is replaced and its unused minutes are given back.
+func Unblock(name string, ids []string, minutes int) (Grant, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, ok := find(name)
+	if !ok {
+		return Grant{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	defaultIDs := p.DefaultIDs()
+	var missing []string
+	for _, id := range ids {
+		if !slices.Contains(defaultIDs, id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return Grant{}, fmt.Errorf("%w: %s", ErrNotInProfile, strings.Join(missing, ", "))
+	}
+
+	now := time.Now()
+	rollOver(now)
+	used, refunded := usedWithRefund(p.Name, now)
+
+	granted := minutes
+	var exhausted []string
+	for _, id := range ids {
+		daily, limited := p.Budgets[id]
+		if !limited {
+			continue
+		}
+		left := max(daily-used[id], 0)
+		if left == 0 {
+			exhausted = append(exhausted, id)
+			continue
+		}
+		granted = min(granted, left)
+	}
+	if len(exhausted) > 0 {
+		logger.Warning("[profile][Unblock] Daily budget of profile '" + p.Name + "' exhausted for: " + strings.Join(exhausted, ", "))
+		return Grant{}, &BudgetExhaustedError{IDs: exhausted, ResetsAt: ResetsAt(now)}
+	}
+
+	blocked := make([]string, 0, len(defaultIDs))
+	for _, id := range defaultIDs {
+		if !slices.Contains(ids, id) {
+			blocked = append(blocked, id)
+		}
+	}
+	err := adguardapi.SetClientBlockedServices(p.ClientName(), blocked)
+	recordAudit(audit.ActionUpdate, len(blocked), err)
+	if err != nil {
+		logger.Error("[profile][Unblock] Failed to unblock the services of profile '" + p.Name + "'")
+		logger.Error(err)
+		return Grant{}, err
+	}
+
+	until := now.Add(time.Duration(granted) * time.Minute)
+	for _, id := range ids {
+		used[id] += granted
+	}
+	state.Used[p.Name] = used
+	state.Active[p.Name] = window{
+		IDs:     ids,
+		Until:   until,
+		Minutes: granted,
+		Date:    state.Date,
+	}
+	save()
+	arm(p.Name, until, until)
+
+	logger.Info("[profile][Unblock] Unblocked "+strings.Join(ids, ", ")+" for profile '"+p.Name+"' for ", granted, " minute(s), until: "+until.Format(time.RFC3339))
+
+	return Grant{
+		Profile:  p,
+		IDs:      ids,
+		Minutes:  granted,
+		Capped:   granted < minutes,
+		Until:    until,
+		Refunded: refunded,
+	}, nil
+}
+
+// Reset applies a profile's default list to its client, ending its running window early. It returns the
+// unused minutes of the window given back to the budgets.
+func Reset(name string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, ok := find(name)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	now := time.Now()
+	rollOver(now)
+	if err := applyDefault(p, "Reset"); err != nil {
+		return 0, err
+	}
+
+	used, refunded := usedWithRefund(p.Name, now)
+	state.Used[p.Name] = used
+	if _, ok := state.Active[p.Name]; ok {
+		delete(state.Active, p.Name)
+		timer.StopTimer(TimerPrefix + p.Name)
+	}
+	save()
+
+	logger.Info("[profile][Reset] Applied the default list of profile '"+p.Name+"', refunded ", refunded, " minute(s)")
+	return refunded, nil
+}
+
+// ResetsAt returns when the budgets start over, the next midnight in the default time zone
+func ResetsAt(now time.Time) time.Time {
+	local := now.In(location())
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+}
+
+// arm creates the timer that applies the default list of a profile at the given time, ending the window
+// that lasts until until
+func arm(name string, until time.Time, at time.Time) {
+	_, err := timer.NewTimer(TimerPrefix+name,
+		timer.WithDeadline(at),
+		timer.WithCallback(func(*timer.Timer) {
+			endWindow(name, until)
+		}),
+	)
+	if err != nil {
+		logger.Error("[profile][arm] Failed to create the timer of profile '" + name + "'")
+		logger.Error(err)
+	}
+}
+
+// endWindow applies the default list of a profile when its window ends, unless the window was replaced or
+// reset meanwhile. A failure is retried after retryDelay.
+func endWindow(name string, until time.Time) {
+	endOperation := adguardapi.WaitOperation("profile window end")
+	defer endOperation()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	active, ok := state.Active[name]
+	if !ok || !active.Until.Equal(until) {
+		return
+	}
+	p, ok := find(name)
+	if !ok {
+		return
+	}
+
+	logger.Info("[profile][endWindow] Unblock window of profile '" + name + "' ended, applying its default list")
+	if err := applyDefault(p, "endWindow"); err != nil {
+		logger.Warning("[profile][endWindow] Retrying profile '" + name + "' in " + retryDelay.String())
+		arm(name, until, time.Now().Add(retryDelay))
+		return
+	}
+	delete(state.Active, name)
+	save()
+}
+
+// applyDefault blocks the profile's default list on its client. The caller must hold mu.
+func applyDefault(p Profile, caller string) error {
+	defaultIDs := p.DefaultIDs()
+	err := adguardapi.SetClientBlockedServices(p.ClientName(), defaultIDs)
+	recordAudit(audit.ActionReset, len(defaultIDs), err)
+	if err != nil {
+		logger.Error("[profile][" + caller + "] Failed to apply the default list of profile '" + p.Name + "'")
+		logger.Error(err)
+	}
+	return err
+}
+
+// usedWithRefund returns a copy of today's use of a profile's budgets, without the minutes its running
+// window has left, and how many minutes those are. The caller must hold mu.
+func usedWithRefund(name string, now time.Time) (map[string]int, int) {
+	used := make(map[string]int)
+	for id, minutes := range state.Used[name] {
+		used[id] = minutes
+	}
+
+	// Minutes charged to an earlier day were already forgotten at midnight
+	active, ok := state.Active[name]
+	if !ok || active.Date != state.Date {
+		return used, 0
+	}
+	refunded := min(int(active.Until.Sub(now).Round(time.Minute)/time.Minute), active.Minutes)
+	if refunded <= 0 {
+		return used, 0
+	}
+	for _, id := range active.IDs {
+		used[id] = max(used[id]-refunded, 0)
+	}
+	return used, refunded
+}
+
+// rollOver forgets the use of the budgets once the day changed. The caller must hold mu.
+func rollOver(now time.Time) {
+	today := now.In(location()).Format(time.DateOnly)
+	if state.Used == nil {
+		state.Used = make(map[string]map[string]int)
+	}
+	if state.Active == nil {
+		state.Active = make(map[string]window)
+	}
+	if state.Date != today {
+		if state.Date != "" {
+			logger.Info("[profile][rollOver] New day " + today + ", resetting the time budgets")
+		}
+		state.Date = today
+		state.Used = make(map[string]map[string]int)
+		save()
+	}
+}
+
+// find returns the profile with the given name. The caller must hold mu.
+func find(name string) (Profile, bool) {
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// budgetIDs returns the services with a budget in a profile, sorted
+func budgetIDs(p Profile) []string {
+	ids := make([]string, 0, len(p.Budgets))
+	for id := range p.Budgets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// location returns the time zone the budgets' days are counted in, the default time zone
+func location() *time.Location {
+	loc, err := time.LoadLocation(adguardapi.DefaultTimeZone())
+	if err != nil {
+		logger.Warning("[profile][location] Unknown default time zone " + adguardapi.DefaultTimeZone() + ", counting the budgets in UTC")
+		return time.UTC
+	}
+	return loc
+}
+
+// recordAudit writes an audit entry for a profile change
+func recordAudit(action string, serviceCount int, err error) {
+	entry := audit.Entry{
+		Action:       action,
+		ClientIP:     "profile",
+		ServiceCount: serviceCount,
+		Outcome:      audit.OutcomeSuccess,
+	}
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+	audit.Record(entry)
+}
+
+// profilesPath returns the file the profiles are configured in
+func profilesPath() string {
+	if path := os.Getenv("profilesPath"); path != "" {
+		return path
+	}
+	return "profiles.json"
+}
+
+// usagePath returns the file the use of the budgets is persisted to
+func usagePath() string {
+	if path := os.Getenv("profileUsagePath"); path != "" {
+		return path
+	}
+	return "profile_usage.json"
+}
+
+// loadProfiles reads and validates the profiles file, returning no profiles if it does not exist
+func loadProfiles() ([]Profile, error) {
+	data, err := os.ReadFile(profilesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Profile{}, nil
+		}
+		return nil, err
+	}
+
+	var loaded []Profile
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(loaded))
+	for _, p := range loaded {
+		if p.Name == "" || strings.ContainsAny(p.Name, "/ ") {
+			return nil, errors.New("profile names must be set and have no spaces or slashes: '" + p.Name + "'")
+		}
+		if names[p.Name] {
+			return nil, errors.New("duplicate profile: " + p.Name)
+		}
+		names[p.Name] = true
+		for id, minutes := range p.Budgets {
+			if minutes < 0 {
+				return nil, errors.New("negative budget for " + id + " in profile " + p.Name)
+			}
+			if !slices.Contains(p.DefaultIDs(), id) {
+				logger.Warning("[profile][loadProfiles] Profile '" + p.Name + "' has a budget for " + id + ", which it doesn't block")
+			}
+		}
+	}
+	return loaded, nil
+}
+
+// loadUsage reads the persisted use of the budgets, starting over when it is missing or unreadable
+func loadUsage() usage {
+	var loaded usage
+	data, err := os.ReadFile(usagePath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Error("[profile][loadUsage] Failed to read the budget usage file")
+			logger.Error(err)
+		}
+		return loaded
+	}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		logger.Error("[profile][loadUsage] Failed to parse the budget usage file")
+		logger.Error(err)
+		return usage{}
+	}
+	return loaded
+}
+
+// save writes the use of the budgets atomically, when there are profiles. The caller must hold mu.
+func save() {
+	if len(profiles) == 0 {
+		return
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		path := usagePath()
+		tmpPath := path + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+	}
+	if err != nil {
+		logger.Error("[profile][save] Failed to persist the budget usage")
+		logger.Error(err)
+	}
+}
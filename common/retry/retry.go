@@ -0,0 +1,29 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// maxDelay caps the delay between attempts regardless of the attempt number
+const maxDelay = 30 * time.Second
+
+// Backoff returns the delay before the given retry attempt (starting at 0) using
+// exponential backoff with jitter: a random delay between half and the full value
+// of base * 2^attempt, capped at maxDelay
+func Backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	delay := base
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
@@ -0,0 +1,427 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/common/audit"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// TimerPrefix prefixes the IDs of all timers owned by the schedule package
+const TimerPrefix = "schedule-"
+
+// ErrInvalidSchedule is returned by Add when the schedule fails validation
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// Schedule is a recurring daily window. When the window opens the given blocked
+// service IDs are applied, and when it closes the default configuration is restored.
+type Schedule struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Start    string   `json:"start"`          // HH:MM in TimeZone
+	End      string   `json:"end"`            // HH:MM in TimeZone, earlier than Start for overnight windows
+	Days     []string `json:"days,omitempty"` // mon..sun the window opens on, every day when empty
+	TimeZone string   `json:"time_zone"`
+	IDs      []string `json:"ids"` // blocked services applied during the window
+}
+
+var (
+	schedules   []Schedule
+	schedulesMu sync.Mutex
+)
+
+// resetFunc resets the blocked services when a window closes, set by SetResetFunc
+var resetFunc func(timerID string)
+
+// SetResetFunc sets the function that resets the blocked services when a window closes, the api's, which
+// retries a failed reset and keeps it pending until AdGuard is back. It takes the operation lock itself.
+// Without it a window closes with a single reset attempt.
+func SetResetFunc(reset func(timerID string)) {
+	resetFunc = reset
+}
+
+// weekdays maps the accepted day names to time.Weekday
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Init loads the persisted schedules and arms a timer for each one
+func Init() error {
+	loaded, err := load()
+	if err != nil {
+		logger.Error("[schedule][Init] Failed to load schedules from: " + schedulesPath())
+		logger.Error(err)
+		return err
+	}
+
+	schedulesMu.Lock()
+	schedules = loaded
+	schedulesMu.Unlock()
+
+	for _, s := range loaded {
+		arm(s)
+	}
+
+	logger.Info("[schedule][Init] Loaded ", len(loaded), " schedule(s) from: "+schedulesPath())
+	return nil
+}
+
+// List returns a copy of all configured schedules
+func List() []Schedule {
+	schedulesMu.Lock()
+	defer schedulesMu.Unlock()
+
+	list := make([]Schedule, len(schedules))
+	copy(list, schedules)
+	return list
+}
+
+// Add validates, persists and arms a new schedule, returning it with its assigned ID
+func Add(s Schedule) (Schedule, error) {
+	if s.TimeZone == "" {
+		s.TimeZone = adguardapi.BuildDefaultConfig().Schedule.TimeZone
+	}
+	if err := s.Validate(); err != nil {
+		return Schedule{}, fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+	}
+
+	s.ID = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	schedulesMu.Lock()
+	schedules = append(schedules, s)
+	err := save(schedules)
+	if err != nil {
+		schedules = schedules[:len(schedules)-1]
+	}
+	schedulesMu.Unlock()
+
+	if err != nil {
+		logger.Error("[schedule][Add] Failed to persist schedules")
+		logger.Error(err)
+		return Schedule{}, err
+	}
+
+	logger.Info("[schedule][Add] Added schedule '" + s.ID + "' (" + s.Name + ") " + s.Start + "-" + s.End + " " + s.TimeZone)
+	arm(s)
+
+	return s, nil
+}
+
+// Remove deletes a schedule and stops its upcoming start timer. Returns false if the schedule does not exist.
+func Remove(id string) (bool, error) {
+	schedulesMu.Lock()
+	index := -1
+	for i, s := range schedules {
+		if s.ID == id {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		schedulesMu.Unlock()
+		return false, nil
+	}
+
+	remaining := append(append([]Schedule{}, schedules[:index]...), schedules[index+1:]...)
+	err := save(remaining)
+	if err == nil {
+		schedules = remaining
+	}
+	schedulesMu.Unlock()
+
+	if err != nil {
+		logger.Error("[schedule][Remove] Failed to persist schedules")
+		logger.Error(err)
+		return true, err
+	}
+
+	// Only cancel the upcoming start, an open window still closes and resets as planned
+	if err := timer.StopTimer(TimerPrefix + id + "-start"); err != nil {
+		logger.Debug("[schedule][Remove] No start timer to stop for schedule '" + id + "'")
+	}
+	logger.Info("[schedule][Remove] Removed schedule '" + id + "'")
+
+	return true, nil
+}
+
+// InWindow reports whether any schedule window is currently applied and waiting to close
+func InWindow() bool {
+	for _, s := range List() {
+		if endTimer, exists := timer.GetTimer(TimerPrefix + s.ID + "-end"); exists && endTimer.IsActive() {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the schedule fields
+func (s *Schedule) Validate() error {
+	if _, err := parseClock(s.Start); err != nil {
+		return errors.New("start must be in HH:MM format")
+	}
+	if _, err := parseClock(s.End); err != nil {
+		return errors.New("end must be in HH:MM format")
+	}
+	if s.Start == s.End {
+		return errors.New("start and end must differ")
+	}
+	for _, day := range s.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return errors.New("invalid day '" + day + "', use sun, mon, tue, wed, thu, fri or sat")
+		}
+	}
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return errors.New("invalid time_zone: " + s.TimeZone)
+	}
+	if s.IDs == nil {
+		return errors.New("ids is required")
+	}
+	return nil
+}
+
+// arm starts the timers for a schedule: the end timer if its window is open right now
+// (applying its services immediately) and the timer for its next window start
+func arm(s Schedule) {
+	if end, open := s.currentWindowEnd(time.Now()); open {
+		logger.Info("[schedule][arm] Schedule '" + s.ID + "' window is open, applying now")
+		endOperation := adguardapi.WaitOperation("schedule window start")
+		openWindow(s, end)
+		endOperation()
+	}
+
+	armNextStart(s)
+}
+
+// armNextStart creates the timer that opens the schedule's next window and re-arms itself after firing
+func armNextStart(s Schedule) {
+	nextStart, err := s.nextStart(time.Now())
+	if err != nil {
+		logger.Error("[schedule][armNextStart] Failed to compute next start for schedule '" + s.ID + "'")
+		logger.Error(err)
+		return
+	}
+
+	_, err = timer.NewTimerWithDeadline(TimerPrefix+s.ID+"-start", nextStart, func(*timer.Timer) {
+		if !exists(s.ID) {
+			return
+		}
+		end, _ := s.currentWindowEnd(time.Now())
+		endOperation := adguardapi.WaitOperation("schedule window start")
+		openWindow(s, end)
+		endOperation()
+		armNextStart(s)
+	})
+	if err != nil {
+		logger.Error("[schedule][armNextStart] Failed to create start timer for schedule '" + s.ID + "'")
+		logger.Error(err)
+		return
+	}
+
+	logger.Info("[schedule][armNextStart] Schedule '" + s.ID + "' next window opens at: " + nextStart.Format(time.RFC3339))
+}
+
+// openWindow applies the schedule's services and creates the timer that closes the window at end
+func openWindow(s Schedule, end time.Time) {
+	serviceConfig := model.ServiceConfig{
+		IDs: s.IDs,
+		Schedule: model.Schedule{
+			TimeZone: s.TimeZone,
+		},
+	}
+
+	err := adguardapi.UpdateBlockedServices(&serviceConfig)
+	recordAudit(audit.ActionUpdate, len(s.IDs), end, err)
+	if err != nil {
+		logger.Error("[schedule][openWindow] Failed to apply schedule '" + s.ID + "'")
+		logger.Error(err)
+		return
+	}
+
+	_, err = timer.NewTimerWithDeadline(TimerPrefix+s.ID+"-end", end, func(t *timer.Timer) {
+		logger.Info("[schedule][openWindow] Schedule '" + s.ID + "' window closed, resetting blocked services")
+		if resetFunc != nil {
+			resetFunc(t.GetID())
+			return
+		}
+
+		endOperation := adguardapi.WaitOperation("schedule window end")
+		defer endOperation()
+
+		err := adguardapi.ResetBlockedServices()
+		recordAudit(audit.ActionReset, len(adguardapi.BuildDefaultConfig().IDs), time.Time{}, err)
+		if err != nil {
+			logger.Error("[schedule][openWindow] Failed to reset blocked services for schedule '" + s.ID + "'")
+			logger.Error(err)
+		}
+	})
+	if err != nil {
+		logger.Error("[schedule][openWindow] Failed to create end timer for schedule '" + s.ID + "'")
+		logger.Error(err)
+		return
+	}
+
+	logger.Info("[schedule][openWindow] Applied schedule '" + s.ID + "' until: " + end.Format(time.RFC3339))
+}
+
+// recordAudit writes an audit entry for a schedule-triggered change
+func recordAudit(action string, serviceCount int, end time.Time, err error) {
+	entry := audit.Entry{
+		Action:       action,
+		ClientIP:     "schedule",
+		ServiceCount: serviceCount,
+		Outcome:      audit.OutcomeSuccess,
+	}
+	if !end.IsZero() {
+		entry.ResetDateTime = end.Format(time.RFC3339)
+	}
+	if err != nil {
+		entry.Outcome = audit.OutcomeFailure
+		entry.Error = err.Error()
+	}
+	audit.Record(entry)
+}
+
+// window returns the start and end of the window that opens on the given day
+func (s *Schedule) window(day time.Time) (time.Time, time.Time) {
+	loc := day.Location()
+	startClock, _ := parseClock(s.Start)
+	endClock, _ := parseClock(s.End)
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), startClock.Hour(), startClock.Minute(), 0, 0, loc)
+	end := time.Date(day.Year(), day.Month(), day.Day(), endClock.Hour(), endClock.Minute(), 0, 0, loc)
+	if !end.After(start) {
+		// Overnight window, closes on the following day
+		end = time.Date(day.Year(), day.Month(), day.Day()+1, endClock.Hour(), endClock.Minute(), 0, 0, loc)
+	}
+
+	return start, end
+}
+
+// opensOn reports whether the window opens on the weekday of day
+func (s *Schedule) opensOn(day time.Time) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, name := range s.Days {
+		if weekdays[strings.ToLower(name)] == day.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// nextStart returns the first window start strictly after from
+func (s *Schedule) nextStart(from time.Time) (time.Time, error) {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := from.In(loc)
+	for offset := 0; offset <= 7; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if !s.opensOn(day) {
+			continue
+		}
+		start, _ := s.window(day)
+		if start.After(from) {
+			return start, nil
+		}
+	}
+
+	return time.Time{}, errors.New("no upcoming window for schedule " + s.ID)
+}
+
+// currentWindowEnd returns the end of the window containing now, if one is open
+func (s *Schedule) currentWindowEnd(now time.Time) (time.Time, bool) {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	// An overnight window that opened yesterday may still be open
+	for offset := -1; offset <= 0; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if !s.opensOn(day) {
+			continue
+		}
+		start, end := s.window(day)
+		if !now.Before(start) && now.Before(end) {
+			return end, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// exists reports whether a schedule with the given ID is still configured
+func exists(id string) bool {
+	for _, s := range List() {
+		if s.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses an HH:MM time of day
+func parseClock(value string) (time.Time, error) {
+	return time.Parse("15:04", value)
+}
+
+// schedulesPath returns the file the schedules are persisted to
+func schedulesPath() string {
+	if path := os.Getenv("schedulesPath"); path != "" {
+		return path
+	}
+	return "schedules.json"
+}
+
+// load reads the schedules file, returning an empty list if it does not exist
+func load() ([]Schedule, error) {
+	data, err := os.ReadFile(schedulesPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Schedule{}, nil
+		}
+		return nil, err
+	}
+
+	var loaded []Schedule
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// save writes the schedules file atomically
+func save(list []Schedule) error {
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := schedulesPath()
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
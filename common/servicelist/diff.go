@@ -0,0 +1,34 @@
+package servicelist
+
+// DiffServiceIDs compares two lists of service IDs and returns the IDs that were
+// added to and removed from the old list. Both results are never nil so they
+// serialize to empty JSON arrays.
+func DiffServiceIDs(oldIDs, newIDs []string) (added []string, removed []string) {
+	oldSet := make(map[string]bool, len(oldIDs))
+	for _, id := range oldIDs {
+		oldSet[id] = true
+	}
+
+	newSet := make(map[string]bool, len(newIDs))
+	for _, id := range newIDs {
+		newSet[id] = true
+	}
+
+	added = []string{}
+	for _, id := range newIDs {
+		if !oldSet[id] {
+			added = append(added, id)
+			oldSet[id] = true
+		}
+	}
+
+	removed = []string{}
+	for _, id := range oldIDs {
+		if !newSet[id] {
+			removed = append(removed, id)
+			newSet[id] = true
+		}
+	}
+
+	return added, removed
+}
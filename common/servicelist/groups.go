@@ -0,0 +1,64 @@
+package servicelist
+
+import "github.com/welasco/adguardfilter/model"
+
+// otherGroupID collects the services whose group is unknown
+const otherGroupID = "other"
+
+// GetServiceGroups returns the service groups known to the bundled service list, in display order
+func GetServiceGroups() []model.ServiceGroup {
+	return serviceGroups
+}
+
+// GroupOf returns the bundled group of a service ID, or "" when the service isn't in the bundled list
+func GroupOf(id string) string {
+	for _, service := range blockedServices {
+		if service.ID == id {
+			return service.GroupID
+		}
+	}
+	return ""
+}
+
+// GroupServices annotates services missing a group_id with the bundled one and groups them by category.
+// Groups keep the bundled order, followed by groups only the live catalog knows and finally "other".
+// Empty groups are left out.
+func GroupServices(services []model.BlockedService) []model.ServiceCategory {
+	order := make([]string, 0, len(serviceGroups))
+	for _, group := range serviceGroups {
+		order = append(order, group.ID)
+	}
+
+	byGroup := make(map[string][]model.BlockedService)
+	for _, service := range services {
+		if service.GroupID == "" {
+			service.GroupID = GroupOf(service.ID)
+		}
+		if service.GroupID == "" {
+			service.GroupID = otherGroupID
+		}
+		if _, seen := byGroup[service.GroupID]; !seen && service.GroupID != otherGroupID && !containsID(order, service.GroupID) {
+			order = append(order, service.GroupID)
+		}
+		byGroup[service.GroupID] = append(byGroup[service.GroupID], service)
+	}
+	order = append(order, otherGroupID)
+
+	categories := make([]model.ServiceCategory, 0, len(byGroup))
+	for _, groupID := range order {
+		if grouped := byGroup[groupID]; len(grouped) > 0 {
+			categories = append(categories, model.ServiceCategory{ID: groupID, Services: grouped})
+		}
+	}
+	return categories
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []string, id string) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package timer
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// Outcomes of a completed timer
+const (
+	OutcomeExpired   = "expired"
+	OutcomeCancelled = "cancelled"
+)
+
+// HistoryEntry records a timer that expired or was cancelled
+type HistoryEntry struct {
+	ID         string            `json:"id"`
+	StartTime  time.Time         `json:"start_time"`
+	ExpireTime time.Time         `json:"expire_time"`
+	EndTime    time.Time         `json:"end_time"` // When it expired or was cancelled
+	Duration   time.Duration     `json:"duration"`
+	Outcome    string            `json:"outcome"`
+	Scope      []string          `json:"scope,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+var (
+	// Completed timers, oldest first, capped to historySize
+	history     []HistoryEntry
+	historyMu   sync.Mutex
+	historyOnce sync.Once
+)
+
+// historySize returns how many completed timers are kept, timerHistorySize (default 100)
+func historySize() int {
+	return max(config.GetInt("timerHistorySize", 100), 0)
+}
+
+// historyPath returns the file the history is persisted to, timerHistoryPath, or an empty string to keep it
+// in memory only
+func historyPath() string {
+	return os.Getenv("timerHistoryPath")
+}
+
+// loadHistory reads the persisted history once, the first time it is used. The caller must hold historyMu.
+func loadHistory() {
+	historyOnce.Do(func() {
+		path := historyPath()
+		if path == "" {
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Error("[timer][loadHistory] Failed to read the timer history file")
+				logger.Error(err)
+			}
+			return
+		}
+		var loaded []HistoryEntry
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			logger.Error("[timer][loadHistory] Failed to parse the timer history file")
+			logger.Error(err)
+			return
+		}
+		history = append(loaded, history...)
+		logger.Info("[timer][loadHistory] Loaded ", len(loaded), " completed timer(s) from: "+path)
+	})
+}
+
+// recordHistory adds a completed timer to the history, dropping the oldest entries beyond historySize
+func (t *Timer) recordHistory(outcome string) {
+	entry := HistoryEntry{
+		ID:         t.id,
+		StartTime:  t.startTime,
+		ExpireTime: t.expireTime,
+		EndTime:    time.Now(),
+		Duration:   t.duration,
+		Outcome:    outcome,
+		Scope:      t.GetScope(),
+		Metadata:   t.GetMetadata(),
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	loadHistory()
+	history = append(history, entry)
+	if size := historySize(); len(history) > size {
+		history = append([]HistoryEntry(nil), history[len(history)-size:]...)
+	}
+	saveHistory()
+}
+
+// saveHistory writes the history atomically when timerHistoryPath is set. The caller must hold historyMu.
+func saveHistory() {
+	path := historyPath()
+	if path == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err == nil {
+		tmpPath := path + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, path)
+		}
+	}
+	if err != nil {
+		logger.Error("[timer][saveHistory] Failed to persist the timer history")
+		logger.Error(err)
+	}
+}
+
+// History returns the completed timers, most recent first, optionally keeping only those with match
+func History(match func(HistoryEntry) bool) []HistoryEntry {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	loadHistory()
+	entries := make([]HistoryEntry, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		if match == nil || match(history[i]) {
+			entries = append(entries, history[i])
+		}
+	}
+	return entries
+}
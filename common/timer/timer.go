@@ -2,87 +2,252 @@ package timer
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/welasco/adguardfilter/common/config"
 	logger "github.com/welasco/adguardfilter/common/logger"
 )
 
+// ErrDeadlineTooFar is returned for a timer that would expire beyond the maximum horizon
+var ErrDeadlineTooFar = errors.New("deadline is too far in the future")
+
+// Callback is executed when a timer expires and receives the timer that fired
+type Callback func(t *Timer)
+
 // Timer represents a timer that executes a callback function when it expires
 type Timer struct {
-	id          string
-	timer       *time.Timer
-	callback    func()
-	expireTime  time.Time
-	isActive    bool
-	mu          sync.Mutex
-	stopChan    chan bool
+	id         string
+	timer      *time.Timer
+	callback   Callback
+	startTime  time.Time
+	expireTime time.Time
+	duration   time.Duration // Configured duration, what Restart starts over with
+	state      atomic.Int32
+	scope      []string
+	metadata   map[string]string
+	// Optional callback executed warningLead before the timer expires
+	warningLead     time.Duration
+	warningCallback Callback
+	mu              sync.Mutex
+	stopChan        chan struct{}
 }
 
+// Timer states. A timer only leaves stateActive once, so Stop and expiry can't both win.
+const (
+	stateActive int32 = iota
+	stateStopping
+	stateStopped
+	stateExpired
+)
+
 var (
 	// Global timer registry to manage multiple timers
 	timers   = make(map[string]*Timer)
 	timersMu sync.RWMutex
+
+	// Registered observers notified of timer state changes
+	observers      = make(map[int]Observer)
+	nextObserverID int
+	observersMu    sync.RWMutex
 )
 
-// NewTimerWithDuration creates a new timer that expires after the specified duration in minutes
-func NewTimerWithDuration(id string, minutes int, callback func()) (*Timer, error) {
-	if minutes <= 0 {
-		logger.Error("[timer][NewTimerWithDuration] Duration must be greater than 0")
-		return nil, errors.New("duration must be greater than 0 minutes")
+// Event types reported to observers
+const (
+	EventCreated   = "created"
+	EventExpired   = "expired"
+	EventCancelled = "cancelled"
+	EventWarning   = "warning"
+)
+
+// Event describes a timer state change
+type Event struct {
+	Type       string
+	TimerID    string
+	ExpireTime time.Time
+}
+
+// Observer is called on every timer state change. It runs on the timer's goroutine and must not block.
+type Observer func(Event)
+
+// TimerOption configures a timer created with NewTimer
+type TimerOption func(*timerConfig)
+
+// timerConfig collects the options passed to NewTimer
+type timerConfig struct {
+	duration    time.Duration
+	hasDuration bool
+	deadline    time.Time
+	hasDeadline bool
+	callback    Callback
+	scope       []string
+	metadata    map[string]string
+	warningLead time.Duration
+	warning     Callback
+}
+
+// WithDuration makes the timer expire after the given duration
+func WithDuration(duration time.Duration) TimerOption {
+	return func(cfg *timerConfig) {
+		cfg.duration = duration
+		cfg.hasDuration = true
 	}
+}
 
-	if callback == nil {
-		logger.Error("[timer][NewTimerWithDuration] Callback function cannot be nil")
-		return nil, errors.New("callback function cannot be nil")
+// WithDeadline makes the timer expire at the given date and time
+func WithDeadline(deadline time.Time) TimerOption {
+	return func(cfg *timerConfig) {
+		cfg.deadline = deadline
+		cfg.hasDeadline = true
 	}
+}
 
-	duration := time.Duration(minutes) * time.Minute
-	expireTime := time.Now().Add(duration)
+// WithCallback sets the function executed when the timer expires
+func WithCallback(callback Callback) TimerOption {
+	return func(cfg *timerConfig) {
+		cfg.callback = callback
+	}
+}
 
-	logger.Info("[timer][NewTimerWithDuration] Creating timer '" + id + "' for " + string(rune(minutes)) + " minutes")
-	logger.Debug("[timer][NewTimerWithDuration] Timer will expire at: " + expireTime.Format(time.RFC3339))
+// WithScope sets the service IDs the timer's callback resets, see SetScope
+func WithScope(ids []string) TimerOption {
+	return func(cfg *timerConfig) {
+		cfg.scope = ids
+	}
+}
 
-	return createTimer(id, duration, expireTime, callback)
+// WithMetadata attaches descriptive key/value pairs to the timer, see SetMetadata
+func WithMetadata(metadata map[string]string) TimerOption {
+	return func(cfg *timerConfig) {
+		cfg.metadata = copyMetadata(metadata)
+	}
 }
 
-// NewTimerWithDeadline creates a new timer that expires at the specified date and time
-func NewTimerWithDeadline(id string, deadline time.Time, callback func()) (*Timer, error) {
-	if deadline.Before(time.Now()) {
-		logger.Error("[timer][NewTimerWithDeadline] Deadline must be in the future")
-		return nil, errors.New("deadline must be in the future")
+// WithWarning executes callback the given lead time before the timer expires, e.g. for a
+// "5 minutes left" notice. The warning is skipped when the timer is shorter than the lead time.
+func WithWarning(lead time.Duration, callback Callback) TimerOption {
+	return func(cfg *timerConfig) {
+		cfg.warningLead = lead
+		cfg.warning = callback
+	}
+}
+
+// NewTimer creates and starts a timer configured by opts. Exactly one of WithDuration and WithDeadline
+// is required, as is WithCallback.
+func NewTimer(id string, opts ...TimerOption) (*Timer, error) {
+	var cfg timerConfig
+	for _, opt := range opts {
+		opt(&cfg)
 	}
 
-	if callback == nil {
-		logger.Error("[timer][NewTimerWithDeadline] Callback function cannot be nil")
+	if cfg.hasDuration == cfg.hasDeadline {
+		logger.Error("[timer][NewTimer] Exactly one of a duration or a deadline is required for timer '" + id + "'")
+		return nil, errors.New("exactly one of a duration or a deadline is required")
+	}
+
+	if cfg.callback == nil {
+		logger.Error("[timer][NewTimer] Callback function cannot be nil")
 		return nil, errors.New("callback function cannot be nil")
 	}
 
-	duration := time.Until(deadline)
+	duration, expireTime := cfg.duration, cfg.deadline
+	if cfg.hasDuration {
+		if duration <= 0 {
+			logger.Error("[timer][NewTimer] Duration must be greater than 0")
+			return nil, errors.New("duration must be greater than 0")
+		}
+		expireTime = time.Now().Add(duration)
+		logger.Info("[timer][NewTimer] Creating timer '" + id + "' for " + duration.String())
+	} else {
+		if expireTime.Before(time.Now()) {
+			logger.Error("[timer][NewTimer] Deadline must be in the future")
+			return nil, errors.New("deadline must be in the future")
+		}
+		duration = time.Until(expireTime)
+		logger.Info("[timer][NewTimer] Creating timer '" + id + "' with deadline: " + expireTime.Format(time.RFC3339))
+	}
+	if err := CheckDeadline(expireTime); err != nil {
+		logger.Error("[timer][NewTimer] Rejected timer '" + id + "'")
+		logger.Error(err)
+		return nil, err
+	}
+	logger.Debug("[timer][NewTimer] Timer will expire at: " + expireTime.Format(time.RFC3339))
+
+	return createTimer(id, duration, expireTime, &cfg)
+}
+
+// MaxHorizon returns how far ahead a timer may expire, from maxTimerHorizonHours (default 0, no limit)
+func MaxHorizon() time.Duration {
+	hours := config.GetInt("maxTimerHorizonHours", 0)
+	if hours <= 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// CheckDeadline returns ErrDeadlineTooFar, with the allowed maximum, when deadline is beyond MaxHorizon or
+// so far away that the duration until it overflows time.Duration
+func CheckDeadline(deadline time.Time) error {
+	// time.Until saturates at the largest Duration instead of overflowing
+	if time.Until(deadline) == time.Duration(math.MaxInt64) {
+		return fmt.Errorf("%w: %s is beyond the largest supported duration", ErrDeadlineTooFar, deadline.Format(time.RFC3339))
+	}
+
+	if horizon := MaxHorizon(); horizon > 0 && time.Until(deadline) > horizon {
+		return fmt.Errorf("%w: the maximum is %d hours ahead (latest %s)", ErrDeadlineTooFar,
+			int64(horizon.Hours()), time.Now().Add(horizon).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// NewTimerWithDuration creates a new timer that expires after the specified duration in minutes
+func NewTimerWithDuration(id string, minutes int, callback Callback) (*Timer, error) {
+	if minutes <= 0 {
+		logger.Error("[timer][NewTimerWithDuration] Duration must be greater than 0")
+		return nil, errors.New("duration must be greater than 0 minutes")
+	}
+	logger.Info("[timer][NewTimerWithDuration] Creating timer '" + id + "' for " + strconv.Itoa(minutes) + " minute(s)")
 
-	logger.Info("[timer][NewTimerWithDeadline] Creating timer '" + id + "' with deadline: " + deadline.Format(time.RFC3339))
-	logger.Debug("[timer][NewTimerWithDeadline] Duration until deadline: " + duration.String())
+	return NewTimer(id, WithDuration(time.Duration(minutes)*time.Minute), WithCallback(callback))
+}
 
-	return createTimer(id, duration, deadline, callback)
+// NewTimerWithRawDuration creates a new timer that expires after the specified duration
+func NewTimerWithRawDuration(id string, duration time.Duration, callback Callback) (*Timer, error) {
+	return NewTimer(id, WithDuration(duration), WithCallback(callback))
+}
+
+// NewTimerWithDeadline creates a new timer that expires at the specified date and time
+func NewTimerWithDeadline(id string, deadline time.Time, callback Callback) (*Timer, error) {
+	return NewTimer(id, WithDeadline(deadline), WithCallback(callback))
 }
 
 // createTimer is an internal function to create and start a timer
-func createTimer(id string, duration time.Duration, expireTime time.Time, callback func()) (*Timer, error) {
-	// Check if a timer with this ID already exists
+func createTimer(id string, duration time.Duration, expireTime time.Time, cfg *timerConfig) (*Timer, error) {
+	// Check if a timer with this ID already exists. The lock is held across the stop so no other
+	// timer can be registered with the same ID in between; Stop never takes timersMu.
 	timersMu.Lock()
 	if existingTimer, exists := timers[id]; exists {
-		timersMu.Unlock()
 		logger.Warning("[timer][createTimer] Timer '" + id + "' already exists. Stopping existing timer.")
 		existingTimer.Stop()
-		timersMu.Lock()
 	}
 
 	t := &Timer{
 		id:         id,
-		callback:   callback,
+		callback:   cfg.callback,
+		startTime:  time.Now(),
 		expireTime: expireTime,
-		isActive:   true,
-		stopChan:   make(chan bool, 1),
+		duration:   duration,
+		scope:      cfg.scope,
+		metadata:   cfg.metadata,
+		stopChan:   make(chan struct{}),
+
+		warningLead:     cfg.warningLead,
+		warningCallback: cfg.warning,
 	}
 
 	// Register the timer
@@ -93,83 +258,128 @@ func createTimer(id string, duration time.Duration, expireTime time.Time, callba
 	go t.run(duration)
 
 	logger.Info("[timer][createTimer] Timer '" + id + "' started successfully")
+	notifyObservers(Event{Type: EventCreated, TimerID: id, ExpireTime: expireTime})
 
 	return t, nil
 }
 
-// run executes the timer and waits for expiration or cancellation
+// run executes the timer and waits for expiration or cancellation, firing the warning on the way
 func (t *Timer) run(duration time.Duration) {
 	t.timer = time.NewTimer(duration)
 
-	select {
-	case <-t.timer.C:
-		// Timer expired - execute callback
-		t.mu.Lock()
-		t.isActive = false
-		t.mu.Unlock()
-
-		logger.Info("[timer][run] Timer '" + t.id + "' expired. Executing callback...")
-
-		// Execute the callback function
-		if t.callback != nil {
-			defer func() {
-				if r := recover(); r != nil {
-					logger.Error("[timer][run] Callback function panicked for timer '" + t.id + "'")
-					logger.Error(r)
-				}
-			}()
-
-			t.callback()
-			logger.Info("[timer][run] Callback executed successfully for timer '" + t.id + "'")
-		}
+	// Schedule the pre-expiry warning, skipped when the timer is shorter than the lead time
+	var warningC <-chan time.Time
+	if t.warningCallback != nil && t.warningLead > 0 && duration > t.warningLead {
+		warning := time.NewTimer(duration - t.warningLead)
+		defer warning.Stop()
+		warningC = warning.C
+	}
 
-		// Remove from registry
-		timersMu.Lock()
-		delete(timers, t.id)
-		timersMu.Unlock()
+	for {
+		select {
+		case <-warningC:
+			// Only warn once, and not for a timer being stopped
+			warningC = nil
+			if t.IsActive() {
+				t.runWarning()
+			}
+
+		case <-t.timer.C:
+			// Timer expired, unless Stop got there first and the stop case below is about to run
+			if !t.state.CompareAndSwap(stateActive, stateExpired) {
+				continue
+			}
+
+			logger.Info("[timer][run] Timer '" + t.id + "' expired. Executing callback...")
+			t.runCallback()
+
+			// Remove from registry
+			t.unregister()
+			t.recordHistory(OutcomeExpired)
+
+			notifyObservers(Event{Type: EventExpired, TimerID: t.id, ExpireTime: t.expireTime})
+			return
+
+		case <-t.stopChan:
+			// Timer was stopped manually
+			t.state.Store(stateStopped)
+			t.timer.Stop()
 
-	case <-t.stopChan:
-		// Timer was stopped manually
-		t.mu.Lock()
-		t.isActive = false
-		t.mu.Unlock()
+			logger.Info("[timer][run] Timer '" + t.id + "' stopped manually")
 
-		if t.timer != nil {
-			t.timer.Stop()
+			// Remove from registry
+			t.unregister()
+			t.recordHistory(OutcomeCancelled)
+
+			notifyObservers(Event{Type: EventCancelled, TimerID: t.id, ExpireTime: t.expireTime})
+			return
 		}
+	}
+}
+
+// runCallback executes the expiry callback, recovering a panic so the timer is still unregistered
+func (t *Timer) runCallback() {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("[timer][runCallback] Callback function panicked for timer '" + t.id + "'")
+			logger.Error(r)
+		}
+	}()
 
-		logger.Info("[timer][run] Timer '" + t.id + "' stopped manually")
+	t.callback(t)
+	logger.Info("[timer][runCallback] Callback executed successfully for timer '" + t.id + "'")
+}
 
-		// Remove from registry
-		timersMu.Lock()
+// unregister removes the timer from the registry, unless it was already replaced by a new timer with the same ID
+func (t *Timer) unregister() {
+	timersMu.Lock()
+	defer timersMu.Unlock()
+	if timers[t.id] == t {
 		delete(timers, t.id)
-		timersMu.Unlock()
 	}
 }
 
-// Stop cancels the timer before it expires
-func (t *Timer) Stop() {
-	t.mu.Lock()
-	defer t.mu.Unlock()
+// runWarning executes the warning callback and notifies observers that the timer is about to expire
+func (t *Timer) runWarning() {
+	logger.Info("[timer][runWarning] Timer '" + t.id + "' expires in " + t.warningLead.String() + ". Executing warning callback...")
+	notifyObservers(Event{Type: EventWarning, TimerID: t.id, ExpireTime: t.expireTime})
 
-	if !t.isActive {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("[timer][runWarning] Warning callback panicked for timer '" + t.id + "'")
+			logger.Error(r)
+		}
+	}()
+	t.warningCallback(t)
+}
+
+// Stop cancels the timer before it expires. It is idempotent and never blocks: stopping a timer
+// that already expired or was stopped does nothing.
+func (t *Timer) Stop() {
+	if !t.state.CompareAndSwap(stateActive, stateStopping) {
 		logger.Debug("[timer][Stop] Timer '" + t.id + "' is already inactive")
 		return
 	}
 
 	logger.Info("[timer][Stop] Stopping timer '" + t.id + "'")
 
-	select {
-	case t.stopChan <- true:
-	default:
-	}
+	// Only the CompareAndSwap winner gets here, so the channel is closed once
+	close(t.stopChan)
 }
 
 // IsActive returns whether the timer is currently active
 func (t *Timer) IsActive() bool {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	return t.isActive
+	return t.state.Load() == stateActive
+}
+
+// GetStartTime returns the time when the timer was created
+func (t *Timer) GetStartTime() time.Time {
+	return t.startTime
+}
+
+// GetDuration returns the duration the timer was created with, from its start to its expiry
+func (t *Timer) GetDuration() time.Duration {
+	return t.duration
 }
 
 // GetExpireTime returns the time when the timer will expire
@@ -177,6 +387,46 @@ func (t *Timer) GetExpireTime() time.Time {
 	return t.expireTime
 }
 
+// SetScope sets the service IDs the timer's callback resets, nil meaning the whole configuration
+func (t *Timer) SetScope(ids []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scope = ids
+}
+
+// GetScope returns the service IDs the timer's callback resets, nil meaning the whole configuration
+func (t *Timer) GetScope() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.scope
+}
+
+// SetMetadata attaches descriptive key/value pairs to the timer, e.g. who requested it
+func (t *Timer) SetMetadata(metadata map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.metadata = copyMetadata(metadata)
+}
+
+// GetMetadata returns a copy of the timer's metadata, nil when none is attached
+func (t *Timer) GetMetadata() map[string]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return copyMetadata(t.metadata)
+}
+
+// copyMetadata returns a copy of metadata so callers can't modify a timer's map
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
+
 // GetID returns the timer's ID
 func (t *Timer) GetID() string {
 	return t.id
@@ -190,6 +440,29 @@ func GetTimer(id string) (*Timer, bool) {
 	return timer, exists
 }
 
+// Restart starts an active timer over from now with the duration it was created with, keeping its
+// callback, scope, metadata and warning, and returns the new timer. The old timer is stopped.
+func Restart(id string) (*Timer, error) {
+	timersMu.RLock()
+	existing, exists := timers[id]
+	timersMu.RUnlock()
+
+	if !exists || !existing.IsActive() {
+		logger.Warning("[timer][Restart] Timer '" + id + "' not found")
+		return nil, errors.New("timer not found: " + id)
+	}
+
+	cfg := &timerConfig{
+		callback:    existing.callback,
+		scope:       existing.GetScope(),
+		metadata:    existing.GetMetadata(),
+		warningLead: existing.warningLead,
+		warning:     existing.warningCallback,
+	}
+	logger.Info("[timer][Restart] Restarting timer '" + id + "' with its duration of " + existing.duration.String())
+	return createTimer(id, existing.duration, time.Now().Add(existing.duration), cfg)
+}
+
 // StopTimer stops a timer by ID
 func StopTimer(id string) error {
 	timersMu.RLock()
@@ -235,3 +508,64 @@ func StopAllTimers() {
 		timer.Stop()
 	}
 }
+
+// GetActiveTimersWithPrefix returns the IDs of all active timers whose ID starts with prefix
+func GetActiveTimersWithPrefix(prefix string) []string {
+	activeTimers := make([]string, 0)
+	for _, id := range GetAllActiveTimers() {
+		if strings.HasPrefix(id, prefix) {
+			activeTimers = append(activeTimers, id)
+		}
+	}
+
+	return activeTimers
+}
+
+// StopTimersWithPrefix stops all timers whose ID starts with prefix
+func StopTimersWithPrefix(prefix string) {
+	timersMu.RLock()
+	timerList := make([]*Timer, 0, len(timers))
+	for id, timer := range timers {
+		if strings.HasPrefix(id, prefix) {
+			timerList = append(timerList, timer)
+		}
+	}
+	timersMu.RUnlock()
+
+	logger.Info("[timer][StopTimersWithPrefix] Stopping timers with prefix '" + prefix + "'")
+
+	for _, timer := range timerList {
+		timer.Stop()
+	}
+}
+
+// AddObserver registers an observer for timer state changes and returns an ID for RemoveObserver
+func AddObserver(observer Observer) int {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+
+	nextObserverID++
+	observers[nextObserverID] = observer
+	logger.Debug("[timer][AddObserver] Registered observer ", nextObserverID)
+
+	return nextObserverID
+}
+
+// RemoveObserver unregisters an observer previously added with AddObserver
+func RemoveObserver(id int) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+
+	delete(observers, id)
+	logger.Debug("[timer][RemoveObserver] Removed observer ", id)
+}
+
+// notifyObservers calls every registered observer with the event
+func notifyObservers(event Event) {
+	observersMu.RLock()
+	defer observersMu.RUnlock()
+
+	for _, observer := range observers {
+		observer(event)
+	}
+}
@@ -0,0 +1,286 @@
+package timer
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// logPath is the file the tests log to, read back by the tests of log lines
+var logPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "timer-test")
+	if err != nil {
+		panic(err)
+	}
+	logPath = filepath.Join(dir, "test.log")
+	logger.Init(logPath, "Inf")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// noop is a callback for timers whose expiry doesn't matter to the test
+func noop(*Timer) {}
+
+// stopOnCleanup stops the timer with the given ID when the test ends
+func stopOnCleanup(t *testing.T, id string) {
+	t.Helper()
+	t.Cleanup(func() { StopTimer(id) })
+}
+
+func TestNewTimerWithDurationLogsMinutes(t *testing.T) {
+	stopOnCleanup(t, "log-minutes")
+	if _, err := NewTimerWithDuration("log-minutes", 30, noop); err != nil {
+		t.Fatalf("NewTimerWithDuration: %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if want := "Creating timer 'log-minutes' for 30 minute(s)"; !strings.Contains(string(data), want) {
+		t.Errorf("log doesn't contain %q:\n%s", want, data)
+	}
+}
+
+func TestNewTimerWithDurationRejectsZeroMinutes(t *testing.T) {
+	if _, err := NewTimerWithDuration("zero-minutes", 0, noop); err == nil {
+		t.Error("NewTimerWithDuration accepted 0 minutes")
+	}
+	if _, exists := GetTimer("zero-minutes"); exists {
+		t.Error("a rejected timer was registered")
+	}
+}
+
+func TestNewTimerOptions(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	callback := WithCallback(noop)
+
+	tests := []struct {
+		name       string
+		opts       []TimerOption
+		wantErr    string
+		wantExpire time.Time
+	}{
+		{name: "duration", opts: []TimerOption{WithDuration(time.Hour), callback}, wantExpire: deadline},
+		{name: "deadline", opts: []TimerOption{WithDeadline(deadline), callback}, wantExpire: deadline},
+		{name: "all options", opts: []TimerOption{
+			WithDuration(time.Hour), callback,
+			WithScope([]string{"youtube"}),
+			WithMetadata(map[string]string{"reason": "homework"}),
+			WithWarning(5*time.Minute, noop),
+		}, wantExpire: deadline},
+		{name: "duration and deadline", opts: []TimerOption{WithDuration(time.Hour), WithDeadline(deadline), callback}, wantErr: "exactly one of a duration or a deadline"},
+		{name: "neither duration nor deadline", opts: []TimerOption{callback}, wantErr: "exactly one of a duration or a deadline"},
+		{name: "no callback", opts: []TimerOption{WithDuration(time.Hour)}, wantErr: "callback function cannot be nil"},
+		{name: "zero duration", opts: []TimerOption{WithDuration(0), callback}, wantErr: "duration must be greater than 0"},
+		{name: "past deadline", opts: []TimerOption{WithDeadline(time.Now().Add(-time.Minute)), callback}, wantErr: "deadline must be in the future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "options-" + strings.ReplaceAll(tt.name, " ", "-")
+			stopOnCleanup(t, id)
+
+			timer, err := NewTimer(id, tt.opts...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				if _, exists := GetTimer(id); exists {
+					t.Error("a rejected timer was registered")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewTimer: %v", err)
+			}
+			if !timer.IsActive() {
+				t.Error("the timer isn't active")
+			}
+			if diff := timer.GetExpireTime().Sub(tt.wantExpire).Abs(); diff > time.Second {
+				t.Errorf("got expiry %v, want %v", timer.GetExpireTime(), tt.wantExpire)
+			}
+		})
+	}
+}
+
+func TestNewTimerKeepsScopeAndMetadata(t *testing.T) {
+	stopOnCleanup(t, "options-scope")
+	metadata := map[string]string{"reason": "homework"}
+
+	timer, err := NewTimer("options-scope",
+		WithDuration(time.Hour),
+		WithCallback(noop),
+		WithScope([]string{"youtube", "tiktok"}),
+		WithMetadata(metadata),
+	)
+	if err != nil {
+		t.Fatalf("NewTimer: %v", err)
+	}
+	metadata["reason"] = "changed"
+
+	if got := timer.GetScope(); len(got) != 2 || got[0] != "youtube" || got[1] != "tiktok" {
+		t.Errorf("got scope %v, want [youtube tiktok]", got)
+	}
+	if got := timer.GetMetadata(); got["reason"] != "homework" {
+		t.Errorf("got metadata %v, want a copy of the option's", got)
+	}
+}
+
+func TestNewTimerWarning(t *testing.T) {
+	stopOnCleanup(t, "options-warning")
+	warned := make(chan struct{})
+	expired := make(chan struct{})
+
+	_, err := NewTimer("options-warning",
+		WithDuration(100*time.Millisecond),
+		WithCallback(func(*Timer) { close(expired) }),
+		WithWarning(80*time.Millisecond, func(*Timer) { close(warned) }),
+	)
+	if err != nil {
+		t.Fatalf("NewTimer: %v", err)
+	}
+
+	for _, step := range []struct {
+		name string
+		done chan struct{}
+	}{{"warning", warned}, {"expiry", expired}} {
+		select {
+		case <-step.done:
+		case <-time.After(time.Second):
+			t.Fatalf("the %s callback didn't run", step.name)
+		}
+	}
+}
+
+func TestConcurrentTimersWithSameID(t *testing.T) {
+	const id = "race-same-id"
+	stopOnCleanup(t, id)
+
+	const creators = 50
+	created := make([]*Timer, creators)
+	var wg sync.WaitGroup
+	for i := range creators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timer, err := NewTimer(id, WithDuration(time.Hour), WithCallback(noop))
+			if err != nil {
+				t.Errorf("NewTimer: %v", err)
+				return
+			}
+			created[i] = timer
+		}()
+	}
+	wg.Wait()
+
+	registered, exists := GetTimer(id)
+	if !exists {
+		t.Fatal("no timer is registered with the ID")
+	}
+	active := 0
+	for _, timer := range created {
+		if timer != nil && timer.IsActive() {
+			active++
+			if timer != registered {
+				t.Error("an active timer isn't the registered one")
+			}
+		}
+	}
+	if active != 1 {
+		t.Errorf("got %d active timers with the ID, want 1", active)
+	}
+
+	count := 0
+	for _, activeID := range GetAllActiveTimers() {
+		if activeID == id {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("GetAllActiveTimers lists the ID %d times, want once", count)
+	}
+}
+
+func TestStopRacingExpiry(t *testing.T) {
+	const prefix = "race-expiry-"
+	const count = 200
+
+	var fired [count]atomic.Int32
+	created := make([]*Timer, count)
+	for i := range count {
+		timer, err := NewTimer(prefix+strconv.Itoa(i),
+			WithDuration(time.Duration(1+i%3)*time.Millisecond),
+			WithCallback(func(*Timer) { fired[i].Add(1) }),
+		)
+		if err != nil {
+			t.Fatalf("NewTimer: %v", err)
+		}
+		created[i] = timer
+	}
+
+	// Stop each timer around its expiry, twice, as an HTTP handler and the shutdown could
+	var wg sync.WaitGroup
+	for i, timer := range created {
+		wg.Add(2)
+		for range 2 {
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Duration(i%4) * time.Millisecond)
+				timer.Stop()
+			}()
+		}
+	}
+	StopTimersWithPrefix(prefix)
+	wg.Wait()
+
+	for i := range fired {
+		if got := fired[i].Load(); got > 1 {
+			t.Errorf("the callback of timer %d ran %d times, want at most once", i, got)
+		}
+	}
+	for i, timer := range created {
+		if timer.IsActive() {
+			t.Errorf("timer %d is still active", i)
+		}
+	}
+	if !waitUntil(func() bool { return len(registeredWithPrefix(prefix)) == 0 }) {
+		t.Errorf("timers %v are still registered", registeredWithPrefix(prefix))
+	}
+}
+
+// registeredWithPrefix returns the IDs in the registry starting with prefix, active or not
+func registeredWithPrefix(prefix string) []string {
+	timersMu.RLock()
+	defer timersMu.RUnlock()
+
+	var ids []string
+	for id := range timers {
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// waitUntil polls condition until it holds or a second passed, reporting whether it held
+func waitUntil(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return condition()
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the instrumentation the spans are recorded by
+const tracerName = "github.com/welasco/adguardfilter"
+
+// enabled is set by Init once an exporter is configured, until then every span is a no-op
+var enabled bool
+
+// Init sends traces to the OTLP/HTTP collector at otelExporterEndpoint, e.g. http://otel-collector:4318, posting
+// to /v1/traces unless the URL has a path of its own.
+// Tracing stays a no-op when it is unset. The returned function flushes the spans left on shutdown.
+func Init() func(context.Context) error {
+	endpoint := os.Getenv("otelExporterEndpoint")
+	if endpoint == "" {
+		logger.Debug("[tracing][Init] otelExporterEndpoint not set, tracing disabled")
+		return func(context.Context) error { return nil }
+	}
+
+	// A bare collector address gets the standard traces path, like OTEL_EXPORTER_OTLP_ENDPOINT
+	exporterURL := endpoint
+	if parsed, err := url.Parse(endpoint); err == nil && strings.Trim(parsed.Path, "/") == "" {
+		exporterURL = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(exporterURL))
+	if err != nil {
+		logger.Error("[tracing][Init] Failed to create the OTLP exporter for: " + endpoint + ", tracing disabled")
+		logger.Error(err)
+		return func(context.Context) error { return nil }
+	}
+
+	serviceName := os.Getenv("otelServiceName")
+	if serviceName == "" {
+		serviceName = "adguardfilter"
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(version.Version()),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	enabled = true
+
+	logger.Info("[tracing][Init] Sending traces as " + serviceName + " to: " + exporterURL)
+	return provider.Shutdown
+}
+
+// Enabled reports whether spans are exported
+func Enabled() bool {
+	return enabled
+}
+
+// Start starts a span as a child of the one in ctx, or a new trace without one
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// StartServer starts the span of an incoming request, continuing the caller's trace from its traceparent header
+func StartServer(ctx context.Context, name string, header http.Header, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+}
+
+// StartClient starts the span of an outgoing request and adds the traceparent header, so AdGuard or a proxy in
+// front of it can join the trace
+func StartClient(ctx context.Context, name string, header http.Header, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	return ctx, span
+}
@@ -0,0 +1,36 @@
+package version
+
+import "runtime"
+
+// Build information, set at build time with
+// -ldflags "-X github.com/welasco/adguardfilter/common/version.version=v1.2.3 ..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// Version returns the release version of the build, dev when built without ldflags
+func Version() string {
+	return version
+}
+
+// Commit returns the git commit the build was made from
+func Commit() string {
+	return commit
+}
+
+// BuildDate returns when the build was made
+func BuildDate() string {
+	return buildDate
+}
+
+// GoVersion returns the Go version the build was compiled with
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// String formats the build information for the logs, e.g. "v1.2.3 (commit abc1234, built 2024-01-02, go1.25.0)"
+func String() string {
+	return version + " (commit " + commit + ", built " + buildDate + ", " + runtime.Version() + ")"
+}
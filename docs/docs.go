@@ -0,0 +1,14 @@
+// Package docs holds the OpenAPI (Swagger 2.0) description of the API. swagger.json is generated from
+// the swag annotations on the handlers and the model structs: regenerate it with
+//
+//	swag init -g main.go -o docs --outputTypes json
+//
+// after changing a route or a request/response model.
+package docs
+
+import _ "embed"
+
+// SwaggerJSON is the generated OpenAPI spec served at /swagger/doc.json
+//
+//go:embed swagger.json
+var SwaggerJSON []byte
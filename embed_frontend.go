@@ -0,0 +1,24 @@
+//go:build embedfrontend
+
+package main
+
+import (
+	"embed"
+	"io/fs"
+
+	"github.com/welasco/adguardfilter/transport"
+)
+
+// frontendFiles is the built frontend, compiled in with: go build -tags embedfrontend
+// (run npm run build in frontend-adguardfilter first)
+//
+//go:embed all:frontend-adguardfilter/dist
+var frontendFiles embed.FS
+
+func init() {
+	dist, err := fs.Sub(frontendFiles, "frontend-adguardfilter/dist")
+	if err != nil {
+		panic(err)
+	}
+	transport.SetEmbeddedFrontend(dist)
+}
@@ -50,8 +50,8 @@ function App() {
         setLoading(true)
 
         // Fetch the list of all services
-        console.log('Deu Certo Fetching services from ' + apiURL + '/api/v1/getservicelist')
-        const servicesResponse = await fetch(apiURL + '/api/v1/getservicelist', {
+        console.log('Deu Certo Fetching services from ' + apiURL + '/api/v1/getservicelist?flat=true')
+        const servicesResponse = await fetch(apiURL + '/api/v1/getservicelist?flat=true', {
           method: 'GET',
           headers: {
             'Content-Type': 'application/json',
@@ -231,7 +231,7 @@ function App() {
           return
         }
 
-        // Format the datetime to ISO string format (YYYY-MM-DDTHH:mm:ss)
+        // Format the datetime to a full ISO string with the UTC offset (YYYY-MM-DDTHH:mm:ss.sssZ)
         const datetime = new Date(resetDateTime)
         if (isNaN(datetime.getTime())) {
           setSaveMessage('❌ Invalid date/time format')
@@ -239,7 +239,7 @@ function App() {
           return
         }
 
-        const formattedDateTime = datetime.toISOString().slice(0, 19)
+        const formattedDateTime = datetime.toISOString()
 
         endpoint = apiURL + '/api/v1/updateblockedservicesdatetime'
         payload = {
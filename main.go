@@ -2,15 +2,30 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
 	"syscall"
 	"time"
 
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/gofiber/fiber/v2"
 	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/api"
+	"github.com/welasco/adguardfilter/common/config"
+	"github.com/welasco/adguardfilter/common/events"
 	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/mqtt"
+	"github.com/welasco/adguardfilter/common/profile"
+	"github.com/welasco/adguardfilter/common/schedule"
+	"github.com/welasco/adguardfilter/common/servicelist"
 	"github.com/welasco/adguardfilter/common/timer"
+	"github.com/welasco/adguardfilter/common/tracing"
+	"github.com/welasco/adguardfilter/common/version"
+	"github.com/welasco/adguardfilter/model"
 	"github.com/welasco/adguardfilter/transport"
 )
 
@@ -19,24 +34,88 @@ func init() {
 	logger.Init(file, os.Getenv("logLevel"))
 }
 
+// @title AdGuard Filter API
+// @version 1.0
+// @description Blocks and unblocks AdGuard Home services with scheduled automatic resets.
+// @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Required on /api/v1 routes when apiKey is set. Authorization: Bearer is accepted as well.
 func main() {
-	logger.Info("[main][main] Starting AdguardFilter")
-	app := transport.Setup()
+	logger.Info("[main][main] Starting AdguardFilter " + version.String())
+
+	// Export traces when an OpenTelemetry collector is configured, before the routes get their middleware
+	shutdownTracing := tracing.Init()
+
+	// Log the effective configuration so a misread .env is obvious from the first lines
+	if effectiveConfig, err := json.Marshal(api.EffectiveConfig()); err == nil {
+		logger.Info("[main][main] Effective configuration: " + string(effectiveConfig))
+	}
+
+	// Authenticate eagerly so credential problems show up at startup and the first request has a session
+	if err := adguardapi.AuthenticateWithStoredCredentials(); errors.Is(err, adguardapi.ErrNoCredentials) {
+		logger.Info("[main][main] No AdGuard credentials configured, skipping startup authentication")
+	} else if err != nil {
+		logger.Error("[main][main] Startup authentication against AdGuard failed")
+		logger.Error(err)
+		if config.GetBool("failFastOnAuth", false) {
+			logger.Error("[main][main] failFastOnAuth is set, exiting")
+			os.Exit(1)
+		}
+		logger.Warning("[main][main] Continuing, authentication will be retried on the first request")
+	} else {
+		logger.Info("[main][main] Startup authentication against AdGuard succeeded")
+	}
+	app := transport.Setup(adguardapi.DefaultClient())
+
+	// Retry a reset that couldn't reach AdGuard before the last shutdown
+	api.ResumePendingReset()
+
+	// Re-arm the reset timers saved by a shutdown with resetOnShutdown disabled
+	api.ResumeResetTimers()
+
+	// Enforce the default configuration right away on a fresh AdGuard install, when enabled
+	api.ApplyDefaultOnStartup()
+
+	// Publish the timer and blocked services state to MQTT when a broker is configured
+	mqtt.Start(api.ResetTimerPrefix)
+
+	// Watch for blocked services being changed directly in AdGuard
+	adguardapi.StartDriftMonitor()
+
+	// Load and arm the recurring unblock schedules, resetting through the api's retries when a window closes
+	schedule.SetResetFunc(api.ResetAfterWindow)
+	if err := schedule.Init(); err != nil {
+		logger.Error("[main][main] Failed to initialize schedules, continuing without them")
+	}
+
+	// Load the household member profiles and re-arm their unblock windows
+	if err := profile.Init(); err != nil {
+		logger.Error("[main][main] Failed to initialize profiles, continuing without them")
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
 	}
 
-	logger.Info("[main][main] Starting server on port " + port)
-
 	// Create a channel to listen for interrupt signals
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
 
+	// Reload the settings on SIGHUP instead of restarting, which would trigger the reset on shutdown
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloadConfig()
+		}
+	}()
+
 	// Start server in a goroutine
 	go func() {
-		if err := app.Listen(":" + port); err != nil {
+		if err := listen(app, os.Getenv("bindAddress"), port); err != nil {
 			logger.Error("[main][main] Server error: " + err.Error())
 		}
 	}()
@@ -48,37 +127,169 @@ func main() {
 	logger.Info("[main][main] Received shutdown signal: " + sig.String())
 	logger.Info("[main][main] Initiating graceful shutdown...")
 
-	// Stop all active timers
-	activeTimers := timer.GetAllActiveTimers()
-	if len(activeTimers) > 0 {
-		logger.Info("[main][main] Stopping ", len(activeTimers), " active timer(s)")
-		timer.StopAllTimers()
-		logger.Info("[main][main] All timers stopped")
+	// The reset and the HTTP server drain share one budget, so the whole shutdown finishes before the
+	// orchestrator's kill timeout (e.g. the Kubernetes termination grace period)
+	shutdownTimeout := time.Duration(config.GetInt("shutdownTimeoutSec", 10)) * time.Second
+	shutdownStart := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	logger.Info("[main][main] Shutdown budget: " + shutdownTimeout.String())
 
-		// Reset blocked services to default
-		err := adguardapi.ResetBlockedServices()
-		if err != nil {
+	// Stop all active timers, resetting if a reset timer or schedule window was pending
+	activeTimers := timer.GetActiveTimersWithPrefix(api.ResetTimerPrefix)
+	windowOpen := schedule.InWindow()
+	_, resetPending := api.GetPendingReset()
+	restoreConfig, restore := api.RestoreConfig()
+	resetOnShutdown := config.GetBool("resetOnShutdown", true)
+	savedTimers := 0
+	if len(activeTimers) > 0 && !resetOnShutdown {
+		// Save the reset timers before they are stopped, so they resume at the next start
+		savedTimers = api.SaveResetTimers()
+	}
+	timer.StopAllTimers()
+	if (len(activeTimers) > 0 || windowOpen || resetPending) && !resetOnShutdown {
+		// Leave AdGuard as it is, e.g. so a deploy doesn't end an unblock window early
+		logger.Warning("[main][main] resetOnShutdown is disabled, leaving blocked services unchanged with ", len(activeTimers), " pending reset timer(s), schedule window open: ", windowOpen, ", reset pending: ", resetPending)
+		logger.Warning("[main][main] ", savedTimers, " of ", len(activeTimers), " reset timer(s) saved to resume at the next start")
+	} else if len(activeTimers) > 0 || windowOpen || resetPending {
+		logger.Info("[main][main] Stopped ", len(activeTimers), " active reset timer(s), schedule window open: ", windowOpen, ", reset pending: ", resetPending)
+
+		// Reset blocked services to default, or restore what a reset_to=previous timer would have, giving up
+		// when a hung AdGuard would exhaust the budget
+		var target *model.ServiceConfig
+		if restore && !resetPending {
+			target = &restoreConfig
+		}
+		resetStart := time.Now()
+		err := resetWithDeadline(ctx, target)
+		if errors.Is(err, context.DeadlineExceeded) {
+			logger.Error("[main][main] Reset of blocked services didn't finish within the shutdown budget, after " + time.Since(resetStart).Round(time.Millisecond).String())
+		} else if err != nil {
 			logger.Error("[main][main] Failed to reset blocked services")
 			logger.Error(err)
 		} else {
-			logger.Info("[main][main] Successfully reset blocked services to default")
+			logger.Info("[main][main] Successfully reset blocked services in " + time.Since(resetStart).Round(time.Millisecond).String())
+			api.ClearPendingReset()
 		}
 
 	} else {
-		logger.Info("[main][main] No active timers to stop")
+		logger.Info("[main][main] No pending reset, leaving blocked services unchanged")
 	}
 
-	// Create a context with timeout for graceful shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Mark the service offline on MQTT before the event bus closes
+	mqtt.Stop()
+
+	// End the open event streams so they don't hold up the shutdown
+	events.CloseAll()
 
-	// Shutdown the server gracefully
-	logger.Info("[main][main] Shutting down HTTP server...")
+	// Shutdown the server gracefully, draining the in-flight requests with what is left of the budget
+	serverStart := time.Now()
+	if deadline, ok := ctx.Deadline(); ok {
+		logger.Info("[main][main] Shutting down HTTP server, " + max(time.Until(deadline), 0).Round(time.Millisecond).String() + " left to drain in-flight requests...")
+	}
 	if err := app.ShutdownWithContext(ctx); err != nil {
-		logger.Error("[main][main] Server shutdown error: " + err.Error())
+		logger.Error("[main][main] Server shutdown error after " + time.Since(serverStart).Round(time.Millisecond).String() + ": " + err.Error())
 	} else {
-		logger.Info("[main][main] Server shutdown completed successfully")
+		logger.Info("[main][main] Server shutdown completed successfully in " + time.Since(serverStart).Round(time.Millisecond).String())
+	}
+
+	// Flush the spans still buffered, the last ones being the shutdown reset's
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("[main][main] Failed to flush traces")
+		logger.Error(err)
+	}
+
+	logger.Info("[main][main] AdguardFilter stopped, shutdown took " + time.Since(shutdownStart).Round(time.Millisecond).String())
+}
+
+// reloadConfig re-reads the .env file and the defaultsFile, applies a changed logLevel and logs what changed.
+// Settings read on every use, such as the webhook and notification ones, take effect right away.
+func reloadConfig() {
+	logger.Info("[main][reloadConfig] Received SIGHUP, reloading configuration")
+
+	oldDefaults := adguardapi.BuildDefaultConfig()
+	oldSource := adguardapi.DefaultConfigSource()
+
+	changed, err := config.ReloadEnvFile()
+	if err != nil {
+		logger.Error("[main][reloadConfig] Failed to reload the .env file, keeping the current environment")
+		logger.Error(err)
+	}
+	if len(changed) > 0 {
+		// Only the names, the values may be credentials
+		logger.Info("[main][reloadConfig] Changed variables: " + strings.Join(changed, ", "))
+	} else {
+		logger.Info("[main][reloadConfig] No variable changed")
+	}
+
+	// Leave a level set through the API alone unless the reload changed logLevel
+	if slices.Contains(changed, "logLevel") {
+		oldLevel := logger.GetLevel()
+		if err := logger.SetLevel(os.Getenv("logLevel")); err != nil {
+			logger.Error("[main][reloadConfig] Invalid logLevel, keeping " + oldLevel)
+			logger.Error(err)
+		} else {
+			logger.Info("[main][reloadConfig] Log level changed from " + oldLevel + " to " + logger.GetLevel())
+		}
+	}
+
+	adguardapi.ReloadDefaultsFile()
+	newDefaults := adguardapi.BuildDefaultConfig()
+	added, removed := servicelist.DiffServiceIDs(oldDefaults.IDs, newDefaults.IDs)
+	if len(added) > 0 || len(removed) > 0 || oldSource != adguardapi.DefaultConfigSource() {
+		logger.Info("[main][reloadConfig] Default services changed from ", len(oldDefaults.IDs), " (", oldSource, ") to ", len(newDefaults.IDs), " (", adguardapi.DefaultConfigSource(), "), added: ", added, ", removed: ", removed)
+	}
+	oldSchedule, _ := json.Marshal(oldDefaults.Schedule)
+	newSchedule, _ := json.Marshal(newDefaults.Schedule)
+	if string(oldSchedule) != string(newSchedule) {
+		logger.Info("[main][reloadConfig] Default schedule changed from " + string(oldSchedule) + " to " + string(newSchedule))
+	}
+
+	logger.Info("[main][reloadConfig] Configuration reloaded, AdGuard connection settings still need a restart")
+}
+
+// resetWithDeadline resets the blocked services to default, or applies target when set, returning ctx's
+// error when it is done first. The AdGuard requests are bound to ctx, so they are cancelled then.
+func resetWithDeadline(ctx context.Context, target *model.ServiceConfig) error {
+	done := make(chan error, 1)
+	go func() {
+		if target != nil {
+			done <- adguardapi.UpdateBlockedServicesContext(ctx, target)
+			return
+		}
+		done <- adguardapi.ResetBlockedServicesContext(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// listen starts the server on bindAddress. An address that looks like a path (containing a "/" or
+// ending in ".sock") is a Unix domain socket, otherwise it is a host or IP combined with port.
+// An empty bindAddress listens on all interfaces.
+func listen(app *fiber.App, bindAddress string, port string) error {
+	if strings.Contains(bindAddress, "/") || strings.HasSuffix(bindAddress, ".sock") {
+		// Remove a socket left behind by a previous run, it would make the bind fail
+		if err := os.Remove(bindAddress); err != nil && !os.IsNotExist(err) {
+			logger.Error("[main][listen] Failed to remove stale socket: " + bindAddress)
+			return err
+		}
+
+		ln, err := net.Listen("unix", bindAddress)
+		if err != nil {
+			logger.Error("[main][listen] Failed to listen on socket: " + bindAddress)
+			return err
+		}
+
+		logger.Info("[main][listen] Starting server on unix socket " + bindAddress)
+		return app.Listener(ln)
 	}
 
-	logger.Info("[main][main] AdguardFilter stopped")
+	address := net.JoinHostPort(bindAddress, port)
+	logger.Info("[main][listen] Starting server on " + address)
+	return app.Listen(address)
 }
@@ -0,0 +1,18 @@
+package model
+
+// ClientsResponse represents the response from /control/clients. Clients are kept as raw maps so
+// that updating one sends back every field AdGuard returned, including ones this model doesn't know.
+type ClientsResponse struct {
+	Clients []map[string]interface{} `json:"clients"`
+}
+
+// ClientUpdateRequest represents the request body of /control/clients/update
+type ClientUpdateRequest struct {
+	Name string                 `json:"name"`
+	Data map[string]interface{} `json:"data"`
+}
+
+// ClientBlockedServicesRequest represents a request to set the blocked services of a single client
+type ClientBlockedServicesRequest struct {
+	IDs []string `json:"ids"`
+}
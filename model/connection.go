@@ -0,0 +1,13 @@
+package model
+
+// ConnectionCheck reports the result of a connectivity and credentials test against AdGuard
+type ConnectionCheck struct {
+	BaseURL         string `json:"base_url"`
+	Reachable       bool   `json:"reachable"`
+	Authenticated   bool   `json:"authenticated"`
+	CookiesReceived bool   `json:"cookies_received"`
+	ResponseTimeMs  int64  `json:"response_time_ms"`
+	Version         string `json:"version,omitempty"`
+	APIVersion      string `json:"api_version,omitempty"` // Blocked services API generation of that version, legacy or current
+	Error           string `json:"error,omitempty"`
+}
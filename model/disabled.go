@@ -0,0 +1,15 @@
+package model
+
+// DisabledService is a service kept in the managed configuration but not enforced: it is left out of
+// every configuration sent to AdGuard until it is enabled again
+type DisabledService struct {
+	ID         string `json:"id"`
+	InConfig   bool   `json:"in_config"` // Whether the managed configuration blocks it, so enabling blocks it again
+	DisabledAt string `json:"disabled_at"`
+}
+
+// DisabledServicesResponse lists the disabled services
+type DisabledServicesResponse struct {
+	Count    int               `json:"count"`
+	Disabled []DisabledService `json:"disabled"`
+}
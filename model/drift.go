@@ -0,0 +1,13 @@
+package model
+
+// Drift describes the difference between the configuration last applied by this service and the one in AdGuard
+type Drift struct {
+	Known            bool     `json:"known"`   // False until a configuration was applied since startup
+	Drifted          bool     `json:"drifted"` // True when AdGuard no longer matches the applied configuration
+	Missing          []string `json:"missing"` // Applied IDs that are no longer blocked in AdGuard
+	Extra            []string `json:"extra"`   // IDs blocked in AdGuard that were not applied
+	ExpectedTimeZone string   `json:"expected_time_zone,omitempty"`
+	ActualTimeZone   string   `json:"actual_time_zone,omitempty"`
+	LastAppliedAt    string   `json:"last_applied_at,omitempty"`
+	CheckedAt        string   `json:"checked_at"`
+}
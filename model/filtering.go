@@ -0,0 +1,50 @@
+package model
+
+// FilteringStatus represents the response from /control/filtering/status
+type FilteringStatus struct {
+	Enabled          bool     `json:"enabled"`
+	Interval         int      `json:"interval"`
+	Filters          []Filter `json:"filters"`
+	WhitelistFilters []Filter `json:"whitelist_filters"`
+	UserRules        []string `json:"user_rules"`
+}
+
+// Filter represents a subscribed filter list (blocklist or allowlist)
+type Filter struct {
+	ID          int64  `json:"id"`
+	URL         string `json:"url"`
+	Name        string `json:"name"`
+	RulesCount  int    `json:"rules_count"`
+	Enabled     bool   `json:"enabled"`
+	LastUpdated string `json:"last_updated,omitempty"`
+}
+
+// SetFilterURLRequest represents the request body of /control/filtering/set_url
+type SetFilterURLRequest struct {
+	URL       string        `json:"url"`
+	Whitelist bool          `json:"whitelist"`
+	Data      FilterURLData `json:"data"`
+}
+
+// FilterURLData holds the new settings of a filter list in SetFilterURLRequest
+type FilterURLData struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Enabled bool   `json:"enabled"`
+}
+
+// FilterToggleRequest represents a request to enable or disable a filter list by URL
+type FilterToggleRequest struct {
+	URL     string `json:"url"`
+	Enabled *bool  `json:"enabled"`
+}
+
+// SetRulesRequest represents the request body of /control/filtering/set_rules
+type SetRulesRequest struct {
+	Rules []string `json:"rules"`
+}
+
+// UserRuleRequest represents a request to add or remove a single custom rule
+type UserRuleRequest struct {
+	Rule string `json:"rule"`
+}
@@ -0,0 +1,6 @@
+package model
+
+// LogLevelRequest is the body of PUT /api/v1/loglevel
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
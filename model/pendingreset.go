@@ -0,0 +1,11 @@
+package model
+
+// PendingReset is a reset that failed at its scheduled time and is retried in the background until it succeeds
+type PendingReset struct {
+	TimerID     string   `json:"timer_id"` // Timer whose reset failed first
+	Scope       []string `json:"scope"`    // Service IDs to block again, null = whole configuration
+	Since       string   `json:"since"`    // When the reset should have happened
+	Attempts    int      `json:"attempts"` // Failed attempts so far, including the timer's own retries
+	LastAttempt string   `json:"last_attempt,omitempty"`
+	LastError   string   `json:"last_error,omitempty"`
+}
@@ -0,0 +1,39 @@
+package model
+
+// ProfileUnblockRequest is the body of POST /api/v1/profiles/{name}/unblock
+type ProfileUnblockRequest struct {
+	IDs           []string `json:"ids"`             // Services of the profile to unblock
+	ResetAfterMin int      `json:"reset_after_min"` // Minutes to unblock them, capped to what is left of their daily budgets
+}
+
+// ServiceBudget is today's use of a service's daily time budget in a profile
+type ServiceBudget struct {
+	ID               string `json:"id"`
+	DailyMinutes     int    `json:"daily_minutes"`
+	UsedMinutes      int    `json:"used_minutes"`
+	RemainingMinutes int    `json:"remaining_minutes"`
+}
+
+// ProfileWindow is a running unblock of some of a profile's services
+type ProfileWindow struct {
+	IDs     []string `json:"ids"`
+	Until   string   `json:"until"`   // RFC 3339, when the profile's default list is applied again
+	Minutes int      `json:"minutes"` // Minutes charged to the budgets of the services
+}
+
+// ProfileStatus is a household member profile with today's use of its time budgets
+type ProfileStatus struct {
+	Name      string          `json:"name"`
+	Client    string          `json:"client"` // AdGuard persistent client the profile applies to
+	IDs       []string        `json:"ids"`    // Services blocked by default
+	Budgets   []ServiceBudget `json:"budgets"`
+	Unblocked *ProfileWindow  `json:"unblocked,omitempty"`
+}
+
+// ProfilesResponse is the response of GET /api/v1/profiles
+type ProfilesResponse struct {
+	Count          int             `json:"count"`
+	TimeZone       string          `json:"time_zone"`        // Time zone the budgets' days are counted in
+	BudgetsResetAt string          `json:"budgets_reset_at"` // RFC 3339, the next midnight
+	Profiles       []ProfileStatus `json:"profiles"`
+}
@@ -0,0 +1,19 @@
+package model
+
+// ProtectionConfig represents the request body of /control/protection
+type ProtectionConfig struct {
+	Enabled  bool `json:"enabled"`
+	Duration int  `json:"duration,omitempty"` // Duration in milliseconds before protection is re-enabled
+}
+
+// ProtectionStatus represents the protection fields of the response from /control/status
+type ProtectionStatus struct {
+	ProtectionEnabled          bool  `json:"protection_enabled"`
+	ProtectionDisabledDuration int64 `json:"protection_disabled_duration"` // Milliseconds left until protection is re-enabled
+}
+
+// ProtectionRequest represents a request to toggle protection, optionally for a limited time
+type ProtectionRequest struct {
+	Enabled         *bool `json:"enabled"`
+	DurationMinutes int   `json:"duration_minutes"` // Only valid when disabling protection
+}
@@ -0,0 +1,103 @@
+package model
+
+import "encoding/json"
+
+// SuccessResponse is the body of a successful mutating request. The endpoint-specific fields in
+// Data are serialized next to success and message.
+type SuccessResponse struct {
+	Success bool                   `json:"success"`
+	Message string                 `json:"message"`
+	Data    map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON flattens Data into the response object
+func (r SuccessResponse) MarshalJSON() ([]byte, error) {
+	body := make(map[string]interface{}, len(r.Data)+2)
+	for key, value := range r.Data {
+		body[key] = value
+	}
+	body["success"] = r.Success
+	body["message"] = r.Message
+	return json.Marshal(body)
+}
+
+// ErrorResponse is the JSON error envelope returned by every failed request
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+// ErrorBody describes an error: a snake case code, a message and optional details
+type ErrorBody struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// TimerResponse describes a reset timer for the timer endpoints
+type TimerResponse struct {
+	IsActive         bool              `json:"is_active"`
+	Message          string            `json:"message,omitempty"`
+	TimerID          string            `json:"timer_id,omitempty"`
+	StartTime        string            `json:"start_time,omitempty"`
+	ExpireTime       string            `json:"expire_time,omitempty"`
+	Duration         string            `json:"duration,omitempty"` // Full duration of the timer, e.g. "1h0m0s"
+	TimeRemaining    string            `json:"time_remaining,omitempty"`
+	ISO8601Remaining string            `json:"iso8601_remaining,omitempty"` // e.g. "PT1H2M3S"
+	SecondsLeft      int64             `json:"seconds_left"`
+	MinutesLeft      int64             `json:"minutes_left"`
+	HoursLeft        float64           `json:"hours_left"`       // Two decimals, e.g. 1.5
+	ProgressPercent  float64           `json:"progress_percent"` // Elapsed share of the timer, 0-100
+	Scope            []string          `json:"scope"`
+	Metadata         map[string]string `json:"metadata"`
+	CurrentTime      string            `json:"current_time,omitempty"`
+
+	// Only with ?format=human
+	TimeRemainingHuman string `json:"time_remaining_human,omitempty"`
+	ExpireTimeLocal    string `json:"expire_time_local,omitempty"`
+	TimeZone           string `json:"time_zone,omitempty"`
+}
+
+// TimerHistoryEntry describes a reset timer that expired or was cancelled
+type TimerHistoryEntry struct {
+	TimerID       string            `json:"timer_id"`
+	StartTime     string            `json:"start_time"`
+	ExpireTime    string            `json:"expire_time"` // When it was due to expire
+	EndTime       string            `json:"end_time"`    // When it expired or was cancelled
+	Duration      string            `json:"duration"`
+	Outcome       string            `json:"outcome"` // expired or cancelled
+	Scope         []string          `json:"scope"`
+	AppliedConfig *ServiceConfig    `json:"applied_config,omitempty"` // Configuration the timer's update applied
+	Metadata      map[string]string `json:"metadata"`
+}
+
+// TimerHistoryResponse lists the most recently completed reset timers, most recent first
+type TimerHistoryResponse struct {
+	Count  int                 `json:"count"`
+	Limit  int                 `json:"limit"`
+	Timers []TimerHistoryEntry `json:"timers"`
+}
+
+// TimersResponse lists the active reset timers, soonest first
+type TimersResponse struct {
+	Count          int             `json:"count"`
+	MultiTimerMode bool            `json:"multi_timer_mode"`
+	CurrentTime    string          `json:"current_time"`
+	Timers         []TimerResponse `json:"timers"`
+}
+
+// StateResponse is the compact unblock state for Home Assistant REST sensors and switches. While a reset
+// is pending and AdGuard is unreachable, ServicesBlocked is null and AdGuardReachable false.
+type StateResponse struct {
+	Unblocked        bool          `json:"unblocked"`
+	ServicesBlocked  *int          `json:"services_blocked"`
+	ActiveTimer      *StateTimer   `json:"active_timer"`
+	PendingReset     *PendingReset `json:"pending_reset"`
+	AdGuardReachable bool          `json:"adguard_reachable"`
+}
+
+// StateTimer is the soonest active reset timer in a StateResponse
+type StateTimer struct {
+	TimerID     string `json:"timer_id"`
+	ExpireTime  string `json:"expire_time"`
+	SecondsLeft int64  `json:"seconds_left"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// SavedTimer is a reset timer saved on shutdown with resetOnShutdown disabled, re-armed at the next start
+type SavedTimer struct {
+	ID         string            `json:"id"`
+	ExpireTime time.Time         `json:"expire_time"` // The timer resets right away at the next start once it is past
+	Scope      []string          `json:"scope"`       // Service IDs it resets, null = whole configuration
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
@@ -1,8 +1,31 @@
 package model
 
-// Schedule represents the scheduling configuration
+import "encoding/json"
+
+// DayRange is a daily window in milliseconds since midnight during which AdGuard pauses the blocked services
+type DayRange struct {
+	Start int64 `json:"start"` // e.g. 0 for 00:00
+	End   int64 `json:"end"`   // e.g. 86400000 for 24:00
+}
+
+// Schedule represents the scheduling configuration, with the weekly windows when blocking is paused.
+// A day without a window keeps the services blocked all day.
 type Schedule struct {
-	TimeZone string `json:"time_zone"`
+	TimeZone string    `json:"time_zone"`
+	Sun      *DayRange `json:"sun,omitempty"`
+	Mon      *DayRange `json:"mon,omitempty"`
+	Tue      *DayRange `json:"tue,omitempty"`
+	Wed      *DayRange `json:"wed,omitempty"`
+	Thu      *DayRange `json:"thu,omitempty"`
+	Fri      *DayRange `json:"fri,omitempty"`
+	Sat      *DayRange `json:"sat,omitempty"`
+}
+
+// Days returns the schedule's windows by day name ("sun" to "sat"), including days without one
+func (s Schedule) Days() map[string]*DayRange {
+	return map[string]*DayRange{
+		"sun": s.Sun, "mon": s.Mon, "tue": s.Tue, "wed": s.Wed, "thu": s.Thu, "fri": s.Fri, "sat": s.Sat,
+	}
 }
 
 // ServiceConfig represents the service configuration with IDs and schedule
@@ -15,12 +38,46 @@ type ServiceConfig struct {
 type ResetServiceMinConfig struct {
 	ServiceConfig ServiceConfig `json:"config"`
 	ResetAfterMin int           `json:"reset_after_min"` // Duration in minutes before resetting to default
+	ResetAfter    string        `json:"reset_after"`     // Optional Go duration string (e.g., "1h30m"), takes precedence over reset_after_min
+	ResetTo       string        `json:"reset_to"`        // "default" (the default) or "previous" to restore the configuration from before the update
+	Mode          string        `json:"mode"`            // "replace" or "merge" the ids into the blocked services, defaults to defaultUpdateMode
 }
 
 // ResetServiceDateTimeConfig represents a temporary service configuration with a reset deadline
 type ResetServiceDateTimeConfig struct {
 	ServiceConfig ServiceConfig `json:"config"`
 	ResetDateTime string        `json:"reset_date_time"` // ISO 8601 datetime string (e.g., "2025-10-12T15:30:00Z")
+	TimeZone      string        `json:"timezone"`        // IANA time zone for a reset_date_time without offset, defaults to defaultTimeZone
+	ResetTo       string        `json:"reset_to"`        // "default" (the default) or "previous" to restore the configuration from before the update
+	Mode          string        `json:"mode"`            // "replace" or "merge" the ids into the blocked services, defaults to defaultUpdateMode
+}
+
+// BatchTimerEntry is one unblock window of POST /api/v1/timers/batch, ending after a duration or at a date and time
+type BatchTimerEntry struct {
+	ServiceConfig ServiceConfig `json:"config"`
+	ResetAfterMin int           `json:"reset_after_min"` // Duration in minutes before the window ends
+	ResetAfter    string        `json:"reset_after"`     // Optional Go duration string (e.g., "1h30m"), takes precedence over reset_after_min
+	ResetDateTime string        `json:"reset_date_time"` // ISO 8601 datetime string, instead of a duration
+	TimeZone      string        `json:"timezone"`        // IANA time zone for a reset_date_time without offset, defaults to defaultTimeZone
+}
+
+// AllowlistRequest allows only the given services for a while, blocking every other one of the catalog
+type AllowlistRequest struct {
+	IDs           []string `json:"ids"`             // Services to allow, every other service is blocked
+	ResetAfterMin int      `json:"reset_after_min"` // Minutes until every service is blocked again
+	ResetAfter    string   `json:"reset_after"`     // Optional Go duration string (e.g., "1h30m"), takes precedence over reset_after_min
+}
+
+// TimeZoneRequest represents a request to change only the schedule time zone
+type TimeZoneRequest struct {
+	TimeZone string `json:"time_zone"`
+}
+
+// BlockedServicesPatch represents a partial change merged into the current configuration
+type BlockedServicesPatch struct {
+	Add      []string `json:"add"`
+	Remove   []string `json:"remove"`
+	TimeZone string   `json:"time_zone"`
 }
 
 // AllBlockedServicesResponse represents the response from /control/blocked_services/all
@@ -28,3 +85,86 @@ type AllBlockedServicesResponse struct {
 	BlockedServices []BlockedService `json:"blocked_services"`
 	Groups          []ServiceGroup   `json:"groups"`
 }
+
+// ResolveServiceNamesRequest is the body of POST /api/v1/resolve
+type ResolveServiceNamesRequest struct {
+	Names []string `json:"names"`           // Service names such as "YouTube", or IDs
+	Fuzzy bool     `json:"fuzzy,omitempty"` // Also match names with small typos
+}
+
+// ResolvedServiceName is a service name matched to its catalog ID
+type ResolvedServiceName struct {
+	Name  string `json:"name"`
+	ID    string `json:"id"`
+	Match string `json:"match"` // exact or fuzzy
+}
+
+// ResolveServiceNamesResponse is the response of POST /api/v1/resolve
+type ResolveServiceNamesResponse struct {
+	IDs       []string              `json:"ids"` // Matched IDs without duplicates, in the order of the names
+	Resolved  []ResolvedServiceName `json:"resolved"`
+	Unmatched []string              `json:"unmatched"`
+}
+
+// ServiceCategory is a service group with the services it contains, for the grouped service list
+type ServiceCategory struct {
+	ID       string           `json:"id"`
+	Services []BlockedService `json:"services"`
+}
+
+// ServiceListResponse is the grouped service list returned by GET /api/v1/getservicelist
+type ServiceListResponse struct {
+	Count  int               `json:"count"`
+	Groups []ServiceCategory `json:"groups"`
+}
+
+// ScheduleStatus reports how the AdGuard schedule applies to the blocked services right now
+type ScheduleStatus struct {
+	TimeZone               string                  `json:"time_zone"` // Time zone the windows are read in
+	CurrentTime            string                  `json:"current_time"`
+	Scheduled              bool                    `json:"scheduled"`       // false when no day has a window, the services are then always blocked
+	Paused                 bool                    `json:"paused"`          // A window pauses the blocking right now
+	NextTransition         *string                 `json:"next_transition"` // When the blocking is next paused or resumed, null when it never changes
+	TimeUntilTransition    string                  `json:"time_until_transition,omitempty"`
+	SecondsUntilTransition int64                   `json:"seconds_until_transition"`
+	Services               []ServiceScheduleStatus `json:"services"`
+}
+
+// ServiceScheduleStatus is the schedule state of one blocked service
+type ServiceScheduleStatus struct {
+	ID      string  `json:"id"`
+	State   string  `json:"state"`   // "blocked", "paused" (by a schedule window) or "always_blocked" (no schedule)
+	Blocked bool    `json:"blocked"` // Whether AdGuard blocks the service right now
+	Until   *string `json:"until"`   // When the state changes, null when it never does
+}
+
+// GroupChange reports the result of blocking or unblocking a service group
+type GroupChange struct {
+	Group        string   `json:"group"`
+	Blocked      bool     `json:"blocked"`       // true when the group was blocked, false when unblocked
+	Members      []string `json:"members"`       // All service IDs of the group
+	Affected     []string `json:"affected"`      // The members whose state changed, the others already were blocked or unblocked
+	ServiceCount int      `json:"service_count"` // Blocked services after the change
+}
+
+// BatchOperation is one operation of POST /api/v1/batch
+type BatchOperation struct {
+	Op      string          `json:"op"`                        // get, update, reset, add, remove, start_timer or cancel_timer
+	Body    json.RawMessage `json:"body" swaggertype:"object"` // update: the updateblockedservicesmin or updateblockedservicesdatetime body, start_timer: its reset fields
+	IDs     []string        `json:"ids"`                       // add and remove: the service IDs
+	TimerID string          `json:"timer_id"`                  // cancel_timer: the timer to cancel
+}
+
+// BatchOperationResult is the response of one batch operation, as the operation's endpoint answered it
+type BatchOperationResult struct {
+	Op     string          `json:"op"`
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body" swaggertype:"object"`
+}
+
+// BatchResponse is the result of POST /api/v1/batch, one result per operation run in order
+type BatchResponse struct {
+	Success   bool                   `json:"success"`   // Whether every operation succeeded
+	Completed int                    `json:"completed"` // Operations run, fewer than sent when one failed without continueOnError
+	Results   []BatchOperationResult `json:"results"`
+}
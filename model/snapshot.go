@@ -0,0 +1,15 @@
+package model
+
+// ConfigSnapshot is the AdGuard blocked services configuration as it was right before a change was applied
+type ConfigSnapshot struct {
+	ID        string        `json:"id"`
+	Timestamp string        `json:"timestamp"`
+	Reason    string        `json:"reason"` // The change it was taken before, e.g. "update" or "reset"
+	Config    ServiceConfig `json:"config"`
+}
+
+// SnapshotsResponse lists the kept snapshots, newest first
+type SnapshotsResponse struct {
+	Count     int              `json:"count"`
+	Snapshots []ConfigSnapshot `json:"snapshots"`
+}
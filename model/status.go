@@ -0,0 +1,15 @@
+package model
+
+// AdGuardStatus represents the response from /control/status. Fields are pointers because older
+// AdGuard Home versions omit some of them.
+type AdGuardStatus struct {
+	Version                    *string  `json:"version,omitempty"`
+	Language                   *string  `json:"language,omitempty"`
+	DNSAddresses               []string `json:"dns_addresses,omitempty"`
+	DNSPort                    *int     `json:"dns_port,omitempty"`
+	HTTPPort                   *int     `json:"http_port,omitempty"`
+	ProtectionEnabled          *bool    `json:"protection_enabled,omitempty"`
+	ProtectionDisabledDuration *int64   `json:"protection_disabled_duration,omitempty"`
+	DHCPAvailable              *bool    `json:"dhcp_available,omitempty"`
+	Running                    *bool    `json:"running,omitempty"`
+}
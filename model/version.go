@@ -0,0 +1,9 @@
+package model
+
+// VersionInfo is the response of GET /api/v1/version
+type VersionInfo struct {
+	Version   string `json:"version"`    // Release version, dev when built without ldflags
+	Commit    string `json:"commit"`     // Git commit of the build
+	BuildDate string `json:"build_date"` // When the build was made
+	GoVersion string `json:"go_version"` // Go version the build was compiled with
+}
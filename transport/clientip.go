@@ -0,0 +1,116 @@
+package transport
+
+import (
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/api"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// clientIPFilter resolves the client address of every request, logs the mutating ones with it and,
+// when allowedIPs is set, rejects sources outside the listed IPs and CIDR ranges with 403.
+// X-Forwarded-For is only honored when trustProxy is set: to "true" for any peer, or to the IPs and
+// CIDR ranges of the proxies. /health stays open so container health checks keep working.
+func clientIPFilter(prefix string) fiber.Handler {
+	trustAll := strings.EqualFold(os.Getenv("trustProxy"), "true")
+	var trustedProxies []netip.Prefix
+	if !trustAll {
+		trustedProxies = parseIPList("trustProxy", os.Getenv("trustProxy"))
+	}
+	allowed := parseIPList("allowedIPs", os.Getenv("allowedIPs"))
+	allowlistEnabled := os.Getenv("allowedIPs") != ""
+
+	if trustAll {
+		logger.Warning("[transport][clientIPFilter] trustProxy is true, X-Forwarded-For is trusted from any peer")
+	}
+	if allowlistEnabled {
+		logger.Info("[transport][clientIPFilter] IP allowlist enabled with ", len(allowed), " range(s)")
+	}
+
+	return func(c *fiber.Ctx) error {
+		remote, _ := netip.AddrFromSlice(c.Context().RemoteIP())
+		remote = remote.Unmap()
+
+		client := remote
+		if trustAll || containsIP(trustedProxies, remote) {
+			client = forwardedClientIP(c.Get(fiber.HeaderXForwardedFor), trustedProxies, remote)
+		}
+		c.Locals(api.LocalsClientIP, client.String())
+
+		if allowlistEnabled && c.Path() != prefix+"/health" && !containsIP(allowed, client) {
+			logger.Warning("[transport][clientIPFilter] Rejected request from " + client.String() + " not in allowedIPs: " + c.Method() + " " + c.Path())
+			return fiber.NewError(fiber.StatusForbidden, "Source address not allowed")
+		}
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		default:
+			logger.Info("[transport][clientIPFilter] " + c.Method() + " " + c.Path() + " from " + client.String())
+		}
+
+		return c.Next()
+	}
+}
+
+// forwardedClientIP walks X-Forwarded-For from the right, where the trusted proxies appended their peers,
+// and returns the first address that isn't a trusted proxy. Entries further left are set by the client
+// and could be spoofed. It returns remote when the header holds no valid address.
+func forwardedClientIP(forwardedFor string, trustedProxies []netip.Prefix, remote netip.Addr) netip.Addr {
+	client := remote
+	hops := strings.Split(forwardedFor, ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			// A malformed hop can't be trusted, and neither can anything left of it
+			break
+		}
+		client = addr.Unmap()
+		if !containsIP(trustedProxies, client) {
+			break
+		}
+	}
+	return client
+}
+
+// parseIPList parses a comma-separated list of IPs and CIDR ranges, logging and skipping invalid entries
+func parseIPList(name string, value string) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				logger.Error("[transport][parseIPList] Ignoring invalid CIDR range in " + name + ": " + entry)
+				continue
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			logger.Error("[transport][parseIPList] Ignoring invalid IP in " + name + ": " + entry)
+			continue
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes
+}
+
+// containsIP reports whether addr is in any of the ranges
+func containsIP(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
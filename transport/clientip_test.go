@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/api"
+)
+
+func TestParseIPList(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{name: "empty", value: "", want: []string{}},
+		{name: "IPs", value: "10.0.0.1, ::1", want: []string{"10.0.0.1/32", "::1/128"}},
+		{name: "CIDR masked", value: "192.168.1.77/24", want: []string{"192.168.1.0/24"}},
+		{name: "IPv4-mapped IPv6", value: "::ffff:10.0.0.1", want: []string{"10.0.0.1/32"}},
+		{name: "invalid entries skipped", value: "10.0.0.1,not-an-ip,10.0.0.0/33,,172.16.0.0/12", want: []string{"10.0.0.1/32", "172.16.0.0/12"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, prefix := range parseIPList("test", tt.value) {
+				got = append(got, prefix.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedClientIP(t *testing.T) {
+	trusted := parseIPList("trustProxy", "10.0.0.0/8, 192.168.1.10")
+	remote := netip.MustParseAddr("10.0.0.2")
+
+	tests := []struct {
+		name         string
+		forwardedFor string
+		want         string
+	}{
+		{name: "no header", forwardedFor: "", want: "10.0.0.2"},
+		{name: "one hop", forwardedFor: "203.0.113.7", want: "203.0.113.7"},
+		{name: "trusted chain", forwardedFor: "203.0.113.7, 192.168.1.10, 10.1.2.3", want: "203.0.113.7"},
+		{name: "spoofed left of the client", forwardedFor: "1.2.3.4, 203.0.113.7, 10.1.2.3", want: "203.0.113.7"},
+		{name: "untrusted hop stops the walk", forwardedFor: "203.0.113.7, 198.51.100.9, 10.1.2.3", want: "198.51.100.9"},
+		{name: "malformed hop", forwardedFor: "203.0.113.7, bogus, 10.1.2.3", want: "10.1.2.3"},
+		{name: "malformed last hop", forwardedFor: "203.0.113.7, bogus", want: "10.0.0.2"},
+		{name: "IPv4-mapped hop", forwardedFor: "::ffff:203.0.113.7", want: "203.0.113.7"},
+		{name: "only trusted proxies", forwardedFor: "10.9.9.9, 10.1.2.3", want: "10.9.9.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardedClientIP(tt.forwardedFor, trusted, remote); got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPFilterTrust(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy string
+		want       string
+	}{
+		// The test requests come from 0.0.0.0
+		{name: "untrusted peer", trustProxy: "", want: "0.0.0.0"},
+		{name: "peer not in the trusted ranges", trustProxy: "10.0.0.0/8", want: "0.0.0.0"},
+		{name: "trusted peer", trustProxy: "0.0.0.0/32", want: "203.0.113.7"},
+		{name: "any peer trusted", trustProxy: "true", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("trustProxy", tt.trustProxy)
+			t.Setenv("allowedIPs", "")
+
+			app := fiber.New()
+			app.Use(clientIPFilter(""))
+			app.Get("/", func(c *fiber.Ctx) error { return c.SendString(api.ClientIP(c)) })
+
+			req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+			req.Header.Set(fiber.HeaderXForwardedFor, "1.2.3.4, 203.0.113.7")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if got := string(body); got != tt.want {
+				t.Errorf("got client %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPFilterAllowlist(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowedIPs string
+		path       string
+		wantStatus int
+	}{
+		{name: "allowed", allowedIPs: "0.0.0.0/8", path: "/api/v1/status", wantStatus: fiber.StatusOK},
+		{name: "not allowed", allowedIPs: "192.168.1.0/24", path: "/api/v1/status", wantStatus: fiber.StatusForbidden},
+		{name: "health stays open", allowedIPs: "192.168.1.0/24", path: "/health", wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("trustProxy", "")
+			t.Setenv("allowedIPs", tt.allowedIPs)
+
+			app := fiber.New()
+			app.Use(clientIPFilter(""))
+			app.Get("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+			resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, tt.path, nil))
+			if err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
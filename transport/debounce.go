@@ -0,0 +1,125 @@
+package transport
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/api"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// coalescedHeader marks the response of an update that was superseded by a later one and answered with its result
+const coalescedHeader = "Update-Coalesced"
+
+// debouncedResponse is the response a coalesced update is answered with
+type debouncedResponse struct {
+	status      int
+	contentType string
+	body        []byte
+}
+
+// debounceMember is an update waiting in a debounce window. Its turn says whether to run its own
+// handler (nil) or to answer with the response of the update that superseded it.
+type debounceMember struct {
+	turn     chan *debouncedResponse
+	finished chan debouncedResponse
+}
+
+// debounceWindow collects the updates of one client to one route arriving within updateDebounceMs of the first
+type debounceWindow struct {
+	members []*debounceMember
+}
+
+var (
+	debounceWindows   = make(map[string]*debounceWindow)
+	debounceWindowsMu sync.Mutex
+)
+
+// debounceUpdates coalesces the full-state updates a client sends within updateDebounceMs (default 0, off)
+// of its first one, e.g. a multi-select firing an update per toggle, into the one write of the latest
+// update. Windows are kept per client IP, method and route, so updates to different endpoints, whose
+// bodies mean different things, never supersede each other. Only the latest runs its handler, so the reset
+// timer is the one it asks for, and the earlier ones get a copy of its response marked with
+// Update-Coalesced: true. If the latest fails, the one before it runs instead, so a bad last request never
+// fails the earlier ones. Dry runs pass through.
+func debounceUpdates(c *fiber.Ctx) error {
+	window := time.Duration(config.GetInt("updateDebounceMs", 0)) * time.Millisecond
+	if window <= 0 || c.QueryBool("dryRun") {
+		return c.Next()
+	}
+
+	member := &debounceMember{
+		turn:     make(chan *debouncedResponse, 1),
+		finished: make(chan debouncedResponse, 1),
+	}
+	key := api.ClientIP(c) + " " + c.Method() + " " + c.Route().Path
+
+	debounceWindowsMu.Lock()
+	open, exists := debounceWindows[key]
+	if !exists {
+		open = &debounceWindow{}
+		debounceWindows[key] = open
+		time.AfterFunc(window, func() { closeDebounceWindow(key, open) })
+	}
+	open.members = append(open.members, member)
+	debounceWindowsMu.Unlock()
+
+	superseding := <-member.turn
+	if superseding != nil {
+		c.Set(coalescedHeader, "true")
+		c.Set(fiber.HeaderContentType, superseding.contentType)
+		return c.Status(superseding.status).Send(superseding.body)
+	}
+
+	// A panicking handler is answered by the recover middleware further up. Report it as a failed update, so
+	// the window runs the one before it instead of waiting for this one forever.
+	defer func() {
+		if r := recover(); r != nil {
+			member.finished <- debouncedResponse{status: fiber.StatusInternalServerError}
+			panic(r)
+		}
+	}()
+
+	// Render an error here rather than after the middleware returns, so the other members get the final response
+	if err := c.Next(); err != nil {
+		if err := c.App().ErrorHandler(c, err); err != nil {
+			return err
+		}
+	}
+	member.finished <- debouncedResponse{
+		status:      c.Response().StatusCode(),
+		contentType: string(c.Response().Header.ContentType()),
+		body:        append([]byte(nil), c.Response().Body()...),
+	}
+	return nil
+}
+
+// closeDebounceWindow ends a debounce window, running its latest update and answering the earlier ones with
+// the response of the latest that succeeded
+func closeDebounceWindow(key string, window *debounceWindow) {
+	debounceWindowsMu.Lock()
+	delete(debounceWindows, key)
+	members := window.members
+	debounceWindowsMu.Unlock()
+
+	if len(members) > 1 {
+		logger.Info("[transport][closeDebounceWindow] Coalescing " + strconv.Itoa(len(members)) + " updates from " + key)
+	}
+
+	for i := len(members) - 1; i >= 0; i-- {
+		members[i].turn <- nil
+		response := <-members[i].finished
+		if response.status >= fiber.StatusBadRequest && i > 0 {
+			logger.Warning("[transport][closeDebounceWindow] Latest update from " + key + " failed with status " + strconv.Itoa(response.status) + ", running the one before it")
+			continue
+		}
+
+		for _, superseded := range members[:i] {
+			superseded.turn <- &response
+		}
+		return
+	}
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// idempotencyKeyHeader carries the client-chosen key identifying one logical write
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the memory a single cached key can take
+const maxIdempotencyKeyLength = 255
+
+// idempotentResponse is a completed response kept for replay, or a request still in flight
+type idempotentResponse struct {
+	bodyHash    [32]byte
+	inFlight    bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+var (
+	idempotentResponses   = make(map[string]*idempotentResponse)
+	idempotentResponsesMu sync.Mutex
+)
+
+// idempotency replays the cached response when a write is repeated with the same Idempotency-Key
+// within idempotencyTTLSec seconds (default 600), instead of applying it again. Requests without
+// the header pass through. Server errors and 429s aren't cached so the request can be retried.
+func idempotency(c *fiber.Ctx) error {
+	key := c.Get(idempotencyKeyHeader)
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return fiber.NewError(fiber.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+	}
+
+	// Keys are scoped to the route so the same key can't replay another endpoint's response
+	cacheKey := c.Method() + " " + c.Path() + " " + key
+	bodyHash := sha256.Sum256(c.Body())
+	ttl := time.Duration(config.GetInt("idempotencyTTLSec", 600)) * time.Second
+
+	idempotentResponsesMu.Lock()
+	purgeExpiredIdempotentResponses()
+	if cached, exists := idempotentResponses[cacheKey]; exists {
+		idempotentResponsesMu.Unlock()
+
+		switch {
+		case cached.bodyHash != bodyHash:
+			logger.Warning("[transport][idempotency] Idempotency-Key reused with a different body on " + c.Method() + " " + c.Path())
+			return fiber.NewError(fiber.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+		case cached.inFlight:
+			return fiber.NewError(fiber.StatusConflict, "A request with this Idempotency-Key is still in progress")
+		}
+
+		logger.Info("[transport][idempotency] Replaying cached response for " + c.Method() + " " + c.Path())
+		c.Set("Idempotent-Replayed", "true")
+		c.Set(fiber.HeaderContentType, cached.contentType)
+		return c.Status(cached.status).Send(cached.body)
+	}
+	idempotentResponses[cacheKey] = &idempotentResponse{bodyHash: bodyHash, inFlight: true}
+	idempotentResponsesMu.Unlock()
+
+	err := c.Next()
+
+	idempotentResponsesMu.Lock()
+	defer idempotentResponsesMu.Unlock()
+
+	status := c.Response().StatusCode()
+	if err != nil || status >= fiber.StatusInternalServerError || status == fiber.StatusTooManyRequests {
+		delete(idempotentResponses, cacheKey)
+		return err
+	}
+
+	idempotentResponses[cacheKey] = &idempotentResponse{
+		bodyHash:    bodyHash,
+		status:      status,
+		contentType: string(c.Response().Header.ContentType()),
+		body:        append([]byte(nil), c.Response().Body()...),
+		expires:     time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// purgeExpiredIdempotentResponses drops cached responses past their TTL. The caller must hold idempotentResponsesMu.
+func purgeExpiredIdempotentResponses() {
+	now := time.Now()
+	for key, cached := range idempotentResponses {
+		if !cached.inFlight && now.After(cached.expires) {
+			delete(idempotentResponses, key)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package transport
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// logPath is the file the tests log to, read back by the tests of log lines
+var logPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "transport-test")
+	if err != nil {
+		panic(err)
+	}
+	logPath = filepath.Join(dir, "test.log")
+	logger.Init(logPath, "Inf")
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,170 @@
+package transport
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/etag"
+	"github.com/welasco/adguardfilter/adguardapi"
+	"github.com/welasco/adguardfilter/api"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// apiKeyAuth requires a matching X-API-Key or Authorization: Bearer header when the apiKey env var is set.
+// The adminApiKey is accepted as well and marks the request as made by an admin. Requests pass through
+// unchanged when no key is configured.
+func apiKeyAuth(c *fiber.Ctx) error {
+	provided := providedAPIKey(c)
+
+	// Use constant-time comparisons so the keys can't be guessed from response timing
+	if adminAPIKey := config.GetSecret("adminApiKey"); adminAPIKey != "" && subtle.ConstantTimeCompare([]byte(provided), []byte(adminAPIKey)) == 1 {
+		c.Locals(api.LocalsAdmin, true)
+		return c.Next()
+	}
+
+	apiKey := config.GetSecret("apiKey")
+	if apiKey == "" {
+		return c.Next()
+	}
+
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(apiKey)) != 1 {
+		logger.Warning("[transport][apiKeyAuth] Rejected request with missing or invalid API key: " + c.Method() + " " + c.Path() + " from " + api.ClientIP(c))
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing or invalid API key")
+	}
+
+	return c.Next()
+}
+
+// providedAPIKey returns the key sent in the X-API-Key header or as an Authorization: Bearer token
+func providedAPIKey(c *fiber.Ctx) string {
+	if provided := c.Get("X-API-Key"); provided != "" {
+		return provided
+	}
+
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	return ""
+}
+
+// corsConfig builds the CORS configuration from the environment. Precedence:
+//   - corsAllowOrigins, corsAllowMethods and corsAllowHeaders (comma-separated) are used when set
+//   - otherwise the permissive Fiber defaults apply (all origins, common methods, request headers echoed back)
+//   - credentials are only allowed when apiKey is set and corsAllowOrigins lists specific origins,
+//     since browsers reject credentials for a wildcard origin
+func corsConfig() cors.Config {
+	corsSettings := cors.ConfigDefault
+
+	if origins := os.Getenv("corsAllowOrigins"); origins != "" {
+		corsSettings.AllowOrigins = origins
+	}
+	if methods := os.Getenv("corsAllowMethods"); methods != "" {
+		corsSettings.AllowMethods = methods
+	}
+	if headers := os.Getenv("corsAllowHeaders"); headers != "" {
+		corsSettings.AllowHeaders = headers
+	}
+
+	corsSettings.AllowCredentials = config.GetSecret("apiKey") != "" && corsSettings.AllowOrigins != "*"
+
+	logger.Info("[transport][corsConfig] CORS allowed origins: " + corsSettings.AllowOrigins)
+	logger.Debug("[transport][corsConfig] CORS allowed methods: " + corsSettings.AllowMethods)
+	logger.Debug("[transport][corsConfig] CORS allowed headers: " + corsSettings.AllowHeaders)
+	logger.Debug("[transport][corsConfig] CORS allow credentials: ", corsSettings.AllowCredentials)
+
+	return corsSettings
+}
+
+// requireJSON answers 415 Unsupported Media Type for a write with a body that isn't JSON, before any handler
+// parses it. BodyParser would otherwise decode e.g. a form-encoded body into an empty struct, which an
+// update applies as an empty configuration. Writes without a body, like a reset, pass unchanged.
+func requireJSON(c *fiber.Ctx) error {
+	switch c.Method() {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+	default:
+		return c.Next()
+	}
+	if len(c.Body()) == 0 {
+		return c.Next()
+	}
+
+	mediaType, _, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+	if err != nil || (mediaType != fiber.MIMEApplicationJSON && !strings.HasSuffix(mediaType, "+json")) {
+		logger.Warning("[transport][requireJSON] Rejecting " + c.Method() + " " + c.Path() + " with Content-Type '" + c.Get(fiber.HeaderContentType) + "'")
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "The request body must be JSON, send Content-Type: application/json")
+	}
+
+	return c.Next()
+}
+
+// serializeOperation runs the request as one operation on the blocked services, so it never interleaves with
+// a timer reset or another update. It waits up to operationWaitMs (default 2000) for the running operation
+// and otherwise answers 409 with a Retry-After header.
+func serializeOperation(c *fiber.Ctx) error {
+	timeout := time.Duration(config.GetInt("operationWaitMs", 2000)) * time.Millisecond
+	end, running, err := adguardapi.BeginOperation(c.Method()+" "+c.Path(), timeout)
+	if err != nil {
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return fiber.NewError(fiber.StatusConflict, "Operation in progress: "+running+", retry shortly")
+	}
+	defer end()
+
+	return c.Next()
+}
+
+// traceRequest records a server span per request, continuing the caller's trace from its traceparent header.
+// Handlers pass c.UserContext() on to adguardapi, so the AdGuard calls show up as its children.
+func traceRequest(c *fiber.Ctx) error {
+	header := http.Header{}
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+
+	ctx, span := tracing.StartServer(c.UserContext(), c.Method()+" "+c.Path(), header,
+		attribute.String("http.request.method", c.Method()),
+		attribute.String("url.path", c.Path()),
+	)
+	defer span.End()
+	c.SetUserContext(ctx)
+
+	err := c.Next()
+
+	// Name the span after the route rather than the path, which may hold IDs
+	span.SetName(c.Method() + " " + c.Route().Path)
+	span.SetAttributes(attribute.String("http.route", c.Route().Path))
+	status := c.Response().StatusCode()
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		status = fiberErr.Code
+	} else if err != nil {
+		status = fiber.StatusInternalServerError
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= fiber.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+
+	return err
+}
+
+// conditionalGet tags a 200 response with an ETag, a hash of its body, and answers 304 Not Modified without
+// the body when the request's If-None-Match matches. Dashboards polling for a rarely changing body use it.
+var conditionalGet = etag.New()
+
+// logPanic logs a recovered handler panic with its stack trace, the recover middleware then answers 500
+func logPanic(c *fiber.Ctx, recovered interface{}) {
+	logger.Error("[transport][logPanic] Panic while handling " + c.Method() + " " + c.Path() + ": " + fmt.Sprint(recovered))
+	logger.Error("[transport][logPanic] Stack trace:\n" + string(debug.Stack()))
+}
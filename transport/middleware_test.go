@@ -0,0 +1,234 @@
+package transport
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/welasco/adguardfilter/api"
+	"github.com/welasco/adguardfilter/model"
+)
+
+// newTestApp returns an app rendering errors like the one Setup builds, with the given middleware in front
+// of a handler answering every request with 200
+func newTestApp(middleware ...fiber.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	for _, handler := range middleware {
+		app.Use(handler)
+	}
+	app.All("/*", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return app
+}
+
+// decodeError decodes the JSON error envelope of resp
+func decodeError(t *testing.T, resp *http.Response) model.ErrorBody {
+	t.Helper()
+	var envelope model.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		t.Fatalf("decoding the error envelope: %v", err)
+	}
+	return envelope.Error
+}
+
+func TestRequireJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "JSON", method: fiber.MethodPut, contentType: "application/json", body: `{"ids":[]}`, wantStatus: fiber.StatusOK},
+		{name: "JSON with charset", method: fiber.MethodPost, contentType: "application/json; charset=utf-8", body: `{}`, wantStatus: fiber.StatusOK},
+		{name: "JSON suffix", method: fiber.MethodPatch, contentType: "application/merge-patch+json", body: `{}`, wantStatus: fiber.StatusOK},
+		{name: "plain text", method: fiber.MethodPut, contentType: "text/plain", body: `{"ids":[]}`, wantStatus: fiber.StatusUnsupportedMediaType},
+		{name: "form", method: fiber.MethodPost, contentType: "application/x-www-form-urlencoded", body: "ids=youtube", wantStatus: fiber.StatusUnsupportedMediaType},
+		{name: "no content type", method: fiber.MethodDelete, body: `{}`, wantStatus: fiber.StatusUnsupportedMediaType},
+		{name: "write without a body", method: fiber.MethodPost, contentType: "text/plain", wantStatus: fiber.StatusOK},
+		{name: "read with a body", method: fiber.MethodGet, contentType: "text/plain", body: "ignored", wantStatus: fiber.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(requireJSON)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/updateblockedservicesmin", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set(fiber.HeaderContentType, tt.contentType)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == fiber.StatusUnsupportedMediaType {
+				if got := decodeError(t, resp); got.Code != "unsupported_media_type" {
+					t.Errorf("got error code %q, want unsupported_media_type", got.Code)
+				}
+			}
+		})
+	}
+}
+
+func TestLogPanic(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace:  true,
+		StackTraceHandler: logPanic,
+	}))
+	app.Get("/panic", func(c *fiber.Ctx) error {
+		panic("handler exploded")
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, "/panic", nil))
+	if err != nil {
+		t.Fatalf("Test: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", resp.StatusCode)
+	}
+	if got := decodeError(t, resp); got.Code != "internal_server_error" || got.Message != "Internal server error" {
+		t.Errorf("got error %+v, want the internal server error envelope", got)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	logged := string(data)
+	for _, want := range []string{
+		"[transport][logPanic] Panic while handling GET /panic: handler exploded",
+		"[transport][logPanic] Stack trace:",
+		"transport.TestLogPanic",
+	} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("log doesn't contain %q", want)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name            string
+		env             map[string]string
+		origin          string
+		wantOrigin      string
+		wantMethods     string
+		wantHeaders     string
+		wantCredentials string
+	}{
+		{
+			name:        "defaults",
+			origin:      "http://dashboard.local",
+			wantOrigin:  "*",
+			wantMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
+			wantHeaders: "Content-Type, X-API-Key",
+		},
+		{
+			name: "configured",
+			env: map[string]string{
+				"corsAllowOrigins": "http://dashboard.local",
+				"corsAllowMethods": "GET,PUT",
+				"corsAllowHeaders": "Content-Type,X-API-Key",
+				"apiKey":           "key",
+			},
+			origin:          "http://dashboard.local",
+			wantOrigin:      "http://dashboard.local",
+			wantMethods:     "GET,PUT",
+			wantHeaders:     "Content-Type,X-API-Key",
+			wantCredentials: "true",
+		},
+		{
+			name:        "origin not allowed",
+			env:         map[string]string{"corsAllowOrigins": "http://dashboard.local"},
+			origin:      "http://evil.example",
+			wantOrigin:  "",
+			wantMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
+			wantHeaders: "Content-Type, X-API-Key",
+		},
+		{
+			name:        "no credentials without an API key",
+			env:         map[string]string{"corsAllowOrigins": "http://dashboard.local"},
+			origin:      "http://dashboard.local",
+			wantOrigin:  "http://dashboard.local",
+			wantMethods: "GET,POST,HEAD,PUT,DELETE,PATCH",
+			wantHeaders: "Content-Type, X-API-Key",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"corsAllowOrigins", "corsAllowMethods", "corsAllowHeaders", "apiKey"} {
+				t.Setenv(name, tt.env[name])
+			}
+			app := newTestApp(cors.New(corsConfig()))
+
+			req := httptest.NewRequest(fiber.MethodOptions, "/api/v1/updateblockedservicesmin", nil)
+			req.Header.Set(fiber.HeaderOrigin, tt.origin)
+			req.Header.Set(fiber.HeaderAccessControlRequestMethod, fiber.MethodPut)
+			req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "Content-Type, X-API-Key")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Test: %v", err)
+			}
+
+			if resp.StatusCode != fiber.StatusNoContent {
+				t.Errorf("got status %d, want 204", resp.StatusCode)
+			}
+			for header, want := range map[string]string{
+				fiber.HeaderAccessControlAllowOrigin:      tt.wantOrigin,
+				fiber.HeaderAccessControlAllowMethods:     tt.wantMethods,
+				fiber.HeaderAccessControlAllowHeaders:     tt.wantHeaders,
+				fiber.HeaderAccessControlAllowCredentials: tt.wantCredentials,
+			} {
+				if got := resp.Header.Get(header); got != want {
+					t.Errorf("got %s %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDebounceUpdatesHandlerPanic(t *testing.T) {
+	t.Setenv("updateDebounceMs", "50")
+	app := fiber.New(fiber.Config{ErrorHandler: api.ErrorHandler})
+	app.Use(recover.New())
+	app.Put("/api/v1/updateblockedservicesmin", debounceUpdates, func(c *fiber.Ctx) error {
+		if string(c.Body()) == "panic" {
+			panic("handler exploded")
+		}
+		return c.SendString(string(c.Body()))
+	})
+	send := func(body string) *http.Response {
+		resp, err := app.Test(httptest.NewRequest(fiber.MethodPut, "/api/v1/updateblockedservicesmin", strings.NewReader(body)), 2000)
+		if err != nil {
+			t.Errorf("Test: %v", err)
+		}
+		return resp
+	}
+
+	// The latest update panics, so the window runs the one before it instead of waiting forever
+	first := make(chan *http.Response, 1)
+	go func() { first <- send("first") }()
+	time.Sleep(10 * time.Millisecond)
+	latest := send("panic")
+
+	if latest == nil || latest.StatusCode != fiber.StatusInternalServerError {
+		t.Fatalf("got latest response %v, want a 500", latest)
+	}
+	resp := <-first
+	if resp == nil {
+		t.Fatal("the earlier update got no response")
+	}
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != fiber.StatusOK || string(body) != "first" {
+		t.Errorf("got status %d and body %q, want the earlier update to run its own handler", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/filesystem"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+)
+
+// embeddedFrontend holds the frontend compiled into the binary, set by SetEmbeddedFrontend in builds with
+// the embedfrontend tag
+var embeddedFrontend fs.FS
+
+// SetEmbeddedFrontend sets the frontend files compiled into the binary, served instead of staticDir
+func SetEmbeddedFrontend(files fs.FS) {
+	embeddedFrontend = files
+}
+
+// setupStatic serves the frontend from the embedded files when the binary has them, unless
+// embeddedFrontend=false, and from staticDir otherwise. serveStatic=false serves nothing, for API-only
+// deployments behind a separate frontend host.
+func setupStatic(router fiber.Router, prefix string) {
+	if !config.GetBool("serveStatic", true) {
+		logger.Info("[transport][setupStatic] serveStatic is disabled, not serving static files")
+		return
+	}
+
+	useEmbedded := config.GetBool("embeddedFrontend", embeddedFrontend != nil)
+	if useEmbedded && embeddedFrontend == nil {
+		logger.Warning("[transport][setupStatic] embeddedFrontend is set but the binary was built without the embedfrontend tag, serving from disk")
+		useEmbedded = false
+	}
+	if useEmbedded {
+		logger.Info("[transport][setupStatic] Serving static files from the embedded frontend")
+		router.Use(serveFS(embeddedFrontend, prefix))
+		return
+	}
+
+	dir := staticDir()
+	if _, err := os.Stat(dir); err != nil {
+		logger.Warning("[transport][setupStatic] Static files directory not found: " + dir + ", the frontend will answer 404")
+	}
+	logger.Info("[transport][setupStatic] Serving static files from: " + dir)
+	router.Static("/", dir)
+}
+
+// staticDir returns the directory the frontend is served from, staticDir when set, otherwise the local build
+// in Dev and ./public, where the Docker image puts it
+func staticDir() string {
+	if dir := os.Getenv("staticDir"); dir != "" {
+		return dir
+	}
+	if os.Getenv("Environment") == "Dev" {
+		return "./frontend-adguardfilter/dist"
+	}
+	return "./public"
+}
+
+// serveFS serves the GET and HEAD requests for a file of files, or a directory with an index.html, like
+// router.Static does for a directory on disk. Other requests pass through to the routes unchanged.
+func serveFS(files fs.FS, prefix string) fiber.Handler {
+	root := http.FS(files)
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+			return c.Next()
+		}
+
+		name := strings.Trim(path.Clean("/"+strings.TrimPrefix(c.Path(), prefix)), "/")
+		if name == "" {
+			name = "."
+		}
+		info, err := fs.Stat(files, name)
+		if err == nil && info.IsDir() {
+			name = path.Join(name, "index.html")
+			info, err = fs.Stat(files, name)
+		}
+		if err != nil || info.IsDir() {
+			return c.Next()
+		}
+
+		return filesystem.SendFile(c, root, "/"+name)
+	}
+}
@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/docs"
+)
+
+// swaggerUIVersion is the swagger-ui-dist release the UI page loads from the CDN
+const swaggerUIVersion = "5.17.14"
+
+// swaggerUIPage renders the Swagger UI for the spec served next to it at doc.json
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>AdGuard Filter API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@` + swaggerUIVersion + `/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "doc.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>`
+
+// setupSwagger serves the OpenAPI spec at /swagger/doc.json and the Swagger UI under /swagger/,
+// unless swaggerEnabled=false. The spec holds no secrets so it doesn't require the API key.
+func setupSwagger(router fiber.Router) {
+	if !config.GetBool("swaggerEnabled", true) {
+		logger.Info("[transport][setupSwagger] Swagger UI disabled")
+		return
+	}
+
+	router.Get("/swagger/doc.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return c.Send(docs.SwaggerJSON)
+	})
+	router.Get("/swagger", func(c *fiber.Ctx) error {
+		return c.Redirect(c.Path() + "/index.html")
+	})
+	router.Get("/swagger/*", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(swaggerUIPage)
+	})
+}
@@ -2,47 +2,182 @@ package transport
 
 import (
 	"os"
+	"strings"
+	"time"
 
 	// "github.com/Welasco/HubitatDeviceEvents/device"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/welasco/adguardfilter/api"
+	"github.com/welasco/adguardfilter/common/config"
+	logger "github.com/welasco/adguardfilter/common/logger"
+	"github.com/welasco/adguardfilter/common/tracing"
 )
 
 func helloWorld(c *fiber.Ctx) error {
 	return c.SendString("Hello, World!")
 }
 
-func setupRoutes(app *fiber.App) {
-	app.Get("/", helloWorld)
-	app.Get("/api/v1/getblockedservices", api.ApiGetBlockedServices)
-	//app.Get("/api/v1/blockedservices", api.ApiGetServiceList)
-	app.Get("/api/v1/getservicelist", api.ApiGetServiceList)
-	app.Get("/api/v1/gettimer", api.ApiGetTimer)
-	app.Put("/api/v1/updateblockedservicesmin", api.ApiUpdateBlockedServicesMin)
-	app.Post("/api/v1/updateblockedservicesmin", api.ApiUpdateBlockedServicesMin)
-	app.Put("/api/v1/updateblockedservicesdatetime", api.ApiUpdateBlockedServicesDateTime)
-	app.Post("/api/v1/updateblockedservicesdatetime", api.ApiUpdateBlockedServicesDateTime)
+// health reports that the server is running
+//
+// @Summary Health check
+// @Tags status
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /health [get]
+func health(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+func setupRoutes(router fiber.Router) {
+	router.Get("/", helloWorld)
+	router.Get("/health", health)
+	setupSwagger(router)
+
+	// All API routes require the API key when one is configured, and JSON for a request body
+	router.Use("/api/v1", apiKeyAuth)
+	router.Use("/api/v1", requireJSON)
+	router.Get("/api/v1/getblockedservices", api.ApiGetBlockedServices)
+	//router.Get("/api/v1/blockedservices", api.ApiGetServiceList)
+	router.Get("/api/v1/getservicelist", conditionalGet, api.ApiGetServiceList)
+	router.Post("/api/v1/catalog/refresh", api.ApiRefreshServiceCatalog)
+	router.Post("/api/v1/resolve", api.ApiResolveServiceNames)
+	router.Get("/api/v1/gettimer", api.ApiGetTimer)
+	router.Get("/api/v1/defaults", api.ApiGetDefaults)
+	router.Get("/api/v1/defaults/resolved", api.ApiGetResolvedDefaults)
+	router.Get("/api/v1/config", api.ApiGetConfig)
+	router.Get("/api/v1/drift", api.ApiGetDrift)
+	router.Get("/api/v1/status", api.ApiGetStatus)
+	router.Get("/api/v1/version", api.ApiGetVersion)
+	router.Get("/api/v1/testconnection", api.ApiTestConnection)
+	router.Post("/api/v1/testconnection", api.ApiTestConnection)
+	router.Post("/api/v1/reauth", api.ApiReauthenticate)
+	router.Get("/api/v1/timers", api.ApiGetTimers)
+	router.Post("/api/v1/timers/batch", idempotency, serializeOperation, api.CheckIfMatch, api.ApiCreateBatchTimers)
+	router.Post("/api/v1/timer/restart", serializeOperation, api.ApiRestartTimer)
+	router.Get("/api/v1/timer/history", api.ApiGetTimerHistory)
+	router.Delete("/api/v1/timer/:id", serializeOperation, api.ApiCancelTimer)
+	router.Get("/api/v1/timer/ws", api.ApiTimerWebSocketUpgrade, api.ApiTimerWebSocket)
+	router.Get("/api/v1/timer/:id", api.ApiGetTimerByID)
+	router.Get("/api/v1/events", api.ApiEvents)
+	router.Get("/api/v1/audit", api.ApiGetAudit)
+	router.Get("/api/v1/state", api.ApiGetState)
+	router.Get("/api/v1/schedulestatus", api.ApiGetScheduleStatus)
+	router.Post("/api/v1/toggle", serializeOperation, api.CheckIfMatch, api.ApiToggle)
+	router.Post("/api/v1/allowlist", idempotency, serializeOperation, api.CheckIfMatch, api.ApiApplyAllowlist)
+	router.Get("/api/v1/loglevel", api.ApiGetLogLevel)
+	router.Put("/api/v1/loglevel", api.ApiSetLogLevel)
+	router.Get("/api/v1/schedules", api.ApiGetSchedules)
+	router.Post("/api/v1/schedules", api.ApiCreateSchedule)
+	router.Delete("/api/v1/schedules/:id", api.ApiDeleteSchedule)
+	router.Put("/api/v1/updateblockedservicesmin", idempotency, debounceUpdates, serializeOperation, api.CheckIfMatch, api.ApiUpdateBlockedServicesMin)
+	router.Post("/api/v1/updateblockedservicesmin", idempotency, debounceUpdates, serializeOperation, api.CheckIfMatch, api.ApiUpdateBlockedServicesMin)
+	router.Put("/api/v1/updateblockedservicesdatetime", idempotency, debounceUpdates, serializeOperation, api.CheckIfMatch, api.ApiUpdateBlockedServicesDateTime)
+	router.Post("/api/v1/updateblockedservicesdatetime", idempotency, debounceUpdates, serializeOperation, api.CheckIfMatch, api.ApiUpdateBlockedServicesDateTime)
+	router.Put("/api/v1/resetblockedservices", serializeOperation, api.CheckIfMatch, api.ApiResetBlockedServices)
+	router.Post("/api/v1/resetblockedservices", serializeOperation, api.CheckIfMatch, api.ApiResetBlockedServices)
+	router.Patch("/api/v1/blockedservices", serializeOperation, api.CheckIfMatch, api.ApiPatchBlockedServices)
+	router.Post("/api/v1/groups/:group/block", serializeOperation, api.CheckIfMatch, api.ApiBlockGroup)
+	router.Post("/api/v1/groups/:group/unblock", serializeOperation, api.CheckIfMatch, api.ApiUnblockGroup)
+	router.Get("/api/v1/services/disabled", api.ApiGetDisabledServices)
+	router.Post("/api/v1/services/:id/disable", serializeOperation, api.CheckIfMatch, api.ApiDisableService)
+	router.Post("/api/v1/services/:id/enable", serializeOperation, api.CheckIfMatch, api.ApiEnableService)
+	router.Get("/api/v1/snapshots", api.ApiGetSnapshots)
+	router.Post("/api/v1/rollback", serializeOperation, api.CheckIfMatch, api.ApiRollback)
+	router.Patch("/api/v1/timezone", serializeOperation, api.CheckIfMatch, api.ApiUpdateTimeZone)
+	router.Get("/api/v1/export", api.ApiExportConfig)
+	router.Post("/api/v1/import", serializeOperation, api.CheckIfMatch, api.ApiImportConfig)
+	router.Post("/api/v1/protection", api.ApiSetProtection)
+	router.Get("/api/v1/rules", api.ApiGetRules)
+	router.Put("/api/v1/rules", api.ApiSetRules)
+	router.Post("/api/v1/rules", api.ApiAddRule)
+	router.Delete("/api/v1/rules", api.ApiDeleteRule)
+	router.Get("/api/v1/filters", api.ApiGetFilters)
+	router.Patch("/api/v1/filters", api.ApiSetFilterEnabled)
+	router.Put("/api/v1/clients/:name/blockedservices", api.ApiSetClientBlockedServices)
+	router.Get("/api/v1/profiles", api.ApiGetProfiles)
+	router.Post("/api/v1/profiles/:name/unblock", idempotency, serializeOperation, api.ApiUnblockProfile)
+	router.Post("/api/v1/profiles/:name/reset", serializeOperation, api.ApiResetProfile)
+	// Not serialized itself, each operation is when its endpoint is
+	router.Post("/api/v1/batch", idempotency, api.ApiBatch)
 
 }
 
-// Setup - set's up our fiber app and the routes
+// Setup - set's up our fiber app and the routes, whose handlers manage backend
 // returns a pointer to app
-func Setup() *fiber.App {
-	app := fiber.New()
+func Setup(backend api.AdGuardBackend) *fiber.App {
+	api.SetBackend(backend)
+
+	// Timeouts guard against slow or hung clients. The write timeout is off by default because
+	// it would cut the long-lived /api/v1/events and /api/v1/timer/ws streams.
+	readTimeout := time.Duration(config.GetInt("readTimeoutSec", 10)) * time.Second
+	writeTimeout := time.Duration(config.GetInt("writeTimeoutSec", 0)) * time.Second
+	idleTimeout := time.Duration(config.GetInt("idleTimeoutSec", 60)) * time.Second
+	bodyLimit := config.GetInt("bodyLimitKB", 1024) * 1024
+
+	logger.Info("[transport][Setup] Server read timeout: " + readTimeout.String() + ", write timeout: " + writeTimeout.String() + ", idle timeout: " + idleTimeout.String())
+	logger.Info("[transport][Setup] Server body limit: ", bodyLimit, " bytes")
+
+	app := fiber.New(fiber.Config{
+		// Render every returned error as the JSON error envelope
+		ErrorHandler: api.ErrorHandler,
+		ReadTimeout:  readTimeout,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  idleTimeout,
+		BodyLimit:    bodyLimit,
+	})
+
+	// Mount everything under the optional route prefix, e.g. when a reverse proxy serves the app at a subpath
+	prefix := routePrefix()
+	router := app.Group(prefix)
+
+	// Turn a panicking handler into a logged 500 instead of a dropped connection, registered first so it
+	// covers every other middleware
+	app.Use(recover.New(recover.Config{
+		EnableStackTrace:  true,
+		StackTraceHandler: logPanic,
+	}))
+
+	// Resolve the client address and apply the IP allowlist before anything else, the frontend included
+	app.Use(clientIPFilter(prefix))
 
-	if os.Getenv("Environment") == "Dev" {
-		app.Static("/", "./frontend-adguardfilter/dist")
-	} else {
-		app.Static("/", "./public")
+	// Record a span per request when an OpenTelemetry exporter is configured
+	if tracing.Enabled() {
+		app.Use(traceRequest)
 	}
-	app.Use(cors.New())
-	setupRoutes(app)
+
+	// Serve the frontend unless it is hosted separately
+	setupStatic(router, prefix)
+	app.Use(cors.New(corsConfig()))
+	setupRoutes(router)
+
+	// Batch operations are served through the router, with the middleware of their endpoints
+	api.SetBatchDispatcher(app.Handler())
+
+	logger.Info("[transport][Setup] Registered routes with prefix '" + prefix + "':")
+	for _, route := range app.GetRoutes(true) {
+		logger.Info("[transport][Setup] " + route.Method + " " + route.Path)
+	}
+
+	// Publish timer changes on the event bus for the /api/v1/events stream
+	api.PublishTimerEvents()
 
 	return app
 }
 
+// routePrefix returns the routePrefix env var normalized to a leading slash and no trailing slash,
+// or an empty string when unset
+func routePrefix() string {
+	prefix := strings.Trim(os.Getenv("routePrefix"), "/")
+	if prefix == "" {
+		return ""
+	}
+	return "/" + prefix
+}
+
 // _ "github.com/joho/godotenv/autoload"
 // )
 